@@ -2,12 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
-	"net/http"
-	"strings"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
-	"github.com/gsiffert/fetch/internal/disk"
+	"github.com/gsiffert/fetch/internal/domain"
 	"github.com/gsiffert/fetch/internal/fetcher"
 	"github.com/gsiffert/fetch/internal/service"
 	"github.com/gsiffert/fetch/internal/sqlite"
@@ -19,11 +24,16 @@ type App struct {
 	config Config
 
 	service      *service.Service
+	scheduler    *service.Scheduler
+	runner       *service.Runner
 	metadataRepo *sqlite.MetaDataRepo
+	storage      service.Disk
+	cookieJar    *fetcher.CookieJar
 	logger       *slog.Logger
 }
 
 func (a *App) before(c *cli.Context) error {
+	a.config.load(c)
 	metadataRepo, err := sqlite.NewMetaDataRepo(c.Context, a.config.DSN)
 	if err != nil {
 		return fmt.Errorf("new metadata repo: %w", err)
@@ -31,9 +41,78 @@ func (a *App) before(c *cli.Context) error {
 
 	a.metadataRepo = metadataRepo
 	a.logger = slog.Default()
-	f := fetcher.New(http.DefaultClient)
-	d := disk.New(a.config.DownloadPath)
-	a.service = service.New(f, d, a.logger, a.metadataRepo)
+	var fetcherOpts []fetcher.Option
+	if !a.config.IgnoreRobots {
+		fetcherOpts = append(fetcherOpts, fetcher.WithRobots(a.config.UserAgent))
+	}
+	hostDelay := a.config.HostDelay
+	if a.config.HostRPS > 0 {
+		hostDelay = max(hostDelay, time.Duration(float64(time.Second)/a.config.HostRPS))
+	}
+	fetcherOpts = append(fetcherOpts, fetcher.WithHostLimit(a.config.HostConcurrency, hostDelay))
+	fetcherOpts = append(fetcherOpts, fetcher.WithRetryPolicy(fetcher.RetryPolicy{
+		Attempts:        a.config.RetryAttempts,
+		BaseDelay:       a.config.RetryBaseDelay,
+		MaxDelay:        a.config.RetryMaxDelay,
+		Jitter:          a.config.RetryJitter,
+		RetryableStatus: a.config.RetryStatus,
+		Budget:          a.config.RetryBudget,
+	}))
+	fetcherOpts = append(fetcherOpts, fetcher.WithAcceptedTypes(a.config.Accept...))
+	maxBodySize, err := parseByteSize(a.config.MaxBodySize)
+	if err != nil {
+		return fmt.Errorf("parse max body size: %w", err)
+	}
+	fetcherOpts = append(fetcherOpts, fetcher.WithMaxBodySize(maxBodySize))
+	httpClient, err := a.newHTTPClient()
+	if err != nil {
+		return fmt.Errorf("new http client: %w", err)
+	}
+	f := fetcher.New(httpClient, fetcherOpts...)
+	compression, err := domain.ParseCompression(a.config.Compression)
+	if err != nil {
+		return fmt.Errorf("parse compression: %w", err)
+	}
+	if a.config.Mirror && compression != domain.CompressionNone {
+		// The mirrored pages are opened by a browser, which cannot read them compressed.
+		return errors.New("--mirror cannot be combined with --compression")
+	}
+	storageClient, err := a.newStorageHTTPClient()
+	if err != nil {
+		return fmt.Errorf("new storage http client: %w", err)
+	}
+	storage, err := newStorage(a.config.Storage, a.config.DownloadPath, compression, storageClient)
+	if err != nil {
+		return fmt.Errorf("new storage: %w", err)
+	}
+	a.storage = storage
+
+	naming, err := domain.ParseFileNaming(a.config.Naming)
+	if err != nil {
+		return fmt.Errorf("parse file naming: %w", err)
+	}
+
+	opts := []service.Option{service.WithFileNaming(naming)}
+	if a.config.Mirror {
+		opts = append(opts, service.WithMirror())
+	}
+	if a.config.UTF8Copy {
+		opts = append(opts, service.WithUTF8Copy())
+	}
+	if a.config.Crawl {
+		scope, err := service.ParseCrawlScope(a.config.Scope)
+		if err != nil {
+			return fmt.Errorf("parse crawl scope: %w", err)
+		}
+		opts = append(opts, service.WithCrawl(service.CrawlOptions{
+			MaxDepth: a.config.Depth,
+			MaxPages: a.config.MaxPages,
+			Scope:    scope,
+		}))
+	}
+	a.service = service.New(f, a.storage, a.logger, a.metadataRepo, opts...)
+	a.scheduler = service.NewScheduler(a.service, a.metadataRepo, a.logger)
+	a.runner = service.NewRunner(a.service, a.metadataRepo, a.logger)
 
 	return nil
 }
@@ -44,17 +123,253 @@ func (a *App) metadataCommand(ctx context.Context, sites []string) error {
 		return fmt.Errorf("service get metadata for sites: %w", err)
 	}
 
-	var strs []string
+	return a.printMetaData(ctx, sites, metadataItems)
+}
+
+func (a *App) historyCommand(ctx context.Context, sites []string) error {
+	metadataItems, err := a.service.GetHistoryForSites(ctx, sites...)
+	if err != nil {
+		return fmt.Errorf("service get history for sites: %w", err)
+	}
+
+	return a.printMetaData(ctx, sites, metadataItems)
+}
+
+func (a *App) restoreCommand(ctx context.Context, sites []string) error {
+	if len(sites) != 1 {
+		return fmt.Errorf("restore expects exactly one site, got %d", len(sites))
+	}
+
+	snapshot := domain.SnapshotID(a.config.Restore)
+	if err := a.service.RestoreSnapshot(ctx, sites[0], snapshot); err != nil {
+		return fmt.Errorf("service restore snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// catCommand prints the content of the last saved page of the site, whichever compression it is stored with.
+func (a *App) catCommand(ctx context.Context, sites []string) error {
+	if len(sites) != 1 {
+		return fmt.Errorf("cat expects exactly one site, got %d", len(sites))
+	}
+
+	page, err := a.service.OpenPage(ctx, sites[0])
+	if err != nil {
+		return fmt.Errorf("service open page: %w", err)
+	}
+	defer page.Close()
+
+	if _, err := io.Copy(os.Stdout, page); err != nil {
+		return fmt.Errorf("print page: %w", err)
+	}
+	return nil
+}
+
+// printMetaData prints a record for each of the metadata of the given sites, in the order of the sites.
+// The sites without metadata are printed as not found.
+func (a *App) printMetaData(ctx context.Context, sites []string, metadataItems []domain.MetaData) error {
+	records, err := metaDataRecords(ctx, a.service, sites, metadataItems)
+	if err != nil {
+		return err
+	}
+
+	writer, err := newRecordWriter(a.config.Output, os.Stdout)
+	if err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := writer.Write(r); err != nil {
+			return fmt.Errorf("write record: %w", err)
+		}
+	}
+
+	return writer.Close()
+}
+
+// metaDataRecords returns a record for each of the metadata of the given sites, in the order of the sites.
+// The sites without metadata are not found.
+func metaDataRecords(ctx context.Context, svc *service.Service, sites []string, metadataItems []domain.MetaData) ([]record, error) {
+	byID := make(map[domain.PageID][]domain.MetaData)
 	for _, metadata := range metadataItems {
-		var builder strings.Builder
-		builder.WriteString(fmt.Sprintf("site: %s\n", metadata.Site))
-		builder.WriteString(fmt.Sprintf("num_links: %d\n", metadata.NumLinks))
-		builder.WriteString(fmt.Sprintf("images: %d\n", metadata.NumImages))
-		builder.WriteString(fmt.Sprintf("last_fetch: %s\n", metadata.LastFetched))
-		strs = append(strs, builder.String())
+		byID[metadata.ID] = append(byID[metadata.ID], metadata)
+	}
+
+	ids, err := svc.ResolveSites(ctx, sites...)
+	if err != nil {
+		return nil, fmt.Errorf("service resolve sites: %w", err)
+	}
+
+	var records []record
+	for i, site := range sites {
+		file, err := svc.PageLocation(ctx, ids[i])
+		if err != nil {
+			return nil, fmt.Errorf("service page location: %w", err)
+		}
+
+		items := byID[ids[i]]
+		if len(items) == 0 {
+			records = append(records, newRecord(site, ids[i], file, statusNotFound, nil, nil))
+			continue
+		}
+		for _, metadata := range items {
+			records = append(records, newRecord(site, ids[i], file, statusFound, nil, &metadata))
+		}
+	}
+	return records, nil
+}
+
+// fetchCommand fetches the sites given as arguments and read from the input within a run, and prints a record
+// for each fetched page as soon as it is fetched. The queue of the run is persisted, so once interrupted the
+// run is resumed where it stopped by --resume. The run is deleted once every site was fetched.
+func (a *App) fetchCommand(ctx context.Context, sites []string) error {
+	writer, err := newRecordWriter(a.config.Output, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	// The run stops once interrupted, after recording which sites are left to fetch.
+	signalCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithCancel(signalCtx)
+	defer cancel()
+
+	run, err := a.startRun(ctx, sites)
+	if err != nil {
+		return err
+	}
+
+	requests := make(chan service.SiteRequest)
+	inputErr := make(chan error, 1)
+	go func() {
+		defer close(requests)
+		inputErr <- a.readSites(ctx, run.Sites, run.Input, requests)
+	}()
+
+	results, err := a.runner.Fetch(ctx, run, requests)
+	if err != nil {
+		return fmt.Errorf("service fetch run: %w", err)
+	}
+
+	var errs error
+	for result := range results {
+		// The sites interrupted along with the run are fetched once it is resumed.
+		if signalCtx.Err() != nil && errors.Is(result.Err, context.Canceled) {
+			continue
+		}
+		errs = errors.Join(errs, result.Err)
+		if err := writer.Write(newFetchRecord(result)); err != nil {
+			return fmt.Errorf("write record: %w", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("close output: %w", err)
+	}
+
+	// The fetch stops reading the input when the crawl reaches its limit, so the reading is canceled.
+	cancel()
+	if err := <-inputErr; err != nil && !errors.Is(err, context.Canceled) {
+		errs = errors.Join(errs, err)
+	}
+
+	switch {
+	case signalCtx.Err() != nil && run.Input == stdinInput:
+		// The standard input is gone with the run, the sites it read are not known once resumed.
+		a.logger.Warn("Run interrupted, it read the standard input so it cannot be resumed.", "run", run.ID)
+		a.finishRun(context.WithoutCancel(ctx), run.ID)
+		errs = errors.Join(errs, fmt.Errorf("run %s interrupted", run.ID))
+	case signalCtx.Err() != nil:
+		a.logger.Warn("Run interrupted, resume it with --resume.", "run", run.ID)
+		errs = errors.Join(errs, fmt.Errorf("run %s interrupted", run.ID))
+	default:
+		a.finishRun(signalCtx, run.ID)
+	}
+	if errs != nil {
+		return fmt.Errorf("service fetch: %w", errs)
+	}
+	return nil
+}
+
+// startRun starts the run of the sites given as arguments followed by the sites read from the input, or returns
+// the run resumed by --resume, which reads its own sites and input again.
+func (a *App) startRun(ctx context.Context, sites []string) (domain.Run, error) {
+	if a.config.Resume == "" {
+		input := a.config.Input
+		// The input is read from the same file when the run is resumed from another directory.
+		if input != "" && input != stdinInput {
+			abs, err := filepath.Abs(input)
+			if err != nil {
+				return domain.Run{}, fmt.Errorf("absolute input path: %w", err)
+			}
+			input = abs
+		}
+
+		run, err := a.runner.Start(ctx, sites, input)
+		if err != nil {
+			return domain.Run{}, fmt.Errorf("service start run: %w", err)
+		}
+		a.logger.Info("Run started.", "run", run.ID)
+		return run, nil
+	}
+
+	if len(sites) > 0 || a.config.Input != "" {
+		return domain.Run{}, errors.New("resume reads the sites and the input of the run, expected none")
+	}
+	run, err := a.runner.Get(ctx, domain.RunID(a.config.Resume))
+	if err != nil {
+		return domain.Run{}, fmt.Errorf("service get run: %w", err)
+	}
+	if run.Input == stdinInput {
+		return domain.Run{}, fmt.Errorf("run %s read the standard input, it cannot be resumed", run.ID)
+	}
+	a.logger.Info(
+		"Run resumed.",
+		"run", run.ID,
+		"done", run.Tasks[domain.TaskDone],
+		"failed", run.Tasks[domain.TaskFailed],
+		"left", run.Tasks[domain.TaskPending]+run.Tasks[domain.TaskInProgress],
+	)
+	return run, nil
+}
+
+// finishRun deletes the run once it stopped for good, the runs left in the database are the ones to resume and
+// the ones whose failed sites are kept.
+func (a *App) finishRun(ctx context.Context, id domain.RunID) {
+	run, kept, err := a.runner.Finish(ctx, id)
+	if err != nil {
+		a.logger.Error("Failed to delete the finished run.", "run", id, "error", err)
+		return
+	}
+	if kept {
+		a.logger.Warn("Run finished with failed sites, it is kept with their errors.", "run", id, "failed", run.Tasks[domain.TaskFailed])
+	}
+}
+
+// readSites sends the sites on the requests channel, followed by the sites read from the input.
+func (a *App) readSites(ctx context.Context, sites []string, input string, requests chan<- service.SiteRequest) error {
+	for _, site := range sites {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case requests <- service.SiteRequest{Site: site}:
+		}
+	}
+
+	if input == "" {
+		return nil
 	}
-	fmt.Println(strings.Join(strs, "\n"))
 
+	reader, err := openInput(input)
+	if err != nil {
+		return fmt.Errorf("open input: %w", err)
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	if err := readInput(ctx, reader, requests); err != nil {
+		return fmt.Errorf("read input %s: %w", input, err)
+	}
 	return nil
 }
 
@@ -66,18 +381,42 @@ func (a *App) run(c *cli.Context) error {
 		return a.metadataCommand(ctx, sites)
 	}
 
-	if err := a.service.Fetch(ctx, sites...); err != nil {
-		return fmt.Errorf("service fetch: %w", err)
+	if a.config.History {
+		return a.historyCommand(ctx, sites)
 	}
 
-	return nil
+	if a.config.Restore != "" {
+		return a.restoreCommand(ctx, sites)
+	}
+
+	if a.config.Cat {
+		return a.catCommand(ctx, sites)
+	}
+
+	if a.config.ReadWARC != "" {
+		return a.readWARCCommand(ctx, sites)
+	}
+
+	return a.fetchCommand(ctx, sites)
 }
 
 func (a *App) after(_ *cli.Context) error {
+	var errs error
+	if a.cookieJar != nil {
+		if err := saveCookies(a.cookieJar, a.config.Cookies); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("save cookies: %w", err))
+		}
+	}
+	// The archives are only complete once closed.
+	if closer, ok := a.storage.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("close storage: %w", err))
+		}
+	}
 	if a.metadataRepo != nil {
 		if err := a.metadataRepo.Close(); err != nil {
-			return fmt.Errorf("close metadata repo: %w", err)
+			errs = errors.Join(errs, fmt.Errorf("close metadata repo: %w", err))
 		}
 	}
-	return nil
+	return errs
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/gsiffert/fetch/internal/fetcher"
+	"github.com/gsiffert/fetch/internal/memory"
+	"github.com/gsiffert/fetch/internal/service"
+	"github.com/gsiffert/fetch/internal/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirror_HostConcurrency(t *testing.T) {
+	t.Parallel()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/logo.png" {
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = io.WriteString(w, "png")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = io.WriteString(w, `<html><body><img src="/logo.png"></body></html>`)
+	}))
+	defer origin.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	repo, err := sqlite.NewMetaDataRepo(ctx, "file:"+t.Name()+"?cache=shared&mode=memory")
+	require.NoError(t, err)
+	defer repo.Close()
+
+	// The assets are fetched from the host of the page, while a single request to the host is in flight.
+	disk := memory.New()
+	f := fetcher.New(origin.Client(), fetcher.WithHostLimit(1, 0))
+	svc := service.New(f, disk, slog.Default(), repo, service.WithMirror())
+
+	results, err := svc.Fetch(ctx, origin.URL)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, service.FetchStatusFetched, results[0].Status)
+
+	var assets int
+	for _, file := range disk.Files() {
+		if content, err := disk.ReadFile(file); err == nil && string(content) == "png" {
+			assets++
+		}
+	}
+	assert.Equal(t, 1, assets, disk.Files())
+}
+
+func TestFetchCommand_Runs(t *testing.T) {
+	t.Parallel()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = io.WriteString(w, "<html><body>Hello</body></html>")
+	}))
+	defer origin.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	repo, err := sqlite.NewMetaDataRepo(ctx, "file:"+t.Name()+"?cache=shared&mode=memory")
+	require.NoError(t, err)
+	defer repo.Close()
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	svc := service.New(fetcher.New(origin.Client()), memory.New(), logger, repo)
+	a := &App{
+		config:  Config{Output: outputJSONL},
+		service: svc,
+		runner:  service.NewRunner(svc, repo, logger),
+		logger:  logger,
+	}
+
+	// The run is deleted once every site was fetched, there is nothing left to resume.
+	require.NoError(t, a.fetchCommand(ctx, []string{origin.URL}))
+	started := regexp.MustCompile(`msg="Run started." run=(\S+)`).FindStringSubmatch(logs.String())
+	require.Len(t, started, 2, logs.String())
+	_, ok, err := repo.RunByID(ctx, domain.RunID(started[1]))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// The run with a failed site is kept, along with the error of the site.
+	logs.Reset()
+	require.Error(t, a.fetchCommand(ctx, []string{origin.URL, origin.URL + "/missing"}))
+	started = regexp.MustCompile(`msg="Run started." run=(\S+)`).FindStringSubmatch(logs.String())
+	require.Len(t, started, 2, logs.String())
+	failed, err := repo.Tasks(ctx, domain.RunID(started[1]), domain.TaskFailed)
+	require.NoError(t, err)
+	require.Len(t, failed, 1)
+	assert.Equal(t, origin.URL+"/missing", failed[0].Site)
+	assert.Contains(t, failed[0].LastError, "404")
+
+	// The standard input read by a run is gone once it is interrupted.
+	run, err := a.runner.Start(ctx, nil, stdinInput)
+	require.NoError(t, err)
+	a.config.Resume = run.ID.String()
+	_, err = a.startRun(ctx, nil)
+	assert.ErrorContains(t, err, "cannot be resumed")
+}
@@ -1,12 +1,80 @@
 package main
 
-import "github.com/urfave/cli/v2"
+import (
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/gsiffert/fetch/internal/fetcher"
+	"github.com/gsiffert/fetch/internal/service"
+	"github.com/urfave/cli/v2"
+)
 
 // Config holds the configuration for the CLI.
 type Config struct {
-	MetaData     bool
-	DownloadPath string
-	DSN          string
+	MetaData        bool
+	History         bool
+	Restore         string
+	Cat             bool
+	ReadWARC        string
+	Extract         string
+	Mirror          bool
+	UTF8Copy        bool
+	Crawl           bool
+	Depth           int
+	MaxPages        int
+	Scope           string
+	IgnoreRobots    bool
+	HostConcurrency int
+	HostDelay       time.Duration
+	HostRPS         float64
+	ConnectTimeout  time.Duration
+	ReadTimeout     time.Duration
+	Timeout         time.Duration
+	UserAgent       string
+	Headers         []string
+	Cookies         string
+	Auth            []string
+	Proxy           string
+	CABundle        string
+	ClientCert      string
+	ClientKey       string
+	Insecure        bool
+	MaxRedirects    int
+	HTTP2           bool
+	RetryAttempts   int
+	RetryBaseDelay  time.Duration
+	RetryMaxDelay   time.Duration
+	RetryJitter     float64
+	RetryStatus     []int
+	RetryBudget     int
+	Accept          []string
+	MaxBodySize     string
+	Naming          string
+	Compression     string
+	Input           string
+	Resume          string
+	Output          string
+	DownloadPath    string
+	Storage         string
+	DSN             string
+
+	// The flags of the serve command.
+	Listen string
+	Token  string
+
+	// The flags of the schedule command.
+	Every  time.Duration
+	Cron   string
+	Remove bool
+}
+
+// load sets the fields of the flags which cannot have a destination: the slice flags ignore the disabled
+// separator of the app when they write to a destination, and the values of the headers may hold commas.
+func (c *Config) load(ctx *cli.Context) {
+	c.Headers = ctx.StringSlice("header")
+	c.Auth = ctx.StringSlice("auth")
+	c.RetryStatus = ctx.IntSlice("retry-status")
+	c.Accept = ctx.StringSlice("accept")
 }
 
 func (c *Config) Flags() []cli.Flag {
@@ -17,6 +85,271 @@ func (c *Config) Flags() []cli.Flag {
 			Destination: &c.MetaData,
 			Value:       false,
 		},
+		&cli.BoolFlag{
+			Name:        "history",
+			Usage:       "list every past fetch of the given sites",
+			Destination: &c.History,
+			Value:       false,
+		},
+		&cli.StringFlag{
+			Name:        "restore",
+			Usage:       "restore the saved page of the given site to the snapshot listed by --history",
+			Destination: &c.Restore,
+		},
+		&cli.BoolFlag{
+			Name:        "cat",
+			Usage:       "print the content of the last saved page of the given site, decompressed",
+			Destination: &c.Cat,
+			Value:       false,
+		},
+		&cli.StringFlag{
+			Name:        "read-warc",
+			Usage:       "list the records of the given WARC file, only the records of the given sites when set",
+			Destination: &c.ReadWARC,
+		},
+		&cli.StringFlag{
+			Name:        "extract",
+			Usage:       "extract the pages and the assets of the WARC file read by --read-warc to the given directory",
+			Destination: &c.Extract,
+		},
+		&cli.BoolFlag{
+			Name:        "mirror",
+			Usage:       "download the images, stylesheets and scripts of the pages so they can be browsed offline",
+			Destination: &c.Mirror,
+			Value:       false,
+		},
+		&cli.BoolFlag{
+			Name:        "utf8-copy",
+			Usage:       "store a copy of the text pages which are not encoded in UTF-8, transcoded to UTF-8",
+			Destination: &c.UTF8Copy,
+			Value:       false,
+			EnvVars:     []string{"FETCH_UTF8_COPY"},
+		},
+		&cli.BoolFlag{
+			Name:        "crawl",
+			Usage:       "follow the links of the fetched pages",
+			Destination: &c.Crawl,
+			Value:       false,
+		},
+		&cli.IntFlag{
+			Name:        "depth",
+			Usage:       "number of links followed from the given sites when crawling",
+			Destination: &c.Depth,
+			Value:       1,
+		},
+		&cli.IntFlag{
+			Name:        "max-pages",
+			Usage:       "maximum number of pages fetched when crawling, 0 means no limit",
+			Destination: &c.MaxPages,
+			Value:       100,
+		},
+		&cli.StringFlag{
+			Name:        "scope",
+			Usage:       "links followed when crawling: 'host' for the same host, 'prefix' for the same directory as the given site",
+			Destination: &c.Scope,
+			Value:       string(service.ScopeHost),
+		},
+		&cli.BoolFlag{
+			Name:        "ignore-robots",
+			Usage:       "fetch the sites even when the robots.txt file of their host disallows it",
+			Destination: &c.IgnoreRobots,
+			Value:       false,
+		},
+		&cli.IntFlag{
+			Name:        "host-concurrency",
+			Usage:       "maximum number of requests in flight to the same host, 0 means no limit",
+			Destination: &c.HostConcurrency,
+			Value:       4,
+			EnvVars:     []string{"FETCH_HOST_CONCURRENCY"},
+		},
+		&cli.DurationFlag{
+			Name:        "host-delay",
+			Usage:       "minimum delay between two requests to the same host",
+			Destination: &c.HostDelay,
+			Value:       0,
+			EnvVars:     []string{"FETCH_HOST_DELAY"},
+		},
+		&cli.Float64Flag{
+			Name:        "host-rps",
+			Usage:       "maximum number of requests per second sent to the same host, 0 means no limit",
+			Destination: &c.HostRPS,
+			Value:       0,
+			EnvVars:     []string{"FETCH_HOST_RPS"},
+		},
+		&cli.DurationFlag{
+			Name:        "connect-timeout",
+			Usage:       "maximum time taken to connect to a host, including the TLS handshake, 0 means no limit",
+			Destination: &c.ConnectTimeout,
+			Value:       10 * time.Second,
+			EnvVars:     []string{"FETCH_CONNECT_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:        "read-timeout",
+			Usage:       "maximum time spent waiting for a host to send the headers or the next bytes of a response, 0 means no limit",
+			Destination: &c.ReadTimeout,
+			Value:       30 * time.Second,
+			EnvVars:     []string{"FETCH_READ_TIMEOUT"},
+		},
+		&cli.DurationFlag{
+			Name:        "timeout",
+			Usage:       "maximum time taken by a request, reading its whole response included, 0 means no limit",
+			Destination: &c.Timeout,
+			Value:       2 * time.Minute,
+			EnvVars:     []string{"FETCH_TIMEOUT"},
+		},
+		&cli.StringFlag{
+			Name:        "user-agent",
+			Usage:       "User-Agent header sent with the requests, it selects the rules of the robots.txt files as well",
+			Destination: &c.UserAgent,
+			Value:       userAgent,
+			EnvVars:     []string{"FETCH_USER_AGENT"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "header",
+			Usage:   "header sent with the requests to the hosts of the sites, as 'Name: value', it may be repeated",
+			EnvVars: []string{"FETCH_HEADER"},
+		},
+		&cli.StringFlag{
+			Name:        "cookies",
+			Usage:       "Netscape cookies file, as exported by curl or a browser, loaded before the run and saved once it is done",
+			Destination: &c.Cookies,
+			EnvVars:     []string{"FETCH_COOKIES"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "auth",
+			Usage:   "credentials of the hosts matching a pattern, as '<pattern>=basic:<username>:<password>' or '<pattern>=bearer:<token>', only sent over https unless the pattern is prefixed with 'http://', it may be repeated",
+			EnvVars: []string{"FETCH_AUTH"},
+		},
+		&cli.StringFlag{
+			Name:        "proxy",
+			Usage:       "URL of the http, https or socks5 proxy the requests go through, the HTTP_PROXY and HTTPS_PROXY environment variables are used by default",
+			Destination: &c.Proxy,
+			EnvVars:     []string{"FETCH_PROXY"},
+		},
+		&cli.StringFlag{
+			Name:        "ca-bundle",
+			Usage:       "PEM file of the certificate authorities trusted on top of the ones of the system",
+			Destination: &c.CABundle,
+			EnvVars:     []string{"FETCH_CA_BUNDLE"},
+		},
+		&cli.StringFlag{
+			Name:        "client-cert",
+			Usage:       "PEM file of the certificate presented to the hosts asking for one, along with --client-key",
+			Destination: &c.ClientCert,
+			EnvVars:     []string{"FETCH_CLIENT_CERT"},
+		},
+		&cli.StringFlag{
+			Name:        "client-key",
+			Usage:       "PEM file of the key of the client certificate",
+			Destination: &c.ClientKey,
+			EnvVars:     []string{"FETCH_CLIENT_KEY"},
+		},
+		&cli.BoolFlag{
+			Name:        "insecure",
+			Usage:       "do not verify the certificates of the hosts",
+			Destination: &c.Insecure,
+			Value:       false,
+			EnvVars:     []string{"FETCH_INSECURE"},
+		},
+		&cli.IntFlag{
+			Name:        "max-redirects",
+			Usage:       "maximum number of redirects followed by a request",
+			Destination: &c.MaxRedirects,
+			Value:       10,
+			EnvVars:     []string{"FETCH_MAX_REDIRECTS"},
+		},
+		&cli.BoolFlag{
+			Name:        "http2",
+			Usage:       "use HTTP/2 with the hosts supporting it, --http2=false only uses HTTP/1.1",
+			Destination: &c.HTTP2,
+			Value:       true,
+			EnvVars:     []string{"FETCH_HTTP2"},
+		},
+		&cli.IntFlag{
+			Name:        "retry-attempts",
+			Usage:       "maximum number of times a request is sent, 1 never retries",
+			Destination: &c.RetryAttempts,
+			Value:       fetcher.DefaultRetryPolicy().Attempts,
+			EnvVars:     []string{"FETCH_RETRY_ATTEMPTS"},
+		},
+		&cli.DurationFlag{
+			Name:        "retry-base-delay",
+			Usage:       "delay before the first retry, it doubles with every retry",
+			Destination: &c.RetryBaseDelay,
+			Value:       fetcher.DefaultRetryPolicy().BaseDelay,
+			EnvVars:     []string{"FETCH_RETRY_BASE_DELAY"},
+		},
+		&cli.DurationFlag{
+			Name:        "retry-max-delay",
+			Usage:       "maximum delay between two retries, unless the host asks for more with the Retry-After header",
+			Destination: &c.RetryMaxDelay,
+			Value:       fetcher.DefaultRetryPolicy().MaxDelay,
+			EnvVars:     []string{"FETCH_RETRY_MAX_DELAY"},
+		},
+		&cli.Float64Flag{
+			Name:        "retry-jitter",
+			Usage:       "fraction of the delay between two retries drawn at random, between 0 and 1",
+			Destination: &c.RetryJitter,
+			Value:       fetcher.DefaultRetryPolicy().Jitter,
+			EnvVars:     []string{"FETCH_RETRY_JITTER"},
+		},
+		&cli.IntSliceFlag{
+			Name:    "retry-status",
+			Usage:   "status code of the responses retried, it may be repeated, the network errors are always retried",
+			Value:   cli.NewIntSlice(fetcher.DefaultRetryPolicy().RetryableStatus...),
+			EnvVars: []string{"FETCH_RETRY_STATUS"},
+		},
+		&cli.IntFlag{
+			Name:        "retry-budget",
+			Usage:       "maximum number of retries of the whole run, 0 means no limit",
+			Destination: &c.RetryBudget,
+			Value:       0,
+			EnvVars:     []string{"FETCH_RETRY_BUDGET"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "accept",
+			Usage:   "media type of the pages fetched, such as application/pdf or image/*, it may be repeated, the other pages fail",
+			Value:   cli.NewStringSlice(domain.DefaultAcceptedMediaTypes...),
+			EnvVars: []string{"FETCH_ACCEPT"},
+		},
+		&cli.StringFlag{
+			Name:        "max-body-size",
+			Usage:       "maximum size of the decoded responses, such as 512KB, 100MB or 2GB, the larger responses fail, 0 means no limit",
+			Destination: &c.MaxBodySize,
+			Value:       "100MB",
+			EnvVars:     []string{"FETCH_MAX_BODY_SIZE"},
+		},
+		&cli.StringFlag{
+			Name:        "naming",
+			Usage:       "naming of the files the pages are stored in: 'flat' in the download path, 'hierarchy' in a directory per host and path segment",
+			Destination: &c.Naming,
+			Value:       string(domain.NamingFlat),
+			EnvVars:     []string{"FETCH_NAMING"},
+		},
+		&cli.StringFlag{
+			Name:        "compression",
+			Usage:       "compression of the saved pages: none, gzip or zstd, only supported when saving to a directory",
+			Destination: &c.Compression,
+			Value:       "none",
+			EnvVars:     []string{"FETCH_COMPRESSION"},
+		},
+		&cli.StringFlag{
+			Name:        "input",
+			Usage:       "file listing the sites to fetch, one URL or JSON record per line, - reads the standard input",
+			Destination: &c.Input,
+		},
+		&cli.StringFlag{
+			Name:        "resume",
+			Usage:       "resume the interrupted run of the given id, fetching the sites of the run it did not fetch yet",
+			Destination: &c.Resume,
+		},
+		&cli.StringFlag{
+			Name:        "output",
+			Usage:       "format of the results printed for each site: text, json, jsonl, csv or table",
+			Destination: &c.Output,
+			Value:       outputText,
+			EnvVars:     []string{"FETCH_OUTPUT"},
+		},
 		&cli.StringFlag{
 			Name:        "dsn",
 			Usage:       "DSN for the sqlite database",
@@ -31,5 +364,52 @@ func (c *Config) Flags() []cli.Flag {
 			Value:       ".",
 			EnvVars:     []string{"FETCH_DOWNLOAD_PATH"},
 		},
+		&cli.StringFlag{
+			Name: "storage",
+			Usage: "URI of the storage of the downloaded files: a directory, s3://<bucket>/<prefix>, " +
+				"tar://<path>, zip://<path> or memory://, the download path is used by default",
+			Destination: &c.Storage,
+			EnvVars:     []string{"FETCH_STORAGE"},
+		},
+	}
+}
+
+// ScheduleFlags returns the flags of the schedule command.
+func (c *Config) ScheduleFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.DurationFlag{
+			Name:        "every",
+			Usage:       "fetch the sites every given interval, such as 30m or 24h",
+			Destination: &c.Every,
+		},
+		&cli.StringFlag{
+			Name:        "cron",
+			Usage:       "fetch the sites at the times of the cron expression, such as '0 6 * * 1-5' or @daily",
+			Destination: &c.Cron,
+		},
+		&cli.BoolFlag{
+			Name:        "remove",
+			Usage:       "stop fetching the sites periodically",
+			Destination: &c.Remove,
+		},
+	}
+}
+
+// ServeFlags returns the flags of the serve command.
+func (c *Config) ServeFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "listen",
+			Usage:       "address the HTTP API listens on",
+			Destination: &c.Listen,
+			Value:       "127.0.0.1:8080",
+			EnvVars:     []string{"FETCH_LISTEN"},
+		},
+		&cli.StringFlag{
+			Name:        "token",
+			Usage:       "bearer token the requests to the HTTP API must hold in their Authorization header, the API is open when empty",
+			Destination: &c.Token,
+			EnvVars:     []string{"FETCH_TOKEN"},
+		},
 	}
 }
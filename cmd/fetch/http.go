@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gsiffert/fetch/internal/fetcher"
+)
+
+// newHTTPClient returns the http.Client of the fetcher, configured by the flags. The cookies file is loaded
+// into the cookie jar of the App, which saves it back once the run is done.
+func (a *App) newHTTPClient() (*http.Client, error) {
+	header, err := parseHeaders(a.config.Headers)
+	if err != nil {
+		return nil, fmt.Errorf("parse headers: %w", err)
+	}
+
+	auth := make([]fetcher.AuthRule, 0, len(a.config.Auth))
+	for _, value := range a.config.Auth {
+		rule, err := fetcher.ParseAuthRule(value)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, rule)
+	}
+
+	config := fetcher.HTTPConfig{
+		ConnectTimeout: a.config.ConnectTimeout,
+		ReadTimeout:    a.config.ReadTimeout,
+		TotalTimeout:   a.config.Timeout,
+		UserAgent:      a.config.UserAgent,
+		Header:         header,
+		Auth:           auth,
+		Proxy:          a.config.Proxy,
+		CABundle:       a.config.CABundle,
+		ClientCert:     a.config.ClientCert,
+		ClientKey:      a.config.ClientKey,
+		Insecure:       a.config.Insecure,
+		MaxRedirects:   a.config.MaxRedirects,
+		DisableHTTP2:   !a.config.HTTP2,
+	}
+	if a.config.Cookies != "" {
+		jar, err := loadCookies(a.config.Cookies)
+		if err != nil {
+			return nil, fmt.Errorf("load cookies: %w", err)
+		}
+		a.cookieJar = jar
+		config.Jar = jar
+	}
+
+	return fetcher.NewHTTPClient(config)
+}
+
+// newStorageHTTPClient returns the http.Client of the storages sending requests, such as the S3 storage. It has
+// the timeouts of the fetcher, none of the headers, credentials and cookies of the fetched hosts.
+func (a *App) newStorageHTTPClient() (*http.Client, error) {
+	return fetcher.NewHTTPClient(fetcher.HTTPConfig{
+		ConnectTimeout: a.config.ConnectTimeout,
+		ReadTimeout:    a.config.ReadTimeout,
+		TotalTimeout:   a.config.Timeout,
+	})
+}
+
+// parseHeaders returns the headers of the given "Name: value" values, a name may be given several times.
+func parseHeaders(values []string) (http.Header, error) {
+	header := make(http.Header, len(values))
+	for _, line := range values {
+		name, value, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("header %q: expected Name: value", line)
+		}
+		header.Add(textproto.CanonicalMIMEHeaderKey(name), strings.TrimSpace(value))
+	}
+	return header, nil
+}
+
+// byteUnits maps the units of the sizes to their number of bytes, the units are multiples of 1024.
+var byteUnits = map[string]int64{
+	"":   1,
+	"B":  1,
+	"KB": 1 << 10,
+	"MB": 1 << 20,
+	"GB": 1 << 30,
+}
+
+// parseByteSize returns the number of bytes of a size such as 512KB, 100MB or 2GB, a number without unit
+// is a number of bytes.
+func parseByteSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	number := strings.TrimRightFunc(value, func(r rune) bool { return 'A' <= r && r <= 'Z' })
+	unit, ok := byteUnits[strings.TrimSpace(value[len(number):])]
+	size, err := strconv.ParseInt(strings.TrimSpace(number), 10, 64)
+	if !ok || err != nil || size < 0 || size > math.MaxInt64/unit {
+		return 0, fmt.Errorf("size %q: expected a number of bytes, KB, MB or GB", value)
+	}
+	return size * unit, nil
+}
+
+// loadCookies returns the cookie jar holding the cookies of the Netscape cookies file, the jar is empty
+// when the file does not exist yet.
+func loadCookies(path string) (*fetcher.CookieJar, error) {
+	jar := fetcher.NewCookieJar()
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return jar, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if err := jar.Load(file); err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return jar, nil
+}
+
+// saveCookies writes the cookies of the jar to the Netscape cookies file, only readable by its owner
+// as it holds the sessions.
+func saveCookies(jar *fetcher.CookieJar, path string) error {
+	var buffer bytes.Buffer
+	if err := jar.Save(&buffer); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buffer.Bytes(), 0o600)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHeaders(t *testing.T) {
+	t.Parallel()
+
+	header, err := parseHeaders([]string{"x-team: crawler", "Accept: text/html, application/xhtml+xml", "X-Team:search"})
+	require.NoError(t, err)
+	assert.Equal(t, http.Header{
+		"X-Team": []string{"crawler", "search"},
+		"Accept": []string{"text/html, application/xhtml+xml"},
+	}, header)
+
+	for _, value := range []string{"X-Team", ": crawler", "X Team: crawler"} {
+		_, err := parseHeaders([]string{value})
+		assert.Error(t, err, value)
+	}
+}
+
+func TestNewStorageHTTPClient(t *testing.T) {
+	t.Parallel()
+
+	a := &App{config: Config{
+		Headers:        []string{"X-Team: crawler"},
+		ConnectTimeout: time.Second,
+		ReadTimeout:    2 * time.Second,
+		Timeout:        time.Minute,
+	}}
+	client, err := a.newStorageHTTPClient()
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, client.Timeout)
+
+	// The storage is not a fetched host, its requests do not get their headers.
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("X-Team"))
+	}))
+	defer srv.Close()
+	resp, err := client.Get(srv.URL)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+}
+
+func TestParseByteSize(t *testing.T) {
+	t.Parallel()
+
+	for value, expected := range map[string]int64{"0": 0, "512": 512, "1b": 1, "512KB": 512 << 10, "100 MB": 100 << 20, "2gb": 2 << 30} {
+		size, err := parseByteSize(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, size, value)
+	}
+
+	for _, value := range []string{"", "MB", "-1MB", "1.5MB", "12TB", "9999999999GB"} {
+		_, err := parseByteSize(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestCookies(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "cookies.txt")
+	jar, err := loadCookies(path)
+	require.NoError(t, err, "a missing file is an empty jar")
+
+	u, err := url.Parse("https://intranet.example.com/")
+	require.NoError(t, err)
+	jar.SetCookies(u, []*http.Cookie{{Name: "sso", Value: "token"}})
+	require.NoError(t, saveCookies(jar, path))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	loaded, err := loadCookies(path)
+	require.NoError(t, err)
+	assert.Equal(t, jar.Cookies(u), loaded.Cookies(u))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gsiffert/fetch/internal/service"
+)
+
+const (
+	// stdinInput is the name of the input reading the sites from the standard input.
+	stdinInput = "-"
+	// maxInputLineSize is the maximum size of a line of the input, a JSON record with its headers must fit in it.
+	maxInputLineSize = 1 << 20
+)
+
+// inputRecord is the schema of the JSON lines of the input, only the url is required.
+type inputRecord struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers"`
+	// Output is the name the page is stored under, relative to the download path.
+	Output string `json:"output"`
+}
+
+// openInput opens the file listing the sites to fetch, the standard input is read when the name is "-".
+func openInput(name string) (io.ReadCloser, error) {
+	if name == stdinInput {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(name)
+}
+
+// readInput sends a service.SiteRequest on the requests channel for each line of the input, as it is read.
+// A line is either a URL or a JSON inputRecord, the empty lines and the lines starting with # are skipped.
+// It stops at the first invalid line, or when the context is done.
+func readInput(ctx context.Context, r io.Reader, requests chan<- service.SiteRequest) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxInputLineSize)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		request, err := parseInputLine(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case requests <- request:
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read input: %w", err)
+	}
+	return nil
+}
+
+// parseInputLine returns the service.SiteRequest described by a line of the input.
+func parseInputLine(line string) (service.SiteRequest, error) {
+	if !strings.HasPrefix(line, "{") {
+		return service.SiteRequest{Site: line}, nil
+	}
+
+	var record inputRecord
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&record); err != nil {
+		return service.SiteRequest{}, fmt.Errorf("decode record: %w", err)
+	}
+	return record.siteRequest()
+}
+
+// siteRequest returns the service.SiteRequest described by the inputRecord.
+func (r inputRecord) siteRequest() (service.SiteRequest, error) {
+	if r.URL == "" {
+		return service.SiteRequest{}, errors.New("missing url")
+	}
+	// The output name is joined to the download path, it must not escape it.
+	if r.Output != "" && !filepath.IsLocal(r.Output) {
+		return service.SiteRequest{}, fmt.Errorf("output %q is not a local path", r.Output)
+	}
+
+	request := service.SiteRequest{
+		Site:   r.URL,
+		Method: strings.ToUpper(r.Method),
+		Name:   r.Output,
+	}
+	if len(r.Headers) > 0 {
+		request.Header = make(http.Header, len(r.Headers))
+		for name, value := range r.Headers {
+			request.Header.Set(name, value)
+		}
+	}
+	return request, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gsiffert/fetch/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadInput(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		input     string
+		expected  []service.SiteRequest
+		assertErr assert.ErrorAssertionFunc
+	}{
+		{
+			name:      "empty",
+			input:     "",
+			assertErr: assert.NoError,
+		},
+		{
+			name:  "urls",
+			input: "https://www.google.com\n\n# Comment\n  https://www.google.com/about  \n",
+			expected: []service.SiteRequest{
+				{Site: "https://www.google.com"},
+				{Site: "https://www.google.com/about"},
+			},
+			assertErr: assert.NoError,
+		},
+		{
+			name: "records",
+			input: "" +
+				`{"url": "https://www.google.com/search", "method": "post", "headers": {"x-api-key": "secret"}, "output": "google/search"}` + "\n" +
+				"https://www.google.com\n",
+			expected: []service.SiteRequest{
+				{
+					Site:   "https://www.google.com/search",
+					Method: http.MethodPost,
+					Header: http.Header{"X-Api-Key": []string{"secret"}},
+					Name:   "google/search",
+				},
+				{Site: "https://www.google.com"},
+			},
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "missing url",
+			input:     `{"method": "GET"}`,
+			assertErr: assert.Error,
+		},
+		{
+			name:      "unknown field",
+			input:     `{"url": "https://www.google.com", "timeout": 10}`,
+			assertErr: assert.Error,
+		},
+		{
+			name:      "output outside of the download path",
+			input:     `{"url": "https://www.google.com", "output": "../google"}`,
+			assertErr: assert.Error,
+		},
+		{
+			name:      "stops at the invalid line",
+			input:     "https://www.google.com\n{not json\nhttps://www.google.com/about\n",
+			expected:  []service.SiteRequest{{Site: "https://www.google.com"}},
+			assertErr: assert.Error,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			requests := make(chan service.SiteRequest)
+			errChan := make(chan error, 1)
+			go func() {
+				defer close(requests)
+				errChan <- readInput(context.Background(), strings.NewReader(test.input), requests)
+			}()
+
+			var read []service.SiteRequest
+			for request := range requests {
+				read = append(read, request)
+			}
+			test.assertErr(t, <-errChan)
+			assert.Equal(t, test.expected, read)
+		})
+	}
+}
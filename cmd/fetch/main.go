@@ -10,6 +10,8 @@ import (
 
 const (
 	version = "0.1.0"
+	// userAgent is the default User-Agent of the requests, it identifies the fetch command to the hosts.
+	userAgent = "fetch/" + version
 )
 
 func main() {
@@ -23,6 +25,28 @@ func main() {
 		Action:  app.run,
 		After:   app.after,
 		Flags:   app.config.Flags(),
+		Commands: []*cli.Command{
+			{
+				Name:      "schedule",
+				Usage:     "fetch the given sites periodically while the daemon runs, list the scheduled sites when none is given",
+				ArgsUsage: "[sites...]",
+				Flags:     app.config.ScheduleFlags(),
+				Action:    app.scheduleCommand,
+			},
+			{
+				Name:   "serve",
+				Usage:  "serve an HTTP API fetching the sites of the submitted jobs and serving the saved pages, until interrupted",
+				Flags:  app.config.ServeFlags(),
+				Action: app.serveCommand,
+			},
+			{
+				Name:   "daemon",
+				Usage:  "fetch the scheduled sites as they are due, until interrupted",
+				Action: app.daemonCommand,
+			},
+		},
+		// The values of the headers may hold commas.
+		DisableSliceFlagSeparator: true,
 	}
 
 	if err := cliApp.Run(os.Args); err != nil {
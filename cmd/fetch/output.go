@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/gsiffert/fetch/internal/service"
+)
+
+const (
+	outputText  = "text"
+	outputJSON  = "json"
+	outputJSONL = "jsonl"
+	outputCSV   = "csv"
+	outputTable = "table"
+)
+
+const (
+	// statusFound reports the metadata of the site were found.
+	statusFound = "found"
+	// statusNotFound reports the site was never fetched.
+	statusNotFound = "not_found"
+)
+
+// tableColumns are the columns of the record printed by the table output, the others do not fit in a terminal.
+var tableColumns = []string{"site", "status", "file", "title", "num_links", "num_images", "last_fetched", "error"}
+
+// record is the schema of the output of the commands, one record is printed per site.
+// The names of the fields are part of the contract with the programs consuming the output,
+// they must not change and new fields are appended.
+type record struct {
+	Site               string `json:"site"`
+	ID                 string `json:"id"`
+	File               string `json:"file"`
+	Status             string `json:"status"`
+	Error              string `json:"error"`
+	LastFetched        string `json:"last_fetched"`
+	Snapshot           string `json:"snapshot"`
+	ETag               string `json:"etag"`
+	LastModified       string `json:"last_modified"`
+	Title              string `json:"title"`
+	Description        string `json:"description"`
+	Canonical          string `json:"canonical"`
+	Lang               string `json:"lang"`
+	OpenGraphType      string `json:"og_type"`
+	OpenGraphTitle     string `json:"og_title"`
+	OpenGraphDesc      string `json:"og_description"`
+	OpenGraphImage     string `json:"og_image"`
+	OpenGraphURL       string `json:"og_url"`
+	TwitterCard        string `json:"twitter_card"`
+	TwitterTitle       string `json:"twitter_title"`
+	TwitterDescription string `json:"twitter_description"`
+	TwitterImage       string `json:"twitter_image"`
+	TwitterURL         string `json:"twitter_url"`
+	NumLinks           int    `json:"num_links"`
+	NumImages          int    `json:"num_images"`
+	NumH1              int    `json:"num_h1"`
+	NumH2              int    `json:"num_h2"`
+	NumH3              int    `json:"num_h3"`
+	NumH4              int    `json:"num_h4"`
+	NumH5              int    `json:"num_h5"`
+	NumH6              int    `json:"num_h6"`
+	NumScripts         int    `json:"num_scripts"`
+	NumStylesheets     int    `json:"num_stylesheets"`
+	WordCount          int    `json:"word_count"`
+	ByteSize           int64  `json:"byte_size"`
+	Compression        string `json:"compression"`
+	Attempts           int    `json:"attempts"`
+	ContentType        string `json:"content_type"`
+	Charset            string `json:"charset"`
+}
+
+// newRecord returns the record of a site identified by the page id, the metadata are left empty when m is nil.
+func newRecord(site string, id domain.PageID, file string, status string, err error, m *domain.MetaData) record {
+	r := record{
+		Site:   site,
+		ID:     id.String(),
+		File:   file,
+		Status: status,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if m == nil {
+		return r
+	}
+
+	r.ID = m.ID.String()
+	if !m.LastFetched.IsZero() {
+		r.LastFetched = m.LastFetched.UTC().Format(time.RFC3339)
+	}
+	r.Snapshot = m.Snapshot.String()
+	r.ETag = m.ETag
+	r.LastModified = m.LastModified
+	r.Title = m.Title
+	r.Description = m.Description
+	r.Canonical = m.Canonical
+	r.Lang = m.Lang
+	r.OpenGraphType = m.OpenGraph.Type
+	r.OpenGraphTitle = m.OpenGraph.Title
+	r.OpenGraphDesc = m.OpenGraph.Description
+	r.OpenGraphImage = m.OpenGraph.Image
+	r.OpenGraphURL = m.OpenGraph.URL
+	r.TwitterCard = m.Twitter.Type
+	r.TwitterTitle = m.Twitter.Title
+	r.TwitterDescription = m.Twitter.Description
+	r.TwitterImage = m.Twitter.Image
+	r.TwitterURL = m.Twitter.URL
+	r.NumLinks = m.NumLinks
+	r.NumImages = m.NumImages
+	r.NumH1, r.NumH2, r.NumH3 = m.NumHeadings[0], m.NumHeadings[1], m.NumHeadings[2]
+	r.NumH4, r.NumH5, r.NumH6 = m.NumHeadings[3], m.NumHeadings[4], m.NumHeadings[5]
+	r.NumScripts = m.NumScripts
+	r.NumStylesheets = m.NumStylesheets
+	r.WordCount = m.WordCount
+	r.ByteSize = m.ByteSize
+	r.Compression = string(m.Compression)
+	r.ContentType = m.ContentType
+	r.Charset = m.Charset
+	return r
+}
+
+// newFetchRecord returns the record of a fetched site.
+func newFetchRecord(result service.FetchResult) record {
+	var m *domain.MetaData
+	if result.Err == nil {
+		m = &result.MetaData
+	}
+	r := newRecord(result.Site, result.Page.ID, result.Location, string(result.Status), result.Err, m)
+	r.Attempts = result.Attempts
+	return r
+}
+
+// recordColumns returns the names of the columns of a record, they are the names of the JSON fields.
+func recordColumns() []string {
+	t := reflect.TypeOf(record{})
+	names := make([]string, t.NumField())
+	for i := range names {
+		names[i] = t.Field(i).Tag.Get("json")
+	}
+	return names
+}
+
+// values returns the values of the columns of the record, formatted as strings.
+func (r record) values() map[string]string {
+	v := reflect.ValueOf(r)
+	values := make(map[string]string, v.NumField())
+	for i, name := range recordColumns() {
+		values[name] = fmt.Sprint(v.Field(i).Interface())
+	}
+	return values
+}
+
+// recordWriter prints the records in one of the output formats.
+// Close must be called once every record is written, to terminate the output.
+type recordWriter interface {
+	Write(r record) error
+	Close() error
+}
+
+// newRecordWriter returns the recordWriter of the given format, writing to w.
+func newRecordWriter(format string, w io.Writer) (recordWriter, error) {
+	switch format {
+	case outputText:
+		return &textWriter{writer: w}, nil
+	case outputJSON:
+		return &jsonWriter{writer: w}, nil
+	case outputJSONL:
+		return &jsonlWriter{encoder: json.NewEncoder(w)}, nil
+	case outputCSV:
+		return newColumnsWriter(csvTable{csv.NewWriter(w)}, recordColumns())
+	case outputTable:
+		return newColumnsWriter(tabTable{tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)}, tableColumns)
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// textWriter prints each record as a block of "name: value" lines.
+type textWriter struct {
+	writer  io.Writer
+	written bool
+}
+
+func (w *textWriter) Write(r record) error {
+	if w.written {
+		if _, err := fmt.Fprintln(w.writer); err != nil {
+			return err
+		}
+	}
+	w.written = true
+
+	values := r.values()
+	for _, name := range recordColumns() {
+		if _, err := fmt.Fprintf(w.writer, "%s: %s\n", name, values[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *textWriter) Close() error {
+	return nil
+}
+
+// jsonWriter prints the records as a JSON array.
+type jsonWriter struct {
+	writer  io.Writer
+	written bool
+}
+
+func (w *jsonWriter) Write(r record) error {
+	data, err := json.MarshalIndent(r, "  ", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal record: %w", err)
+	}
+
+	separator := ",\n  "
+	if !w.written {
+		separator = "[\n  "
+	}
+	w.written = true
+
+	_, err = fmt.Fprintf(w.writer, "%s%s", separator, data)
+	return err
+}
+
+func (w *jsonWriter) Close() error {
+	if !w.written {
+		_, err := fmt.Fprintln(w.writer, "[]")
+		return err
+	}
+	_, err := fmt.Fprintln(w.writer, "\n]")
+	return err
+}
+
+// jsonlWriter prints each record as a JSON object on its own line.
+type jsonlWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *jsonlWriter) Write(r record) error {
+	return w.encoder.Encode(r)
+}
+
+func (w *jsonlWriter) Close() error {
+	return nil
+}
+
+// table writes rows of cells, it is implemented by the csv and the tabwriter writers.
+type table interface {
+	writeRow(cells []string) error
+	flush() error
+}
+
+// columnsWriter prints the given columns of the records as the rows of a table, after a header.
+type columnsWriter struct {
+	table   table
+	columns []string
+}
+
+func newColumnsWriter(t table, columns []string) (*columnsWriter, error) {
+	if err := t.writeRow(columns); err != nil {
+		return nil, fmt.Errorf("write header: %w", err)
+	}
+	return &columnsWriter{table: t, columns: columns}, nil
+}
+
+func (w *columnsWriter) Write(r record) error {
+	values := r.values()
+	cells := make([]string, len(w.columns))
+	for i, name := range w.columns {
+		cells[i] = values[name]
+	}
+	return w.table.writeRow(cells)
+}
+
+func (w *columnsWriter) Close() error {
+	return w.table.flush()
+}
+
+type csvTable struct {
+	writer *csv.Writer
+}
+
+func (t csvTable) writeRow(cells []string) error {
+	return t.writer.Write(cells)
+}
+
+func (t csvTable) flush() error {
+	t.writer.Flush()
+	return t.writer.Error()
+}
+
+type tabTable struct {
+	writer *tabwriter.Writer
+}
+
+func (t tabTable) writeRow(cells []string) error {
+	for i, cell := range cells {
+		separator := "\t"
+		if i == len(cells)-1 {
+			separator = "\n"
+		}
+		// The cells are kept on a single line, so the text of the pages does not break the table.
+		cell = strings.Join(strings.Fields(cell), " ")
+		if _, err := fmt.Fprint(t.writer, cell, separator); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t tabTable) flush() error {
+	return t.writer.Flush()
+}
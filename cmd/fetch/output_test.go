@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/gsiffert/fetch/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordWriter(t *testing.T) {
+	t.Parallel()
+
+	records := []record{
+		newFetchRecord(service.FetchResult{
+			Site:     "https://www.google.com",
+			Location: "www.google.com.html",
+			Status:   service.FetchStatusFetched,
+			MetaData: domain.MetaData{
+				ID:          "https://www.google.com",
+				Site:        "www.google.com",
+				LastFetched: time.Date(2024, 3, 17, 14, 43, 0, 0, time.UTC),
+				NumLinks:    4,
+				Title:       "Google,\n Search",
+				ContentType: "text/html",
+			},
+		}),
+		newFetchRecord(service.FetchResult{
+			Site:     "https://www.google.com/about",
+			Page:     domain.Page{ID: "https://www.google.com/about"},
+			Location: "www.google.com%2Fabout.html",
+			Status:   service.FetchStatusFailed,
+			MetaData: domain.MetaData{NumLinks: 12},
+			Err:      errors.New("unexpected status code: 404"),
+		}),
+	}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format: outputTable,
+			expected: "" +
+				"site                          status   file                         title           num_links  num_images  last_fetched          error\n" +
+				"https://www.google.com        fetched  www.google.com.html          Google, Search  4          0           2024-03-17T14:43:00Z  \n" +
+				"https://www.google.com/about  failed   www.google.com%2Fabout.html                  0          0                                 unexpected status code: 404\n",
+		},
+		{
+			format: outputJSONL,
+			expected: "" +
+				`{"site":"https://www.google.com","id":"https://www.google.com","file":"www.google.com.html","status":"fetched","error":"","last_fetched":"2024-03-17T14:43:00Z","snapshot":"","etag":"","last_modified":"","title":"Google,\n Search","description":"","canonical":"","lang":"","og_type":"","og_title":"","og_description":"","og_image":"","og_url":"","twitter_card":"","twitter_title":"","twitter_description":"","twitter_image":"","twitter_url":"","num_links":4,"num_images":0,"num_h1":0,"num_h2":0,"num_h3":0,"num_h4":0,"num_h5":0,"num_h6":0,"num_scripts":0,"num_stylesheets":0,"word_count":0,"byte_size":0,"compression":"","attempts":0,"content_type":"text/html","charset":""}` + "\n" +
+				`{"site":"https://www.google.com/about","id":"https://www.google.com/about","file":"www.google.com%2Fabout.html","status":"failed","error":"unexpected status code: 404","last_fetched":"","snapshot":"","etag":"","last_modified":"","title":"","description":"","canonical":"","lang":"","og_type":"","og_title":"","og_description":"","og_image":"","og_url":"","twitter_card":"","twitter_title":"","twitter_description":"","twitter_image":"","twitter_url":"","num_links":0,"num_images":0,"num_h1":0,"num_h2":0,"num_h3":0,"num_h4":0,"num_h5":0,"num_h6":0,"num_scripts":0,"num_stylesheets":0,"word_count":0,"byte_size":0,"compression":"","attempts":0,"content_type":"","charset":""}` + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			writer, err := newRecordWriter(test.format, &buf)
+			require.NoError(t, err)
+			for _, r := range records {
+				require.NoError(t, writer.Write(r))
+			}
+			require.NoError(t, writer.Close())
+			assert.Equal(t, test.expected, buf.String())
+		})
+	}
+
+	t.Run(outputJSON, func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		writer, err := newRecordWriter(outputJSON, &buf)
+		require.NoError(t, err)
+		for _, r := range records {
+			require.NoError(t, writer.Write(r))
+		}
+		require.NoError(t, writer.Close())
+
+		var decoded []record
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+		assert.Equal(t, records, decoded)
+	})
+
+	t.Run(outputCSV, func(t *testing.T) {
+		t.Parallel()
+
+		var buf bytes.Buffer
+		writer, err := newRecordWriter(outputCSV, &buf)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		assert.Equal(t, strings.Join(recordColumns(), ",")+"\n", buf.String())
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := newRecordWriter("xml", &bytes.Buffer{})
+		assert.Error(t, err)
+	})
+}
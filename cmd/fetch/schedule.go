@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/urfave/cli/v2"
+)
+
+// scheduleCommand schedules the sites given as arguments, or stops fetching them periodically with --remove.
+// Without sites, it lists the scheduled sites.
+func (a *App) scheduleCommand(c *cli.Context) error {
+	ctx := c.Context
+	sites := c.Args().Slice()
+	if len(sites) == 0 {
+		schedules, err := a.scheduler.List(ctx)
+		if err != nil {
+			return err
+		}
+		return printSchedules(os.Stdout, schedules)
+	}
+
+	var errs error
+	for _, site := range sites {
+		if a.config.Remove {
+			errs = errors.Join(errs, a.scheduler.Remove(ctx, site))
+			continue
+		}
+		schedule, err := a.scheduler.Add(ctx, site, a.config.Every, a.config.Cron)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		a.logger.Info("Site scheduled.", "site", site, "next_run", schedule.NextRun)
+	}
+	return errs
+}
+
+// printSchedules prints a line for each schedule.
+func printSchedules(out io.Writer, schedules []domain.Schedule) error {
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "SITE\tSCHEDULE\tNEXT RUN\tLAST RUN")
+	for _, schedule := range schedules {
+		every := schedule.Cron
+		if every == "" {
+			every = "every " + schedule.Interval.String()
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", schedule.Site, every, formatRun(schedule.NextRun), formatRun(schedule.LastRun))
+	}
+	return writer.Flush()
+}
+
+// formatRun formats the time of a run in the local time, a zero time is printed as a dash.
+func formatRun(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+// daemonCommand fetches the scheduled sites as they are due and prints a record for each fetched page, until
+// it is interrupted.
+func (a *App) daemonCommand(c *cli.Context) error {
+	writer, err := newRecordWriter(a.config.Output, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	a.logger.Info("Daemon started.")
+	for result := range a.scheduler.Run(ctx) {
+		if err := writer.Write(newFetchRecord(result)); err != nil {
+			return fmt.Errorf("write record: %w", err)
+		}
+	}
+	a.logger.Info("Daemon stopped.")
+	return writer.Close()
+}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/gsiffert/fetch/internal/service"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	// maxRunningJobs is the number of jobs fetching their sites at the same time, the other jobs are pending.
+	maxRunningJobs = 4
+	// maxPendingJobs is the number of jobs waiting for a running job to be over, the jobs submitted once it is
+	// reached are rejected.
+	maxPendingJobs = 100
+	// maxFinishedJobs is the number of finished jobs kept, the oldest are forgotten.
+	maxFinishedJobs = 1000
+	// finishedJobRetention is how long a finished job is kept, so its results can be read back.
+	finishedJobRetention = time.Hour
+	// maxJobRequestSize is the maximum size of the body submitting a job.
+	maxJobRequestSize = 1 << 20
+	// shutdownTimeout is how long the server waits for the requests in flight once interrupted.
+	shutdownTimeout = 30 * time.Second
+)
+
+// errTooManyJobs is returned when a job is submitted while maxPendingJobs jobs are pending.
+var errTooManyJobs = errors.New("too many pending jobs")
+
+// The statuses of a job.
+const (
+	jobPending  = "pending"
+	jobRunning  = "running"
+	jobDone     = "done"
+	jobCanceled = "canceled"
+)
+
+// serveCommand serves the HTTP API until it is interrupted.
+func (a *App) serveCommand(c *cli.Context) error {
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if a.config.Token == "" && !isLoopback(a.config.Listen) {
+		a.logger.Warn(
+			"The API is served without authentication on a non-loopback address, anyone reaching it can use it. "+
+				"Require a token with --token.",
+			"address", a.config.Listen,
+		)
+	}
+
+	api := newAPIServer(ctx, a.service, a.logger, a.config.Token)
+	server := &http.Server{
+		Addr:              a.config.Listen,
+		Handler:           api.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.ListenAndServe()
+	}()
+	a.logger.Info("Server started.", "address", a.config.Listen)
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	// The jobs in flight are canceled along with the context, they are over before the database is closed.
+	api.Wait()
+	a.logger.Info("Server stopped.")
+	if err != nil {
+		return fmt.Errorf("shutdown server: %w", err)
+	}
+	return nil
+}
+
+// apiServer exposes the Service over HTTP: it fetches the sites of the submitted jobs, and serves the metadata
+// and the content of the fetched pages.
+type apiServer struct {
+	// ctx is the context of the asynchronous jobs, they are canceled once it is done.
+	ctx     context.Context
+	service *service.Service
+	logger  *slog.Logger
+	// token is the bearer token the requests must hold, the API is open when it is empty.
+	token   string
+	running chan struct{}
+	wg      sync.WaitGroup
+	// maxPending and retention are maxPendingJobs and finishedJobRetention, unless changed by the tests.
+	maxPending int
+	retention  time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	pending int
+	// finished lists the finished jobs, from the oldest to the newest.
+	finished []finishedJob
+}
+
+// finishedJob is a job which is over, it is forgotten once the retention is elapsed.
+type finishedJob struct {
+	id       string
+	finished time.Time
+}
+
+// newAPIServer instantiates a new apiServer, its asynchronous jobs are canceled once the context is done.
+// The requests must hold the bearer token, unless it is empty.
+func newAPIServer(ctx context.Context, svc *service.Service, logger *slog.Logger, token string) *apiServer {
+	return &apiServer{
+		ctx:        ctx,
+		service:    svc,
+		logger:     logger,
+		token:      token,
+		running:    make(chan struct{}, maxRunningJobs),
+		maxPending: maxPendingJobs,
+		retention:  finishedJobRetention,
+		now:        time.Now,
+		jobs:       make(map[string]*job),
+	}
+}
+
+// Handler returns the http.Handler serving the API.
+func (s *apiServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("POST /v1/jobs", s.submitJob)
+	mux.HandleFunc("GET /v1/jobs/{id}", s.getJob)
+	mux.HandleFunc("GET /v1/metadata", s.getMetaData)
+	mux.HandleFunc("GET /v1/content", s.getContent)
+	if s.token == "" {
+		return mux
+	}
+	return s.authenticate(mux)
+}
+
+// authenticate answers 401 to the requests which do not hold the bearer token, except the health checks.
+func (s *apiServer) authenticate(next http.Handler) http.Handler {
+	expected := []byte("Bearer " + s.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isLoopback reports whether the address only listens on the loopback interface.
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Wait waits for the jobs in flight to be over.
+func (s *apiServer) Wait() {
+	s.wg.Wait()
+}
+
+// jobRequest is the schema of the body submitting a job, listing the sites to fetch either as URLs or as
+// inputRecord, as the lines of the --input file.
+type jobRequest struct {
+	Sites    []string      `json:"sites"`
+	Requests []inputRecord `json:"requests"`
+	// Async makes the job run in the background, the response only holds its id.
+	Async bool `json:"async"`
+}
+
+// job fetches a list of sites, its results are recorded as they are fetched.
+type job struct {
+	mu       sync.Mutex
+	id       string
+	status   string
+	created  time.Time
+	finished time.Time
+	requests []service.SiteRequest
+	results  []record
+	failed   int
+}
+
+// jobView is the JSON representation of a job.
+type jobView struct {
+	ID       string     `json:"id"`
+	Status   string     `json:"status"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+	Sites    int        `json:"sites"`
+	Fetched  int        `json:"fetched"`
+	Failed   int        `json:"failed"`
+	Results  []record   `json:"results"`
+}
+
+// view returns the JSON representation of the job.
+func (j *job) view() jobView {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	v := jobView{
+		ID:      j.id,
+		Status:  j.status,
+		Created: j.created,
+		Sites:   len(j.requests),
+		Fetched: len(j.results) - j.failed,
+		Failed:  j.failed,
+		Results: append([]record{}, j.results...),
+	}
+	if !j.finished.IsZero() {
+		finished := j.finished
+		v.Finished = &finished
+	}
+	return v
+}
+
+// submitJob creates a job fetching the sites of the jobRequest. An asynchronous job is answered right away
+// with its id, the response of a synchronous job holds its results.
+func (s *apiServer) submitJob(w http.ResponseWriter, r *http.Request) {
+	var body jobRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJobRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("decode job: %w", err))
+		return
+	}
+
+	requests := make([]service.SiteRequest, 0, len(body.Sites)+len(body.Requests))
+	for _, site := range body.Sites {
+		requests = append(requests, service.SiteRequest{Site: site})
+	}
+	for i, input := range body.Requests {
+		request, err := input.siteRequest()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("request %d: %w", i, err))
+			return
+		}
+		requests = append(requests, request)
+	}
+	if len(requests) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("no site to fetch"))
+		return
+	}
+
+	j, err := s.newJob(requests)
+	if errors.Is(err, errTooManyJobs) {
+		w.Header().Set("Retry-After", "60")
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if body.Async {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.run(s.ctx, j)
+		}()
+		w.Header().Set("Location", "/v1/jobs/"+j.id)
+		writeJSON(w, http.StatusAccepted, j.view())
+		return
+	}
+
+	// A synchronous job is canceled when the client goes away, or when the server stops.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	stop := context.AfterFunc(s.ctx, cancel)
+	defer stop()
+	s.wg.Add(1)
+	defer s.wg.Done()
+	s.run(ctx, j)
+	writeJSON(w, http.StatusOK, j.view())
+}
+
+// newJob registers a pending job fetching the requests. It returns errTooManyJobs once maxPending jobs
+// are pending.
+func (s *apiServer) newJob(requests []service.SiteRequest) (*job, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("generate job id: %w", err)
+	}
+
+	j := &job{
+		id:       hex.EncodeToString(id),
+		status:   jobPending,
+		created:  s.now().UTC(),
+		requests: requests,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evict()
+	if s.pending >= s.maxPending {
+		return nil, errTooManyJobs
+	}
+	s.pending++
+	s.jobs[j.id] = j
+	return j, nil
+}
+
+// start marks the pending job as running.
+func (s *apiServer) start(j *job) {
+	j.mu.Lock()
+	j.status = jobRunning
+	j.mu.Unlock()
+
+	s.mu.Lock()
+	s.pending--
+	s.mu.Unlock()
+}
+
+// run fetches the sites of the job once fewer than maxRunningJobs jobs are running, and records their results.
+func (s *apiServer) run(ctx context.Context, j *job) {
+	defer s.finish(j)
+
+	select {
+	case <-ctx.Done():
+		return
+	case s.running <- struct{}{}:
+	}
+	defer func() {
+		<-s.running
+	}()
+
+	s.start(j)
+
+	requests := make(chan service.SiteRequest, len(j.requests))
+	for _, request := range j.requests {
+		requests <- request
+	}
+	close(requests)
+
+	for result := range s.service.FetchStream(ctx, requests) {
+		j.mu.Lock()
+		j.results = append(j.results, newFetchRecord(result))
+		if result.Err != nil {
+			j.failed++
+		}
+		j.mu.Unlock()
+	}
+	s.logger.Info("Job done.", "job", j.id, "sites", len(j.requests))
+}
+
+// finish marks the job as done, or as canceled when its sites were not all fetched, and forgets the oldest
+// finished jobs.
+func (s *apiServer) finish(j *job) {
+	j.mu.Lock()
+	wasPending := j.status == jobPending
+	j.status = jobDone
+	if len(j.results) < len(j.requests) {
+		j.status = jobCanceled
+	}
+	j.finished = s.now().UTC()
+	finished := j.finished
+	j.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if wasPending {
+		// The job was canceled before it started.
+		s.pending--
+	}
+	s.finished = append(s.finished, finishedJob{id: j.id, finished: finished})
+	s.evict()
+}
+
+// evict forgets the finished jobs kept for longer than the retention, and the oldest ones beyond
+// maxFinishedJobs. It must be called with the lock held.
+func (s *apiServer) evict() {
+	expired := s.now().Add(-s.retention)
+	for len(s.finished) > 0 && (len(s.finished) > maxFinishedJobs || s.finished[0].finished.Before(expired)) {
+		delete(s.jobs, s.finished[0].id)
+		s.finished = s.finished[1:]
+	}
+}
+
+// getJob answers the status and the results of a job.
+func (s *apiServer) getJob(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.evict()
+	j, ok := s.jobs[r.PathValue("id")]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("job %s not found", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, http.StatusOK, j.view())
+}
+
+// getMetaData answers a record for each of the metadata of the sites given by the site query parameters,
+// every past fetch when the history query parameter is true.
+func (s *apiServer) getMetaData(w http.ResponseWriter, r *http.Request) {
+	sites := r.URL.Query()["site"]
+	if err := validateSites(sites...); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	get := s.service.GetMetaDataForSites
+	if r.URL.Query().Get("history") == "true" {
+		get = s.service.GetHistoryForSites
+	}
+	items, err := get(r.Context(), sites...)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	records, err := metaDataRecords(r.Context(), s.service, sites, items)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, records)
+}
+
+// getContent answers the content of the last saved page of the site given by the site query parameter,
+// decompressed and with its media type. The page is served by a third party, it is sandboxed so its scripts
+// do not run with the origin of the API.
+func (s *apiServer) getContent(w http.ResponseWriter, r *http.Request) {
+	site := r.URL.Query().Get("site")
+	if err := validateSites(site); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := s.service.OpenPage(r.Context(), site)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	defer page.Close()
+
+	contentType := domain.MediaTypeUnknown
+	if items, err := s.service.GetMetaDataForSites(r.Context(), site); err == nil && len(items) > 0 {
+		contentType = items[0].ContentType
+		if contentType == "" {
+			contentType = domain.MediaTypeHTML
+		}
+		if items[0].Charset != "" {
+			contentType += "; charset=" + items[0].Charset
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	if _, err := io.Copy(w, page); err != nil {
+		s.logger.Warn("Failed to send the page.", "site", site, "error", err)
+	}
+}
+
+// validateSites returns an error if a site is missing or is not an absolute URL.
+func validateSites(sites ...string) error {
+	if len(sites) == 0 || (len(sites) == 1 && sites[0] == "") {
+		return errors.New("missing site query parameter")
+	}
+	for _, site := range sites {
+		if _, err := domain.NewPageID(site); err != nil {
+			return fmt.Errorf("invalid site %s: %w", site, err)
+		}
+	}
+	return nil
+}
+
+// statusOf returns the HTTP status of the errors of the Service.
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, service.ErrSnapshotNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeJSON answers the value encoded in JSON with the given status.
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+// writeError answers the error in JSON with the given status.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/fetcher"
+	"github.com/gsiffert/fetch/internal/memory"
+	"github.com/gsiffert/fetch/internal/service"
+	"github.com/gsiffert/fetch/internal/sqlite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestAPI returns the API fetching the pages of an origin server, which serves an HTML page on / and fails
+// on any other path.
+func newTestAPI(t *testing.T) (api *httptest.Server, origin *httptest.Server) {
+	t.Helper()
+
+	origin = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = io.WriteString(w, "<html><head><title>Origin</title></head><body>Hello</body></html>")
+	}))
+	t.Cleanup(origin.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	repo, err := sqlite.NewMetaDataRepo(ctx, "file:"+t.Name()+"?cache=shared&mode=memory")
+	require.NoError(t, err)
+	svc := service.New(fetcher.New(origin.Client()), memory.New(), slog.Default(), repo)
+	server := newAPIServer(ctx, svc, slog.Default(), "")
+	api = httptest.NewServer(server.Handler())
+	t.Cleanup(func() {
+		api.Close()
+		cancel()
+		server.Wait()
+		_ = repo.Close()
+	})
+	return api, origin
+}
+
+// do sends the request to the API and decodes its JSON response into the value, it returns the status.
+func do(t *testing.T, method string, u string, body string, value any) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, u, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if value != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(value))
+	}
+	return resp.StatusCode
+}
+
+func TestAPIServer_Jobs(t *testing.T) {
+	t.Parallel()
+
+	api, origin := newTestAPI(t)
+
+	var sync jobView
+	status := do(t, http.MethodPost, api.URL+"/v1/jobs", `{"sites": ["`+origin.URL+`", "`+origin.URL+`/missing"]}`, &sync)
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, jobDone, sync.Status)
+	assert.Equal(t, 2, sync.Sites)
+	assert.Equal(t, 1, sync.Fetched)
+	assert.Equal(t, 1, sync.Failed)
+	if assert.Len(t, sync.Results, 2) {
+		byStatus := map[string]record{}
+		for _, r := range sync.Results {
+			byStatus[r.Status] = r
+		}
+		assert.Equal(t, "Origin", byStatus[string(service.FetchStatusFetched)].Title)
+		assert.Contains(t, byStatus[string(service.FetchStatusFailed)].Error, "404")
+	}
+
+	var async jobView
+	body := `{"requests": [{"url": "` + origin.URL + `", "method": "get"}], "async": true}`
+	status = do(t, http.MethodPost, api.URL+"/v1/jobs", body, &async)
+	require.Equal(t, http.StatusAccepted, status)
+	require.NotEmpty(t, async.ID)
+	assert.Eventually(t, func() bool {
+		var job jobView
+		status := do(t, http.MethodGet, api.URL+"/v1/jobs/"+async.ID, "", &job)
+		return status == http.StatusOK && job.Status == jobDone && job.Fetched == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	var failure map[string]string
+	assert.Equal(t, http.StatusNotFound, do(t, http.MethodGet, api.URL+"/v1/jobs/unknown", "", &failure))
+	assert.Equal(t, http.StatusBadRequest, do(t, http.MethodPost, api.URL+"/v1/jobs", `{"sites": []}`, &failure))
+	assert.Equal(t, http.StatusBadRequest, do(t, http.MethodPost, api.URL+"/v1/jobs", `{"urls": []}`, &failure))
+	assert.Equal(t, http.StatusBadRequest, do(t, http.MethodPost, api.URL+"/v1/jobs", `{"requests": [{"method": "GET"}]}`, &failure))
+}
+
+func TestAPIServer_JobLimits(t *testing.T) {
+	t.Parallel()
+
+	// The sites are fetched once released, so the jobs stay running meanwhile.
+	release := make(chan struct{})
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = io.WriteString(w, "<html><body>Hello</body></html>")
+	}))
+	defer origin.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	repo, err := sqlite.NewMetaDataRepo(ctx, "file:"+t.Name()+"?cache=shared&mode=memory")
+	require.NoError(t, err)
+	svc := service.New(fetcher.New(origin.Client()), memory.New(), slog.Default(), repo)
+	server := newAPIServer(ctx, svc, slog.Default(), "")
+	server.maxPending = 1
+	var elapsed atomic.Int64
+	started := time.Now()
+	server.now = func() time.Time { return started.Add(time.Duration(elapsed.Load())) }
+	api := httptest.NewServer(server.Handler())
+	defer func() {
+		api.Close()
+		cancel()
+		server.Wait()
+		_ = repo.Close()
+	}()
+
+	submit := func() (jobView, int) {
+		var job jobView
+		status := do(t, http.MethodPost, api.URL+"/v1/jobs", `{"sites": ["`+origin.URL+`"], "async": true}`, &job)
+		return job, status
+	}
+	statusOf := func(id string) string {
+		var job jobView
+		if do(t, http.MethodGet, api.URL+"/v1/jobs/"+id, "", &job) != http.StatusOK {
+			return ""
+		}
+		return job.Status
+	}
+
+	var jobs []jobView
+	for range maxRunningJobs {
+		job, status := submit()
+		require.Equal(t, http.StatusAccepted, status)
+		require.Eventually(t, func() bool { return statusOf(job.ID) == jobRunning }, 5*time.Second, 10*time.Millisecond)
+		jobs = append(jobs, job)
+	}
+	// A single job waits for the running ones, the next one is rejected.
+	job, status := submit()
+	require.Equal(t, http.StatusAccepted, status)
+	assert.Equal(t, jobPending, job.Status)
+	jobs = append(jobs, job)
+	_, status = submit()
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+
+	close(release)
+	for _, job := range jobs {
+		assert.Eventually(t, func() bool { return statusOf(job.ID) == jobDone }, 5*time.Second, 10*time.Millisecond)
+	}
+
+	// The finished jobs are forgotten once the retention is elapsed.
+	elapsed.Store(int64(finishedJobRetention + time.Minute))
+	var failure map[string]string
+	assert.Equal(t, http.StatusNotFound, do(t, http.MethodGet, api.URL+"/v1/jobs/"+jobs[0].ID, "", &failure))
+	_, status = submit()
+	assert.Equal(t, http.StatusAccepted, status)
+}
+
+func TestAPIServer_Pages(t *testing.T) {
+	t.Parallel()
+
+	api, origin := newTestAPI(t)
+	require.Equal(t, http.StatusOK, do(t, http.MethodPost, api.URL+"/v1/jobs", `{"sites": ["`+origin.URL+`"]}`, nil))
+
+	var records []record
+	status := do(t, http.MethodGet, api.URL+"/v1/metadata?site="+origin.URL+"&site="+origin.URL+"/missing", "", &records)
+	require.Equal(t, http.StatusOK, status)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, statusFound, records[0].Status)
+		assert.Equal(t, "Origin", records[0].Title)
+		assert.Equal(t, "utf-8", records[0].Charset)
+		assert.Equal(t, statusNotFound, records[1].Status)
+	}
+
+	resp, err := http.Get(api.URL + "/v1/content?site=" + origin.URL)
+	require.NoError(t, err)
+	content, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "sandbox", resp.Header.Get("Content-Security-Policy"))
+	assert.Equal(t, "<html><head><title>Origin</title></head><body>Hello</body></html>", string(content))
+
+	var failure map[string]string
+	assert.Equal(t, http.StatusNotFound, do(t, http.MethodGet, api.URL+"/v1/content?site="+origin.URL+"/missing", "", &failure))
+	assert.Equal(t, http.StatusBadRequest, do(t, http.MethodGet, api.URL+"/v1/content?site=missing", "", &failure))
+	assert.Equal(t, http.StatusBadRequest, do(t, http.MethodGet, api.URL+"/v1/metadata", "", &failure))
+}
+
+func TestAPIServer_Token(t *testing.T) {
+	t.Parallel()
+
+	server := newAPIServer(context.Background(), nil, slog.Default(), "secret")
+	api := httptest.NewServer(server.Handler())
+	defer api.Close()
+
+	get := func(path string, authorization string) int {
+		req, err := http.NewRequest(http.MethodGet, api.URL+path, nil)
+		require.NoError(t, err)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, get("/healthz", ""))
+	assert.Equal(t, http.StatusUnauthorized, get("/v1/jobs/unknown", ""))
+	assert.Equal(t, http.StatusUnauthorized, get("/v1/jobs/unknown", "Bearer other"))
+	assert.Equal(t, http.StatusNotFound, get("/v1/jobs/unknown", "Bearer secret"))
+}
+
+func TestIsLoopback(t *testing.T) {
+	t.Parallel()
+
+	for address, expected := range map[string]bool{
+		"127.0.0.1:8080": true,
+		"localhost:8080": true,
+		"[::1]:8080":     true,
+		":8080":          false,
+		"0.0.0.0:8080":   false,
+		"10.0.0.1:8080":  false,
+	} {
+		assert.Equal(t, expected, isLoopback(address), address)
+	}
+}
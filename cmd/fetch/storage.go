@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/archive"
+	"github.com/gsiffert/fetch/internal/disk"
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/gsiffert/fetch/internal/memory"
+	"github.com/gsiffert/fetch/internal/s3"
+	"github.com/gsiffert/fetch/internal/service"
+	"github.com/gsiffert/fetch/internal/warc"
+)
+
+const (
+	// defaultS3Region is the region of the object store when neither the URI nor the environment sets it.
+	defaultS3Region = "us-east-1"
+)
+
+// newStorage returns the service.Disk storing the pages at the given URI, the download path is used when
+// the URI is empty. The storage must be closed once the run is done when it implements io.Closer.
+//
+// The URI is one of:
+//   - a path, or file://<path>, to store the pages in a local directory;
+//   - s3://<bucket>/<prefix>, to store the pages in an S3-compatible object store;
+//   - tar://<path> or zip://<path>, to store the pages in a single archive, named after the run when the
+//     path is a directory;
+//   - warc://<path>, to store the fetches in a single WARC file, named after the run when the path is a
+//     directory, compressed when its name ends with ".gz";
+//   - memory://, to keep the pages in memory for the duration of the run.
+//
+// The pages are only compressed in a local directory, the other storages fail with a compression. The S3 storage
+// sends its requests with the given http.Client.
+func newStorage(uri string, downloadPath string, compression domain.Compression, httpClient *http.Client) (service.Disk, error) {
+	if uri == "" {
+		return disk.New(downloadPath, disk.WithCompression(compression)), nil
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" || len(u.Scheme) == 1 {
+		// A path, including a Windows path starting with a drive letter.
+		return disk.New(uri, disk.WithCompression(compression)), nil
+	}
+
+	localPath := u.Host + u.Path
+	if u.Scheme != "file" && compression != domain.CompressionNone {
+		return nil, fmt.Errorf("compression is not supported by the %s storage", u.Scheme)
+	}
+	switch u.Scheme {
+	case "file":
+		return disk.New(localPath, disk.WithCompression(compression)), nil
+	case "memory":
+		return memory.New(), nil
+	case "s3":
+		config, err := parseS3Config(u)
+		if err != nil {
+			return nil, fmt.Errorf("parse s3 storage: %w", err)
+		}
+		client, err := s3.New(httpClient, config)
+		if err != nil {
+			return nil, fmt.Errorf("new s3 storage: %w", err)
+		}
+		return client, nil
+	case string(archive.FormatTar), string(archive.FormatZip):
+		format := archive.Format(u.Scheme)
+		if isDir(localPath) {
+			localPath = filepath.Join(localPath, archiveName("."+string(format), time.Now()))
+		}
+		client, err := archive.New(localPath, format)
+		if err != nil {
+			return nil, fmt.Errorf("new archive storage: %w", err)
+		}
+		return client, nil
+	case "warc":
+		if isDir(localPath) {
+			localPath = filepath.Join(localPath, archiveName(".warc"+warc.CompressedExtension, time.Now()))
+		}
+		client, err := warc.New(localPath)
+		if err != nil {
+			return nil, fmt.Errorf("new warc storage: %w", err)
+		}
+		return client, nil
+	default:
+		return nil, fmt.Errorf("unknown storage scheme %q", u.Scheme)
+	}
+}
+
+// archiveName returns the name, with the given extension, of the archive of a run started at the given time.
+func archiveName(ext string, start time.Time) string {
+	return fmt.Sprintf("fetch-%s%s", start.UTC().Format("20060102T150405Z"), ext)
+}
+
+func isDir(localPath string) bool {
+	info, err := os.Stat(localPath)
+	return err == nil && info.IsDir()
+}
+
+// parseS3Config returns the configuration of the object store of an s3://<bucket>/<prefix> URI.
+// The endpoint, the region and the addressing of the bucket are set by the endpoint, region and
+// path-style query parameters, or by the AWS_ENDPOINT_URL and AWS_REGION environment variables.
+// The credentials are read from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+// environment variables.
+func parseS3Config(u *url.URL) (s3.Config, error) {
+	query := u.Query()
+	config := s3.Config{
+		Endpoint: firstNonEmpty(query.Get("endpoint"), os.Getenv("AWS_ENDPOINT_URL")),
+		Region:   firstNonEmpty(query.Get("region"), os.Getenv("AWS_REGION"), defaultS3Region),
+		Bucket:   u.Host,
+		Prefix:   strings.Trim(u.Path, "/"),
+		Credentials: s3.Credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		},
+	}
+
+	// The S3-compatible stores running on a custom endpoint, such as MinIO, expect the path style.
+	config.PathStyle = config.Endpoint != ""
+	if pathStyle := query.Get("path-style"); pathStyle != "" {
+		var err error
+		if config.PathStyle, err = strconv.ParseBool(pathStyle); err != nil {
+			return s3.Config{}, fmt.Errorf("parse path-style: %w", err)
+		}
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	return config, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/archive"
+	"github.com/gsiffert/fetch/internal/disk"
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/gsiffert/fetch/internal/memory"
+	"github.com/gsiffert/fetch/internal/s3"
+	"github.com/gsiffert/fetch/internal/service"
+	"github.com/gsiffert/fetch/internal/warc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewStorage(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	tests := []struct {
+		name        string
+		uri         string
+		compression domain.Compression
+		expected    service.Disk
+		location    string
+		assertErr   assert.ErrorAssertionFunc
+	}{
+		{
+			name:      "download path",
+			uri:       "",
+			expected:  &disk.Client{},
+			location:  filepath.Join("downloads", "page.html"),
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "directory",
+			uri:       dir,
+			expected:  &disk.Client{},
+			location:  filepath.Join(dir, "page.html"),
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "file",
+			uri:       "file://" + dir,
+			expected:  &disk.Client{},
+			location:  filepath.Join(dir, "page.html"),
+			assertErr: assert.NoError,
+		},
+		{
+			name:        "compressed directory",
+			uri:         dir,
+			compression: domain.CompressionGzip,
+			expected:    &disk.Client{},
+			location:    filepath.Join(dir, "page.html.gz"),
+			assertErr:   assert.NoError,
+		},
+		{
+			name:        "compressed memory",
+			uri:         "memory://",
+			compression: domain.CompressionGzip,
+			assertErr:   assert.Error,
+		},
+		{
+			name:      "memory",
+			uri:       "memory://",
+			expected:  &memory.Client{},
+			location:  "page.html",
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "s3",
+			uri:       "s3://bucket/prefix",
+			expected:  &s3.Client{},
+			location:  "s3://bucket/prefix/page.html",
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "tar",
+			uri:       "tar://" + filepath.Join(dir, "run.tar"),
+			expected:  &archive.Client{},
+			location:  filepath.Join(dir, "run.tar", "page.html"),
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "warc",
+			uri:       "warc://" + filepath.Join(dir, "run.warc.gz"),
+			expected:  &warc.Client{},
+			location:  filepath.Join(dir, "run.warc.gz"),
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "unknown scheme",
+			uri:       "ftp://example.com",
+			assertErr: assert.Error,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			storage, err := newStorage(test.uri, "downloads", test.compression, http.DefaultClient)
+			test.assertErr(t, err)
+			if test.expected == nil {
+				return
+			}
+			assert.IsType(t, test.expected, storage)
+			assert.Equal(t, test.location, storage.PageLocation("page.html"))
+			if closer, ok := storage.(io.Closer); ok {
+				require.NoError(t, closer.Close())
+			}
+		})
+	}
+}
+
+func TestNewStorage_ArchivePerRun(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	storage, err := newStorage("zip://"+dir, "", domain.CompressionNone, http.DefaultClient)
+	require.NoError(t, err)
+	require.NoError(t, storage.(io.Closer).Close())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Regexp(t, `^fetch-\d{8}T\d{6}Z\.zip$`, entries[0].Name())
+	assert.Equal(t, "fetch-20240317T144300Z.tar", archiveName(".tar", time.Date(2024, 3, 17, 14, 43, 0, 0, time.UTC)))
+}
+
+func TestParseS3Config(t *testing.T) {
+	tests := []struct {
+		name      string
+		uri       string
+		expected  s3.Config
+		assertErr assert.ErrorAssertionFunc
+	}{
+		{
+			name: "aws",
+			uri:  "s3://bucket/fetch/pages/",
+			expected: s3.Config{
+				Endpoint: "https://s3.eu-west-1.amazonaws.com",
+				Region:   "eu-west-1",
+				Bucket:   "bucket",
+				Prefix:   "fetch/pages",
+			},
+			assertErr: assert.NoError,
+		},
+		{
+			name: "custom endpoint",
+			uri:  "s3://bucket?endpoint=http://localhost:9000&region=local",
+			expected: s3.Config{
+				Endpoint:  "http://localhost:9000",
+				Region:    "local",
+				Bucket:    "bucket",
+				PathStyle: true,
+			},
+			assertErr: assert.NoError,
+		},
+		{
+			name: "virtual host on a custom endpoint",
+			uri:  "s3://bucket?endpoint=https://storage.example.com&path-style=false",
+			expected: s3.Config{
+				Endpoint: "https://storage.example.com",
+				Region:   "eu-west-1",
+				Bucket:   "bucket",
+			},
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "invalid path style",
+			uri:       "s3://bucket?path-style=maybe",
+			assertErr: assert.Error,
+		},
+	}
+
+	// The environment is shared, so the tests are not run in parallel.
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			u, err := url.Parse(test.uri)
+			require.NoError(t, err)
+
+			config, err := parseS3Config(u)
+			test.assertErr(t, err)
+			assert.Equal(t, test.expected, config)
+		})
+	}
+}
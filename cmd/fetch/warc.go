@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/gsiffert/fetch/internal/warc"
+)
+
+// readWARCCommand lists the records of the WARC file, and extracts their payloads when an extract directory
+// is given.
+func (a *App) readWARCCommand(_ context.Context, sites []string) error {
+	naming, err := domain.ParseFileNaming(a.config.Naming)
+	if err != nil {
+		return fmt.Errorf("parse file naming: %w", err)
+	}
+
+	file, err := os.Open(a.config.ReadWARC)
+	if err != nil {
+		return fmt.Errorf("open warc file: %w", err)
+	}
+	defer file.Close()
+
+	return readWARC(file, os.Stdout, sites, a.config.Extract, naming)
+}
+
+// readWARC prints a line for each record of the WARC file, only for the records of the given sites when set.
+// When the extract directory is set, the payloads of the responses are written to the files named by the
+// FileNaming, and the assets to their own name.
+func readWARC(r io.Reader, out io.Writer, sites []string, extract string, naming domain.FileNaming) error {
+	reader, err := warc.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("new warc reader: %w", err)
+	}
+
+	wanted := make(map[domain.PageID]bool, len(sites))
+	for _, site := range sites {
+		id, err := domain.NewPageID(site)
+		if err != nil {
+			return fmt.Errorf("invalid site %s: %w", site, err)
+		}
+		wanted[id] = true
+	}
+
+	writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(writer, "TYPE\tDATE\tTARGET\tLENGTH\tFILE")
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read record: %w", err)
+		}
+
+		target := record.TargetURI()
+		if len(wanted) > 0 {
+			id, err := domain.NewPageID(target)
+			if err != nil || !wanted[id] {
+				continue
+			}
+		}
+
+		var file string
+		if extract != "" {
+			if file, err = extractRecord(record, extract, naming); err != nil {
+				return fmt.Errorf("extract %s: %w", target, err)
+			}
+		}
+		length, _ := record.ContentLength()
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%s\n", record.Type(), record.Header.Get(warc.FieldDate), target, length, file)
+	}
+
+	return writer.Flush()
+}
+
+// extractRecord writes the payload of the response and resource records to the extract directory, and returns
+// the path of the written file. The other records are not extracted.
+func extractRecord(record *warc.Record, extract string, naming domain.FileNaming) (string, error) {
+	var (
+		name    string
+		payload io.Reader
+	)
+	switch record.Type() {
+	case warc.TypeResponse:
+		u, err := url.Parse(record.TargetURI())
+		if err != nil {
+			return "", fmt.Errorf("parse target: %w", err)
+		}
+		resp, err := record.Response()
+		if err != nil {
+			return "", err
+		}
+		// The page is extracted with the extension of its media type.
+		name = naming.FileLocation(u) + domain.Extension(domain.ParseMediaType(resp.Header.Get("Content-Type")))
+		payload = resp.Body
+	case warc.TypeResource:
+		var ok bool
+		name, ok = strings.CutPrefix(record.TargetURI(), warc.AssetURIPrefix)
+		// The name is joined to the extract directory, it must not escape it.
+		if !ok || !filepath.IsLocal(name) {
+			return "", nil
+		}
+		var err error
+		if payload, err = record.Payload(); err != nil {
+			return "", err
+		}
+	default:
+		return "", nil
+	}
+
+	filePath := filepath.Join(extract, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return "", fmt.Errorf("create directory: %w", err)
+	}
+	file, err := os.Create(filePath)
+	if err != nil {
+		return "", fmt.Errorf("create file: %w", err)
+	}
+	if _, err := io.Copy(file, payload); err != nil {
+		_ = file.Close()
+		return "", fmt.Errorf("write file: %w", err)
+	}
+	return filePath, file.Close()
+}
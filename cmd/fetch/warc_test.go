@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/gsiffert/fetch/internal/service"
+	"github.com/gsiffert/fetch/internal/warc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadWARC(t *testing.T) {
+	t.Parallel()
+
+	warcPath := filepath.Join(t.TempDir(), "run.warc.gz")
+	client, err := warc.New(warcPath)
+	require.NoError(t, err)
+	ctx := context.Background()
+	// The pages are extracted with the extension of their media type.
+	extensions := map[string]string{"https://www.google.com/": ".html", "https://www.google.com/about": ".txt"}
+	contentTypes := map[string]string{"https://www.google.com/": "text/html; charset=utf-8", "https://www.google.com/about": "text/plain"}
+	for _, site := range []string{"https://www.google.com/", "https://www.google.com/about"} {
+		writer, err := client.NewPageWriter(ctx, "page", service.Exchange{
+			Method:         http.MethodGet,
+			URL:            site,
+			StatusCode:     http.StatusOK,
+			ResponseHeader: http.Header{"Content-Type": []string{contentTypes[site]}},
+			Started:        time.Date(2024, 3, 17, 14, 43, 0, 0, time.UTC),
+		})
+		require.NoError(t, err)
+		_, err = fmt.Fprintf(writer, "<html>%s</html>", site)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		require.NoError(t, writer.Commit())
+	}
+	require.NoError(t, client.Close())
+
+	tests := []struct {
+		name      string
+		sites     []string
+		extract   bool
+		expected  []string
+		extracted map[string]string
+	}{
+		{
+			name:     "list",
+			expected: []string{"warcinfo", "request", "response", "metadata", "request", "response", "metadata"},
+		},
+		{
+			name:     "list the records of a site",
+			sites:    []string{"https://WWW.google.com/about"},
+			expected: []string{"request", "response", "metadata"},
+		},
+		{
+			name:     "extract",
+			sites:    []string{"https://www.google.com", "https://www.google.com/about"},
+			extract:  true,
+			expected: []string{"request", "response", "metadata", "request", "response", "metadata"},
+			extracted: map[string]string{
+				"https://www.google.com/":      "<html>https://www.google.com/</html>",
+				"https://www.google.com/about": "<html>https://www.google.com/about</html>",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			file, err := os.Open(warcPath)
+			require.NoError(t, err)
+			defer file.Close()
+
+			var extract string
+			if test.extract {
+				extract = t.TempDir()
+			}
+			var out bytes.Buffer
+			require.NoError(t, readWARC(file, &out, test.sites, extract, domain.NamingFlat))
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			var types []string
+			for _, line := range lines[1:] {
+				types = append(types, strings.Fields(line)[0])
+			}
+			assert.Equal(t, test.expected, types)
+
+			for site, expected := range test.extracted {
+				u, err := url.Parse(site)
+				require.NoError(t, err)
+				content, err := os.ReadFile(filepath.Join(extract, domain.NamingFlat.FileLocation(u)+extensions[site]))
+				require.NoError(t, err)
+				assert.Equal(t, expected, string(content))
+			}
+		})
+	}
+}
@@ -3,12 +3,15 @@ module github.com/gsiffert/fetch
 go 1.22.0
 
 require (
-	github.com/eapache/go-resiliency v1.6.0
+	github.com/andybalholm/brotli v1.2.0
 	github.com/jmoiron/sqlx v1.3.5
+	github.com/klauspost/compress v1.18.0
 	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/stretchr/testify v1.9.0
 	github.com/urfave/cli/v2 v2.27.1
+	go.uber.org/mock v0.4.0
 	golang.org/x/net v0.22.0
+	golang.org/x/text v0.14.0
 )
 
 require (
@@ -17,6 +20,5 @@ require (
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
 	github.com/xrash/smetrics v0.0.0-20201216005158-039620a65673 // indirect
-	go.uber.org/mock v0.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,366 @@
+// Package archive is part of the infrastructure layer and it implements the service.Disk interface by appending
+// the content to a single tar or zip archive, which is complete once closed.
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/gsiffert/fetch/internal/service"
+)
+
+const (
+	// snapshotDirectory is the directory, in the archive, holding the snapshots of the pages.
+	snapshotDirectory = "snapshots"
+)
+
+// ErrRestoreNotSupported is returned when restoring a snapshot, as the archive is written once.
+var ErrRestoreNotSupported = errors.New("restore is not supported by archives")
+
+// ErrOpenNotSupported is returned when opening a snapshot, as the archive is only read once complete.
+var ErrOpenNotSupported = errors.New("opening a snapshot is not supported by archives")
+
+// Format of the archive.
+type Format string
+
+const (
+	// FormatTar writes a tar archive, a page is a hard link to its snapshot.
+	FormatTar Format = "tar"
+	// FormatZip writes a zip archive, a page is a copy of its snapshot.
+	FormatZip Format = "zip"
+)
+
+// Client of the archive package. The content is written to temporary files, and appended to the archive
+// once complete, so the entries of the concurrent fetches are never interleaved.
+type Client struct {
+	archivePath string
+	format      Format
+
+	mu   sync.Mutex
+	file *os.File
+	tar  *tar.Writer
+	zip  *zip.Writer
+	// snapshots holds the entries of the snapshots already in the archive.
+	snapshots map[string]bool
+}
+
+// New creates the archive at the given path, it must be closed to be complete.
+func New(archivePath string, format Format) (*Client, error) {
+	if format != FormatTar && format != FormatZip {
+		return nil, fmt.Errorf("unknown archive format %q", format)
+	}
+
+	file, err := os.Create(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("create archive: %w", err)
+	}
+
+	c := &Client{
+		archivePath: archivePath,
+		format:      format,
+		file:        file,
+		snapshots:   make(map[string]bool),
+	}
+	if format == FormatTar {
+		c.tar = tar.NewWriter(file)
+	} else {
+		c.zip = zip.NewWriter(file)
+	}
+	return c, nil
+}
+
+// NewPageWriter creates a new PageWriter for the given name.
+func (c *Client) NewPageWriter(_ context.Context, name string, _ service.Exchange) (service.PageWriter, error) {
+	file, err := os.CreateTemp("", "fetch-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+
+	hash := sha256.New()
+	return &PageWriter{
+		client: c,
+		name:   name,
+		file:   file,
+		hash:   hash,
+		writer: io.MultiWriter(file, hash),
+	}, nil
+}
+
+// NewAssetWriter creates a new entry for the given name, the entry is appended once the writer is closed.
+func (c *Client) NewAssetWriter(_ context.Context, name string) (service.AssetWriter, error) {
+	file, err := os.CreateTemp("", "fetch-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	return &assetWriter{client: c, name: name, file: file}, nil
+}
+
+// RestoreSnapshot is not supported, the entries of an archive are never replaced.
+func (c *Client) RestoreSnapshot(_ context.Context, _ string, _ domain.SnapshotID) error {
+	return ErrRestoreNotSupported
+}
+
+// OpenSnapshot is not supported, the archive is being written.
+func (c *Client) OpenSnapshot(_ context.Context, _ string, _ domain.SnapshotID, _ domain.Compression) (io.ReadCloser, error) {
+	return nil, ErrOpenNotSupported
+}
+
+// PageLocation returns the path of the entry holding the page of the given name, below the path of the archive.
+func (c *Client) PageLocation(name string) string {
+	return path.Join(c.archivePath, name)
+}
+
+// HasPage reports false, every archive is a new file which holds none of the pages stored before.
+func (c *Client) HasPage(_ context.Context, _ string) (bool, error) {
+	return false, nil
+}
+
+// SaveNotModified does nothing, the pages are never requested conditionally as the archive holds none of them.
+func (c *Client) SaveNotModified(_ context.Context, _ string, _ service.Exchange, _ time.Time) error {
+	return nil
+}
+
+// Close completes the archive.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	if c.tar != nil {
+		err = c.tar.Close()
+	} else {
+		err = c.zip.Close()
+	}
+	if err != nil {
+		_ = c.file.Close()
+		return fmt.Errorf("close archive: %w", err)
+	}
+	return c.file.Close()
+}
+
+// appendFile appends the content of the file as an entry of the given name.
+func (c *Client) appendFile(name string, file *os.File) error {
+	size, err := rewind(file)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.appendEntry(name, file, size)
+}
+
+func (c *Client) appendEntry(name string, content io.Reader, size int64) error {
+	now := time.Now()
+	var writer io.Writer
+	if c.tar != nil {
+		header := &tar.Header{Typeflag: tar.TypeReg, Name: name, Size: size, Mode: 0o644, ModTime: now}
+		if err := c.tar.WriteHeader(header); err != nil {
+			return fmt.Errorf("write header: %w", err)
+		}
+		writer = c.tar
+	} else {
+		var err error
+		writer, err = c.zip.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return fmt.Errorf("create entry: %w", err)
+		}
+	}
+
+	if _, err := io.CopyN(writer, content, size); err != nil {
+		return fmt.Errorf("write entry: %w", err)
+	}
+	return nil
+}
+
+// appendSnapshot appends the content of the file as the entry of the snapshot of the page of the given name,
+// unless the snapshot is already in the archive.
+func (c *Client) appendSnapshot(name string, snapshot domain.SnapshotID, file *os.File) error {
+	size, err := rewind(file)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := snapshotEntry(name, snapshot)
+	if c.snapshots[entry] {
+		return nil
+	}
+	if err := c.appendEntry(entry, file, size); err != nil {
+		return err
+	}
+	c.snapshots[entry] = true
+	return nil
+}
+
+// appendPage appends the entry of the page, a tar archive links it to the entry of the snapshot, the zip
+// archives do not support links so the content of the file is appended again.
+func (c *Client) appendPage(name string, snapshot domain.SnapshotID, file *os.File) error {
+	if c.tar == nil {
+		return c.appendFile(name, file)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	header := &tar.Header{
+		Typeflag: tar.TypeLink,
+		Name:     name,
+		Linkname: snapshotEntry(name, snapshot),
+		Mode:     0o644,
+		ModTime:  time.Now(),
+	}
+	if err := c.tar.WriteHeader(header); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	return nil
+}
+
+// rewind returns the size of the content written to the file, and seeks back to its start.
+func rewind(file *os.File) (int64, error) {
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, fmt.Errorf("size of file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("rewind file: %w", err)
+	}
+	return size, nil
+}
+
+// snapshotEntry returns the entry of the snapshot of the page of the given name, it has the extension of the page.
+func snapshotEntry(name string, snapshot domain.SnapshotID) string {
+	return path.Join(snapshotDirectory, string(snapshot)+path.Ext(name))
+}
+
+// PageWriter writes the content of a page to a temporary file. Once closed, the content is appended as an
+// immutable snapshot named after its hash, and once committed the page is appended as well.
+type PageWriter struct {
+	client   *Client
+	name     string
+	file     *os.File
+	hash     hash.Hash
+	writer   io.Writer
+	snapshot domain.SnapshotID
+	done     bool
+}
+
+// Write implements the io.Writer interface.
+func (w *PageWriter) Write(p []byte) (int, error) {
+	return w.writer.Write(p)
+}
+
+// Snapshot returns the ID of the snapshot holding the content of the page, it is set once the writer is closed.
+func (w *PageWriter) Snapshot() domain.SnapshotID {
+	return w.snapshot
+}
+
+// Compression returns domain.CompressionNone, the pages are stored as is in the archive.
+func (w *PageWriter) Compression() domain.Compression {
+	return domain.CompressionNone
+}
+
+// Close appends the content written so far as a snapshot, the page is only appended once the writer is
+// committed. If the snapshot is already in the archive, it is reused.
+func (w *PageWriter) Close() error {
+	if w.snapshot != "" || w.done {
+		return nil
+	}
+
+	snapshot := domain.SnapshotID(hex.EncodeToString(w.hash.Sum(nil)))
+	if err := w.client.appendSnapshot(w.name, snapshot, w.file); err != nil {
+		return fmt.Errorf("append snapshot: %w", err)
+	}
+	w.snapshot = snapshot
+	return nil
+}
+
+// Commit appends the page to the archive.
+func (w *PageWriter) Commit() error {
+	if w.snapshot == "" || w.done {
+		return errors.New("commit a page writer which is not closed")
+	}
+	defer w.removeFile()
+
+	if err := w.client.appendPage(w.name, w.snapshot, w.file); err != nil {
+		return fmt.Errorf("append page: %w", err)
+	}
+	return nil
+}
+
+// Discard removes the temporary file holding the content written so far, the page is not appended.
+func (w *PageWriter) Discard() error {
+	if w.done {
+		return nil
+	}
+	return w.removeFile()
+}
+
+func (w *PageWriter) removeFile() error {
+	w.done = true
+	closeErr := w.file.Close()
+	if err := os.Remove(w.file.Name()); err != nil {
+		return fmt.Errorf("remove temporary file: %w", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("close file: %w", closeErr)
+	}
+	return nil
+}
+
+// assetWriter writes the content of an asset to a temporary file, which is appended once closed.
+type assetWriter struct {
+	client *Client
+	name   string
+	file   *os.File
+	done   bool
+}
+
+// Write implements the io.Writer interface.
+func (w *assetWriter) Write(p []byte) (int, error) {
+	return w.file.Write(p)
+}
+
+// Close appends the asset to the archive.
+func (w *assetWriter) Close() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	defer os.Remove(w.file.Name())
+	defer w.file.Close()
+
+	if err := w.client.appendFile(w.name, w.file); err != nil {
+		return fmt.Errorf("append asset: %w", err)
+	}
+	return nil
+}
+
+// Discard removes the temporary file, the asset is not appended.
+func (w *assetWriter) Discard() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+
+	closeErr := w.file.Close()
+	if err := os.Remove(w.file.Name()); err != nil {
+		return fmt.Errorf("remove temporary file: %w", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("close file: %w", closeErr)
+	}
+	return nil
+}
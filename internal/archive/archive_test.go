@@ -0,0 +1,115 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/gsiffert/fetch/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readArchive returns the content of the entries of the archive by name, the links hold the name of their target.
+func readArchive(t *testing.T, archivePath string, format Format) map[string]string {
+	t.Helper()
+
+	entries := make(map[string]string)
+	if format == FormatZip {
+		reader, err := zip.OpenReader(archivePath)
+		require.NoError(t, err)
+		defer reader.Close()
+		for _, file := range reader.File {
+			rc, err := file.Open()
+			require.NoError(t, err)
+			content, err := io.ReadAll(rc)
+			require.NoError(t, err)
+			require.NoError(t, rc.Close())
+			entries[file.Name] = string(content)
+		}
+		return entries
+	}
+
+	file, err := os.Open(archivePath)
+	require.NoError(t, err)
+	defer file.Close()
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return entries
+		}
+		require.NoError(t, err)
+		if header.Typeflag == tar.TypeLink {
+			entries[header.Name] = "link:" + header.Linkname
+			continue
+		}
+		content, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		entries[header.Name] = string(content)
+	}
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range []Format{FormatTar, FormatZip} {
+		t.Run(string(format), func(t *testing.T) {
+			t.Parallel()
+
+			archivePath := filepath.Join(t.TempDir(), "run."+string(format))
+			client, err := New(archivePath, format)
+			require.NoError(t, err)
+			ctx := context.Background()
+
+			writePage := func(name string, content string, commit bool) domain.SnapshotID {
+				writer, err := client.NewPageWriter(ctx, name, service.Exchange{})
+				require.NoError(t, err)
+				_, err = fmt.Fprint(writer, content)
+				require.NoError(t, err)
+				if !commit {
+					require.NoError(t, writer.Discard())
+					return ""
+				}
+				require.NoError(t, writer.Close())
+				require.NoError(t, writer.Commit())
+				return writer.Snapshot()
+			}
+
+			home := writePage("www.google.com.html", "home", true)
+			about := writePage("www.google.com/about.html", "home", true)
+			writePage("www.google.com/contact.html", "partial", false)
+
+			asset, err := client.NewAssetWriter(ctx, "www.google.com_files/style.css")
+			require.NoError(t, err)
+			_, err = fmt.Fprint(asset, "body { color: red; }")
+			require.NoError(t, err)
+			require.NoError(t, asset.Close())
+
+			assert.ErrorIs(t, client.RestoreSnapshot(ctx, "www.google.com.html", home), ErrRestoreNotSupported)
+			assert.Equal(t, filepath.Join(archivePath, "www.google.com.html"), client.PageLocation("www.google.com.html"))
+			require.NoError(t, client.Close())
+
+			// The pages sharing their content share their snapshot.
+			assert.Equal(t, home, about)
+			snapshot := snapshotEntry("www.google.com.html", home)
+			page := "home"
+			if format == FormatTar {
+				page = "link:" + snapshot
+			}
+			assert.Equal(t, map[string]string{
+				snapshot:                         "home",
+				"www.google.com.html":            page,
+				"www.google.com/about.html":      page,
+				"www.google.com_files/style.css": "body { color: red; }",
+			}, readArchive(t, archivePath, format))
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package disk
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressions lists every domain.Compression a page may be stored with, the stale copies of a page stored
+// with another compression are looked up in this order.
+var compressions = []domain.Compression{domain.CompressionNone, domain.CompressionGzip, domain.CompressionZstd}
+
+// extension returns the extension appended to the files compressed with the given compression.
+func extension(compression domain.Compression) string {
+	switch compression {
+	case domain.CompressionGzip:
+		return ".gz"
+	case domain.CompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// nopWriteCloser turns an io.Writer into an io.WriteCloser whose Close does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// newCompressor returns a writer compressing what is written to w, it must be closed to flush the compressed data.
+func newCompressor(w io.Writer, compression domain.Compression) (io.WriteCloser, error) {
+	switch compression {
+	case domain.CompressionNone:
+		return nopWriteCloser{Writer: w}, nil
+	case domain.CompressionGzip:
+		return gzip.NewWriter(w), nil
+	case domain.CompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unknown compression %q", compression)
+	}
+}
+
+// zstdReadCloser releases the resources of the zstd decoder once closed.
+type zstdReadCloser struct {
+	*zstd.Decoder
+}
+
+func (r zstdReadCloser) Close() error {
+	r.Decoder.Close()
+	return nil
+}
+
+// newDecompressor returns a reader decompressing what is read from r.
+func newDecompressor(r io.Reader, compression domain.Compression) (io.ReadCloser, error) {
+	switch compression {
+	case domain.CompressionNone:
+		return io.NopCloser(r), nil
+	case domain.CompressionGzip:
+		return gzip.NewReader(r)
+	case domain.CompressionZstd:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zstdReadCloser{Decoder: decoder}, nil
+	default:
+		return nil, fmt.Errorf("unknown compression %q", compression)
+	}
+}
@@ -3,29 +3,417 @@ package disk
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"io/fs"
 	"os"
 	"path"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/gsiffert/fetch/internal/service"
+)
+
+const (
+	// snapshotDirectory is the directory, relative to the base path, holding the snapshots of the pages.
+	snapshotDirectory = "snapshots"
 )
 
 // Client of the disk package.
 type Client struct {
-	basePath string
+	basePath    string
+	compression domain.Compression
+}
+
+// Option configures optional behaviours of the Client.
+type Option func(c *Client)
+
+// WithCompression makes the Client compress the pages and their snapshots with the given compression,
+// the extension of the compression is appended to their files. The pages are stored as is by default.
+func WithCompression(compression domain.Compression) Option {
+	return func(c *Client) {
+		c.compression = compression
+	}
 }
 
 // New instantiates a new Client.
-func New(basePath string) *Client {
-	return &Client{basePath: basePath}
+func New(basePath string, opts ...Option) *Client {
+	c := &Client{basePath: basePath}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
-// NewPageWriter creates a new file for the given name.
-func (c *Client) NewPageWriter(_ context.Context, name string) (io.WriteCloser, error) {
-	fileName := fmt.Sprintf("%s.html", name)
-	filePath := path.Join(c.basePath, fileName)
-	file, err := os.Create(filePath)
+// NewPageWriter creates a new PageWriter for the given name.
+func (c *Client) NewPageWriter(_ context.Context, name string, _ service.Exchange) (service.PageWriter, error) {
+	dir := path.Join(c.basePath, snapshotDirectory)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create snapshot directory: %w", err)
+	}
+
+	file, err := os.CreateTemp(dir, "*.tmp")
 	if err != nil {
 		return nil, fmt.Errorf("open file: %w", err)
 	}
-	return file, nil
+
+	compressor, err := newCompressor(file, c.compression)
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return nil, fmt.Errorf("new compressor: %w", err)
+	}
+
+	// The snapshot is named after the hash of the content of the page, not of its compressed form.
+	hash := sha256.New()
+	return &PageWriter{
+		client:      c,
+		name:        name,
+		compression: c.compression,
+		file:        file,
+		compressor:  compressor,
+		hash:        hash,
+		writer:      io.MultiWriter(compressor, hash),
+	}, nil
+}
+
+// NewAssetWriter creates a new file for the given name, the name is used as is and may contain directories.
+// The content is written to a temporary file next to it, which replaces the file once the writer is closed.
+func (c *Client) NewAssetWriter(_ context.Context, name string) (service.AssetWriter, error) {
+	filePath := path.Join(c.basePath, name)
+	if err := os.MkdirAll(path.Dir(filePath), 0o755); err != nil {
+		return nil, fmt.Errorf("create directory: %w", err)
+	}
+
+	file, err := os.CreateTemp(path.Dir(filePath), "*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	return &assetWriter{file: file, path: filePath}, nil
+}
+
+// RestoreSnapshot replaces the page of the given name with the content of the snapshot. The page is stored
+// with the compression of the snapshot, whichever compression the Client is configured with.
+func (c *Client) RestoreSnapshot(_ context.Context, name string, snapshot domain.SnapshotID) error {
+	compression, ok := c.find(func(compression domain.Compression) string {
+		return c.snapshotPath(name, snapshot, compression)
+	})
+	if !ok {
+		return fmt.Errorf("stat snapshot %s: %w", snapshot, fs.ErrNotExist)
+	}
+
+	if err := linkFile(c.snapshotPath(name, snapshot, compression), c.pagePath(name, compression)); err != nil {
+		return fmt.Errorf("link snapshot: %w", err)
+	}
+	return c.removeStalePages(name, compression)
+}
+
+// OpenSnapshot returns the content of the snapshot of the page of the given name stored with the given
+// compression, decompressed.
+func (c *Client) OpenSnapshot(
+	_ context.Context,
+	name string,
+	snapshot domain.SnapshotID,
+	compression domain.Compression,
+) (io.ReadCloser, error) {
+	file, err := os.Open(c.snapshotPath(name, snapshot, compression))
+	if err != nil {
+		return nil, fmt.Errorf("open snapshot: %w", err)
+	}
+
+	decompressor, err := newDecompressor(file, compression)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("new decompressor: %w", err)
+	}
+	return &snapshotReader{ReadCloser: decompressor, file: file}, nil
+}
+
+// PageLocation returns the path of the file holding the page of the given name. The page may have been
+// stored with another compression than the one of the Client, the existing file is returned then.
+func (c *Client) PageLocation(name string) string {
+	compression, ok := c.find(func(compression domain.Compression) string {
+		return c.pagePath(name, compression)
+	})
+	if !ok {
+		compression = c.compression
+	}
+	return c.pagePath(name, compression)
+}
+
+// HasPage reports whether the file of the page of the given name exists, with any compression.
+func (c *Client) HasPage(_ context.Context, name string) (bool, error) {
+	_, ok := c.find(func(compression domain.Compression) string {
+		return c.pagePath(name, compression)
+	})
+	return ok, nil
+}
+
+// SaveNotModified does nothing, the file of the page is kept as is.
+func (c *Client) SaveNotModified(_ context.Context, _ string, _ service.Exchange, _ time.Time) error {
+	return nil
+}
+
+// find returns the first compression, starting with the one of the Client, for which the file of the given
+// path exists.
+func (c *Client) find(pathOf func(domain.Compression) string) (domain.Compression, bool) {
+	candidates := append([]domain.Compression{c.compression}, compressions...)
+	for _, compression := range candidates {
+		if _, err := os.Stat(pathOf(compression)); err == nil {
+			return compression, true
+		}
+	}
+	return "", false
+}
+
+// removeStalePages removes the copies of the page of the given name stored with another compression
+// than the given one, so a single copy of the page is left.
+func (c *Client) removeStalePages(name string, kept domain.Compression) error {
+	for _, compression := range compressions {
+		if compression == kept {
+			continue
+		}
+		if err := os.Remove(c.pagePath(name, compression)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("remove stale page: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) pagePath(name string, compression domain.Compression) string {
+	return path.Join(c.basePath, name+extension(compression))
+}
+
+// snapshotPath returns the path of the snapshot of the page of the given name, it has the extension of the page.
+func (c *Client) snapshotPath(name string, snapshot domain.SnapshotID, compression domain.Compression) string {
+	return path.Join(c.basePath, snapshotDirectory, fmt.Sprintf("%s%s%s", snapshot, path.Ext(name), extension(compression)))
+}
+
+// snapshotReader closes the file of the snapshot along with its decompressor.
+type snapshotReader struct {
+	io.ReadCloser
+	file *os.File
+}
+
+// Close implements the io.Closer interface.
+func (r *snapshotReader) Close() error {
+	return errors.Join(r.ReadCloser.Close(), r.file.Close())
+}
+
+// copyFile copies the source file to the destination through a temporary file, so the destination
+// is either left untouched or entirely replaced. The directory of the destination is created if needed.
+func copyFile(src string, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("open source: %w", err)
+	}
+	defer srcFile.Close()
+
+	if err := os.MkdirAll(path.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+
+	tmpFile, err := os.CreateTemp(path.Dir(dst), "*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temporary file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := io.Copy(tmpFile, srcFile); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("copy: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("close temporary file: %w", err)
+	}
+	if err := os.Chmod(tmpFile.Name(), 0o644); err != nil {
+		return fmt.Errorf("chmod: %w", err)
+	}
+
+	return os.Rename(tmpFile.Name(), dst)
+}
+
+// linkFile replaces the destination with a hard link to the source, so the file is stored once. The source
+// is copied instead when it cannot be linked, such as when the destination is on another device. As copyFile,
+// the destination is either left untouched or entirely replaced.
+func linkFile(src string, dst string) error {
+	if err := os.MkdirAll(path.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+
+	// The temporary file reserves a name next to the destination, the link takes its place.
+	tmpFile, err := os.CreateTemp(path.Dir(dst), "*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temporary file: %w", err)
+	}
+	_ = tmpFile.Close()
+	if err := os.Remove(tmpFile.Name()); err != nil {
+		return fmt.Errorf("remove temporary file: %w", err)
+	}
+
+	if err := os.Link(src, tmpFile.Name()); err != nil {
+		return copyFile(src, dst)
+	}
+	if err := os.Rename(tmpFile.Name(), dst); err != nil {
+		_ = os.Remove(tmpFile.Name())
+		return fmt.Errorf("rename: %w", err)
+	}
+	return nil
+}
+
+// PageWriter writes the content of a page to a temporary file. Once closed, the content is stored as an
+// immutable snapshot named after its hash, and once committed the page file is replaced by a link to the snapshot.
+type PageWriter struct {
+	client      *Client
+	name        string
+	compression domain.Compression
+	file        *os.File
+	compressor  io.WriteCloser
+	hash        hash.Hash
+	writer      io.Writer
+	snapshot    domain.SnapshotID
+	closed      bool
+	committed   bool
+}
+
+// Write implements the io.Writer interface.
+func (w *PageWriter) Write(p []byte) (int, error) {
+	return w.writer.Write(p)
+}
+
+// Snapshot returns the ID of the snapshot holding the content of the page, it is set once the writer is closed.
+func (w *PageWriter) Snapshot() domain.SnapshotID {
+	return w.snapshot
+}
+
+// Compression returns the compression the snapshot and the page are stored with.
+func (w *PageWriter) Compression() domain.Compression {
+	return w.compression
+}
+
+// Close stores the content written so far as a snapshot, the page file is left untouched until the writer
+// is committed. If a snapshot with the same content already exists, it is reused.
+func (w *PageWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer os.Remove(w.file.Name())
+
+	if err := w.compressor.Close(); err != nil {
+		_ = w.file.Close()
+		return fmt.Errorf("close compressor: %w", err)
+	}
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("close file: %w", err)
+	}
+
+	snapshot := domain.SnapshotID(hex.EncodeToString(w.hash.Sum(nil)))
+	snapshotPath := w.client.snapshotPath(w.name, snapshot, w.compression)
+	_, err := os.Stat(snapshotPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if err := os.Chmod(w.file.Name(), 0o644); err != nil {
+			return fmt.Errorf("chmod snapshot: %w", err)
+		}
+		if err := os.Rename(w.file.Name(), snapshotPath); err != nil {
+			return fmt.Errorf("rename snapshot: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("stat snapshot: %w", err)
+	}
+
+	w.snapshot = snapshot
+	return nil
+}
+
+// Commit replaces the page file with a hard link to the snapshot, or a copy when it cannot be linked, the page
+// is either left untouched or entirely replaced. The copies of the page stored with another compression are removed.
+func (w *PageWriter) Commit() error {
+	if w.snapshot == "" {
+		return errors.New("commit a page writer which is not closed")
+	}
+
+	if err := linkFile(w.client.snapshotPath(w.name, w.snapshot, w.compression), w.client.pagePath(w.name, w.compression)); err != nil {
+		return fmt.Errorf("link snapshot: %w", err)
+	}
+	w.committed = true
+	return w.client.removeStalePages(w.name, w.compression)
+}
+
+// Discard removes the temporary file holding the content written so far, the page file is left untouched.
+// The snapshot is kept once the writer is closed, as it is immutable and may be shared with other pages.
+func (w *PageWriter) Discard() error {
+	if w.closed || w.committed {
+		return nil
+	}
+	w.closed = true
+
+	// The compressor is closed first, so it releases its resources before the file it writes to is gone.
+	compressorErr := w.compressor.Close()
+	closeErr := w.file.Close()
+	if err := os.Remove(w.file.Name()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("remove temporary file: %w", err)
+	}
+	if compressorErr != nil {
+		return fmt.Errorf("close compressor: %w", compressorErr)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("close file: %w", closeErr)
+	}
+	return nil
+}
+
+// assetWriter writes the content of an asset to a temporary file, which replaces the file of the asset once
+// closed, so a failed download leaves no partial file behind.
+type assetWriter struct {
+	file *os.File
+	path string
+	done bool
+}
+
+// Write implements the io.Writer interface.
+func (w *assetWriter) Write(p []byte) (int, error) {
+	return w.file.Write(p)
+}
+
+// Close replaces the file of the asset with the content written so far.
+func (w *assetWriter) Close() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	defer os.Remove(w.file.Name())
+
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("close file: %w", err)
+	}
+	if err := os.Chmod(w.file.Name(), 0o644); err != nil {
+		return fmt.Errorf("chmod: %w", err)
+	}
+	if err := os.Rename(w.file.Name(), w.path); err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+	return nil
+}
+
+// Discard removes the temporary file, the file of the asset is left untouched.
+func (w *assetWriter) Discard() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+
+	closeErr := w.file.Close()
+	if err := os.Remove(w.file.Name()); err != nil {
+		return fmt.Errorf("remove temporary file: %w", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("close file: %w", closeErr)
+	}
+	return nil
 }
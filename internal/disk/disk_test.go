@@ -8,6 +8,8 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/gsiffert/fetch/internal/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -20,12 +22,14 @@ func TestNewPageWriter(t *testing.T) {
 	expectedContent := "Hello World"
 
 	t.Run("write to file", func(t *testing.T) {
-		writer, err := client.NewPageWriter(context.Background(), "www.google.com")
+		writer, err := client.NewPageWriter(context.Background(), "www.google.com.html", service.Exchange{})
 		require.NoError(t, err)
 		_, err = fmt.Fprint(writer, expectedContent)
 		require.NoError(t, err)
 		err = writer.Close()
 		require.NoError(t, err)
+		err = writer.Commit()
+		require.NoError(t, err)
 	})
 
 	t.Run("read content", func(t *testing.T) {
@@ -36,4 +40,263 @@ func TestNewPageWriter(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, expectedContent, string(content))
 	})
+
+	t.Run("write to a sub directory", func(t *testing.T) {
+		client := New(t.TempDir())
+		writer, err := client.NewPageWriter(context.Background(), "google/search.html", service.Exchange{})
+		require.NoError(t, err)
+		_, err = fmt.Fprint(writer, expectedContent)
+		require.NoError(t, err)
+		err = writer.Close()
+		require.NoError(t, err)
+		err = writer.Commit()
+		require.NoError(t, err)
+
+		content, err := os.ReadFile(client.PageLocation("google/search.html"))
+		require.NoError(t, err)
+		assert.Equal(t, expectedContent, string(content))
+	})
+}
+
+func TestNewAssetWriter(t *testing.T) {
+	t.Parallel()
+
+	temporyDir := t.TempDir()
+	client := New(temporyDir)
+	expectedContent := "body { color: red; }"
+
+	t.Run("write to file", func(t *testing.T) {
+		writer, err := client.NewAssetWriter(context.Background(), "www.google.com_files/style.css")
+		require.NoError(t, err)
+		_, err = fmt.Fprint(writer, expectedContent)
+		require.NoError(t, err)
+		err = writer.Close()
+		require.NoError(t, err)
+	})
+
+	t.Run("read content", func(t *testing.T) {
+		expectedFile := filepath.Join(temporyDir, "www.google.com_files", "style.css")
+		content, err := os.ReadFile(expectedFile)
+		require.NoError(t, err)
+		assert.Equal(t, expectedContent, string(content))
+	})
+
+	t.Run("discard leaves the file untouched", func(t *testing.T) {
+		writer, err := client.NewAssetWriter(context.Background(), "www.google.com_files/style.css")
+		require.NoError(t, err)
+		_, err = fmt.Fprint(writer, "partial")
+		require.NoError(t, err)
+		require.NoError(t, writer.Discard())
+		require.NoError(t, writer.Close())
+
+		entries, err := os.ReadDir(filepath.Join(temporyDir, "www.google.com_files"))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+		content, err := os.ReadFile(filepath.Join(temporyDir, "www.google.com_files", "style.css"))
+		require.NoError(t, err)
+		assert.Equal(t, expectedContent, string(content))
+	})
+}
+
+func TestPageWriter_Snapshot(t *testing.T) {
+	t.Parallel()
+
+	temporyDir := t.TempDir()
+	client := New(temporyDir)
+	ctx := context.Background()
+
+	writePage := func(t *testing.T, content string) domain.SnapshotID {
+		writer, err := client.NewPageWriter(ctx, "www.google.com.html", service.Exchange{})
+		require.NoError(t, err)
+		_, err = fmt.Fprint(writer, content)
+		require.NoError(t, err)
+		err = writer.Close()
+		require.NoError(t, err)
+		err = writer.Commit()
+		require.NoError(t, err)
+		return writer.Snapshot()
+	}
+
+	first := writePage(t, "first version")
+	second := writePage(t, "second version")
+	again := writePage(t, "first version")
+
+	t.Run("same content shares the snapshot", func(t *testing.T) {
+		assert.Equal(t, first, again)
+		assert.NotEqual(t, first, second)
+
+		entries, err := os.ReadDir(filepath.Join(temporyDir, snapshotDirectory))
+		require.NoError(t, err)
+		assert.Len(t, entries, 2)
+	})
+
+	t.Run("page holds the latest version", func(t *testing.T) {
+		content, err := os.ReadFile(filepath.Join(temporyDir, "www.google.com.html"))
+		require.NoError(t, err)
+		assert.Equal(t, "first version", string(content))
+	})
+
+	t.Run("page is a link to its snapshot", func(t *testing.T) {
+		page, err := os.Stat(filepath.Join(temporyDir, "www.google.com.html"))
+		require.NoError(t, err)
+		snapshot, err := os.Stat(client.snapshotPath("www.google.com.html", first, domain.CompressionNone))
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(page, snapshot))
+	})
+
+	t.Run("restore snapshot", func(t *testing.T) {
+		err := client.RestoreSnapshot(ctx, "www.google.com.html", second)
+		require.NoError(t, err)
+
+		content, err := os.ReadFile(filepath.Join(temporyDir, "www.google.com.html"))
+		require.NoError(t, err)
+		assert.Equal(t, "second version", string(content))
+	})
+
+	t.Run("restore unknown snapshot", func(t *testing.T) {
+		err := client.RestoreSnapshot(ctx, "www.google.com.html", domain.SnapshotID("unknown"))
+		assert.Error(t, err)
+	})
+}
+
+func TestPageWriter_Discard(t *testing.T) {
+	t.Parallel()
+
+	temporyDir := t.TempDir()
+	client := New(temporyDir)
+	ctx := context.Background()
+	pagePath := filepath.Join(temporyDir, "www.google.com.html")
+
+	writer, err := client.NewPageWriter(ctx, "www.google.com.html", service.Exchange{})
+	require.NoError(t, err)
+	_, err = fmt.Fprint(writer, "complete page")
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.NoError(t, writer.Commit())
+
+	t.Run("partial page is removed", func(t *testing.T) {
+		writer, err := client.NewPageWriter(ctx, "www.google.com.html", service.Exchange{})
+		require.NoError(t, err)
+		_, err = fmt.Fprint(writer, "partial")
+		require.NoError(t, err)
+		require.NoError(t, writer.Discard())
+
+		content, err := os.ReadFile(pagePath)
+		require.NoError(t, err)
+		assert.Equal(t, "complete page", string(content))
+
+		// Only the snapshot of the complete page is left.
+		entries, err := os.ReadDir(filepath.Join(temporyDir, snapshotDirectory))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("compressed partial page is removed", func(t *testing.T) {
+		client := New(temporyDir, WithCompression(domain.CompressionZstd))
+		writer, err := client.NewPageWriter(ctx, "www.google.com.html", service.Exchange{})
+		require.NoError(t, err)
+		_, err = fmt.Fprint(writer, "partial")
+		require.NoError(t, err)
+		require.NoError(t, writer.Discard())
+
+		entries, err := os.ReadDir(filepath.Join(temporyDir, snapshotDirectory))
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("page is only replaced once committed", func(t *testing.T) {
+		writer, err := client.NewPageWriter(ctx, "www.google.com.html", service.Exchange{})
+		require.NoError(t, err)
+		_, err = fmt.Fprint(writer, "new page")
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		require.NoError(t, writer.Discard())
+
+		content, err := os.ReadFile(pagePath)
+		require.NoError(t, err)
+		assert.Equal(t, "complete page", string(content))
+	})
+
+	t.Run("commit requires a closed writer", func(t *testing.T) {
+		writer, err := client.NewPageWriter(ctx, "www.google.com.html", service.Exchange{})
+		require.NoError(t, err)
+		defer writer.Discard()
+		assert.Error(t, writer.Commit())
+	})
+}
+
+func TestPageWriter_Compression(t *testing.T) {
+	t.Parallel()
+
+	for _, compression := range []domain.Compression{domain.CompressionGzip, domain.CompressionZstd} {
+		t.Run(string(compression), func(t *testing.T) {
+			t.Parallel()
+
+			temporyDir := t.TempDir()
+			ctx := context.Background()
+			plain := New(temporyDir)
+			compressed := New(temporyDir, WithCompression(compression))
+
+			writePage := func(t *testing.T, client *Client, content string) service.PageWriter {
+				writer, err := client.NewPageWriter(ctx, "www.google.com.html", service.Exchange{})
+				require.NoError(t, err)
+				_, err = fmt.Fprint(writer, content)
+				require.NoError(t, err)
+				require.NoError(t, writer.Close())
+				require.NoError(t, writer.Commit())
+				return writer
+			}
+
+			previous := writePage(t, plain, "Hello World")
+			writer := writePage(t, compressed, "Hello World")
+
+			t.Run("snapshot is named after the content", func(t *testing.T) {
+				assert.Equal(t, previous.Snapshot(), writer.Snapshot())
+				assert.Equal(t, compression, writer.Compression())
+			})
+
+			t.Run("page is stored compressed", func(t *testing.T) {
+				pagePath := filepath.Join(temporyDir, "www.google.com.html"+extension(compression))
+				assert.Equal(t, pagePath, compressed.PageLocation("www.google.com.html"))
+				assert.Equal(t, pagePath, plain.PageLocation("www.google.com.html"))
+
+				file, err := os.Open(pagePath)
+				require.NoError(t, err)
+				defer file.Close()
+				decompressor, err := newDecompressor(file, compression)
+				require.NoError(t, err)
+				defer decompressor.Close()
+				content, err := io.ReadAll(decompressor)
+				require.NoError(t, err)
+				assert.Equal(t, "Hello World", string(content))
+
+				// The copy of the page stored as is was replaced.
+				_, err = os.Stat(filepath.Join(temporyDir, "www.google.com.html"))
+				assert.ErrorIs(t, err, os.ErrNotExist)
+			})
+
+			t.Run("open snapshot", func(t *testing.T) {
+				snapshot, err := compressed.OpenSnapshot(ctx, "www.google.com.html", writer.Snapshot(), compression)
+				require.NoError(t, err)
+				defer snapshot.Close()
+				content, err := io.ReadAll(snapshot)
+				require.NoError(t, err)
+				assert.Equal(t, "Hello World", string(content))
+			})
+
+			t.Run("restore snapshot", func(t *testing.T) {
+				second := writePage(t, plain, "second version")
+				require.NoError(t, compressed.RestoreSnapshot(ctx, "www.google.com.html", writer.Snapshot()))
+
+				// The snapshot of the configured compression is restored first.
+				assert.Equal(t, filepath.Join(temporyDir, "www.google.com.html"+extension(compression)), plain.PageLocation("www.google.com.html"))
+
+				// A snapshot only stored as is restores the page as is.
+				require.NoError(t, compressed.RestoreSnapshot(ctx, "www.google.com.html", second.Snapshot()))
+				content, err := os.ReadFile(compressed.PageLocation("www.google.com.html"))
+				require.NoError(t, err)
+				assert.Equal(t, "second version", string(content))
+			})
+		})
+	}
 }
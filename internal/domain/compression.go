@@ -0,0 +1,28 @@
+package domain
+
+import "fmt"
+
+// Compression is the codec the content of a page is stored with.
+type Compression string
+
+const (
+	// CompressionNone stores the content as is, it is the compression of the pages stored before
+	// the compression existed.
+	CompressionNone Compression = ""
+	// CompressionGzip stores the content compressed with gzip.
+	CompressionGzip Compression = "gzip"
+	// CompressionZstd stores the content compressed with Zstandard.
+	CompressionZstd Compression = "zstd"
+)
+
+// ParseCompression returns the Compression matching the given name, "none" stores the content as is.
+func ParseCompression(name string) (Compression, error) {
+	switch compression := Compression(name); compression {
+	case "none", CompressionNone:
+		return CompressionNone, nil
+	case CompressionGzip, CompressionZstd:
+		return compression, nil
+	default:
+		return "", fmt.Errorf("unknown compression %q", name)
+	}
+}
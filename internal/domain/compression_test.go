@@ -0,0 +1,25 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCompression(t *testing.T) {
+	t.Parallel()
+
+	for name, expected := range map[string]Compression{
+		"":     CompressionNone,
+		"none": CompressionNone,
+		"gzip": CompressionGzip,
+		"zstd": CompressionZstd,
+	} {
+		compression, err := ParseCompression(name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, compression)
+	}
+
+	_, err := ParseCompression("brotli")
+	assert.Error(t, err)
+}
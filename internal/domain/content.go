@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"mime"
+	"path"
+	"strings"
+)
+
+// The media types of the contents handled by type, the others are stored without extracting anything but their size.
+const (
+	MediaTypeHTML  = "text/html"
+	MediaTypeXHTML = "application/xhtml+xml"
+	MediaTypeText  = "text/plain"
+	MediaTypeJSON  = "application/json"
+	MediaTypeXML   = "application/xml"
+	MediaTypeRSS   = "application/rss+xml"
+	MediaTypeAtom  = "application/atom+xml"
+	MediaTypePDF   = "application/pdf"
+	// MediaTypeUnknown is the media type of the contents whose type is neither declared nor recognized.
+	MediaTypeUnknown = "application/octet-stream"
+)
+
+// defaultExtension is the extension of the pages of an unknown media type. The pages fetched before the
+// media types were recorded are HTML pages.
+const defaultExtension = ".html"
+
+// extensions holds the extension of the files of the common media types, it takes precedence over the
+// extensions known by the system which may list several extensions for a media type.
+var extensions = map[string]string{
+	MediaTypeHTML:              ".html",
+	MediaTypeXHTML:             ".xhtml",
+	MediaTypeText:              ".txt",
+	MediaTypeJSON:              ".json",
+	MediaTypeXML:               ".xml",
+	"text/xml":                 ".xml",
+	MediaTypeRSS:               ".rss",
+	MediaTypeAtom:              ".atom",
+	MediaTypePDF:               ".pdf",
+	"image/png":                ".png",
+	"image/jpeg":               ".jpg",
+	"image/gif":                ".gif",
+	"image/webp":               ".webp",
+	"image/svg+xml":            ".svg",
+	"image/avif":               ".avif",
+	"image/bmp":                ".bmp",
+	"image/x-icon":             ".ico",
+	"image/vnd.microsoft.icon": ".ico",
+	MediaTypeUnknown:           ".bin",
+}
+
+// DefaultAcceptedMediaTypes lists the media types accepted by default: the HTML pages.
+var DefaultAcceptedMediaTypes = []string{MediaTypeHTML, MediaTypeXHTML}
+
+// ParseMediaType returns the media type of the value of a Content-Type header, lower cased and without
+// its parameters. It returns an empty string when the value is empty.
+func ParseMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, _, _ = strings.Cut(contentType, ";")
+	}
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+// Extension returns the extension of the files holding a content of the media type, including the dot.
+// An empty media type is the one of the pages fetched before the media types were recorded, they are HTML pages.
+func Extension(mediaType string) string {
+	if mediaType == "" {
+		return defaultExtension
+	}
+	if extension, ok := extensions[mediaType]; ok {
+		return extension
+	}
+	if known, err := mime.ExtensionsByType(mediaType); err == nil && len(known) > 0 {
+		return known[0]
+	}
+	return extensions[MediaTypeUnknown]
+}
+
+// MatchMediaType reports whether the media type matches one of the patterns, a pattern being either a media
+// type, such as text/html, or a wildcard, such as image/* or */*.
+func MatchMediaType(patterns []string, mediaType string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if ok, _ := path.Match(pattern, mediaType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// IsHTML reports whether the media type is the one of an HTML or XHTML document.
+func IsHTML(mediaType string) bool {
+	return mediaType == "" || mediaType == MediaTypeHTML || mediaType == MediaTypeXHTML
+}
+
+// IsText reports whether the content of the media type is text, encoded in a charset: the HTML pages, the
+// plain texts, and the XML and JSON documents.
+func IsText(mediaType string) bool {
+	return IsHTML(mediaType) || IsXML(mediaType) || mediaType == MediaTypeJSON || strings.HasPrefix(mediaType, "text/")
+}
+
+// IsXML reports whether the media type is the one of an XML document, such as an RSS or an Atom feed.
+// The XHTML documents are HTML documents.
+func IsXML(mediaType string) bool {
+	switch mediaType {
+	case MediaTypeXML, "text/xml":
+		return true
+	case MediaTypeXHTML, "image/svg+xml":
+		return false
+	default:
+		return strings.HasSuffix(mediaType, "+xml")
+	}
+}
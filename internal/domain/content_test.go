@@ -0,0 +1,75 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMediaType(t *testing.T) {
+	t.Parallel()
+
+	for contentType, expected := range map[string]string{
+		"":                          "",
+		"text/html":                 MediaTypeHTML,
+		"Text/HTML; charset=UTF-8":  MediaTypeHTML,
+		"application/pdf;":          MediaTypePDF,
+		"application/rss+xml; q=1;": MediaTypeRSS,
+	} {
+		assert.Equal(t, expected, ParseMediaType(contentType), contentType)
+	}
+}
+
+func TestExtension(t *testing.T) {
+	t.Parallel()
+
+	for mediaType, expected := range map[string]string{
+		"":               ".html",
+		MediaTypeHTML:    ".html",
+		MediaTypeXHTML:   ".xhtml",
+		MediaTypeText:    ".txt",
+		MediaTypeJSON:    ".json",
+		MediaTypeRSS:     ".rss",
+		MediaTypePDF:     ".pdf",
+		"image/jpeg":     ".jpg",
+		"x-unknown/type": ".bin",
+	} {
+		assert.Equal(t, expected, Extension(mediaType), mediaType)
+	}
+}
+
+func TestMatchMediaType(t *testing.T) {
+	t.Parallel()
+
+	patterns := []string{"text/html", "Image/*"}
+	assert.True(t, MatchMediaType(patterns, "text/html"))
+	assert.True(t, MatchMediaType(patterns, "image/png"))
+	assert.False(t, MatchMediaType(patterns, "text/plain"))
+	assert.False(t, MatchMediaType(patterns, "application/pdf"))
+	assert.True(t, MatchMediaType([]string{"*/*"}, "application/pdf"))
+}
+
+func TestIsXML(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, IsXML(MediaTypeXML))
+	assert.True(t, IsXML("text/xml"))
+	assert.True(t, IsXML(MediaTypeRSS))
+	assert.True(t, IsXML(MediaTypeAtom))
+	assert.False(t, IsXML(MediaTypeXHTML))
+	assert.False(t, IsXML("image/svg+xml"))
+	assert.False(t, IsXML(MediaTypeHTML))
+}
+
+func TestIsText(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, IsText(""))
+	assert.True(t, IsText(MediaTypeHTML))
+	assert.True(t, IsText(MediaTypeText))
+	assert.True(t, IsText("text/csv"))
+	assert.True(t, IsText(MediaTypeJSON))
+	assert.True(t, IsText(MediaTypeRSS))
+	assert.False(t, IsText(MediaTypePDF))
+	assert.False(t, IsText("image/png"))
+}
@@ -0,0 +1,173 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCronYears bounds the search of the next time of a Cron, an expression such as "0 0 30 2 *" never matches.
+const maxCronYears = 5
+
+// cronMacros maps the shorthands of the cron expressions to the expression they stand for.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField describes the range of the values of a field of a cron expression.
+type cronField struct {
+	name string
+	min  int
+	max  int
+}
+
+var cronFields = [5]cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	// Sunday is either 0 or 7.
+	{name: "day of week", min: 0, max: 7},
+}
+
+// Cron is a parsed cron expression of five fields: minute, hour, day of month, month and day of week.
+// Each field is either *, a value, a range such as 1-5, a step such as */15 or 1-30/2, or a list of them
+// separated by commas. The @hourly, @daily, @weekly, @monthly and @yearly shorthands are supported as well.
+type Cron struct {
+	expr string
+	// fields holds a bit per value of each field.
+	fields [5]uint64
+	// restrictedDays reports whether the day of month and the day of week are restricted, a day then
+	// matches when either of them matches, as cron does.
+	restrictedDays bool
+}
+
+// ParseCron parses a cron expression.
+func ParseCron(expr string) (Cron, error) {
+	expr = strings.TrimSpace(expr)
+	fields := strings.Fields(expr)
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		fields = strings.Fields(macro)
+	}
+	if len(fields) != len(cronFields) {
+		return Cron{}, fmt.Errorf("cron %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	c := Cron{expr: expr}
+	for i, field := range fields {
+		bits, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return Cron{}, fmt.Errorf("cron %q: %w", expr, err)
+		}
+		c.fields[i] = bits
+	}
+	// Sunday is the 7th day as well as the 0th.
+	if c.fields[4]&(1<<7) != 0 {
+		c.fields[4] |= 1
+	}
+	c.restrictedDays = fields[2] != "*" && fields[4] != "*"
+	return c, nil
+}
+
+// parseCronField returns the bits of the values matched by a field of a cron expression.
+func parseCronField(field string, spec cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		values, step, hasStep := strings.Cut(part, "/")
+		every := 1
+		if hasStep {
+			n, err := strconv.Atoi(step)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s %q: invalid step", spec.name, part)
+			}
+			every = n
+		}
+
+		low, high := spec.min, spec.max
+		if values != "*" {
+			first, last, isRange := strings.Cut(values, "-")
+			var err error
+			if low, err = strconv.Atoi(first); err != nil {
+				return 0, fmt.Errorf("%s %q: invalid value", spec.name, part)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(last); err != nil {
+					return 0, fmt.Errorf("%s %q: invalid value", spec.name, part)
+				}
+			} else if hasStep {
+				// A value with a step, such as 5/15, starts at the value up to the end of the range.
+				high = spec.max
+			}
+		}
+		if low < spec.min || high > spec.max || low > high {
+			return 0, fmt.Errorf("%s %q: out of range %d-%d", spec.name, part, spec.min, spec.max)
+		}
+
+		for value := low; value <= high; value += every {
+			bits |= 1 << value
+		}
+	}
+	return bits, nil
+}
+
+// String returns the expression the Cron was parsed from.
+func (c Cron) String() string {
+	return c.expr
+}
+
+// Next returns the first time matching the Cron strictly after the given time, in the location of the given
+// time. It returns the zero time if no time matches within the next years, such as on the 30th of February.
+// The wall clock times repeated when the clocks go back, at the end of the daylight saving time, match once.
+func (c Cron) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxCronYears, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !c.matches(3, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !c.matches(1, t.Hour()):
+			// Truncate rounds the absolute time, the next hour is built in the location so the zones offset
+			// by a fraction of an hour start at its first minute.
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !c.matches(0, t.Minute()):
+			t = t.Add(time.Minute)
+		case !wallClock(t).After(wallClock(after)):
+			// The clocks went back, the time already matched before they did.
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matches reports whether the value matches the field of the given index.
+func (c Cron) matches(field int, value int) bool {
+	return c.fields[field]&(1<<value) != 0
+}
+
+// matchesDay reports whether the day of the time matches the day of month and the day of week of the Cron.
+func (c Cron) matchesDay(t time.Time) bool {
+	dayOfMonth := c.matches(2, t.Day())
+	dayOfWeek := c.matches(4, int(t.Weekday()))
+	if c.restrictedDays {
+		return dayOfMonth || dayOfWeek
+	}
+	return dayOfMonth && dayOfWeek
+}
+
+// wallClock returns the time read on the clock of its location, without the offset of the location, so the times
+// repeated when the clocks go back are equal.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCron_Next(t *testing.T) {
+	t.Parallel()
+
+	// Friday, the 15th of March 2024.
+	after := time.Date(2024, time.March, 15, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{expr: "* * * * *", expected: time.Date(2024, time.March, 15, 10, 8, 0, 0, time.UTC)},
+		{expr: "*/15 * * * *", expected: time.Date(2024, time.March, 15, 10, 15, 0, 0, time.UTC)},
+		{expr: "5 * * * *", expected: time.Date(2024, time.March, 15, 11, 5, 0, 0, time.UTC)},
+		{expr: "30 2 * * *", expected: time.Date(2024, time.March, 16, 2, 30, 0, 0, time.UTC)},
+		{expr: "0 9-17/4 * * 1-5", expected: time.Date(2024, time.March, 15, 13, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 7", expected: time.Date(2024, time.March, 17, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 29 2 *", expected: time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		// The day of month and the day of week both restricted, either of them matches.
+		{expr: "0 0 1 * 1", expected: time.Date(2024, time.March, 18, 0, 0, 0, 0, time.UTC)},
+		{expr: "@monthly", expected: time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 30 2 *", expected: time.Time{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			t.Parallel()
+
+			c, err := ParseCron(test.expr)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, c.Next(after))
+		})
+	}
+}
+
+func TestCron_Next_Location(t *testing.T) {
+	t.Parallel()
+
+	// The hours of a zone offset by half an hour start half an hour past the hours of UTC.
+	kolkata := time.FixedZone("IST", 5*60*60+30*60)
+	after := time.Date(2024, time.March, 15, 10, 15, 0, 0, kolkata)
+
+	c, err := ParseCron("0 11 * * *")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, time.March, 15, 11, 0, 0, 0, kolkata), c.Next(after))
+
+	c, err = ParseCron("@daily")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, time.March, 16, 0, 0, 0, 0, kolkata), c.Next(after))
+}
+
+func TestCron_Next_DaylightSaving(t *testing.T) {
+	t.Parallel()
+
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// The clocks go back from 2:00 EDT to 1:00 EST on the 3rd of November 2024, 1:30 happens twice.
+	c, err := ParseCron("30 1 * * *")
+	require.NoError(t, err)
+	first := c.Next(time.Date(2024, time.November, 3, 0, 0, 0, 0, newYork))
+	assert.Equal(t, time.Date(2024, time.November, 3, 5, 30, 0, 0, time.UTC), first.UTC())
+	assert.Equal(t, time.Date(2024, time.November, 4, 1, 30, 0, 0, newYork), c.Next(first))
+
+	// The repeated hour is skipped by the schedules which already ran during it.
+	c, err = ParseCron("*/15 * * * *")
+	require.NoError(t, err)
+	last := time.Date(2024, time.November, 3, 1, 45, 0, 0, newYork)
+	require.Equal(t, "EDT", last.Format("MST"))
+	assert.Equal(t, time.Date(2024, time.November, 3, 7, 0, 0, 0, time.UTC), c.Next(last).UTC())
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "@never"} {
+		_, err := ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
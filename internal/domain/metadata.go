@@ -10,4 +10,43 @@ type MetaData struct {
 	LastFetched time.Time
 	NumLinks    int
 	NumImages   int
+	Snapshot    SnapshotID
+	// FileLocation is the location of the file holding the page, relative to the download path.
+	FileLocation string
+	// Compression is the codec the content of the page is stored with.
+	Compression Compression
+	// ContentType is the media type of the content of the page, such as text/html or application/pdf.
+	ContentType string
+	// Charset is the charset the text content of the page is encoded with, such as utf-8 or shift_jis.
+	Charset string
+	// ETag and LastModified are the validators returned by the server, they are sent back on the next fetch
+	// so the server can tell the page did not change.
+	ETag         string
+	LastModified string
+
+	Title       string
+	Description string
+	Canonical   string
+	Lang        string
+	OpenGraph   SocialCard
+	Twitter     SocialCard
+	// NumHeadings holds the number of headings of each level, from h1 to h6.
+	NumHeadings    [6]int
+	NumScripts     int
+	NumStylesheets int
+	// WordCount is the number of words of the text of the page, outside of the scripts and styles.
+	WordCount int
+	// ByteSize is the size of the page as returned by the server.
+	ByteSize int64
+}
+
+// SocialCard holds the fields describing a Page when it is shared on social networks,
+// either through the OpenGraph protocol or a Twitter card.
+type SocialCard struct {
+	// Type is the og:type of the page, or the twitter:card type.
+	Type        string
+	Title       string
+	Description string
+	Image       string
+	URL         string
 }
@@ -0,0 +1,93 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	// nameHashLength is the number of hexadecimal characters of the hash of the URL suffixing the names of the files.
+	nameHashLength = 16
+	// maxNamePrefixLength is the maximum length of the readable prefix of a flat name.
+	maxNamePrefixLength = 100
+	// maxSegmentLength is the maximum length of a directory, or of the readable prefix of a file, of a hierarchy.
+	maxSegmentLength = 64
+	// maxHierarchyDepth is the maximum number of directories of a hierarchy below the host.
+	maxHierarchyDepth = 8
+)
+
+// FileNaming is the strategy naming the files the pages are stored in.
+// The names are suffixed with the hash of the normalized URL of the page, so two pages never share a file,
+// and are bounded in length, so they fit in the limits of the file systems. The database holds the URL of
+// the page stored in each file.
+type FileNaming string
+
+const (
+	// NamingFlat stores every page in the same directory, as host_path-hash.
+	NamingFlat FileNaming = "flat"
+	// NamingHierarchy stores the pages in a directory per host and per segment of their path, as host/path-hash.
+	NamingHierarchy FileNaming = "hierarchy"
+)
+
+// ParseFileNaming returns the FileNaming matching the given name.
+func ParseFileNaming(name string) (FileNaming, error) {
+	switch naming := FileNaming(name); naming {
+	case NamingFlat, NamingHierarchy:
+		return naming, nil
+	default:
+		return "", fmt.Errorf("unknown file naming %q", name)
+	}
+}
+
+// FileLocation returns the location of the file holding the page of the URL, relative to the download path
+// and without extension.
+func (n FileNaming) FileLocation(u *url.URL) string {
+	u = NormalizeURL(u)
+	sum := sha256.Sum256([]byte(u.String()))
+	hash := hex.EncodeToString(sum[:])[:nameHashLength]
+
+	segments := strings.FieldsFunc(u.Path, func(r rune) bool { return r == '/' })
+	if n != NamingHierarchy {
+		prefix := strings.Join(append([]string{sanitizeName(u.Host)}, segments...), "_")
+		return truncate(sanitizeName(prefix), maxNamePrefixLength) + "-" + hash
+	}
+
+	dirs := []string{truncate(sanitizeName(u.Host), maxSegmentLength)}
+	file := "index"
+	if len(segments) > 0 {
+		file = segments[len(segments)-1]
+		segments = segments[:len(segments)-1]
+	}
+	for _, segment := range segments[:min(len(segments), maxHierarchyDepth)] {
+		dirs = append(dirs, truncate(sanitizeName(segment), maxSegmentLength))
+	}
+	return path.Join(append(dirs, truncate(sanitizeName(file), maxSegmentLength)+"-"+hash)...)
+}
+
+// sanitizeName replaces the characters which are not safe in a file name by an underscore.
+// A name made of dots only is replaced as well, so it does not refer to a directory.
+func sanitizeName(name string) string {
+	sanitized := strings.Map(func(r rune) rune {
+		if isNotAlphaNumeric(r) && r != '.' && r != '-' && r != '_' {
+			return '_'
+		}
+		return r
+	}, name)
+
+	if strings.Trim(sanitized, ".") == "" {
+		return strings.Repeat("_", len(sanitized))
+	}
+	return sanitized
+}
+
+// truncate cuts the name to the maximum length, the names are sanitized so they only hold single byte characters.
+func truncate(name string, maxLength int) string {
+	if len(name) > maxLength {
+		return name[:maxLength]
+	}
+	return name
+}
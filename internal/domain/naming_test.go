@@ -0,0 +1,118 @@
+package domain
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileNaming_FileLocation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		input     string
+		flat      string
+		hierarchy string
+	}{
+		{
+			name:      "root",
+			input:     "https://www.google.com",
+			flat:      "www.google.com-",
+			hierarchy: "www.google.com/index-",
+		},
+		{
+			name:      "path",
+			input:     "https://www.google.com/docs/intro/",
+			flat:      "www.google.com_docs_intro-",
+			hierarchy: "www.google.com/docs/intro-",
+		},
+		{
+			name:      "unsafe characters",
+			input:     "http://www.google.com:8080/a%20b/été;x?q=1",
+			flat:      "www.google.com_8080_a_b__t__x-",
+			hierarchy: "www.google.com_8080/a_b/_t__x-",
+		},
+		{
+			name:      "dots only",
+			input:     "https://www.google.com/%2E%2E%2E",
+			flat:      "www.google.com_...-",
+			hierarchy: "www.google.com/___-",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			u, err := url.Parse(test.input)
+			require.NoError(t, err)
+
+			flat := NamingFlat.FileLocation(u)
+			assert.True(t, strings.HasPrefix(flat, test.flat), flat)
+			assert.Len(t, flat, len(test.flat)+nameHashLength)
+
+			hierarchy := NamingHierarchy.FileLocation(u)
+			assert.True(t, strings.HasPrefix(hierarchy, test.hierarchy), hierarchy)
+			assert.Len(t, hierarchy, len(test.hierarchy)+nameHashLength)
+		})
+	}
+
+	t.Run("collision free", func(t *testing.T) {
+		t.Parallel()
+
+		sites := []string{"https://a.com/p?id=1", "http://a.com/p?id=2", "https://a.com/p", "https://a.com/p/"}
+		seen := make(map[string]string)
+		for _, site := range sites {
+			u, err := url.Parse(site)
+			require.NoError(t, err)
+
+			for _, naming := range []FileNaming{NamingFlat, NamingHierarchy} {
+				location := naming.FileLocation(u)
+				assert.NotContains(t, seen, location, "%s collides with %s", site, seen[location])
+				seen[location] = site
+			}
+		}
+	})
+
+	t.Run("same page", func(t *testing.T) {
+		t.Parallel()
+
+		u1, err := url.Parse("https://a.com/p?b=2&a=1")
+		require.NoError(t, err)
+		u2, err := url.Parse("HTTPS://A.com:443/p?a=1&b=2#top")
+		require.NoError(t, err)
+		assert.Equal(t, NamingFlat.FileLocation(u1), NamingFlat.FileLocation(u2))
+	})
+
+	t.Run("length bounded", func(t *testing.T) {
+		t.Parallel()
+
+		u, err := url.Parse("https://a.com/" + strings.Repeat("segment/", 100) + strings.Repeat("a", 300))
+		require.NoError(t, err)
+
+		flat := NamingFlat.FileLocation(u)
+		assert.Len(t, flat, maxNamePrefixLength+1+nameHashLength)
+
+		hierarchy := NamingHierarchy.FileLocation(u)
+		parts := strings.Split(hierarchy, "/")
+		assert.Len(t, parts, 1+maxHierarchyDepth+1)
+		for _, part := range parts {
+			assert.LessOrEqual(t, len(part), maxSegmentLength+1+nameHashLength)
+		}
+	})
+}
+
+func TestParseFileNaming(t *testing.T) {
+	t.Parallel()
+
+	naming, err := ParseFileNaming("hierarchy")
+	assert.NoError(t, err)
+	assert.Equal(t, NamingHierarchy, naming)
+
+	_, err = ParseFileNaming("tree")
+	assert.Error(t, err)
+}
@@ -1,8 +1,15 @@
 package domain
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"net/url"
 	"path"
+	"strings"
+)
+
+const (
+	maxAssetExtLength = 8
 )
 
 // PageID represents a unique ID for a Page.
@@ -20,12 +27,40 @@ type Page struct {
 	FileLocation string
 }
 
-// NewPage instantiates a new Page.
+// NewPage instantiates a new Page, identified by the normalized URL and stored in a flat file.
 func NewPage(u *url.URL) Page {
+	u = NormalizeURL(u)
 	site := path.Join(u.Host, u.Path)
 	return Page{
 		ID:           PageID(u.String()),
 		Site:         site,
-		FileLocation: url.PathEscape(site),
+		FileLocation: NamingFlat.FileLocation(u),
 	}
 }
+
+// AssetDirectory returns the location of the directory holding the assets of the Page, named after the file
+// of the Page without its extension, as the browsers save the pages.
+func (p Page) AssetDirectory() string {
+	name := strings.TrimSuffix(p.FileLocation, Extension(MediaTypeHTML))
+	name = strings.TrimSuffix(name, Extension(MediaTypeXHTML))
+	return name + "_files"
+}
+
+// AssetLocation returns the location of an asset referenced by the Page, such as an image or a stylesheet.
+// The asset is named after the hash of its URL, so an asset referenced several times is only stored once.
+func (p Page) AssetLocation(asset *url.URL) string {
+	sum := sha256.Sum256([]byte(asset.String()))
+	name := hex.EncodeToString(sum[:8])
+
+	// The extension is kept so the browser can guess the type of the asset when the page is opened offline.
+	ext := path.Ext(asset.Path)
+	if len(ext) > maxAssetExtLength || strings.ContainsFunc(strings.TrimPrefix(ext, "."), isNotAlphaNumeric) {
+		ext = ""
+	}
+
+	return path.Join(p.AssetDirectory(), name+ext)
+}
+
+func isNotAlphaNumeric(r rune) bool {
+	return !('a' <= r && r <= 'z') && !('A' <= r && r <= 'Z') && !('0' <= r && r <= '9')
+}
@@ -20,9 +20,18 @@ func TestNewPage(t *testing.T) {
 			name:  "without path",
 			input: "https://www.google.com",
 			expected: Page{
-				ID:           PageID("https://www.google.com"),
+				ID:           PageID("https://www.google.com/"),
 				Site:         "www.google.com",
-				FileLocation: "www.google.com",
+				FileLocation: "www.google.com-d0e196a0c25d35dd",
+			},
+		},
+		{
+			name:  "not normalized",
+			input: "HTTPS://WWW.Google.com:443/about#team",
+			expected: Page{
+				ID:           PageID("https://www.google.com/about"),
+				Site:         "www.google.com/about",
+				FileLocation: "www.google.com_about-d2bfc30fb9386b2a",
 			},
 		},
 		{
@@ -31,7 +40,7 @@ func TestNewPage(t *testing.T) {
 			expected: Page{
 				ID:           PageID("https://www.google.com/about"),
 				Site:         "www.google.com/about",
-				FileLocation: "www.google.com%2Fabout",
+				FileLocation: "www.google.com_about-d2bfc30fb9386b2a",
 			},
 		},
 	}
@@ -48,3 +57,46 @@ func TestNewPage(t *testing.T) {
 		})
 	}
 }
+
+func TestPage_AssetLocation(t *testing.T) {
+	t.Parallel()
+
+	page := Page{
+		ID:           PageID("https://www.google.com/about"),
+		Site:         "www.google.com/about",
+		FileLocation: "www.google.com%2Fabout.html",
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "with extension",
+			input:    "https://www.google.com/logo.png",
+			expected: "www.google.com%2Fabout_files/bc3c9344ab4c0e69.png",
+		},
+		{
+			name:     "without extension",
+			input:    "https://www.google.com/logo",
+			expected: "www.google.com%2Fabout_files/6ff852890831701e",
+		},
+		{
+			name:     "invalid extension",
+			input:    "https://www.google.com/logo.png;v=2",
+			expected: "www.google.com%2Fabout_files/f3cfcb232413551b",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			u, err := url.Parse(test.input)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.expected, page.AssetLocation(u))
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package domain
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// RunID identifies a Run, it starts with the time the run started so the ids sort in that order.
+type RunID string
+
+// String implements the Stringer interface for a RunID.
+func (id RunID) String() string {
+	return string(id)
+}
+
+// TaskStatus is the progress of the fetch of a RunTask.
+type TaskStatus string
+
+const (
+	// TaskPending reports the site is queued and not fetched yet.
+	TaskPending TaskStatus = "pending"
+	// TaskInProgress reports the site is being fetched, a task left in progress by an interrupted run is
+	// fetched again when the run is resumed.
+	TaskInProgress TaskStatus = "in_progress"
+	// TaskDone reports the site was fetched.
+	TaskDone TaskStatus = "done"
+	// TaskFailed reports the site could not be fetched, the LastError of the task tells why.
+	TaskFailed TaskStatus = "failed"
+)
+
+// Run represents a single invocation fetching a list of sites, its queue of RunTask is persisted so an
+// interrupted run can be resumed where it stopped.
+type Run struct {
+	ID      RunID
+	Started time.Time
+	// Sites and Input are the sites given to the run and the input the following sites are read from, so a
+	// resumed run reads the same sites.
+	Sites []string
+	Input string
+	// Read is the number of sites read from the Sites and the Input, a resumed run reads the sites after them.
+	Read int
+	// Tasks is the number of tasks of the run by status.
+	Tasks map[TaskStatus]int
+}
+
+// NewRun instantiates a new Run of the sites, followed by the sites read from the input, started at the given time.
+func NewRun(sites []string, input string, now time.Time) (Run, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return Run{}, fmt.Errorf("generate run id: %w", err)
+	}
+
+	now = now.UTC()
+	id := RunID(now.Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix))
+	return Run{ID: id, Started: now, Sites: sites, Input: input, Tasks: map[TaskStatus]int{}}, nil
+}
+
+// RunTask represents a site queued by a Run, either read from the sites of the run or found when crawling.
+type RunTask struct {
+	// ID identifies the task, the tasks of a run are fetched in the order of their ids.
+	ID  int64
+	Run RunID
+	// Site, Method, Header and Name describe the request of the site, as it was given to the run.
+	Site   string
+	Method string
+	Header map[string][]string
+	Name   string
+	// Depth is the number of links followed to reach the site when crawling, and Seed is the site the crawl
+	// started from. The sites read by the run have a zero Depth.
+	Depth int
+	Seed  string
+	// Status is the progress of the fetch of the site.
+	Status TaskStatus
+	// Attempts is the number of requests sent to fetch the site, over every time the run was resumed.
+	Attempts int
+	// LastError is the cause of the failure of the last fetch of the site, it is empty unless the task failed.
+	LastError string
+}
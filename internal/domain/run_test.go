@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRun(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.March, 15, 10, 7, 30, 0, time.FixedZone("CET", 3600))
+
+	run, err := NewRun([]string{"https://www.google.com"}, "sites.txt", now)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(run.ID.String(), "20240315T090730Z-"), run.ID)
+	assert.Len(t, run.ID.String(), len("20240315T090730Z-")+8)
+	assert.Equal(t, now.UTC(), run.Started)
+	assert.Equal(t, []string{"https://www.google.com"}, run.Sites)
+	assert.Equal(t, "sites.txt", run.Input)
+	assert.Empty(t, run.Tasks)
+
+	other, err := NewRun(nil, "", now)
+	require.NoError(t, err)
+	assert.NotEqual(t, run.ID, other.ID, "the runs started at the same time have different ids")
+}
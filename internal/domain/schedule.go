@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Schedule represents a site fetched periodically, either every Interval or at the times of a cron expression.
+type Schedule struct {
+	// ID identifies the page of the site, a site has at most one Schedule.
+	ID   PageID
+	Site string
+	// Interval is the time between two fetches, it is zero when the Schedule follows a cron expression.
+	Interval time.Duration
+	// Cron is the cron expression of the times the site is fetched at, it is empty when the Schedule
+	// follows an Interval.
+	Cron string
+	// NextRun is the time the site is due to be fetched.
+	NextRun time.Time
+	// LastRun is the time the site was last fetched on schedule, it is zero until then.
+	LastRun time.Time
+}
+
+// NewSchedule instantiates the Schedule of a site, fetched either every interval or at the times of the cron
+// expression. The site is due right away when fetched every interval, and at the first time of the cron
+// expression otherwise.
+func NewSchedule(site string, interval time.Duration, cron string, now time.Time) (Schedule, error) {
+	id, err := NewPageID(site)
+	if err != nil {
+		return Schedule{}, err
+	}
+	if (interval > 0) == (cron != "") {
+		return Schedule{}, errors.New("expected either an interval or a cron expression")
+	}
+	if interval < 0 {
+		return Schedule{}, fmt.Errorf("negative interval: %s", interval)
+	}
+
+	s := Schedule{ID: id, Site: site, Interval: interval, Cron: cron, NextRun: now}
+	if cron != "" {
+		c, err := ParseCron(cron)
+		if err != nil {
+			return Schedule{}, err
+		}
+		s.NextRun = c.Next(now)
+		if s.NextRun.IsZero() {
+			return Schedule{}, fmt.Errorf("cron %q never matches", cron)
+		}
+	}
+	return s, nil
+}
+
+// Next returns the time the site is due to be fetched after it was fetched at the given time.
+// It returns the zero time when the cron expression is invalid or never matches again.
+func (s Schedule) Next(after time.Time) time.Time {
+	if s.Cron == "" {
+		return after.Add(s.Interval)
+	}
+	c, err := ParseCron(s.Cron)
+	if err != nil {
+		return time.Time{}
+	}
+	return c.Next(after)
+}
+
+// Due reports whether the site is due to be fetched at the given time.
+func (s Schedule) Due(now time.Time) bool {
+	return !s.NextRun.IsZero() && !s.NextRun.After(now)
+}
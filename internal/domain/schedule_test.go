@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewSchedule(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.March, 15, 10, 7, 30, 0, time.UTC)
+
+	s, err := NewSchedule("https://www.google.com", time.Hour, "", now)
+	require.NoError(t, err)
+	assert.Equal(t, PageID("https://www.google.com/"), s.ID)
+	assert.True(t, s.Due(now), "an interval is due right away")
+	assert.Equal(t, now.Add(time.Hour), s.Next(now))
+
+	s, err = NewSchedule("https://www.google.com", 0, "@daily", now)
+	require.NoError(t, err)
+	assert.False(t, s.Due(now))
+	assert.Equal(t, time.Date(2024, time.March, 16, 0, 0, 0, 0, time.UTC), s.NextRun)
+	assert.Equal(t, time.Date(2024, time.March, 17, 0, 0, 0, 0, time.UTC), s.Next(s.NextRun))
+
+	for _, invalid := range []struct {
+		site     string
+		interval time.Duration
+		cron     string
+	}{
+		{site: "www.google.com", interval: time.Hour},
+		{site: "https://www.google.com"},
+		{site: "https://www.google.com", interval: time.Hour, cron: "@daily"},
+		{site: "https://www.google.com", interval: -time.Hour},
+		{site: "https://www.google.com", cron: "0 0 30 2 *"},
+	} {
+		_, err := NewSchedule(invalid.site, invalid.interval, invalid.cron, now)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,10 @@
+package domain
+
+// SnapshotID identifies an immutable copy of the content of a Page, it is derived from the hash of the content
+// so two fetches returning the same content share the same snapshot.
+type SnapshotID string
+
+// String implements the Stringer interface for a SnapshotID.
+func (id SnapshotID) String() string {
+	return string(id)
+}
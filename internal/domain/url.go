@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// defaultPorts maps the schemes to the port they use when the URL does not specify one.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// NormalizeURL returns the canonical form of the URL, so the different ways of writing the URL of a page
+// identify the same page. The scheme and the host are lower cased, internationalized hosts are converted
+// to punycode, the default port of the scheme and the fragment are removed, an empty path is replaced by "/",
+// the dot segments of the path are resolved and the query parameters are sorted by name.
+// The trailing slash of other paths is kept, as "/docs" and "/docs/" may be different pages.
+func NormalizeURL(u *url.URL) *url.URL {
+	normalized := *u
+	normalized.Scheme = strings.ToLower(u.Scheme)
+	normalized.Fragment = ""
+	normalized.RawFragment = ""
+	if normalized.Opaque != "" {
+		return &normalized
+	}
+
+	normalized.Host = normalizeHost(normalized.Scheme, u.Host)
+	if normalized.Path == "" {
+		normalized.Path = "/"
+		normalized.RawPath = ""
+	} else if strings.Contains(normalized.Path, "/.") {
+		// JoinPath resolves the dot segments and keeps the trailing slash.
+		normalized = *normalized.JoinPath()
+	}
+	normalized.RawQuery = sortQuery(u.RawQuery)
+	normalized.ForceQuery = false
+
+	return &normalized
+}
+
+// NewPageID returns the PageID identifying the page of the given URL.
+func NewPageID(rawURL string) (PageID, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("parse url: %w", err)
+	}
+	if u.Scheme == "" || (u.Host == "" && u.Opaque == "") {
+		return "", fmt.Errorf("url %q is not absolute", rawURL)
+	}
+
+	return PageID(NormalizeURL(u).String()), nil
+}
+
+// normalizeHost lower cases the host, converts it to punycode and removes the default port of the scheme.
+func normalizeHost(scheme string, host string) string {
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		// The host has no port.
+		hostname, port = host, ""
+	}
+	hostname = strings.ToLower(strings.Trim(hostname, "[]"))
+
+	if !isASCII(hostname) {
+		// The host is kept as is when it is not a valid domain name, the request will fail anyway.
+		if ascii, err := idna.Lookup.ToASCII(hostname); err == nil {
+			hostname = ascii
+		}
+	}
+
+	if port == defaultPorts[scheme] {
+		port = ""
+	}
+	if port != "" {
+		return net.JoinHostPort(hostname, port)
+	}
+	if strings.Contains(hostname, ":") {
+		// IPv6 addresses are always written between brackets.
+		return "[" + hostname + "]"
+	}
+	return hostname
+}
+
+// sortQuery sorts the parameters of the raw query by name. The parameters are not decoded, so their encoding
+// is kept, and the values of a parameter given several times keep their order.
+func sortQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	params := strings.FieldsFunc(rawQuery, func(r rune) bool { return r == '&' })
+	sort.SliceStable(params, func(i, j int) bool {
+		nameI, _, _ := strings.Cut(params[i], "=")
+		nameJ, _, _ := strings.Cut(params[j], "=")
+		return nameI < nameJ
+	})
+	return strings.Join(params, "&")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
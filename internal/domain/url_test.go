@@ -0,0 +1,105 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPageID(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		input     string
+		expected  PageID
+		assertErr assert.ErrorAssertionFunc
+	}{
+		{
+			name:      "already normalized",
+			input:     "https://example.com/",
+			expected:  "https://example.com/",
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "empty path",
+			input:     "https://example.com",
+			expected:  "https://example.com/",
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "case folding",
+			input:     "HTTPS://Example.COM/About",
+			expected:  "https://example.com/About",
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "default port",
+			input:     "http://example.com:80/docs/",
+			expected:  "http://example.com/docs/",
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "other port",
+			input:     "http://example.com:8080",
+			expected:  "http://example.com:8080/",
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "ipv6",
+			input:     "https://[::1]:443/",
+			expected:  "https://[::1]/",
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "fragment",
+			input:     "https://example.com/docs#intro",
+			expected:  "https://example.com/docs",
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "sorted query",
+			input:     "https://example.com/search?q=go&lang=en&q=html&page",
+			expected:  "https://example.com/search?lang=en&page&q=go&q=html",
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "empty query",
+			input:     "https://example.com/search?",
+			expected:  "https://example.com/search",
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "dot segments",
+			input:     "https://example.com/docs/./intro/../search/",
+			expected:  "https://example.com/docs/search/",
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "internationalized domain name",
+			input:     "https://Bücher.example/",
+			expected:  "https://xn--bcher-kva.example/",
+			assertErr: assert.NoError,
+		},
+		{
+			name:      "relative",
+			input:     "/docs",
+			assertErr: assert.Error,
+		},
+		{
+			name:      "invalid",
+			input:     "://example.com",
+			assertErr: assert.Error,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			id, err := NewPageID(test.input)
+			test.assertErr(t, err)
+			assert.Equal(t, test.expected, id)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package fetcher
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// insecurePrefix prefixes the host pattern of the rules whose credentials are also sent over plain HTTP.
+const insecurePrefix = "http://"
+
+// AuthRule authenticates the requests sent to the hosts matching its pattern, either with a username and
+// a password, or with a bearer token. The credentials are only sent over HTTPS unless AllowHTTP is set.
+type AuthRule struct {
+	// HostPattern is matched against the host of the requests, without its port. It is a pattern of the
+	// path.Match function, so *.example.com matches the subdomains of example.com but not example.com itself.
+	HostPattern string
+	Username    string
+	Password    string
+	Token       string
+	// AllowHTTP sends the credentials over plain HTTP as well, where anyone on the path can read them.
+	AllowHTTP bool
+}
+
+// ParseAuthRule returns the AuthRule of the given value, written as <host pattern>=basic:<username>:<password>
+// or <host pattern>=bearer:<token>. The credentials of a host pattern prefixed with http:// are also sent
+// over plain HTTP.
+func ParseAuthRule(value string) (AuthRule, error) {
+	pattern, credentials, ok := strings.Cut(value, "=")
+	if !ok || pattern == "" {
+		return AuthRule{}, fmt.Errorf("auth %q: expected <host pattern>=<credentials>", value)
+	}
+	pattern = strings.ToLower(pattern)
+	rule := AuthRule{
+		HostPattern: strings.TrimPrefix(pattern, insecurePrefix),
+		AllowHTTP:   strings.HasPrefix(pattern, insecurePrefix),
+	}
+	if rule.HostPattern == "" {
+		return AuthRule{}, fmt.Errorf("auth %q: expected <host pattern>=<credentials>", value)
+	}
+	if _, err := path.Match(rule.HostPattern, ""); err != nil {
+		return AuthRule{}, fmt.Errorf("auth %q: invalid host pattern: %w", value, err)
+	}
+
+	scheme, secret, _ := strings.Cut(credentials, ":")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		username, password, ok := strings.Cut(secret, ":")
+		if !ok || username == "" {
+			return AuthRule{}, fmt.Errorf("auth %q: expected basic:<username>:<password>", value)
+		}
+		rule.Username, rule.Password = username, password
+	case "bearer":
+		if secret == "" {
+			return AuthRule{}, fmt.Errorf("auth %q: expected bearer:<token>", value)
+		}
+		rule.Token = secret
+	default:
+		return AuthRule{}, fmt.Errorf("auth %q: unknown scheme %q, expected basic or bearer", value, scheme)
+	}
+	return rule, nil
+}
+
+// matches reports whether the rule applies to the given host.
+func (r AuthRule) matches(host string) bool {
+	matched, _ := path.Match(r.HostPattern, strings.ToLower(host))
+	return matched
+}
+
+// secures reports whether the credentials of the rule can be sent with the request, over HTTPS or over plain
+// HTTP once allowed.
+func (r AuthRule) secures(req *http.Request) bool {
+	return req.URL.Scheme == "https" || (r.AllowHTTP && req.URL.Scheme == "http")
+}
+
+// apply sets the Authorization header of the request.
+func (r AuthRule) apply(req *http.Request) {
+	if r.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.Token)
+		return
+	}
+	req.SetBasicAuth(r.Username, r.Password)
+}
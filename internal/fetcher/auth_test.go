@@ -0,0 +1,73 @@
+package fetcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAuthRule(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		value     string
+		expected  AuthRule
+		assertErr assert.ErrorAssertionFunc
+	}{
+		{
+			value:     "*.Example.com=basic:user:pa:ss",
+			expected:  AuthRule{HostPattern: "*.example.com", Username: "user", Password: "pa:ss"},
+			assertErr: assert.NoError,
+		},
+		{
+			value:     "api.example.com=bearer:token",
+			expected:  AuthRule{HostPattern: "api.example.com", Token: "token"},
+			assertErr: assert.NoError,
+		},
+		{
+			value:     "http://Intranet.example.com=bearer:token",
+			expected:  AuthRule{HostPattern: "intranet.example.com", Token: "token", AllowHTTP: true},
+			assertErr: assert.NoError,
+		},
+		{
+			value:     "api.example.com",
+			assertErr: assert.Error,
+		},
+		{
+			value:     "http://=bearer:token",
+			assertErr: assert.Error,
+		},
+		{
+			value:     "[=bearer:token",
+			assertErr: assert.Error,
+		},
+		{
+			value:     "api.example.com=basic:user",
+			assertErr: assert.Error,
+		},
+		{
+			value:     "api.example.com=digest:user:password",
+			assertErr: assert.Error,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			t.Parallel()
+
+			rule, err := ParseAuthRule(test.value)
+			test.assertErr(t, err)
+			assert.Equal(t, test.expected, rule)
+		})
+	}
+}
+
+func TestAuthRule_Matches(t *testing.T) {
+	t.Parallel()
+
+	rule := AuthRule{HostPattern: "*.example.com"}
+	assert.True(t, rule.matches("intranet.example.com"))
+	assert.True(t, rule.matches("Intranet.Example.com"))
+	assert.False(t, rule.matches("example.com"))
+	assert.False(t, rule.matches("intranet.example.org"))
+}
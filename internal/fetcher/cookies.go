@@ -0,0 +1,248 @@
+package fetcher
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// netscapeHeader is the first line of the cookies files, as written by curl and the browser extensions.
+	netscapeHeader = "# Netscape HTTP Cookie File"
+	// httpOnlyPrefix prefixes the domain of the HttpOnly cookies in a cookies file.
+	httpOnlyPrefix = "#HttpOnly_"
+)
+
+// CookieJar implements the http.CookieJar interface, its cookies can be loaded from and saved to a file
+// in the Netscape format used by curl and wget, so a session opened in a browser can be reused.
+type CookieJar struct {
+	mu      sync.Mutex
+	cookies []jarCookie
+	now     func() time.Time
+}
+
+// jarCookie is a cookie along with the attributes deciding which requests it is sent with.
+type jarCookie struct {
+	domain string
+	// hostOnly cookies are only sent to their domain, not to its subdomains.
+	hostOnly bool
+	path     string
+	secure   bool
+	httpOnly bool
+	// expires is zero for the session cookies.
+	expires time.Time
+	name    string
+	value   string
+}
+
+// NewCookieJar returns an empty CookieJar.
+func NewCookieJar() *CookieJar {
+	return &CookieJar{now: time.Now}
+}
+
+// SetCookies implements the http.CookieJar interface.
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	host := strings.ToLower(u.Hostname())
+	now := j.now()
+	for _, cookie := range cookies {
+		c := jarCookie{
+			domain:   host,
+			hostOnly: true,
+			path:     cookie.Path,
+			secure:   cookie.Secure,
+			httpOnly: cookie.HttpOnly,
+			name:     cookie.Name,
+			value:    cookie.Value,
+		}
+		if cookie.Domain != "" {
+			domain := strings.TrimPrefix(strings.ToLower(cookie.Domain), ".")
+			// A host can only set the cookies of its own domain.
+			if !domainMatch(host, domain) {
+				continue
+			}
+			c.domain, c.hostOnly = domain, false
+		}
+		if !strings.HasPrefix(c.path, "/") {
+			c.path = defaultPath(u.Path)
+		}
+		switch {
+		case cookie.MaxAge < 0:
+			c.expires = now
+		case cookie.MaxAge > 0:
+			c.expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		default:
+			c.expires = cookie.Expires
+		}
+		j.set(c, now)
+	}
+}
+
+// Cookies implements the http.CookieJar interface.
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	host := strings.ToLower(u.Hostname())
+	requestPath := u.EscapedPath()
+	if requestPath == "" {
+		requestPath = "/"
+	}
+	now := j.now()
+
+	var matching []jarCookie
+	for _, c := range j.cookies {
+		switch {
+		case c.expired(now):
+		case c.hostOnly && host != c.domain:
+		case !c.hostOnly && !domainMatch(host, c.domain):
+		case !pathMatch(requestPath, c.path):
+		case c.secure && u.Scheme != "https":
+		default:
+			matching = append(matching, c)
+		}
+	}
+
+	// The cookies of the most specific paths are sent first.
+	sort.SliceStable(matching, func(a, b int) bool {
+		return len(matching[a].path) > len(matching[b].path)
+	})
+	cookies := make([]*http.Cookie, len(matching))
+	for i, c := range matching {
+		cookies[i] = &http.Cookie{Name: c.name, Value: c.value}
+	}
+	return cookies
+}
+
+// Load adds the cookies of the Netscape cookies file read from r, the expired cookies are skipped.
+func (j *CookieJar) Load(r io.Reader) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := j.now()
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+		line = strings.TrimPrefix(line, httpOnlyPrefix)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return fmt.Errorf("line %d: expected 7 fields, got %d", lineNumber, len(fields))
+		}
+		expires, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid expiry: %w", lineNumber, err)
+		}
+
+		c := jarCookie{
+			domain:   strings.TrimPrefix(strings.ToLower(fields[0]), "."),
+			hostOnly: !strings.EqualFold(fields[1], "TRUE"),
+			path:     fields[2],
+			secure:   strings.EqualFold(fields[3], "TRUE"),
+			httpOnly: httpOnly,
+			name:     fields[5],
+			value:    fields[6],
+		}
+		if expires > 0 {
+			c.expires = time.Unix(expires, 0)
+		}
+		j.set(c, now)
+	}
+	return scanner.Err()
+}
+
+// Save writes the cookies of the jar to w, in the Netscape format. The session cookies are saved as well,
+// so the session goes on with the next run.
+func (j *CookieJar) Save(w io.Writer) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	buffered := bufio.NewWriter(w)
+	fmt.Fprintf(buffered, "%s\n\n", netscapeHeader)
+	now := j.now()
+	for _, c := range j.cookies {
+		if c.expired(now) {
+			continue
+		}
+		domain := c.domain
+		if !c.hostOnly {
+			domain = "." + domain
+		}
+		if c.httpOnly {
+			domain = httpOnlyPrefix + domain
+		}
+		var expires int64
+		if !c.expires.IsZero() {
+			expires = c.expires.Unix()
+		}
+		fmt.Fprintf(buffered, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			domain, formatBool(!c.hostOnly), c.path, formatBool(c.secure), expires, c.name, c.value)
+	}
+	return buffered.Flush()
+}
+
+// set replaces the cookie of the same domain, path and name, the expired cookies are removed.
+func (j *CookieJar) set(c jarCookie, now time.Time) {
+	for i, existing := range j.cookies {
+		if existing.domain == c.domain && existing.path == c.path && existing.name == c.name {
+			j.cookies = append(j.cookies[:i], j.cookies[i+1:]...)
+			break
+		}
+	}
+	if !c.expired(now) {
+		j.cookies = append(j.cookies, c)
+	}
+}
+
+// expired reports whether the cookie expired, the session cookies never do.
+func (c jarCookie) expired(now time.Time) bool {
+	return !c.expires.IsZero() && !c.expires.After(now)
+}
+
+// domainMatch reports whether the host belongs to the domain, an IP address only matches itself.
+func domainMatch(host string, domain string) bool {
+	if host == domain {
+		return true
+	}
+	return strings.HasSuffix(host, "."+domain) && net.ParseIP(host) == nil
+}
+
+// pathMatch reports whether the path of the request is within the path of the cookie.
+func pathMatch(requestPath string, cookiePath string) bool {
+	if !strings.HasPrefix(requestPath, cookiePath) {
+		return false
+	}
+	return len(requestPath) == len(cookiePath) ||
+		strings.HasSuffix(cookiePath, "/") ||
+		requestPath[len(cookiePath)] == '/'
+}
+
+// defaultPath returns the path of the cookies which do not set theirs: the directory of the request path.
+func defaultPath(requestPath string) string {
+	i := strings.LastIndex(requestPath, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return requestPath[:i]
+}
+
+func formatBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
@@ -0,0 +1,87 @@
+package fetcher
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cookieNames(cookies []*http.Cookie) []string {
+	names := make([]string, len(cookies))
+	for i, cookie := range cookies {
+		names[i] = cookie.Name + "=" + cookie.Value
+	}
+	return names
+}
+
+func TestCookieJar(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 17, 14, 43, 0, 0, time.UTC)
+	jar := NewCookieJar()
+	jar.now = func() time.Time { return now }
+
+	site, err := url.Parse("https://www.example.com/docs/page")
+	require.NoError(t, err)
+	jar.SetCookies(site, []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "domain", Value: "2", Domain: ".example.com", Path: "/"},
+		{Name: "secure", Value: "3", Path: "/", Secure: true},
+		{Name: "expired", Value: "4", Path: "/", Expires: now.Add(-time.Hour)},
+		{Name: "other", Value: "5", Domain: "example.org"},
+	})
+
+	tests := []struct {
+		site     string
+		expected []string
+	}{
+		{site: "https://www.example.com/docs/other", expected: []string{"host=1", "domain=2", "secure=3"}},
+		{site: "http://www.example.com/docs", expected: []string{"host=1", "domain=2"}},
+		{site: "https://www.example.com/", expected: []string{"domain=2", "secure=3"}},
+		{site: "https://api.example.com/docs", expected: []string{"domain=2"}},
+		{site: "https://www.example.com/documents", expected: []string{"domain=2", "secure=3"}},
+		{site: "https://example.org/", expected: []string{}},
+	}
+	for _, test := range tests {
+		u, err := url.Parse(test.site)
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, cookieNames(jar.Cookies(u)), test.site)
+	}
+
+	t.Run("removed by max age", func(t *testing.T) {
+		jar.SetCookies(site, []*http.Cookie{{Name: "host", MaxAge: -1}})
+		assert.Equal(t, []string{"domain=2", "secure=3"}, cookieNames(jar.Cookies(site)))
+	})
+}
+
+func TestCookieJar_LoadSave(t *testing.T) {
+	t.Parallel()
+
+	content := "# Netscape HTTP Cookie File\n" +
+		"\n" +
+		".example.com\tTRUE\t/\tFALSE\t0\tsession\topened\n" +
+		"#HttpOnly_intranet.example.com\tFALSE\t/app\tTRUE\t4102444800\tsso\ttoken\n" +
+		"old.example.com\tFALSE\t/\tFALSE\t1\texpired\tvalue\n"
+
+	jar := NewCookieJar()
+	require.NoError(t, jar.Load(strings.NewReader(content)))
+
+	u, err := url.Parse("https://intranet.example.com/app/home")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sso=token", "session=opened"}, cookieNames(jar.Cookies(u)))
+
+	var saved bytes.Buffer
+	require.NoError(t, jar.Save(&saved))
+	assert.Equal(t, "# Netscape HTTP Cookie File\n"+
+		"\n"+
+		".example.com\tTRUE\t/\tFALSE\t0\tsession\topened\n"+
+		"#HttpOnly_intranet.example.com\tFALSE\t/app\tTRUE\t4102444800\tsso\ttoken\n", saved.String())
+
+	assert.Error(t, NewCookieJar().Load(strings.NewReader("example.com\tTRUE\t/\n")))
+}
@@ -0,0 +1,182 @@
+package fetcher
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// acceptEncoding lists the content encodings the Client decodes, sent with every request.
+	acceptEncoding = "gzip, deflate, br, zstd"
+	// maxCompressionRatio is the largest ratio between the decoded and the encoded size of a response, the
+	// pages compress at most a few dozen times while a decompression bomb compresses thousands of times.
+	maxCompressionRatio = 200
+	// minBombSize is the decoded size from which the compression ratio is checked, so the small responses
+	// which compress well are never rejected.
+	minBombSize = 1 << 20
+	// maxZstdWindow bounds the memory the zstd decoder allocates for a response.
+	maxZstdWindow = 8 << 20
+)
+
+var (
+	// ErrBodyTooLarge is returned when the body of a response is larger than the maximum size of the Client.
+	ErrBodyTooLarge = errors.New("response body too large")
+	// ErrDecompressionBomb is returned when the body of a response decodes to a lot more than it weighs.
+	ErrDecompressionBomb = errors.New("decompression bomb")
+)
+
+// decodeBody replaces the body of the response with its decoded content, as described by the Content-Encoding
+// header, and drops the headers describing the encoded content, as the http.Transport does when it decodes
+// the gzip responses itself. The decoded body is bounded to maxSize bytes, unless maxSize is zero, and to
+// maxCompressionRatio times the size of the encoded body.
+func decodeBody(resp *http.Response, maxSize int64) error {
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		return fmt.Errorf("%w: %d bytes", ErrBodyTooLarge, resp.ContentLength)
+	}
+
+	var encodings []string
+	for _, encoding := range strings.Split(resp.Header.Get("Content-Encoding"), ",") {
+		encoding = strings.ToLower(strings.TrimSpace(encoding))
+		if encoding != "" && encoding != "identity" {
+			encodings = append(encodings, encoding)
+		}
+	}
+
+	encoded := &countingReader{reader: resp.Body}
+	body := io.Reader(encoded)
+	closers := []io.Closer{resp.Body}
+	// The encodings are listed in the order they were applied, they are decoded the other way around.
+	for i := len(encodings) - 1; i >= 0; i-- {
+		decoder, err := newDecoder(encodings[i], body)
+		if err != nil {
+			closeAll(closers)
+			return err
+		}
+		body = decoder
+		closers = append([]io.Closer{decoder}, closers...)
+	}
+
+	limited := &limitedBody{reader: body, closers: closers, maxSize: maxSize}
+	if len(encodings) > 0 {
+		limited.encoded = encoded
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	resp.Body = limited
+	return nil
+}
+
+// newDecoder returns the reader decoding the content encoded with the given encoding.
+func newDecoder(encoding string, r io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		decoder, err := gzip.NewReader(r)
+		// An empty body has no header, it decodes to an empty body.
+		if errors.Is(err, io.EOF) {
+			return http.NoBody, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read gzip header: %w", err)
+		}
+		return decoder, nil
+	case "deflate":
+		// The deflate encoding is the zlib format, yet some servers send the raw deflate format.
+		buffered := bufio.NewReader(r)
+		header, err := buffered.Peek(2)
+		if errors.Is(err, io.EOF) && len(header) == 0 {
+			return http.NoBody, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read deflate header: %w", err)
+		}
+		if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			decoder, err := zlib.NewReader(buffered)
+			if err != nil {
+				return nil, fmt.Errorf("read zlib header: %w", err)
+			}
+			return decoder, nil
+		}
+		return flate.NewReader(buffered), nil
+	case "br":
+		return io.NopCloser(brotli.NewReader(r)), nil
+	case "zstd":
+		decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(maxZstdWindow))
+		if err != nil {
+			return nil, fmt.Errorf("new zstd decoder: %w", err)
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding: %s", encoding)
+	}
+}
+
+// closeAll closes the closers, ignoring their errors.
+func closeAll(closers []io.Closer) {
+	for _, closer := range closers {
+		_ = closer.Close()
+	}
+}
+
+// limitedBody is the decoded body of a response, failing once it exceeds the maximum size or the maximum
+// compression ratio of its encoded content, if any.
+type limitedBody struct {
+	reader  io.Reader
+	closers []io.Closer
+	maxSize int64
+	encoded *countingReader
+	read    int64
+	err     error
+}
+
+// Read implements the io.Reader interface.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+
+	n, err := b.reader.Read(p)
+	b.read += int64(n)
+	switch {
+	case b.maxSize > 0 && b.read > b.maxSize:
+		b.err = fmt.Errorf("%w: more than %d bytes", ErrBodyTooLarge, b.maxSize)
+	case b.encoded != nil && b.read > minBombSize && b.read > maxCompressionRatio*b.encoded.count:
+		b.err = fmt.Errorf("%w: %d bytes decoded from %d bytes", ErrDecompressionBomb, b.read, b.encoded.count)
+	default:
+		return n, err
+	}
+	return 0, b.err
+}
+
+// Close implements the io.Closer interface, it closes the decoders and the body of the response.
+func (b *limitedBody) Close() error {
+	var errs []error
+	for _, closer := range b.closers {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+// Read implements the io.Reader interface.
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
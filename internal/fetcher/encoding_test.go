@@ -0,0 +1,134 @@
+package fetcher
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gsiffert/fetch/internal/service"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encode encodes the content with the given content encoding.
+func encode(t *testing.T, encoding string, content []byte) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	var writer io.WriteCloser
+	var err error
+	switch encoding {
+	case "gzip":
+		writer = gzip.NewWriter(buf)
+	case "deflate":
+		writer = zlib.NewWriter(buf)
+	case "raw-deflate":
+		writer, err = flate.NewWriter(buf, flate.DefaultCompression)
+	case "br":
+		writer = brotli.NewWriter(buf)
+	case "zstd":
+		writer, err = zstd.NewWriter(buf)
+	}
+	require.NoError(t, err)
+	_, err = writer.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestClient_Fetch_ContentEncoding(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		header   string
+		encoding []string
+	}{
+		{name: "identity", header: ""},
+		{name: "gzip", header: "gzip", encoding: []string{"gzip"}},
+		{name: "deflate", header: "deflate", encoding: []string{"deflate"}},
+		{name: "raw deflate", header: "deflate", encoding: []string{"raw-deflate"}},
+		{name: "brotli", header: "br", encoding: []string{"br"}},
+		{name: "zstd", header: "zstd", encoding: []string{"zstd"}},
+		{name: "several encodings", header: "gzip, br", encoding: []string{"gzip", "br"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			body := []byte(htmlContent)
+			for _, encoding := range test.encoding {
+				body = encode(t, encoding, body)
+			}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, acceptEncoding, r.Header.Get("Accept-Encoding"))
+				w.Header().Set("Content-Type", htmlContentType)
+				if test.header != "" {
+					w.Header().Set("Content-Encoding", test.header)
+				}
+				_, _ = w.Write(body)
+			}))
+			defer srv.Close()
+
+			client := New(srv.Client())
+			item, err := client.Fetch(context.Background(), service.FetchRequest{Site: srv.URL})
+			require.NoError(t, err)
+			defer item.Close()
+
+			content, err := io.ReadAll(item.Content)
+			require.NoError(t, err)
+			assert.Equal(t, htmlContent, string(content))
+			assert.Equal(t, htmlContentType, item.ContentType)
+			// The stored response describes the decoded content.
+			assert.Empty(t, item.Exchange.ResponseHeader.Get("Content-Encoding"))
+		})
+	}
+}
+
+func TestClient_Fetch_MaxBodySize(t *testing.T) {
+	t.Parallel()
+
+	page := "<html><body>" + strings.Repeat("a", 1500) + "</body></html>"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", htmlContentType)
+		switch r.URL.Path {
+		case "/chunked":
+			// The size of the body is not announced, it is only known once read.
+			w.(http.Flusher).Flush()
+		case "/bomb":
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(encode(t, "gzip", []byte("<html>"+strings.Repeat(" ", 4*minBombSize))))
+			return
+		}
+		_, _ = w.Write([]byte(page))
+	}))
+	defer srv.Close()
+
+	client := New(srv.Client(), WithMaxBodySize(1024))
+
+	_, err := client.Fetch(context.Background(), service.FetchRequest{Site: srv.URL + "/announced"})
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	item, err := client.Fetch(context.Background(), service.FetchRequest{Site: srv.URL + "/chunked"})
+	require.NoError(t, err)
+	_, err = io.ReadAll(item.Content)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+	require.NoError(t, item.Close())
+
+	client = New(srv.Client())
+	item, err = client.Fetch(context.Background(), service.FetchRequest{Site: srv.URL + "/bomb"})
+	require.NoError(t, err)
+	_, err = io.ReadAll(item.Content)
+	assert.ErrorIs(t, err, ErrDecompressionBomb)
+	require.NoError(t, item.Close())
+}
@@ -2,67 +2,343 @@
 package fetcher
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
-	"github.com/eapache/go-resiliency/retrier"
 	"github.com/gsiffert/fetch/internal/domain"
 	"github.com/gsiffert/fetch/internal/service"
 )
 
 const (
-	maxRetries        = 5
-	initialRetryDelay = 100 * time.Millisecond
-	htmlContentType   = "text/html"
+	// sniffLength is the number of bytes read ahead to recognize the type of a content, as many as
+	// http.DetectContentType considers.
+	sniffLength = 512
 )
 
-var retryErr = errors.New("retry")
-
 // Client to Fetch webpages.
 type Client struct {
 	httpClient *http.Client
+	robots     *robotsCache
+	limiter    *hostLimiter
+	retrier    *retrier
+	// accepted lists the patterns of the media types of the pages fetched, the other pages are rejected.
+	accepted []string
+	// maxBodySize is the maximum size of the decoded body of the responses, zero does not limit it.
+	maxBodySize int64
+}
+
+// Option configures optional behaviours of the Client.
+type Option func(c *Client)
+
+// WithRobots makes the Client honor the robots.txt file of the hosts for the given user agent.
+// The URLs disallowed by the robots.txt file fail with service.ErrDisallowedByRobots.
+func WithRobots(userAgent string) Option {
+	return func(c *Client) {
+		c.robots = newRobotsCache(c.httpClient, userAgent)
+	}
+}
+
+// WithHostLimit limits the requests sent to each host to maxInFlight concurrent requests, started at least
+// minDelay apart. The Crawl-delay of the robots.txt file and the Retry-After header of the responses
+// are honored as well. A maxInFlight of zero does not limit the number of concurrent requests.
+func WithHostLimit(maxInFlight int, minDelay time.Duration) Option {
+	return func(c *Client) {
+		c.limiter = newHostLimiter(maxInFlight, minDelay)
+	}
+}
+
+// WithRetryPolicy makes the Client retry the failed requests as the RetryPolicy decides, the
+// DefaultRetryPolicy is used otherwise.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retrier = newRetrier(policy)
+	}
+}
+
+// WithAcceptedTypes makes the Client accept the pages of the media types matching the patterns, such as
+// application/pdf or image/*, only the HTML pages are accepted by default.
+func WithAcceptedTypes(patterns ...string) Option {
+	return func(c *Client) {
+		c.accepted = patterns
+	}
+}
+
+// WithMaxBodySize makes the Client fail the responses whose decoded body is larger than maxSize bytes
+// with ErrBodyTooLarge, as soon as they are known to be. A maxSize of zero does not limit the size of the bodies.
+func WithMaxBodySize(maxSize int64) Option {
+	return func(c *Client) {
+		c.maxBodySize = maxSize
+	}
 }
 
 // New returns a new Client.
-func New(httpClient *http.Client) *Client {
-	return &Client{httpClient: httpClient}
+func New(httpClient *http.Client, opts ...Option) *Client {
+	c := &Client{
+		httpClient: httpClient,
+		retrier:    newRetrier(DefaultRetryPolicy()),
+		accepted:   domain.DefaultAcceptedMediaTypes,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
-// Fetch queries the page from the given site and returns a service.FetchedItem.
-// It retries on network errors and server errors.
-func (c *Client) Fetch(ctx context.Context, site string) (*service.FetchedItem, error) {
-	r := retrier.New(retrier.ExponentialBackoff(maxRetries, initialRetryDelay), retrier.WhitelistClassifier{retryErr})
-
-	var fetchedItem *service.FetchedItem
-	err := r.Run(func() error {
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, site, nil)
-		if err != nil {
-			return fmt.Errorf("new request: %w", err)
-		}
+// checkRobots returns service.ErrDisallowedByRobots if the robots.txt file of the host disallows the URL,
+// otherwise it returns the Crawl-delay of the host.
+func (c *Client) checkRobots(ctx context.Context, u *url.URL) (time.Duration, error) {
+	if c.robots == nil {
+		return 0, nil
+	}
+
+	rules, err := c.robots.rules(ctx, u)
+	if err != nil {
+		return 0, fmt.Errorf("get robots.txt: %w", err)
+	}
+	if !rules.allowed(u) {
+		return 0, fmt.Errorf("%s: %w", u, service.ErrDisallowedByRobots)
+	}
+	return rules.crawlDelay, nil
+}
+
+// acquire waits until a request can be sent to the host and returns the function releasing it.
+func (c *Client) acquire(ctx context.Context, host string, crawlDelay time.Duration) (func(), error) {
+	if c.limiter == nil {
+		return func() {}, nil
+	}
+	return c.limiter.acquire(ctx, host, crawlDelay)
+}
 
-		resp, err := c.httpClient.Do(req)
-		if err != nil {
-			return errors.Join(fmt.Errorf("do request: %w", err), retryErr)
+// get queries the given site with the given method and headers until it gets a successful response or the retries are exhausted.
+// The body of the 200 responses is decoded as described by their Content-Encoding header and bounded to the maximum
+// size of the Client. The validate function is then called, a non nil error fails the query without retrying.
+// When the headers make the request conditional, a 304 response is successful as well.
+// It retries on network errors and on the status codes of the RetryPolicy, and honors the robots.txt file and
+// the limits of the host when enabled. It returns the response along with the time its request was sent and the
+// number of attempts made. Once a request was sent, the error is a service.FetchError.
+func (c *Client) get(
+	ctx context.Context,
+	method string,
+	site string,
+	header http.Header,
+	validate func(*http.Response) error,
+) (*http.Response, time.Time, int, error) {
+	u, err := url.Parse(site)
+	if err != nil {
+		return nil, time.Time{}, 0, fmt.Errorf("parse site: %w", err)
+	}
+
+	crawlDelay, err := c.checkRobots(ctx, u)
+	if err != nil {
+		return nil, time.Time{}, 0, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, started, retryAfter, retryable, err := c.attempt(ctx, method, u, header, crawlDelay, validate)
+		if err == nil {
+			return resp, started, attempt, nil
 		}
 
 		switch {
-		case resp.StatusCode >= http.StatusInternalServerError:
-			return errors.Join(fmt.Errorf("unexpected server error: %d", resp.StatusCode), retryErr)
-		case resp.StatusCode != http.StatusOK:
-			return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-		case !strings.Contains(resp.Header.Get("Content-Type"), htmlContentType):
-			return fmt.Errorf("unexpected content type: %s", resp.Header.Get("Content-Type"))
+		case !retryable || attempt >= c.retrier.policy.Attempts:
+		case !c.retrier.take():
+			err = fmt.Errorf("%w: %w", ErrRetryBudgetExhausted, err)
 		default:
+			if waitErr := wait(ctx, c.retrier.delay(attempt, retryAfter)); waitErr != nil {
+				err = errors.Join(err, waitErr)
+				break
+			}
+			continue
+		}
+		return nil, started, attempt, &service.FetchError{Attempts: attempt, Err: err}
+	}
+}
+
+// attempt sends the request once. When it fails, it reports whether the request may be retried, and how long
+// the server asked to wait before retrying, if it did.
+func (c *Client) attempt(
+	ctx context.Context,
+	method string,
+	u *url.URL,
+	header http.Header,
+	crawlDelay time.Duration,
+	validate func(*http.Response) error,
+) (resp *http.Response, started time.Time, retryAfter time.Duration, retryable bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, started, 0, false, fmt.Errorf("new request: %w", err)
+	}
+	if header != nil {
+		req.Header = header.Clone()
+	}
+	if req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+
+	release, err := c.acquire(ctx, u.Host, crawlDelay)
+	if err != nil {
+		return nil, started, 0, false, fmt.Errorf("wait for host: %w", err)
+	}
+
+	started = time.Now()
+	resp, err = c.httpClient.Do(req)
+	if err != nil {
+		release()
+		// The request is not retried once the run is canceled.
+		return nil, started, 0, ctx.Err() == nil, fmt.Errorf("do request: %w", err)
+	}
+
+	retryAfter, hasRetryAfter := parseRetryAfter(resp, time.Now())
+	// The server asks us to slow down, no request is sent to the host until the delay is over.
+	isThrottled := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+	if hasRetryAfter && isThrottled && c.limiter != nil {
+		c.limiter.delay(u.Host, time.Now().Add(retryAfter))
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && isConditional(req.Header):
+	case c.retrier.retryableStatus(resp.StatusCode):
+		retryable = true
+		err = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		err = fmt.Errorf("unexpected server error: %d", resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		err = fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	default:
+		if err = decodeBody(resp, c.maxBodySize); err == nil {
+			err = validate(resp)
 		}
+	}
+	if err != nil {
+		_ = resp.Body.Close()
+		release()
+		return nil, started, retryAfter, retryable, err
+	}
+
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: release}
+	return resp, started, 0, false, nil
+}
 
-		page := domain.NewPage(req.URL)
-		fetchedItem = &service.FetchedItem{Page: page, Content: resp.Body}
+// isConditional reports whether the headers make the request conditional.
+func isConditional(header http.Header) bool {
+	return header.Get("If-None-Match") != "" || header.Get("If-Modified-Since") != ""
+}
+
+// Fetch queries the page from the given site and returns a service.FetchedItem.
+// The request is sent with the method and the headers of the service.FetchRequest, GET by default.
+// When the request holds the validators of a previous fetch, the request is conditional and
+// the service.FetchedItem is NotModified if the server reports the page did not change.
+// It retries the failed requests as the RetryPolicy of the Client decides. The media type of the page is
+// sniffed from its first bytes when the Content-Type header is missing or wrong, the pages of a media type
+// the Client does not accept are rejected.
+func (c *Client) Fetch(ctx context.Context, request service.FetchRequest) (*service.FetchedItem, error) {
+	site := request.Site
+	method := request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	header := request.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if request.ETag != "" {
+		header.Set("If-None-Match", request.ETag)
+	}
+	if request.LastModified != "" {
+		header.Set("If-Modified-Since", request.LastModified)
+	}
+
+	if u, err := url.Parse(site); err == nil {
+		ctx = withSiteHost(ctx, u.Host)
+	}
+
+	var mediaType string
+	resp, started, attempts, err := c.get(ctx, method, site, header, func(resp *http.Response) error {
+		body := bufio.NewReaderSize(resp.Body, sniffLength)
+		head, err := body.Peek(sniffLength)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("read content: %w", err)
+		}
+		resp.Body = &sniffedBody{Reader: body, Closer: resp.Body}
+
+		mediaType = sniffMediaType(domain.ParseMediaType(resp.Header.Get("Content-Type")), head)
+		if !domain.MatchMediaType(c.accepted, mediaType) {
+			return fmt.Errorf("unexpected content type: %s", mediaType)
+		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The page is identified by the URL we were redirected to, so the different URLs redirecting to a page
+	// all resolve to the same page.
+	page := domain.NewPage(resp.Request.URL)
+	return &service.FetchedItem{
+		Page:    page,
+		Content: resp.Body,
+		Exchange: service.Exchange{
+			Method:         resp.Request.Method,
+			URL:            resp.Request.URL.String(),
+			RequestHeader:  resp.Request.Header.Clone(),
+			Proto:          resp.Proto,
+			StatusCode:     resp.StatusCode,
+			ResponseHeader: resp.Header.Clone(),
+			Started:        started,
+		},
+		ContentType:  mediaType,
+		Attempts:     attempts,
+		NotModified:  resp.StatusCode == http.StatusNotModified,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// sniffMediaType returns the media type of a content from the media type declared by the server and the first
+// bytes of the content. The declared media type is trusted, unless it is missing or generic, or the content
+// starts with the signature of a binary format of another type, such as a PDF file served as text/html.
+func sniffMediaType(declared string, head []byte) string {
+	sniffed := domain.ParseMediaType(http.DetectContentType(head))
+	isBinary := !strings.HasPrefix(sniffed, "text/") && sniffed != domain.MediaTypeUnknown
+
+	switch {
+	case declared == "" || declared == domain.MediaTypeUnknown:
+		return sniffed
+	// The servers often declare the documents they do not know the type of as plain text.
+	case declared == domain.MediaTypeText && sniffed != domain.MediaTypeUnknown:
+		return sniffed
+	case isBinary && sniffed != declared:
+		return sniffed
+	default:
+		return declared
+	}
+}
+
+// sniffedBody is the body of a response whose first bytes were read ahead to sniff its media type.
+type sniffedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// FetchAsset queries a resource referenced by a page of the site, such as an image or a stylesheet, and returns
+// its content. Unlike Fetch, any content type is accepted. The assets served by the host of the site are
+// requested with the same headers as the site.
+func (c *Client) FetchAsset(ctx context.Context, site string, asset string) (io.ReadCloser, error) {
+	if u, err := url.Parse(site); err == nil {
+		ctx = withSiteHost(ctx, u.Host)
+	}
+
+	resp, _, _, err := c.get(ctx, http.MethodGet, asset, nil, func(*http.Response) error { return nil })
+	if err != nil {
+		return nil, err
+	}
 
-	return fetchedItem, err
+	return resp.Body, nil
 }
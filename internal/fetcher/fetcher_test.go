@@ -5,14 +5,20 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/gsiffert/fetch/internal/service"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+const htmlContentType = "text/html"
+
 const htmlContent = `
 <!DOCTYPE html>
 <html>
@@ -31,7 +37,7 @@ type retryInternalErrorServer struct {
 
 func (s *retryInternalErrorServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.count++
-	if s.count < maxRetries-1 {
+	if s.count < DefaultRetryPolicy().Attempts-1 {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -98,13 +104,15 @@ func TestClient_Fetch(t *testing.T) {
 			defer srv.Close()
 
 			client := New(http.DefaultClient)
-			item, err := client.Fetch(ctx, srv.URL)
+			item, err := client.Fetch(ctx, service.FetchRequest{Site: srv.URL})
 			test.assertErr(t, err)
 			if test.expectResp {
 				withoutProtocol := strings.TrimPrefix(srv.URL, "http://")
-				assert.Equal(t, domain.PageID(srv.URL), item.Page.ID)
+				assert.Equal(t, domain.PageID(srv.URL+"/"), item.Page.ID)
 				assert.Equal(t, withoutProtocol, item.Page.Site)
-				assert.Equal(t, withoutProtocol, item.Page.FileLocation)
+				u, err := url.Parse(srv.URL)
+				require.NoError(t, err)
+				assert.Equal(t, domain.NamingFlat.FileLocation(u), item.Page.FileLocation)
 				b, err := io.ReadAll(item.Content)
 				require.NoError(t, err)
 				assert.Equal(t, htmlContent, string(b))
@@ -112,3 +120,296 @@ func TestClient_Fetch(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_FetchAsset(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		server     http.Handler
+		assertErr  assert.ErrorAssertionFunc
+		expectResp bool
+	}{
+		{
+			name: "failed on 4xx",
+			server: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			}),
+			assertErr: assert.Error,
+		},
+		{
+			name: "any content type",
+			server: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				w.WriteHeader(http.StatusOK)
+				_, _ = w.Write([]byte(htmlContent))
+			}),
+			assertErr:  assert.NoError,
+			expectResp: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			srv := httptest.NewServer(test.server)
+			defer srv.Close()
+
+			client := New(http.DefaultClient)
+			content, err := client.FetchAsset(ctx, srv.URL, srv.URL)
+			test.assertErr(t, err)
+			if test.expectResp {
+				b, err := io.ReadAll(content)
+				require.NoError(t, err)
+				assert.Equal(t, htmlContent, string(b))
+			}
+		})
+	}
+}
+
+func TestClient_Fetch_Robots(t *testing.T) {
+	t.Parallel()
+
+	var robotsRequests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		robotsRequests.Add(1)
+		_, _ = w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", htmlContentType)
+		_, _ = w.Write([]byte(htmlContent))
+	})
+
+	ctx := context.Background()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := New(http.DefaultClient, WithRobots("fetch"))
+
+	item, err := client.Fetch(ctx, service.FetchRequest{Site: srv.URL + "/public"})
+	require.NoError(t, err)
+	require.NoError(t, item.Close())
+
+	_, err = client.Fetch(ctx, service.FetchRequest{Site: srv.URL + "/private"})
+	assert.ErrorIs(t, err, service.ErrDisallowedByRobots)
+
+	_, err = client.FetchAsset(ctx, srv.URL, srv.URL+"/private/logo.png")
+	assert.ErrorIs(t, err, service.ErrDisallowedByRobots)
+
+	assert.Equal(t, int32(1), robotsRequests.Load())
+}
+
+func TestClient_Fetch_HostLimit(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", htmlContentType)
+		_, _ = w.Write([]byte(htmlContent))
+	}))
+	defer srv.Close()
+
+	client := New(http.DefaultClient, WithHostLimit(1, 0))
+
+	item, err := client.Fetch(ctx, service.FetchRequest{Site: srv.URL})
+	require.NoError(t, err)
+
+	// The first request is in flight until its content is closed.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = client.Fetch(timeoutCtx, service.FetchRequest{Site: srv.URL})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	require.NoError(t, item.Close())
+	item, err = client.Fetch(ctx, service.FetchRequest{Site: srv.URL})
+	require.NoError(t, err)
+	require.NoError(t, item.Close())
+}
+
+func TestClient_Fetch_Conditional(t *testing.T) {
+	t.Parallel()
+
+	const (
+		etag         = `"33a64df551425fcc55e4d42a148795d9f25f89d4"`
+		lastModified = "Wed, 21 Oct 2015 07:28:00 GMT"
+	)
+
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag || r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", htmlContentType)
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		_, _ = w.Write([]byte(htmlContent))
+	}))
+	defer srv.Close()
+
+	client := New(http.DefaultClient)
+
+	tests := []struct {
+		name        string
+		request     service.FetchRequest
+		notModified bool
+	}{
+		{
+			name:    "first fetch",
+			request: service.FetchRequest{Site: srv.URL},
+		},
+		{
+			name:        "etag",
+			request:     service.FetchRequest{Site: srv.URL, ETag: etag},
+			notModified: true,
+		},
+		{
+			name:        "last modified",
+			request:     service.FetchRequest{Site: srv.URL, LastModified: lastModified},
+			notModified: true,
+		},
+		{
+			name:    "outdated etag",
+			request: service.FetchRequest{Site: srv.URL, ETag: `"outdated"`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			item, err := client.Fetch(ctx, test.request)
+			require.NoError(t, err)
+			defer item.Close()
+
+			assert.Equal(t, test.notModified, item.NotModified)
+			if !test.notModified {
+				assert.Equal(t, etag, item.ETag)
+				assert.Equal(t, lastModified, item.LastModified)
+			}
+		})
+	}
+}
+
+func TestClient_Fetch_Request(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("X-Api-Key") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", htmlContentType)
+		_, _ = w.Write([]byte(htmlContent))
+	}))
+	defer srv.Close()
+
+	client := New(http.DefaultClient)
+	item, err := client.Fetch(context.Background(), service.FetchRequest{
+		Site:   srv.URL,
+		Method: http.MethodPost,
+		Header: http.Header{"X-Api-Key": []string{"secret"}},
+	})
+	require.NoError(t, err)
+	defer item.Close()
+
+	b, err := io.ReadAll(item.Content)
+	require.NoError(t, err)
+	assert.Equal(t, htmlContent, string(b))
+
+	// The exchange describes the request sent and the response received.
+	assert.Equal(t, http.MethodPost, item.Exchange.Method)
+	assert.Equal(t, srv.URL, item.Exchange.URL)
+	assert.Equal(t, "secret", item.Exchange.RequestHeader.Get("X-Api-Key"))
+	assert.Equal(t, http.StatusOK, item.Exchange.StatusCode)
+	assert.Equal(t, htmlContentType, item.Exchange.ResponseHeader.Get("Content-Type"))
+	assert.False(t, item.Exchange.Started.IsZero())
+}
+
+func TestClient_Fetch_Redirect(t *testing.T) {
+	t.Parallel()
+
+	mux := http.NewServeMux()
+	mux.Handle("/old", http.RedirectHandler("/new", http.StatusMovedPermanently))
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", htmlContentType)
+		_, _ = w.Write([]byte(htmlContent))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := New(http.DefaultClient)
+	item, err := client.Fetch(context.Background(), service.FetchRequest{Site: srv.URL + "/old"})
+	require.NoError(t, err)
+	defer item.Close()
+
+	// The page is identified by the URL it was redirected to.
+	assert.Equal(t, domain.PageID(srv.URL+"/new"), item.Page.ID)
+}
+
+func TestSniffMediaType(t *testing.T) {
+	t.Parallel()
+
+	pdf := []byte("%PDF-1.7\n")
+	tests := []struct {
+		name     string
+		declared string
+		head     []byte
+		expected string
+	}{
+		{name: "declared", declared: domain.MediaTypeRSS, head: []byte("<?xml version=\"1.0\"?><rss>"), expected: domain.MediaTypeRSS},
+		{name: "missing", declared: "", head: []byte(htmlContent), expected: domain.MediaTypeHTML},
+		{name: "generic", declared: domain.MediaTypeUnknown, head: pdf, expected: domain.MediaTypePDF},
+		{name: "plain text", declared: domain.MediaTypeText, head: []byte("<?xml version=\"1.0\"?><feed>"), expected: "text/xml"},
+		{name: "binary served as html", declared: domain.MediaTypeHTML, head: pdf, expected: domain.MediaTypePDF},
+		{name: "text not recognized", declared: domain.MediaTypeJSON, head: []byte(`{"key": "value"}`), expected: domain.MediaTypeJSON},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, test.expected, sniffMediaType(test.declared, test.head))
+		})
+	}
+}
+
+func TestClient_Fetch_AcceptedTypes(t *testing.T) {
+	t.Parallel()
+
+	const pdfContent = "%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed":
+			w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+			_, _ = w.Write([]byte(`<?xml version="1.0"?><rss><channel><title>Feed</title></channel></rss>`))
+		case "/document":
+			// The server does not know the type of the document, it is sniffed.
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write([]byte(pdfContent))
+		default:
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("\x89PNG\r\n\x1a\n"))
+		}
+	}))
+	defer srv.Close()
+
+	client := New(srv.Client(), WithAcceptedTypes(domain.MediaTypeRSS, domain.MediaTypePDF))
+
+	item, err := client.Fetch(context.Background(), service.FetchRequest{Site: srv.URL + "/feed"})
+	require.NoError(t, err)
+	assert.Equal(t, domain.MediaTypeRSS, item.ContentType)
+	require.NoError(t, item.Close())
+
+	item, err = client.Fetch(context.Background(), service.FetchRequest{Site: srv.URL + "/document"})
+	require.NoError(t, err)
+	assert.Equal(t, domain.MediaTypePDF, item.ContentType)
+	// The bytes read to sniff the type are still part of the content.
+	b, err := io.ReadAll(item.Content)
+	require.NoError(t, err)
+	assert.Equal(t, pdfContent, string(b))
+	require.NoError(t, item.Close())
+
+	_, err = client.Fetch(context.Background(), service.FetchRequest{Site: srv.URL + "/image"})
+	assert.ErrorContains(t, err, "unexpected content type: image/png")
+}
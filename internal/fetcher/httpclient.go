@@ -0,0 +1,258 @@
+package fetcher
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// HTTPConfig configures the http.Client built by NewHTTPClient. The zero value of a timeout disables it.
+type HTTPConfig struct {
+	// ConnectTimeout limits the time taken to open a connection, including the TLS handshake.
+	ConnectTimeout time.Duration
+	// ReadTimeout limits the time spent waiting for the server to send anything, such as the headers
+	// of the response or the next bytes of its body.
+	ReadTimeout time.Duration
+	// TotalTimeout limits the time taken by a request, from sending it to reading the whole body of its response.
+	TotalTimeout time.Duration
+	// UserAgent is sent with every request which does not set its own User-Agent header.
+	UserAgent string
+	// Header holds the headers sent with the requests to the hosts of the sites fetched by the Client, the headers
+	// set by a request take precedence. They are not sent to the other hosts, such as the ones a site redirects
+	// to or the ones serving the assets of a page, as they may hold credentials.
+	Header http.Header
+	// Auth authenticates the requests sent to the hosts matching one of the rules, the first matching rule
+	// is used. The requests setting their own Authorization header are left untouched.
+	Auth []AuthRule
+	// Jar stores the cookies set by the hosts and sends them back, no cookie is kept when it is nil.
+	Jar http.CookieJar
+	// Proxy is the URL of the HTTP, HTTPS or SOCKS5 proxy the requests go through. The HTTP_PROXY, HTTPS_PROXY
+	// and NO_PROXY environment variables are used when it is empty.
+	Proxy string
+	// CABundle is the path of a PEM file holding the certificates of the authorities trusted on top of the
+	// ones of the system.
+	CABundle string
+	// ClientCert and ClientKey are the paths of the PEM files holding the certificate, and its key, presented
+	// to the servers asking for one.
+	ClientCert string
+	ClientKey  string
+	// Insecure skips the verification of the certificates of the servers.
+	Insecure bool
+	// MaxRedirects is the maximum number of redirects followed by a request, the response of the last
+	// redirect is returned once reached. Zero follows no redirect.
+	MaxRedirects int
+	// DisableHTTP2 only speaks HTTP/1.1 with the servers.
+	DisableHTTP2 bool
+}
+
+// NewHTTPClient returns a http.Client configured by the given HTTPConfig.
+func NewHTTPClient(config HTTPConfig) (*http.Client, error) {
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if config.Proxy != "" {
+		proxyURL, err := url.Parse(config.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("parse proxy: %w", err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	dialer := &net.Dialer{Timeout: config.ConnectTimeout, KeepAlive: 30 * time.Second}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   config.ConnectTimeout,
+		ResponseHeaderTimeout: config.ReadTimeout,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		ForceAttemptHTTP2:     !config.DisableHTTP2,
+	}
+	if config.DisableHTTP2 {
+		// A non nil empty map disables HTTP/2, it is otherwise negotiated during the TLS handshake.
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if config.ReadTimeout > 0 {
+		roundTripper = &readTimeoutTransport{RoundTripper: roundTripper, timeout: config.ReadTimeout}
+	}
+	if config.UserAgent != "" || len(config.Header) > 0 || len(config.Auth) > 0 {
+		roundTripper = &headerTransport{
+			RoundTripper: roundTripper,
+			userAgent:    config.UserAgent,
+			header:       config.Header,
+			auth:         config.Auth,
+		}
+	}
+
+	return &http.Client{
+		Transport: roundTripper,
+		Jar:       config.Jar,
+		Timeout:   config.TotalTimeout,
+		CheckRedirect: func(_ *http.Request, via []*http.Request) error {
+			if len(via) > config.MaxRedirects {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}, nil
+}
+
+// newTLSConfig returns the tls.Config trusting the CA bundle and presenting the client certificate of the
+// HTTPConfig, if any.
+func newTLSConfig(config HTTPConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// The servers are only verified when the user did not ask otherwise.
+		InsecureSkipVerify: config.Insecure,
+	}
+
+	if config.CABundle != "" {
+		pem, err := os.ReadFile(config.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("read ca bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in ca bundle %s", config.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	switch {
+	case config.ClientCert != "" && config.ClientKey != "":
+		cert, err := tls.LoadX509KeyPair(config.ClientCert, config.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case config.ClientCert != "" || config.ClientKey != "":
+		return nil, errors.New("the client certificate and its key must be set together")
+	}
+
+	return tlsConfig, nil
+}
+
+// siteHostKey is the key of the context value holding the host of the site a request is sent for.
+type siteHostKey struct{}
+
+// withSiteHost returns a context whose requests are sent for a site of the given host.
+func withSiteHost(ctx context.Context, host string) context.Context {
+	return context.WithValue(ctx, siteHostKey{}, host)
+}
+
+// headerTransport adds the User-Agent, the default headers and the Authorization header to the requests
+// which do not set their own. As it sees every request, the redirects to the hosts of an AuthRule are
+// authenticated as well, as long as they go over HTTPS. The default headers are only added to the requests
+// sent to the host of the site of their context, the hosts a site redirects to are not trusted with them.
+type headerTransport struct {
+	http.RoundTripper
+	userAgent string
+	header    http.Header
+	auth      []AuthRule
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the request.
+	req = req.Clone(req.Context())
+	if t.trusts(req) {
+		for name, values := range t.header {
+			if _, ok := req.Header[name]; !ok {
+				req.Header[name] = values
+			}
+		}
+	}
+	if t.userAgent != "" && req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	if req.Header.Get("Authorization") == "" {
+		for _, rule := range t.auth {
+			if rule.matches(req.URL.Hostname()) {
+				if rule.secures(req) {
+					rule.apply(req)
+				}
+				break
+			}
+		}
+	}
+	return t.RoundTripper.RoundTrip(req)
+}
+
+// trusts reports whether the request is sent to the host of the site of its context, such as the site itself,
+// its robots.txt file and its assets.
+func (t *headerTransport) trusts(req *http.Request) bool {
+	host, ok := req.Context().Value(siteHostKey{}).(string)
+	return ok && strings.EqualFold(host, req.URL.Host)
+}
+
+// errReadTimeout is returned by the reads of a response body which wait for more than the read timeout.
+var errReadTimeout = errors.New("timeout reading the response body")
+
+// readTimeoutTransport fails the reads of the response bodies which wait for more than the timeout, so a server
+// which stops sending in the middle of a response does not block the request forever. The timeout only applies
+// while a body is read, the idle connections of the pool are left alone.
+type readTimeoutTransport struct {
+	http.RoundTripper
+	timeout time.Duration
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *readTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	resp, err := t.RoundTripper.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+	resp.Body = &readTimeoutBody{ReadCloser: resp.Body, timeout: t.timeout, cancel: cancel}
+	return resp, nil
+}
+
+// readTimeoutBody cancels the request of the body when a read waits for more than the timeout, which aborts
+// the read along with the stream or the connection it is sent on.
+type readTimeoutBody struct {
+	io.ReadCloser
+	timeout time.Duration
+	cancel  context.CancelCauseFunc
+}
+
+// Read implements the io.Reader interface.
+func (b *readTimeoutBody) Read(p []byte) (int, error) {
+	timer := time.AfterFunc(b.timeout, func() { b.cancel(errReadTimeout) })
+	n, err := b.ReadCloser.Read(p)
+	if !timer.Stop() && err != nil && !errors.Is(err, io.EOF) {
+		return n, errReadTimeout
+	}
+	return n, err
+}
+
+// Close implements the io.Closer interface.
+func (b *readTimeoutBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel(nil)
+	return err
+}
@@ -0,0 +1,310 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	t.Parallel()
+
+	t.Run("user agent", func(t *testing.T) {
+		t.Parallel()
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.UserAgent()))
+		}))
+		defer srv.Close()
+
+		client, err := NewHTTPClient(HTTPConfig{UserAgent: "fetch/test"})
+		require.NoError(t, err)
+
+		assert.Equal(t, "fetch/test", get(t, client, srv.URL, nil))
+		assert.Equal(t, "custom", get(t, client, srv.URL, http.Header{"User-Agent": []string{"custom"}}))
+	})
+
+	t.Run("headers and auth", func(t *testing.T) {
+		t.Parallel()
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = fmt.Fprintf(w, "%s|%s", r.Header.Get("X-Team"), r.Header.Get("Authorization"))
+		}))
+		defer srv.Close()
+
+		client, err := NewHTTPClient(HTTPConfig{
+			Header: http.Header{"X-Team": []string{"crawler"}},
+			Auth: []AuthRule{
+				{HostPattern: "*.example.com", Token: "other"},
+				{HostPattern: "127.0.0.*", Token: "secret", AllowHTTP: true},
+			},
+		})
+		require.NoError(t, err)
+
+		// The headers are only sent to the host of the site of the request.
+		assert.Equal(t, "|Bearer secret", get(t, client, srv.URL, nil))
+		ctx := withSiteHost(context.Background(), srv.Listener.Addr().String())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, "crawler|Bearer secret", string(body))
+		assert.Equal(t, "|Bearer secret", get(t, client, srv.URL, nil), "the host of a site is not trusted once fetched")
+		assert.Equal(t, "custom|Basic dXNlcjpwYXNz", get(t, client, srv.URL, http.Header{
+			"X-Team":        []string{"custom"},
+			"Authorization": []string{"Basic dXNlcjpwYXNz"},
+		}))
+	})
+
+	t.Run("auth over https only", func(t *testing.T) {
+		t.Parallel()
+
+		var leaked atomic.Value
+		insecure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			leaked.Store(r.Header.Get("Authorization"))
+		}))
+		defer insecure.Close()
+		origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			http.Redirect(w, r, insecure.URL+"/landing", http.StatusFound)
+		}))
+		defer origin.Close()
+
+		caBundle := filepath.Join(t.TempDir(), "ca.pem")
+		certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: origin.Certificate().Raw})
+		require.NoError(t, os.WriteFile(caBundle, certificate, 0o600))
+		client, err := NewHTTPClient(HTTPConfig{
+			CABundle:     caBundle,
+			Auth:         []AuthRule{{HostPattern: "127.0.0.1", Token: "secret"}},
+			MaxRedirects: 10,
+		})
+		require.NoError(t, err)
+
+		resp, err := client.Get(origin.URL)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, insecure.URL+"/landing", resp.Request.URL.String())
+		assert.Equal(t, "", leaked.Load(), "the credentials are not sent over plain http")
+	})
+
+	t.Run("headers on redirect", func(t *testing.T) {
+		t.Parallel()
+
+		var leaked atomic.Value
+		other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			leaked.Store(r.Header.Get("Authorization") + r.Header.Get("Cookie"))
+			w.Header().Set("Content-Type", htmlContentType)
+			_, _ = io.WriteString(w, htmlContent)
+		}))
+		defer other.Close()
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" || r.Header.Get("Cookie") == "" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Path == "/logo.png" {
+				_, _ = io.WriteString(w, "png")
+				return
+			}
+			http.Redirect(w, r, other.URL+"/landing", http.StatusFound)
+		}))
+		defer origin.Close()
+
+		client, err := NewHTTPClient(HTTPConfig{
+			Header:       http.Header{"Authorization": []string{"Bearer secret"}, "Cookie": []string{"session=opened"}},
+			MaxRedirects: 10,
+		})
+		require.NoError(t, err)
+		f := New(client)
+
+		item, err := f.Fetch(context.Background(), service.FetchRequest{Site: origin.URL})
+		require.NoError(t, err)
+		_ = item.Content.Close()
+		assert.Equal(t, other.URL+"/landing", item.Exchange.URL)
+		assert.Equal(t, "", leaked.Load(), "the headers are not sent to the host redirected to")
+
+		// The assets of the host of the site get the headers, unlike the ones of the other hosts.
+		asset, err := f.FetchAsset(context.Background(), origin.URL, origin.URL+"/logo.png")
+		require.NoError(t, err)
+		_ = asset.Close()
+		asset, err = f.FetchAsset(context.Background(), origin.URL, other.URL+"/logo.png")
+		require.NoError(t, err)
+		_ = asset.Close()
+		assert.Equal(t, "", leaked.Load())
+	})
+
+	t.Run("cookies", func(t *testing.T) {
+		t.Parallel()
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cookie, err := r.Cookie("session"); err == nil {
+				_, _ = w.Write([]byte(cookie.Value))
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "opened"})
+		}))
+		defer srv.Close()
+
+		client, err := NewHTTPClient(HTTPConfig{Jar: NewCookieJar()})
+		require.NoError(t, err)
+
+		assert.Equal(t, "", get(t, client, srv.URL, nil))
+		assert.Equal(t, "opened", get(t, client, srv.URL, nil))
+	})
+
+	t.Run("max redirects", func(t *testing.T) {
+		t.Parallel()
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/first", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/second", http.StatusFound)
+		})
+		mux.HandleFunc("/second", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/final", http.StatusFound)
+		})
+		mux.HandleFunc("/final", func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("final"))
+		})
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+
+		for maxRedirects, expectedPath := range map[int]string{0: "/first", 1: "/second", 2: "/final"} {
+			client, err := NewHTTPClient(HTTPConfig{MaxRedirects: maxRedirects})
+			require.NoError(t, err)
+			resp, err := client.Get(srv.URL + "/first")
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+			assert.Equal(t, expectedPath, resp.Request.URL.Path, "max redirects %d", maxRedirects)
+		}
+	})
+
+	t.Run("read timeout", func(t *testing.T) {
+		t.Parallel()
+
+		done := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			// The server sends the headers and hangs in the middle of the body.
+			_, _ = w.Write([]byte("partial"))
+			w.(http.Flusher).Flush()
+			<-done
+		}))
+		defer srv.Close()
+		defer close(done)
+
+		client, err := NewHTTPClient(HTTPConfig{ReadTimeout: 50 * time.Millisecond})
+		require.NoError(t, err)
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		_, err = io.ReadAll(resp.Body)
+		assert.ErrorIs(t, err, errReadTimeout)
+	})
+
+	t.Run("read timeout of idle connections", func(t *testing.T) {
+		t.Parallel()
+
+		var conns atomic.Int32
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("content"))
+		}))
+		srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+			if state == http.StateNew {
+				conns.Add(1)
+			}
+		}
+		srv.Start()
+		defer srv.Close()
+
+		client, err := NewHTTPClient(HTTPConfig{ReadTimeout: 50 * time.Millisecond})
+		require.NoError(t, err)
+		for range 2 {
+			resp, err := client.Get(srv.URL)
+			require.NoError(t, err)
+			content, err := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			require.NoError(t, err)
+			assert.Equal(t, "content", string(content))
+
+			// The connection stays idle in the pool for longer than the read timeout.
+			time.Sleep(150 * time.Millisecond)
+		}
+		assert.Equal(t, int32(1), conns.Load(), "the idle connection is reused")
+	})
+
+	t.Run("tls", func(t *testing.T) {
+		t.Parallel()
+
+		srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.Proto))
+		}))
+		defer srv.Close()
+
+		caBundle := filepath.Join(t.TempDir(), "ca.pem")
+		certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+		require.NoError(t, os.WriteFile(caBundle, certificate, 0o600))
+
+		client, err := NewHTTPClient(HTTPConfig{})
+		require.NoError(t, err)
+		_, err = client.Get(srv.URL)
+		assert.Error(t, err, "the certificate of the server is not trusted")
+
+		client, err = NewHTTPClient(HTTPConfig{Insecure: true})
+		require.NoError(t, err)
+		assert.Equal(t, "HTTP/1.1", get(t, client, srv.URL, nil))
+
+		client, err = NewHTTPClient(HTTPConfig{CABundle: caBundle})
+		require.NoError(t, err)
+		assert.Equal(t, "HTTP/1.1", get(t, client, srv.URL, nil))
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		t.Parallel()
+
+		for name, config := range map[string]HTTPConfig{
+			"unsupported proxy":   {Proxy: "ftp://proxy"},
+			"missing ca bundle":   {CABundle: filepath.Join(t.TempDir(), "missing.pem")},
+			"client key required": {ClientCert: "cert.pem"},
+		} {
+			_, err := NewHTTPClient(config)
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+// get returns the body of the response to the GET request of the given URL.
+func get(t *testing.T, client *http.Client, u string, header http.Header) string {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	require.NoError(t, err)
+	if header != nil {
+		req.Header = header
+	}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
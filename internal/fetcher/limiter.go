@@ -0,0 +1,205 @@
+package fetcher
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRetryAfter caps the delay requested by a server through the Retry-After header,
+	// so a single host cannot stall a run indefinitely.
+	maxRetryAfter = 10 * time.Minute
+	// hostSweepInterval is how often the idle hosts are forgotten, so the hosts of a long run do not pile up.
+	hostSweepInterval = time.Minute
+)
+
+// hostState tracks the requests sent to a host.
+type hostState struct {
+	// slots holds a value for each request in flight, it is nil when the number of requests is not limited.
+	slots chan struct{}
+	// refs is the number of requests holding the state, waiting for their turn or in flight. It is guarded by
+	// the mutex of the hostLimiter.
+	refs int
+
+	mu sync.Mutex
+	// next is the earliest time the next request to the host can start.
+	next time.Time
+}
+
+// hostLimiter limits the requests sent to each host: the number of requests in flight
+// and the delay between the start of two requests.
+type hostLimiter struct {
+	maxInFlight int
+	minDelay    time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+	// swept is when the idle hosts were last forgotten.
+	swept time.Time
+}
+
+func newHostLimiter(maxInFlight int, minDelay time.Duration) *hostLimiter {
+	return &hostLimiter{
+		maxInFlight: maxInFlight,
+		minDelay:    minDelay,
+		hosts:       make(map[string]*hostState),
+	}
+}
+
+// state returns the state of the host, it is held until given back with put.
+func (l *hostLimiter) state(host string) *hostState {
+	host = strings.ToLower(host)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(time.Now())
+	state, ok := l.hosts[host]
+	if !ok {
+		state = &hostState{}
+		if l.maxInFlight > 0 {
+			state.slots = make(chan struct{}, l.maxInFlight)
+		}
+		l.hosts[host] = state
+	}
+	state.refs++
+	return state
+}
+
+// put gives back the state returned by state.
+func (l *hostLimiter) put(state *hostState) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state.refs--
+}
+
+// sweep forgets the hosts which no request holds and whose delay is over, their state is the one of a new
+// host. It runs at most once every hostSweepInterval, and must be called with the lock held.
+func (l *hostLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < hostSweepInterval {
+		return
+	}
+	l.swept = now
+
+	for host, state := range l.hosts {
+		if state.refs > 0 {
+			continue
+		}
+		state.mu.Lock()
+		idle := !state.next.After(now)
+		state.mu.Unlock()
+		if idle {
+			delete(l.hosts, host)
+		}
+	}
+}
+
+// acquire waits until a request can be sent to the host and returns the function releasing it.
+// The delay between two requests is the largest of the configured delay and the given crawl delay.
+func (l *hostLimiter) acquire(ctx context.Context, host string, crawlDelay time.Duration) (func(), error) {
+	state := l.state(host)
+
+	if state.slots != nil {
+		select {
+		case <-ctx.Done():
+			l.put(state)
+			return nil, ctx.Err()
+		case state.slots <- struct{}{}:
+		}
+	}
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			if state.slots != nil {
+				<-state.slots
+			}
+			l.put(state)
+		})
+	}
+
+	// The request reserves its start time, so the concurrent requests to the host are spread by the delay.
+	state.mu.Lock()
+	start := time.Now()
+	if state.next.After(start) {
+		start = state.next
+	}
+	state.next = start.Add(max(l.minDelay, crawlDelay))
+	state.mu.Unlock()
+
+	if wait := time.Until(start); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return release, nil
+}
+
+// delay prevents any new request to the host until the given time.
+func (l *hostLimiter) delay(host string, until time.Time) {
+	state := l.state(host)
+	defer l.put(state)
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if until.After(state.next) {
+		state.next = until
+	}
+}
+
+// parseRetryAfter returns the delay requested by the Retry-After header of the response, if any.
+// The header holds either a number of seconds or an HTTP date.
+func parseRetryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	value := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		delay = date.Sub(now)
+	} else {
+		return 0, false
+	}
+
+	return min(max(delay, 0), maxRetryAfter), true
+}
+
+// releaseOnClose releases the request to the host once the body of the response is read to its end or closed,
+// as the request is in flight as long as its body is being read.
+type releaseOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+// Read implements the io.Reader interface, the request is released once the body is read to its end so the
+// next requests to the host do not wait for the body to be closed.
+func (r *releaseOnClose) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		r.release()
+	}
+	return n, err
+}
+
+// Close implements the io.Closer interface.
+func (r *releaseOnClose) Close() error {
+	defer r.release()
+	return r.ReadCloser.Close()
+}
@@ -0,0 +1,170 @@
+package fetcher
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostLimiter_MaxInFlight(t *testing.T) {
+	t.Parallel()
+
+	limiter := newHostLimiter(1, 0)
+
+	release, err := limiter.acquire(context.Background(), "www.google.com", 0)
+	require.NoError(t, err)
+
+	t.Run("other hosts are not limited", func(t *testing.T) {
+		release, err := limiter.acquire(context.Background(), "maps.google.com", 0)
+		require.NoError(t, err)
+		release()
+	})
+
+	t.Run("same host waits for the release", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := limiter.acquire(ctx, "WWW.google.com", 0)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	release()
+
+	t.Run("same host after the release", func(t *testing.T) {
+		release, err := limiter.acquire(context.Background(), "www.google.com", 0)
+		require.NoError(t, err)
+		release()
+	})
+}
+
+func TestHostLimiter_Delay(t *testing.T) {
+	t.Parallel()
+
+	const minDelay = 50 * time.Millisecond
+	limiter := newHostLimiter(0, minDelay)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		release, err := limiter.acquire(ctx, "www.google.com", 0)
+		require.NoError(t, err)
+		release()
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 2*minDelay)
+
+	t.Run("crawl delay is honored", func(t *testing.T) {
+		release, err := limiter.acquire(ctx, "maps.google.com", 2*minDelay)
+		require.NoError(t, err)
+		release()
+
+		start := time.Now()
+		release, err = limiter.acquire(ctx, "maps.google.com", 2*minDelay)
+		require.NoError(t, err)
+		release()
+		assert.GreaterOrEqual(t, time.Since(start), minDelay)
+	})
+
+	t.Run("retry after is honored", func(t *testing.T) {
+		start := time.Now()
+		limiter.delay("mail.google.com", start.Add(minDelay))
+
+		release, err := limiter.acquire(ctx, "mail.google.com", 0)
+		require.NoError(t, err)
+		release()
+		assert.GreaterOrEqual(t, time.Since(start), minDelay)
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 17, 14, 43, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		header   string
+		expected time.Duration
+		ok       bool
+	}{
+		{name: "missing"},
+		{name: "seconds", header: "120", expected: 2 * time.Minute, ok: true},
+		{name: "date", header: now.Add(time.Minute).Format(http.TimeFormat), expected: time.Minute, ok: true},
+		{name: "past date", header: now.Add(-time.Minute).Format(http.TimeFormat), expected: 0, ok: true},
+		{name: "capped", header: "86400", expected: maxRetryAfter, ok: true},
+		{name: "invalid", header: "soon"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			resp := &http.Response{Header: http.Header{}}
+			if test.header != "" {
+				resp.Header.Set("Retry-After", test.header)
+			}
+
+			delay, ok := parseRetryAfter(resp, now)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.expected, delay)
+		})
+	}
+}
+
+func TestReleaseOnClose(t *testing.T) {
+	t.Parallel()
+
+	var released int
+	body := &releaseOnClose{ReadCloser: io.NopCloser(strings.NewReader("page")), release: func() { released++ }}
+
+	// The request is released once the body is read to its end, before it is closed.
+	content, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "page", string(content))
+	assert.Equal(t, 1, released)
+
+	body = &releaseOnClose{ReadCloser: io.NopCloser(strings.NewReader("page")), release: func() { released++ }}
+	require.NoError(t, body.Close())
+	assert.Equal(t, 2, released)
+}
+
+func TestHostLimiter_Sweep(t *testing.T) {
+	t.Parallel()
+
+	limiter := newHostLimiter(1, 0)
+	ctx := context.Background()
+	hosts := func() []string {
+		limiter.mu.Lock()
+		defer limiter.mu.Unlock()
+
+		var hosts []string
+		for host := range limiter.hosts {
+			hosts = append(hosts, host)
+		}
+		sort.Strings(hosts)
+		return hosts
+	}
+
+	done, err := limiter.acquire(ctx, "www.google.com", 0)
+	require.NoError(t, err)
+	done()
+	inFlight, err := limiter.acquire(ctx, "maps.google.com", 0)
+	require.NoError(t, err)
+	defer inFlight()
+	limiter.delay("mail.google.com", time.Now().Add(time.Hour))
+
+	// The idle host is forgotten, unlike the host with a request in flight and the host still delayed.
+	limiter.mu.Lock()
+	limiter.swept = time.Time{}
+	limiter.mu.Unlock()
+	release, err := limiter.acquire(ctx, "docs.google.com", 0)
+	require.NoError(t, err)
+	release()
+	assert.Equal(t, []string{"docs.google.com", "mail.google.com", "maps.google.com"}, hosts())
+}
@@ -0,0 +1,104 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// ErrRetryBudgetExhausted is returned when a request fails once every retry of the run was spent.
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// RetryPolicy decides whether, and when, a failed request is sent again.
+type RetryPolicy struct {
+	// Attempts is the maximum number of times a request is sent, 1 never retries.
+	Attempts int
+	// BaseDelay is the delay before the first retry, it doubles with every retry up to MaxDelay. The MaxDelay
+	// of the DefaultRetryPolicy is used when it is zero.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Jitter is the fraction of the delay drawn at random, between 0 and 1, so the clients failing together
+	// do not retry together.
+	Jitter float64
+	// RetryableStatus lists the status codes of the responses retried, the network errors are always retried.
+	RetryableStatus []int
+	// Budget is the maximum number of retries of the whole run, shared by every request, 0 means no limit.
+	Budget int
+}
+
+// DefaultRetryPolicy returns the RetryPolicy of the Client, used unless WithRetryPolicy sets another one.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Attempts:  5,
+		BaseDelay: 100 * time.Millisecond,
+		MaxDelay:  30 * time.Second,
+		Jitter:    0.2,
+		RetryableStatus: []int{
+			http.StatusRequestTimeout,
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+// retrier applies a RetryPolicy and keeps track of the retries left in the budget of the run.
+type retrier struct {
+	policy RetryPolicy
+	// spent is the number of retries made so far.
+	spent atomic.Int64
+}
+
+func newRetrier(policy RetryPolicy) *retrier {
+	return &retrier{policy: policy}
+}
+
+// retryableStatus reports whether the responses of the status code are retried.
+func (r *retrier) retryableStatus(statusCode int) bool {
+	return slices.Contains(r.policy.RetryableStatus, statusCode)
+}
+
+// delay returns how long to wait before the retry following the given attempt. The delay requested by the
+// server through the Retry-After header is honored, it is not capped by MaxDelay.
+func (r *retrier) delay(attempt int, retryAfter time.Duration) time.Duration {
+	maxDelay := r.policy.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultRetryPolicy().MaxDelay
+	}
+	delay := r.policy.BaseDelay
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxDelay)
+	if jitter := min(max(r.policy.Jitter, 0), 1); jitter > 0 && delay > 0 {
+		delay -= time.Duration(jitter * rand.Float64() * float64(delay))
+	}
+	return max(delay, retryAfter)
+}
+
+// take spends a retry of the budget, it reports false once the budget is exhausted.
+func (r *retrier) take() bool {
+	if r.policy.Budget <= 0 {
+		return true
+	}
+	return r.spent.Add(1) <= int64(r.policy.Budget)
+}
+
+// wait sleeps for the delay, or until the context is done.
+func wait(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,151 @@
+package fetcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetrier_Delay(t *testing.T) {
+	t.Parallel()
+
+	r := newRetrier(RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second})
+	assert.Equal(t, 100*time.Millisecond, r.delay(1, 0))
+	assert.Equal(t, 200*time.Millisecond, r.delay(2, 0))
+	assert.Equal(t, 800*time.Millisecond, r.delay(4, 0))
+	assert.Equal(t, time.Second, r.delay(10, 0))
+	// The delay asked by the server is honored, even above the maximum delay.
+	assert.Equal(t, 5*time.Second, r.delay(1, 5*time.Second))
+
+	// Without a maximum delay, the one of the default policy caps the delay instead of letting it overflow.
+	r = newRetrier(RetryPolicy{BaseDelay: 100 * time.Millisecond})
+	assert.Equal(t, DefaultRetryPolicy().MaxDelay, r.delay(100, 0))
+
+	r = newRetrier(RetryPolicy{BaseDelay: 100 * time.Millisecond, Jitter: 0.5})
+	for range 100 {
+		delay := r.delay(1, 0)
+		assert.GreaterOrEqual(t, delay, 50*time.Millisecond)
+		assert.LessOrEqual(t, delay, 100*time.Millisecond)
+	}
+}
+
+func TestRetrier_Take(t *testing.T) {
+	t.Parallel()
+
+	r := newRetrier(RetryPolicy{Budget: 2})
+	assert.True(t, r.take())
+	assert.True(t, r.take())
+	assert.False(t, r.take())
+
+	r = newRetrier(RetryPolicy{})
+	for range 100 {
+		assert.True(t, r.take())
+	}
+}
+
+func TestClient_Fetch_Retry(t *testing.T) {
+	t.Parallel()
+
+	policy := RetryPolicy{
+		Attempts:        3,
+		BaseDelay:       time.Millisecond,
+		RetryableStatus: []int{http.StatusTooManyRequests, http.StatusServiceUnavailable},
+	}
+
+	tests := []struct {
+		name             string
+		policy           RetryPolicy
+		statuses         []int
+		retryAfter       string
+		expectedAttempts int
+		assertErr        assert.ErrorAssertionFunc
+	}{
+		{
+			name:             "retried until success",
+			policy:           policy,
+			statuses:         []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK},
+			expectedAttempts: 3,
+			assertErr:        assert.NoError,
+		},
+		{
+			name:             "attempts exhausted",
+			policy:           policy,
+			statuses:         []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			expectedAttempts: 3,
+			assertErr:        assert.Error,
+		},
+		{
+			name:             "status not retryable",
+			policy:           policy,
+			statuses:         []int{http.StatusInternalServerError},
+			expectedAttempts: 1,
+			assertErr:        assert.Error,
+		},
+		{
+			name: "budget exhausted",
+			policy: RetryPolicy{
+				Attempts:        3,
+				RetryableStatus: []int{http.StatusServiceUnavailable},
+				Budget:          1,
+			},
+			statuses:         []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK},
+			expectedAttempts: 2,
+			assertErr: func(t assert.TestingT, err error, _ ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrRetryBudgetExhausted)
+			},
+		},
+		{
+			name:             "retry after honored",
+			policy:           policy,
+			statuses:         []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter:       "1",
+			expectedAttempts: 2,
+			assertErr:        assert.NoError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			var count atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				status := test.statuses[count.Add(1)-1]
+				if test.retryAfter != "" {
+					w.Header().Set("Retry-After", test.retryAfter)
+				}
+				w.Header().Set("Content-Type", htmlContentType)
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte(htmlContent))
+			}))
+			defer srv.Close()
+
+			client := New(srv.Client(), WithRetryPolicy(test.policy))
+			started := time.Now()
+			item, err := client.Fetch(context.Background(), service.FetchRequest{Site: srv.URL})
+			test.assertErr(t, err)
+
+			attempts := 0
+			if err != nil {
+				var fetchErr *service.FetchError
+				require.ErrorAs(t, err, &fetchErr)
+				attempts = fetchErr.Attempts
+			} else {
+				attempts = item.Attempts
+				require.NoError(t, item.Close())
+			}
+			assert.Equal(t, test.expectedAttempts, attempts)
+			assert.Equal(t, int32(test.expectedAttempts), count.Load())
+			if test.retryAfter != "" {
+				assert.GreaterOrEqual(t, time.Since(started), time.Second)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package fetcher
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// robotsMaxSize is the maximum size of a robots.txt file read, the rest of the file is ignored.
+	robotsMaxSize = 500 * 1024
+	// robotsCacheTTL is the duration after which the robots.txt file of a host is fetched again.
+	robotsCacheTTL = 24 * time.Hour
+	// robotsFailureTTL is the duration after which the robots.txt file of a host which could not be reached
+	// is fetched again, the pages of the host fail meanwhile without a new attempt.
+	robotsFailureTTL = time.Minute
+)
+
+// robotsRule is an Allow or Disallow line of a robots.txt file.
+type robotsRule struct {
+	pattern string
+	allow   bool
+}
+
+// robotsGroup is a group of rules of a robots.txt file, applying to the user agents of the group.
+type robotsGroup struct {
+	userAgents []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// robotsRules holds the rules of a robots.txt file applying to our user agent.
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+// allowAll is used when the host has no robots.txt file.
+var allowAll = &robotsRules{}
+
+// disallowAll is used when the robots.txt file of the host cannot be retrieved because of a server error.
+var disallowAll = &robotsRules{rules: []robotsRule{{pattern: "/", allow: false}}}
+
+// parseRobots parses a robots.txt file and returns the rules applying to the given user agent,
+// following RFC 9309. When no group matches the user agent, the rules of the '*' group apply.
+func parseRobots(r io.Reader, userAgent string) (*robotsRules, error) {
+	var groups []*robotsGroup
+	var current *robotsGroup
+	inUserAgents := false
+
+	scanner := bufio.NewScanner(io.LimitReader(r, robotsMaxSize))
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// Consecutive user-agent lines share the same group of rules.
+			if !inUserAgents {
+				current = &robotsGroup{}
+				groups = append(groups, current)
+			}
+			current.userAgents = append(current.userAgents, strings.ToLower(value))
+			inUserAgents = true
+			continue
+		case "allow", "disallow":
+			// An empty disallow allows everything, which is the default.
+			if current != nil && value != "" {
+				current.rules = append(current.rules, robotsRule{pattern: value, allow: key == "allow"})
+			}
+		case "crawl-delay":
+			if current == nil {
+				break
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				current.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		}
+		inUserAgents = false
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scan robots.txt: %w", err)
+	}
+
+	// The product token of the user agent is matched without its version, as in "fetch/1.0".
+	token, _, _ := strings.Cut(strings.ToLower(userAgent), "/")
+	rules, ok := selectGroups(groups, token)
+	if !ok {
+		rules, _ = selectGroups(groups, "*")
+	}
+	return rules, nil
+}
+
+// selectGroups merges the groups applying to the given user agent token, it reports whether any group matched.
+func selectGroups(groups []*robotsGroup, token string) (*robotsRules, bool) {
+	rules := &robotsRules{}
+	matched := false
+	for _, group := range groups {
+		if !slices.Contains(group.userAgents, token) {
+			continue
+		}
+
+		matched = true
+		rules.rules = append(rules.rules, group.rules...)
+		if rules.crawlDelay == 0 {
+			rules.crawlDelay = group.crawlDelay
+		}
+	}
+	return rules, matched
+}
+
+// allowed reports whether the URL can be fetched. The most specific matching rule wins,
+// and Allow wins over Disallow when they are as specific.
+func (r *robotsRules) allowed(u *url.URL) bool {
+	target := u.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+
+	allowed := true
+	matchLength := -1
+	for _, rule := range r.rules {
+		if !matchRobotsPattern(rule.pattern, target) {
+			continue
+		}
+		if len(rule.pattern) > matchLength || (len(rule.pattern) == matchLength && rule.allow) {
+			allowed = rule.allow
+			matchLength = len(rule.pattern)
+		}
+	}
+	return allowed
+}
+
+// matchRobotsPattern reports whether the path matches the pattern of a rule.
+// The pattern matches the beginning of the path, '*' matches any sequence of characters and
+// a trailing '$' anchors the pattern to the end of the path.
+func matchRobotsPattern(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	path = path[len(parts[0]):]
+
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(path, part)
+		}
+		index := strings.Index(path, part)
+		if index < 0 {
+			return false
+		}
+		path = path[index+len(part):]
+	}
+
+	return !anchored || path == ""
+}
+
+// robotsEntry holds the rules of a host, or the error of the last fetch of its robots.txt file when the host
+// could not be reached. The mutex ensures the robots.txt file is only fetched once when several pages of the
+// host are fetched concurrently.
+type robotsEntry struct {
+	mu        sync.Mutex
+	rules     *robotsRules
+	err       error
+	fetchedAt time.Time
+}
+
+// robotsCache fetches and caches the robots.txt file of each host.
+type robotsCache struct {
+	httpClient *http.Client
+	userAgent  string
+	now        func() time.Time
+
+	mu    sync.Mutex
+	hosts map[string]*robotsEntry
+}
+
+func newRobotsCache(httpClient *http.Client, userAgent string) *robotsCache {
+	return &robotsCache{
+		httpClient: httpClient,
+		userAgent:  userAgent,
+		now:        time.Now,
+		hosts:      make(map[string]*robotsEntry),
+	}
+}
+
+// rules returns the rules of the host of the URL, fetching its robots.txt file if needed.
+func (c *robotsCache) rules(ctx context.Context, u *url.URL) (*robotsRules, error) {
+	key := u.Scheme + "://" + u.Host
+
+	c.mu.Lock()
+	entry, ok := c.hosts[key]
+	if !ok {
+		entry = &robotsEntry{}
+		c.hosts[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	age := c.now().Sub(entry.fetchedAt)
+	if entry.rules != nil && age < robotsCacheTTL {
+		return entry.rules, nil
+	}
+	// As defined by RFC 9309, an unreachable robots.txt file disallows everything. The failure is cached for
+	// a short while, so the pages of a host which is down do not all try to reach it again.
+	if entry.err != nil && age < robotsFailureTTL {
+		return nil, entry.err
+	}
+
+	rules, err := c.fetch(ctx, key)
+	if err != nil {
+		// The fetch canceled by the caller says nothing about the host.
+		if ctx.Err() == nil {
+			entry.rules, entry.err, entry.fetchedAt = nil, err, c.now()
+		}
+		return nil, err
+	}
+	entry.rules, entry.err, entry.fetchedAt = rules, nil, c.now()
+	return rules, nil
+}
+
+// fetch retrieves the robots.txt file of the host. As defined by RFC 9309, a missing file allows everything
+// while a server error disallows everything.
+func (c *robotsCache) fetch(ctx context.Context, host string) (*robotsRules, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, host+"/robots.txt", nil)
+	if err != nil {
+		return nil, fmt.Errorf("new robots.txt request: %w", err)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do robots.txt request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return disallowAll, nil
+	case resp.StatusCode != http.StatusOK:
+		return allowAll, nil
+	}
+
+	return parseRobots(resp.Body, c.userAgent)
+}
@@ -0,0 +1,160 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const robotsContent = `
+# Rules for everyone.
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Crawl-delay: 10
+
+User-agent: Fetch
+User-agent: other
+Disallow: /search
+Disallow: /*.pdf$
+Allow: /search/about
+Crawl-delay: 1.5
+
+User-agent: blocked
+Disallow: /
+`
+
+func TestParseRobots(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		userAgent  string
+		allowed    []string
+		disallowed []string
+		crawlDelay time.Duration
+	}{
+		{
+			name:       "default group",
+			userAgent:  "unknown",
+			allowed:    []string{"/", "/search", "/private/public/page"},
+			disallowed: []string{"/private", "/private/page"},
+			crawlDelay: 10 * time.Second,
+		},
+		{
+			name:       "specific group",
+			userAgent:  "fetch/0.1.0",
+			allowed:    []string{"/", "/private", "/search/about", "/doc.pdf?download=1", "/about?q=search"},
+			disallowed: []string{"/search", "/search?q=test", "/doc.pdf", "/files/doc.pdf"},
+			crawlDelay: 1500 * time.Millisecond,
+		},
+		{
+			name:       "disallow everything",
+			userAgent:  "blocked",
+			disallowed: []string{"/", "/page"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			rules, err := parseRobots(strings.NewReader(robotsContent), test.userAgent)
+			require.NoError(t, err)
+			assert.Equal(t, test.crawlDelay, rules.crawlDelay)
+
+			for _, target := range test.allowed {
+				u, err := url.Parse("https://www.google.com" + target)
+				require.NoError(t, err)
+				assert.True(t, rules.allowed(u), target)
+			}
+			for _, target := range test.disallowed {
+				u, err := url.Parse("https://www.google.com" + target)
+				require.NoError(t, err)
+				assert.False(t, rules.allowed(u), target)
+			}
+		})
+	}
+}
+
+func TestMatchRobotsPattern(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{pattern: "/fish", path: "/fish.html", expected: true},
+		{pattern: "/fish", path: "/Fish.html", expected: false},
+		{pattern: "/fish*", path: "/fishheads/yummy.html", expected: true},
+		{pattern: "/*.php", path: "/folder/filename.php?parameters", expected: true},
+		{pattern: "/*.php$", path: "/filename.php", expected: true},
+		{pattern: "/*.php$", path: "/filename.php?parameters", expected: false},
+		{pattern: "/fish*.php", path: "/fishheads/catfish.php?parameters", expected: true},
+		{pattern: "/fish*.php", path: "/Fish.PHP", expected: false},
+		{pattern: "/$", path: "/", expected: true},
+		{pattern: "/$", path: "/page", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern+" "+test.path, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, test.expected, matchRobotsPattern(test.pattern, test.path))
+		})
+	}
+}
+
+// failingTransport fails every request as a host which cannot be reached, and counts them.
+type failingTransport struct {
+	requests atomic.Int32
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *failingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return nil, errors.New("connection refused")
+}
+
+func TestRobotsCache_Unreachable(t *testing.T) {
+	t.Parallel()
+
+	transport := &failingTransport{}
+	cache := newRobotsCache(&http.Client{Transport: transport}, "fetch")
+	now := time.Date(2024, 3, 17, 14, 43, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	u, err := url.Parse("https://www.google.com/search")
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// The failure is cached for a short while, the pages of the host fail without reaching it again.
+	for range 3 {
+		_, err := cache.rules(ctx, u)
+		assert.ErrorContains(t, err, "connection refused")
+	}
+	assert.Equal(t, int32(1), transport.requests.Load())
+
+	now = now.Add(robotsFailureTTL)
+	_, err = cache.rules(ctx, u)
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), transport.requests.Load())
+
+	// A fetch canceled by the caller is not cached.
+	now = now.Add(robotsFailureTTL)
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = cache.rules(canceled, u)
+	assert.Error(t, err)
+	_, err = cache.rules(ctx, u)
+	assert.Error(t, err)
+	assert.Equal(t, int32(4), transport.requests.Load())
+}
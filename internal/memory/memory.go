@@ -0,0 +1,228 @@
+// Package memory is part of the infrastructure layer and it implements the service.Disk interface in memory.
+// The content is lost once the process exits, it is meant for the tests and for the dry runs.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/gsiffert/fetch/internal/service"
+)
+
+const (
+	// snapshotDirectory is the directory holding the snapshots of the pages.
+	snapshotDirectory = "snapshots"
+)
+
+// Client of the memory package.
+type Client struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// New instantiates a new Client, without any file.
+func New() *Client {
+	return &Client{files: make(map[string][]byte)}
+}
+
+// NewPageWriter creates a new PageWriter for the given name.
+func (c *Client) NewPageWriter(_ context.Context, name string, _ service.Exchange) (service.PageWriter, error) {
+	return &PageWriter{client: c, name: name}, nil
+}
+
+// NewAssetWriter creates a new file for the given name, the file is stored once the writer is closed.
+func (c *Client) NewAssetWriter(_ context.Context, name string) (service.AssetWriter, error) {
+	return &assetWriter{client: c, name: name}, nil
+}
+
+// RestoreSnapshot replaces the page of the given name with the content of the snapshot.
+func (c *Client) RestoreSnapshot(_ context.Context, name string, snapshot domain.SnapshotID) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	content, ok := c.files[snapshotPath(name, snapshot)]
+	if !ok {
+		return fmt.Errorf("snapshot %s: %w", snapshot, fs.ErrNotExist)
+	}
+	c.files[c.PageLocation(name)] = content
+	return nil
+}
+
+// OpenSnapshot returns the content of the snapshot of the page of the given name, the pages are never
+// compressed in memory.
+func (c *Client) OpenSnapshot(
+	_ context.Context,
+	name string,
+	snapshot domain.SnapshotID,
+	compression domain.Compression,
+) (io.ReadCloser, error) {
+	if compression != domain.CompressionNone {
+		return nil, fmt.Errorf("unsupported compression %q", compression)
+	}
+
+	content, err := c.ReadFile(snapshotPath(name, snapshot))
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+// PageLocation returns the path of the file holding the page of the given name.
+func (c *Client) PageLocation(name string) string {
+	return name
+}
+
+// HasPage reports whether the page of the given name is stored, the files only live as long as the Client.
+func (c *Client) HasPage(_ context.Context, name string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.files[c.PageLocation(name)]
+	return ok, nil
+}
+
+// SaveNotModified does nothing, the page is kept as is.
+func (c *Client) SaveNotModified(_ context.Context, _ string, _ service.Exchange, _ time.Time) error {
+	return nil
+}
+
+// ReadFile returns the content of the file at the given location, such as the location of a page.
+func (c *Client) ReadFile(location string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	content, ok := c.files[location]
+	if !ok {
+		return nil, fmt.Errorf("file %s: %w", location, fs.ErrNotExist)
+	}
+	return bytes.Clone(content), nil
+}
+
+// Files returns the sorted locations of every stored file.
+func (c *Client) Files() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	locations := make([]string, 0, len(c.files))
+	for location := range c.files {
+		locations = append(locations, location)
+	}
+	sort.Strings(locations)
+	return locations
+}
+
+func (c *Client) store(location string, content []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.files[location] = content
+}
+
+// snapshotPath returns the path of the snapshot of the page of the given name, it has the extension of the page.
+func snapshotPath(name string, snapshot domain.SnapshotID) string {
+	return path.Join(snapshotDirectory, string(snapshot)+path.Ext(name))
+}
+
+// PageWriter buffers the content of a page. Once closed, the content is stored as an immutable snapshot
+// named after its hash, and once committed the page is replaced by the snapshot.
+type PageWriter struct {
+	client    *Client
+	name      string
+	buffer    bytes.Buffer
+	snapshot  domain.SnapshotID
+	closed    bool
+	committed bool
+}
+
+// Write implements the io.Writer interface.
+func (w *PageWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fs.ErrClosed
+	}
+	return w.buffer.Write(p)
+}
+
+// Snapshot returns the ID of the snapshot holding the content of the page, it is set once the writer is closed.
+func (w *PageWriter) Snapshot() domain.SnapshotID {
+	return w.snapshot
+}
+
+// Compression returns domain.CompressionNone, the pages are never compressed in memory.
+func (w *PageWriter) Compression() domain.Compression {
+	return domain.CompressionNone
+}
+
+// Close stores the content written so far as a snapshot, the page is left untouched until the writer
+// is committed.
+func (w *PageWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	sum := sha256.Sum256(w.buffer.Bytes())
+	w.snapshot = domain.SnapshotID(hex.EncodeToString(sum[:]))
+	w.client.store(snapshotPath(w.name, w.snapshot), w.buffer.Bytes())
+	return nil
+}
+
+// Commit replaces the page with the snapshot.
+func (w *PageWriter) Commit() error {
+	if w.snapshot == "" {
+		return errors.New("commit a page writer which is not closed")
+	}
+
+	w.client.store(w.client.PageLocation(w.name), w.buffer.Bytes())
+	w.committed = true
+	return nil
+}
+
+// Discard drops the content written so far, the page is left untouched.
+func (w *PageWriter) Discard() error {
+	if !w.closed {
+		w.closed = true
+		w.buffer.Reset()
+	}
+	return nil
+}
+
+// assetWriter buffers the content of an asset, which is stored once the writer is closed.
+type assetWriter struct {
+	client *Client
+	name   string
+	buffer bytes.Buffer
+	done   bool
+}
+
+// Write implements the io.Writer interface.
+func (w *assetWriter) Write(p []byte) (int, error) {
+	return w.buffer.Write(p)
+}
+
+// Close stores the asset.
+func (w *assetWriter) Close() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	w.client.store(w.name, w.buffer.Bytes())
+	return nil
+}
+
+// Discard drops the content written so far, the asset is not stored.
+func (w *assetWriter) Discard() error {
+	w.done = true
+	w.buffer.Reset()
+	return nil
+}
@@ -0,0 +1,81 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/gsiffert/fetch/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	client := New()
+	ctx := context.Background()
+
+	writePage := func(t *testing.T, content string, commit bool) domain.SnapshotID {
+		writer, err := client.NewPageWriter(ctx, "www.google.com.html", service.Exchange{})
+		require.NoError(t, err)
+		_, err = fmt.Fprint(writer, content)
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+		if commit {
+			require.NoError(t, writer.Commit())
+		}
+		return writer.Snapshot()
+	}
+
+	first := writePage(t, "first version", true)
+	second := writePage(t, "second version", false)
+
+	t.Run("page holds the committed version", func(t *testing.T) {
+		content, err := client.ReadFile(client.PageLocation("www.google.com.html"))
+		require.NoError(t, err)
+		assert.Equal(t, "first version", string(content))
+	})
+
+	t.Run("discarded page", func(t *testing.T) {
+		writer, err := client.NewPageWriter(ctx, "www.google.com/about.html", service.Exchange{})
+		require.NoError(t, err)
+		_, err = fmt.Fprint(writer, "partial")
+		require.NoError(t, err)
+		require.NoError(t, writer.Discard())
+
+		_, err = client.ReadFile(client.PageLocation("www.google.com/about.html"))
+		assert.Error(t, err)
+	})
+
+	t.Run("asset", func(t *testing.T) {
+		writer, err := client.NewAssetWriter(ctx, "www.google.com_files/style.css")
+		require.NoError(t, err)
+		_, err = fmt.Fprint(writer, "body { color: red; }")
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		content, err := client.ReadFile("www.google.com_files/style.css")
+		require.NoError(t, err)
+		assert.Equal(t, "body { color: red; }", string(content))
+	})
+
+	t.Run("restore snapshot", func(t *testing.T) {
+		require.NoError(t, client.RestoreSnapshot(ctx, "www.google.com.html", second))
+
+		content, err := client.ReadFile(client.PageLocation("www.google.com.html"))
+		require.NoError(t, err)
+		assert.Equal(t, "second version", string(content))
+		assert.Error(t, client.RestoreSnapshot(ctx, "www.google.com.html", domain.SnapshotID("unknown")))
+	})
+
+	t.Run("files", func(t *testing.T) {
+		assert.Equal(t, []string{
+			snapshotPath("www.google.com.html", first),
+			snapshotPath("www.google.com.html", second),
+			"www.google.com.html",
+			"www.google.com_files/style.css",
+		}, client.Files())
+	})
+}
@@ -0,0 +1,442 @@
+// Package s3 is part of the infrastructure layer and it implements the service.Disk interface using an
+// S3-compatible object store, such as AWS S3 or MinIO.
+package s3
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/gsiffert/fetch/internal/service"
+)
+
+const (
+	// snapshotDirectory is the directory, relative to the prefix, holding the snapshots of the pages.
+	snapshotDirectory = "snapshots"
+	// maxErrorBodySize is the maximum size of the error responses read to report the error of the store.
+	maxErrorBodySize = 64 * 1024
+)
+
+// Config locates the bucket the content is stored in.
+type Config struct {
+	// Endpoint is the base URL of the store, such as https://s3.eu-west-1.amazonaws.com or http://localhost:9000.
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix is the directory of the bucket the objects are stored in.
+	Prefix      string
+	Credentials Credentials
+	// PathStyle addresses the bucket in the path of the URLs rather than in their host, most S3-compatible
+	// stores expect it.
+	PathStyle bool
+}
+
+// Client of the s3 package.
+type Client struct {
+	httpClient *http.Client
+	endpoint   *url.URL
+	config     Config
+	signer     signer
+}
+
+// New instantiates a new Client.
+func New(httpClient *http.Client, config Config) (*Client, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse endpoint: %w", err)
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("endpoint %q is not absolute", config.Endpoint)
+	}
+	if config.Bucket == "" {
+		return nil, errors.New("missing bucket")
+	}
+
+	return &Client{
+		httpClient: httpClient,
+		endpoint:   endpoint,
+		config:     config,
+		signer:     signer{credentials: config.Credentials, region: config.Region},
+	}, nil
+}
+
+// NewPageWriter creates a new PageWriter for the given name.
+func (c *Client) NewPageWriter(ctx context.Context, name string, _ service.Exchange) (service.PageWriter, error) {
+	file, err := os.CreateTemp("", "fetch-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+
+	hash := sha256.New()
+	return &PageWriter{
+		ctx:    ctx,
+		client: c,
+		name:   name,
+		file:   file,
+		hash:   hash,
+		writer: io.MultiWriter(file, hash),
+	}, nil
+}
+
+// NewAssetWriter creates a new object for the given name, the object is uploaded once the writer is closed.
+func (c *Client) NewAssetWriter(ctx context.Context, name string) (service.AssetWriter, error) {
+	file, err := os.CreateTemp("", "fetch-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+
+	hash := sha256.New()
+	return &assetWriter{
+		ctx:    ctx,
+		client: c,
+		key:    c.key(name),
+		file:   file,
+		hash:   hash,
+		writer: io.MultiWriter(file, hash),
+	}, nil
+}
+
+// RestoreSnapshot replaces the page of the given name with the content of the snapshot.
+func (c *Client) RestoreSnapshot(ctx context.Context, name string, snapshot domain.SnapshotID) error {
+	if err := c.copyObject(ctx, c.snapshotKey(name, snapshot), c.pageKey(name)); err != nil {
+		return fmt.Errorf("copy snapshot: %w", err)
+	}
+	return nil
+}
+
+// OpenSnapshot downloads the content of the snapshot of the page of the given name, the pages are never
+// compressed in the object store.
+func (c *Client) OpenSnapshot(
+	ctx context.Context,
+	name string,
+	snapshot domain.SnapshotID,
+	compression domain.Compression,
+) (io.ReadCloser, error) {
+	if compression != domain.CompressionNone {
+		return nil, fmt.Errorf("unsupported compression %q", compression)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.objectURL(c.snapshotKey(name, snapshot)).String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("new request: %w", err)
+	}
+	resp, err := c.do(req, emptyPayloadHash)
+	if err != nil {
+		return nil, fmt.Errorf("download snapshot: %w", err)
+	}
+	return resp.Body, nil
+}
+
+// PageLocation returns the URI of the object holding the page of the given name.
+func (c *Client) PageLocation(name string) string {
+	return fmt.Sprintf("s3://%s/%s", c.config.Bucket, c.pageKey(name))
+}
+
+// HasPage reports whether the object holding the page of the given name exists.
+func (c *Client) HasPage(ctx context.Context, name string) (bool, error) {
+	ok, err := c.objectExists(ctx, c.pageKey(name))
+	if err != nil {
+		return false, fmt.Errorf("check page: %w", err)
+	}
+	return ok, nil
+}
+
+// SaveNotModified does nothing, the object holding the page is kept as is.
+func (c *Client) SaveNotModified(_ context.Context, _ string, _ service.Exchange, _ time.Time) error {
+	return nil
+}
+
+func (c *Client) key(name string) string {
+	return strings.TrimPrefix(path.Join(c.config.Prefix, name), "/")
+}
+
+func (c *Client) pageKey(name string) string {
+	return c.key(name)
+}
+
+// snapshotKey returns the key of the snapshot of the page of the given name, it has the extension of the page.
+func (c *Client) snapshotKey(name string, snapshot domain.SnapshotID) string {
+	return c.key(path.Join(snapshotDirectory, string(snapshot)+path.Ext(name)))
+}
+
+// objectURL returns the URL of the object of the given key.
+func (c *Client) objectURL(key string) *url.URL {
+	u := *c.endpoint
+	if c.config.PathStyle {
+		u.Path = path.Join("/", u.Path, c.config.Bucket, key)
+	} else {
+		u.Host = c.config.Bucket + "." + u.Host
+		u.Path = path.Join("/", u.Path, key)
+	}
+	u.RawPath = ""
+	return &u
+}
+
+// putObject uploads the content of the body to the object of the given key.
+func (c *Client) putObject(ctx context.Context, key string, body io.Reader, size int64, payloadHash string) error {
+	if size == 0 {
+		// An empty body would be sent with a chunked encoding, which the stores reject.
+		body = http.NoBody
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.objectURL(key).String(), body)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req.ContentLength = size
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.do(req, payloadHash)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// objectExists reports whether the object of the given key exists.
+func (c *Client) objectExists(ctx context.Context, key string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.objectURL(key).String(), nil)
+	if err != nil {
+		return false, fmt.Errorf("new request: %w", err)
+	}
+
+	resp, err := c.do(req, emptyPayloadHash)
+	var respErr *ResponseError
+	if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, resp.Body.Close()
+}
+
+// copyObject copies the object of the src key to the dst key, without downloading it.
+func (c *Client) copyObject(ctx context.Context, src string, dst string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.objectURL(dst).String(), nil)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("X-Amz-Copy-Source", (&url.URL{Path: path.Join("/", c.config.Bucket, src)}).EscapedPath())
+
+	resp, err := c.do(req, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// A copy may fail after the response started, the error is then reported in the body of a 200 response.
+	var result struct {
+		XMLName xml.Name
+		ResponseError
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+	if xml.Unmarshal(body, &result) == nil && result.XMLName.Local == "Error" {
+		result.StatusCode = resp.StatusCode
+		return &result.ResponseError
+	}
+	return nil
+}
+
+// do signs and sends the request, the responses which are not successful are returned as a ResponseError.
+func (c *Client) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	c.signer.sign(req, payloadHash, time.Now())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	respErr := &ResponseError{StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	_ = xml.Unmarshal(body, respErr)
+	return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, respErr)
+}
+
+// ResponseError is the error reported by the object store.
+type ResponseError struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+// Error implements the error interface.
+func (e *ResponseError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("unexpected status code %d", e.StatusCode)
+	}
+	return fmt.Sprintf("%s: %s (status code %d)", e.Code, e.Message, e.StatusCode)
+}
+
+// PageWriter writes the content of a page to a local temporary file. Once closed, the content is uploaded as
+// an immutable snapshot named after its hash, and once committed the page object is replaced by a copy of
+// the snapshot.
+type PageWriter struct {
+	// ctx is the context of the fetch of the page, the uploads are bound to it.
+	ctx       context.Context
+	client    *Client
+	name      string
+	file      *os.File
+	hash      hash.Hash
+	writer    io.Writer
+	snapshot  domain.SnapshotID
+	closed    bool
+	committed bool
+}
+
+// Write implements the io.Writer interface.
+func (w *PageWriter) Write(p []byte) (int, error) {
+	return w.writer.Write(p)
+}
+
+// Snapshot returns the ID of the snapshot holding the content of the page, it is set once the writer is closed.
+func (w *PageWriter) Snapshot() domain.SnapshotID {
+	return w.snapshot
+}
+
+// Compression returns domain.CompressionNone, the pages are never compressed in the object store.
+func (w *PageWriter) Compression() domain.Compression {
+	return domain.CompressionNone
+}
+
+// Close uploads the content written so far as a snapshot, the page object is left untouched until the writer
+// is committed. If a snapshot with the same content already exists, it is reused.
+func (w *PageWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	defer os.Remove(w.file.Name())
+	defer w.file.Close()
+
+	// The snapshot is named after the SHA-256 of its content, which is also the hash of the signed payload.
+	payloadHash := hex.EncodeToString(w.hash.Sum(nil))
+	snapshot := domain.SnapshotID(payloadHash)
+	key := w.client.snapshotKey(w.name, snapshot)
+
+	exists, err := w.client.objectExists(w.ctx, key)
+	if err != nil {
+		return fmt.Errorf("stat snapshot: %w", err)
+	}
+	if !exists {
+		size, err := w.file.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("size of file: %w", err)
+		}
+		if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("rewind file: %w", err)
+		}
+		if err := w.client.putObject(w.ctx, key, w.file, size, payloadHash); err != nil {
+			return fmt.Errorf("upload snapshot: %w", err)
+		}
+	}
+
+	w.snapshot = snapshot
+	return nil
+}
+
+// Commit replaces the page object with a copy of the snapshot.
+func (w *PageWriter) Commit() error {
+	if w.snapshot == "" {
+		return errors.New("commit a page writer which is not closed")
+	}
+
+	if err := w.client.copyObject(w.ctx, w.client.snapshotKey(w.name, w.snapshot), w.client.pageKey(w.name)); err != nil {
+		return fmt.Errorf("copy snapshot: %w", err)
+	}
+	w.committed = true
+	return nil
+}
+
+// Discard removes the temporary file holding the content written so far, nothing is uploaded.
+func (w *PageWriter) Discard() error {
+	if w.closed || w.committed {
+		return nil
+	}
+	w.closed = true
+
+	closeErr := w.file.Close()
+	if err := os.Remove(w.file.Name()); err != nil {
+		return fmt.Errorf("remove temporary file: %w", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("close file: %w", closeErr)
+	}
+	return nil
+}
+
+// assetWriter writes the content of an asset to a local temporary file, which is uploaded once closed.
+type assetWriter struct {
+	ctx    context.Context
+	client *Client
+	key    string
+	file   *os.File
+	hash   hash.Hash
+	writer io.Writer
+	done   bool
+}
+
+// Write implements the io.Writer interface.
+func (w *assetWriter) Write(p []byte) (int, error) {
+	return w.writer.Write(p)
+}
+
+// Close uploads the asset.
+func (w *assetWriter) Close() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	defer os.Remove(w.file.Name())
+	defer w.file.Close()
+
+	size, err := w.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("size of file: %w", err)
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("rewind file: %w", err)
+	}
+	if err := w.client.putObject(w.ctx, w.key, w.file, size, hex.EncodeToString(w.hash.Sum(nil))); err != nil {
+		return fmt.Errorf("upload asset: %w", err)
+	}
+	return nil
+}
+
+// Discard removes the temporary file, the asset is not uploaded.
+func (w *assetWriter) Discard() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+
+	closeErr := w.file.Close()
+	if err := os.Remove(w.file.Name()); err != nil {
+		return fmt.Errorf("remove temporary file: %w", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("close file: %w", closeErr)
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+)
+
+const (
+	// charsetSniffLength is the number of bytes read ahead to detect the charset of a page, as many as the
+	// browsers consider.
+	charsetSniffLength = 1024
+	// utf8Charset is the name of the UTF-8 charset, the pages encoded with it are never transcoded.
+	utf8Charset = "utf-8"
+	// utf8BOM starts the UTF-8 copies of the pages, the browsers trust it over the charset declared by the page.
+	utf8BOM = "\xef\xbb\xbf"
+)
+
+// xmlEncoding matches the encoding declared by the XML declaration of a document.
+var xmlEncoding = regexp.MustCompile(`^<\?xml[^>]*\sencoding\s*=\s*["']([A-Za-z0-9._:-]+)["']`)
+
+// boms maps the byte order marks to the charset they announce.
+var boms = []struct {
+	bom     string
+	charset string
+}{
+	{bom: utf8BOM, charset: utf8Charset},
+	{bom: "\xfe\xff", charset: "utf-16be"},
+	{bom: "\xff\xfe", charset: "utf-16le"},
+}
+
+// pageCharset is the charset a page is encoded with.
+type pageCharset struct {
+	name     string
+	encoding encoding.Encoding
+}
+
+// lookupCharset returns the charset of the given label, as known by the browsers, such as latin1 for windows-1252.
+func lookupCharset(label string) (pageCharset, bool) {
+	e, name := charset.Lookup(label)
+	if e == nil {
+		return pageCharset{}, false
+	}
+	return pageCharset{name: name, encoding: e}, true
+}
+
+// isUTF8 reports whether the page is encoded in UTF-8, so it is parsed as is.
+func (c pageCharset) isUTF8() bool {
+	return c.encoding == nil || c.name == utf8Charset
+}
+
+// detectCharset returns the charset of the text content starting with the given bytes, of the given media type
+// and served with the given Content-Type header. The byte order mark wins, then the charset of the header,
+// then the charset declared by the document itself: the meta tags of an HTML page, the XML declaration of an
+// XML document. The XML and JSON documents are UTF-8 unless declared otherwise, the other documents are UTF-8
+// when they are valid UTF-8 and windows-1252 otherwise, as the browsers do.
+func detectCharset(head []byte, contentType string, mediaType string) pageCharset {
+	for _, bom := range boms {
+		if strings.HasPrefix(string(head[:min(len(head), len(bom.bom))]), bom.bom) {
+			c, _ := lookupCharset(bom.charset)
+			return c
+		}
+	}
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if c, ok := lookupCharset(params["charset"]); ok {
+			return c
+		}
+	}
+
+	var declared string
+	switch {
+	case domain.IsHTML(mediaType):
+		declared = metaCharset(head)
+	case domain.IsXML(mediaType):
+		if match := xmlEncoding.FindSubmatch(head); match != nil {
+			declared = string(match[1])
+		}
+	}
+	// A document read as bytes cannot be encoded in UTF-16 without a byte order mark, it is UTF-8 then.
+	if c, ok := lookupCharset(declared); ok && !strings.HasPrefix(c.name, "utf-16") {
+		return c
+	}
+
+	if domain.IsXML(mediaType) || mediaType == domain.MediaTypeJSON || isUTF8(head) {
+		c, _ := lookupCharset(utf8Charset)
+		return c
+	}
+	c, _ := lookupCharset("windows-1252")
+	return c
+}
+
+// metaCharset returns the charset declared by the meta tags of the beginning of an HTML page, either by the
+// charset attribute or by the Content-Type of the http-equiv attribute.
+func metaCharset(head []byte) string {
+	tokenizer := html.NewTokenizer(bytes.NewReader(head))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tag := tokenizer.Token()
+			if tag.Data != "meta" {
+				continue
+			}
+			if value, ok := attribute(&tag, "charset"); ok {
+				return value
+			}
+			if httpEquiv, _ := attribute(&tag, "http-equiv"); strings.EqualFold(httpEquiv, "content-type") {
+				content, _ := attribute(&tag, "content")
+				if _, params, err := mime.ParseMediaType(content); err == nil && params["charset"] != "" {
+					return params["charset"]
+				}
+			}
+		}
+	}
+}
+
+// isUTF8 reports whether the content is valid UTF-8, ignoring the rune the content may end in the middle of.
+func isUTF8(content []byte) bool {
+	for i := len(content) - 1; i >= 0 && i >= len(content)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(content[i]) {
+			if !utf8.FullRune(content[i:]) {
+				content = content[:i]
+			}
+			break
+		}
+	}
+	return utf8.Valid(content)
+}
+
+// readCharset reads ahead the beginning of the text content of the FetchedItem to detect its charset.
+// It returns the content to read the page from, as the beginning read ahead is part of it.
+func readCharset(item *FetchedItem) (io.Reader, pageCharset, error) {
+	if !domain.IsText(item.ContentType) {
+		return item.Content, pageCharset{}, nil
+	}
+
+	content := bufio.NewReaderSize(item.Content, charsetSniffLength)
+	head, err := content.Peek(charsetSniffLength)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, pageCharset{}, fmt.Errorf("read page: %w", err)
+	}
+	return content, detectCharset(head, item.Exchange.ResponseHeader.Get("Content-Type"), item.ContentType), nil
+}
+
+// utf8CopyLocation returns the location of the UTF-8 copy of the page stored in the given location, next to
+// the page and with the same extension.
+func utf8CopyLocation(location string, mediaType string) string {
+	extension := domain.Extension(mediaType)
+	return strings.TrimSuffix(location, extension) + "." + utf8Charset + extension
+}
+
+// newUTF8Copy creates the UTF-8 copy of the page of the given location, it starts with a byte order mark so
+// the copy is read as UTF-8 whatever the charset declared by the page.
+func (s *Service) newUTF8Copy(ctx context.Context, location string, mediaType string) (AssetWriter, error) {
+	writer, err := s.disk.NewAssetWriter(ctx, utf8CopyLocation(location, mediaType))
+	if err != nil {
+		return nil, fmt.Errorf("create file: %w", err)
+	}
+	if _, err := io.WriteString(writer, utf8BOM); err != nil {
+		_ = writer.Discard()
+		return nil, fmt.Errorf("write byte order mark: %w", err)
+	}
+	return writer, nil
+}
+
+// decoder returns the reader decoding the content from the charset to UTF-8.
+func (c pageCharset) decoder(r io.Reader) io.Reader {
+	if c.isUTF8() {
+		return r
+	}
+	return transform.NewReader(r, c.encoding.NewDecoder())
+}
+
+// encoder returns the writer encoding the UTF-8 content written to w in the charset, the characters the
+// charset cannot encode are written as HTML character references. It must be closed to flush the content.
+func (c pageCharset) encoder(w io.Writer) io.WriteCloser {
+	if c.isUTF8() {
+		return nopWriteCloser{w}
+	}
+	return transform.NewWriter(w, encoding.HTMLEscapeUnsupported(c.encoding.NewEncoder()))
+}
+
+// nopWriteCloser turns a writer into an io.WriteCloser whose Close does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close implements the io.Closer interface.
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectCharset(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		head        string
+		contentType string
+		mediaType   string
+		expected    string
+	}{
+		{
+			name:      "BOM wins over the header",
+			head:      "\xef\xbb\xbf<html></html>",
+			mediaType: domain.MediaTypeHTML,
+			expected:  "utf-8",
+		},
+		{
+			name:      "UTF-16 BOM",
+			head:      "\xff\xfe<\x00h\x00",
+			mediaType: domain.MediaTypeText,
+			expected:  "utf-16le",
+		},
+		{
+			name:        "header",
+			head:        `<html><head><meta charset="utf-8"></head></html>`,
+			contentType: "text/html; charset=Shift_JIS",
+			mediaType:   domain.MediaTypeHTML,
+			expected:    "shift_jis",
+		},
+		{
+			name:      "meta charset",
+			head:      `<html><head><meta charset="EUC-JP"></head></html>`,
+			mediaType: domain.MediaTypeHTML,
+			expected:  "euc-jp",
+		},
+		{
+			name:      "meta http-equiv",
+			head:      `<html><head><meta http-equiv="Content-Type" content="text/html; charset=latin1"></head></html>`,
+			mediaType: domain.MediaTypeHTML,
+			expected:  "windows-1252",
+		},
+		{
+			name:      "meta UTF-16 is UTF-8",
+			head:      `<html><head><meta charset="utf-16"></head></html>`,
+			mediaType: domain.MediaTypeHTML,
+			expected:  "utf-8",
+		},
+		{
+			name:      "XML declaration",
+			head:      `<?xml version="1.0" encoding="ISO-8859-2"?><rss></rss>`,
+			mediaType: domain.MediaTypeRSS,
+			expected:  "iso-8859-2",
+		},
+		{
+			name:      "XML without declaration",
+			head:      "<rss>\xe9</rss>",
+			mediaType: domain.MediaTypeRSS,
+			expected:  "utf-8",
+		},
+		{
+			name:      "valid UTF-8, cut in the middle of a rune",
+			head:      "<html>caf\xc3\xa9 \xe6\x97",
+			mediaType: domain.MediaTypeHTML,
+			expected:  "utf-8",
+		},
+		{
+			name:      "invalid UTF-8",
+			head:      "caf\xe9 au lait",
+			mediaType: domain.MediaTypeText,
+			expected:  "windows-1252",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			charset := detectCharset([]byte(test.head), test.contentType, test.mediaType)
+			assert.Equal(t, test.expected, charset.name)
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gsiffert/fetch/internal/domain"
+)
+
+// CrawlScope restricts the links followed when crawling, relative to the site the crawl started from.
+type CrawlScope string
+
+const (
+	// ScopeHost follows the links to the same host as the site the crawl started from.
+	ScopeHost CrawlScope = "host"
+	// ScopePrefix follows the links under the directory of the site the crawl started from.
+	ScopePrefix CrawlScope = "prefix"
+)
+
+// ParseCrawlScope returns the CrawlScope matching the given name.
+func ParseCrawlScope(name string) (CrawlScope, error) {
+	switch scope := CrawlScope(name); scope {
+	case ScopeHost, ScopePrefix:
+		return scope, nil
+	default:
+		return "", fmt.Errorf("unknown crawl scope %q", name)
+	}
+}
+
+// CrawlOptions defines the limits of a crawl.
+type CrawlOptions struct {
+	// MaxDepth is the number of links followed from the sites the crawl started from.
+	MaxDepth int
+	// MaxPages is the maximum number of pages fetched by the crawl, including the sites it started from.
+	// Zero means no limit.
+	MaxPages int
+	// Scope restricts the links followed.
+	Scope CrawlScope
+}
+
+// fetchTask is a site to fetch, along with the way it was reached when crawling.
+type fetchTask struct {
+	request SiteRequest
+	depth   int
+	// seed is the site the crawl started from to reach this one, it is nil for the sites that are not URLs.
+	seed *url.URL
+	// id identifies the domain.RunTask recording the task in the queue of a run, it is zero outside a run.
+	id int64
+}
+
+// fetchedTask is the outcome of a fetchTask.
+type fetchedTask struct {
+	task   fetchTask
+	result FetchResult
+	links  []*url.URL
+}
+
+// frontier holds the sites left to fetch. When crawling, the links found in the fetched pages are pushed
+// to it and it only keeps those within the limits of the crawl, that were not queued yet.
+// Within a run, the sites are recorded in the queue of the run as they are queued, popped and fetched.
+type frontier struct {
+	crawl  *CrawlOptions
+	run    *runQueue
+	queue  []fetchTask
+	seen   map[string]struct{}
+	popped int
+}
+
+func newFrontier(crawl *CrawlOptions) *frontier {
+	return &frontier{
+		crawl: crawl,
+		seen:  make(map[string]struct{}),
+	}
+}
+
+// add queues the sites the fetch starts from.
+func (f *frontier) add(requests ...SiteRequest) {
+	tasks := make([]fetchTask, 0, len(requests))
+	for _, request := range requests {
+		seed, err := url.Parse(request.Site)
+		if err != nil {
+			// The fetch will report the invalid site, we only need to not follow its links.
+			seed = nil
+		}
+		// The sites are only remembered when crawling, so a long list of sites does not pile up in memory.
+		if f.crawl != nil && seed != nil {
+			f.seen[domain.NormalizeURL(seed).String()] = struct{}{}
+		}
+		tasks = append(tasks, fetchTask{request: request, seed: seed})
+	}
+	f.queue = append(f.queue, f.run.enqueue(tasks...)...)
+}
+
+// empty reports whether no site is queued.
+func (f *frontier) empty() bool {
+	return len(f.queue) == 0
+}
+
+// full reports whether the crawl reached its limit, no more site is popped from the frontier.
+func (f *frontier) full() bool {
+	return f.crawl != nil && f.crawl.MaxPages > 0 && f.popped >= f.crawl.MaxPages
+}
+
+// capacity returns the number of sites which can still be popped, at most n, so the sites queued beyond the
+// limit of the crawl are not read.
+func (f *frontier) capacity(n int) int {
+	if f.crawl == nil || f.crawl.MaxPages == 0 {
+		return n
+	}
+	return max(min(n, f.crawl.MaxPages-f.popped-len(f.queue)), 1)
+}
+
+// pop returns the next site to fetch, it returns false when the frontier is empty or the crawl reached its limit.
+func (f *frontier) pop() (fetchTask, bool) {
+	if f.empty() || f.full() {
+		return fetchTask{}, false
+	}
+
+	task := f.queue[0]
+	f.queue = f.queue[1:]
+	f.popped++
+	f.run.start(task)
+	return task, true
+}
+
+// push queues the links found in the page fetched by the task, the links are ignored when not crawling.
+func (f *frontier) push(task fetchTask, links []*url.URL) {
+	if f.crawl == nil || task.seed == nil || task.depth >= f.crawl.MaxDepth {
+		return
+	}
+
+	var tasks []fetchTask
+	for _, link := range links {
+		// The links are normalized, so the different ways of writing the URL of a page only queue it once.
+		site := domain.NormalizeURL(link).String()
+		if _, ok := f.seen[site]; ok || !f.inScope(task.seed, link) {
+			continue
+		}
+
+		f.seen[site] = struct{}{}
+		tasks = append(tasks, fetchTask{request: SiteRequest{Site: site}, depth: task.depth + 1, seed: task.seed})
+	}
+	f.queue = append(f.queue, f.run.enqueue(tasks...)...)
+}
+
+// inScope reports whether the link can be followed by a crawl started from the seed. They are compared once
+// normalized, so the default port or the Unicode form of the host does not take the link out of the scope.
+func (f *frontier) inScope(seed *url.URL, link *url.URL) bool {
+	seed, link = domain.NormalizeURL(seed), domain.NormalizeURL(link)
+	if seed.Host != link.Host {
+		return false
+	}
+	if f.crawl.Scope != ScopePrefix {
+		return true
+	}
+
+	// The prefix is the directory of the seed, so a crawl started from /docs/intro follows the links under /docs/.
+	prefix := "/"
+	if i := strings.LastIndex(seed.Path, "/"); i >= 0 {
+		prefix = seed.Path[:i+1]
+	}
+	return strings.HasPrefix(link.Path, prefix) || link.Path+"/" == prefix
+}
+
+// resolveLinks returns the absolute URL of the links of the parsed page, fragments are removed and
+// only the links to http and https pages are kept.
+func resolveLinks(page domain.Page, parsed *parsedPage) []*url.URL {
+	base, err := url.Parse(page.ID.String())
+	if err != nil {
+		return nil
+	}
+	if parsed.base != "" {
+		if b, err := base.Parse(parsed.base); err == nil {
+			base = b
+		}
+	}
+
+	links := make([]*url.URL, 0, len(parsed.links))
+	for _, href := range parsed.links {
+		link, err := base.Parse(href)
+		if err != nil || (link.Scheme != "http" && link.Scheme != "https") {
+			continue
+		}
+		link.Fragment = ""
+		link.RawFragment = ""
+		links = append(links, link)
+	}
+
+	return links
+}
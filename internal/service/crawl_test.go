@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestFrontier(t *testing.T) {
+	t.Parallel()
+
+	links := []string{
+		"https://www.google.com/docs/search",
+		"https://www.google.com/docs",
+		"https://www.google.com/about",
+		"https://maps.google.com/docs/search",
+		"https://www.google.com/docs/search",
+	}
+
+	tests := []struct {
+		name     string
+		crawl    *CrawlOptions
+		expected []string
+	}{
+		{
+			name:     "not crawling",
+			expected: []string{"https://www.google.com/docs/intro"},
+		},
+		{
+			name:  "host scope",
+			crawl: &CrawlOptions{MaxDepth: 1, Scope: ScopeHost},
+			expected: []string{
+				"https://www.google.com/docs/intro",
+				"https://www.google.com/docs/search",
+				"https://www.google.com/docs",
+				"https://www.google.com/about",
+			},
+		},
+		{
+			name:  "prefix scope",
+			crawl: &CrawlOptions{MaxDepth: 1, Scope: ScopePrefix},
+			expected: []string{
+				"https://www.google.com/docs/intro",
+				"https://www.google.com/docs/search",
+				"https://www.google.com/docs",
+			},
+		},
+		{
+			name:     "max depth",
+			crawl:    &CrawlOptions{MaxDepth: 0, Scope: ScopeHost},
+			expected: []string{"https://www.google.com/docs/intro"},
+		},
+		{
+			name:  "max pages",
+			crawl: &CrawlOptions{MaxDepth: 1, MaxPages: 2, Scope: ScopeHost},
+			expected: []string{
+				"https://www.google.com/docs/intro",
+				"https://www.google.com/docs/search",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			f := newFrontier(test.crawl)
+			f.add(SiteRequest{Site: "https://www.google.com/docs/intro"})
+
+			var popped []string
+			for task, ok := f.pop(); ok; task, ok = f.pop() {
+				popped = append(popped, task.request.Site)
+
+				var found []*url.URL
+				for _, link := range links {
+					u, err := url.Parse(link)
+					require.NoError(t, err)
+					found = append(found, u)
+				}
+				f.push(task, found)
+			}
+
+			assert.Equal(t, test.expected, popped)
+		})
+	}
+}
+
+func TestFrontier_InScope(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		seed     string
+		link     string
+		scope    CrawlScope
+		expected bool
+	}{
+		{seed: "https://www.google.com/", link: "https://WWW.Google.com/about", scope: ScopeHost, expected: true},
+		{seed: "https://www.google.com:443/", link: "https://www.google.com/about", scope: ScopeHost, expected: true},
+		{seed: "http://www.google.com/", link: "http://www.google.com:80/about", scope: ScopeHost, expected: true},
+		{seed: "https://bücher.example/", link: "https://xn--bcher-kva.example/about", scope: ScopeHost, expected: true},
+		{seed: "https://www.google.com/", link: "https://www.google.com:8443/about", scope: ScopeHost, expected: false},
+		{seed: "https://www.google.com/", link: "https://maps.google.com/", scope: ScopeHost, expected: false},
+		{seed: "https://www.google.com:443/docs/intro", link: "https://www.google.com/docs/search", scope: ScopePrefix, expected: true},
+		{seed: "https://www.google.com/docs/intro", link: "https://www.google.com/docs/../about", scope: ScopePrefix, expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.seed+" "+test.link, func(t *testing.T) {
+			t.Parallel()
+
+			seed, err := url.Parse(test.seed)
+			require.NoError(t, err)
+			link, err := url.Parse(test.link)
+			require.NoError(t, err)
+			f := newFrontier(&CrawlOptions{MaxDepth: 1, Scope: test.scope})
+			assert.Equal(t, test.expected, f.inScope(seed, link))
+		})
+	}
+}
+
+func TestService_Fetch_Crawl(t *testing.T) {
+	t.Parallel()
+
+	pages := map[string]string{
+		"https://www.google.com": `
+			<a href="/about#team">About</a>
+			<a href="https://www.google.com/about">About</a>
+			<a href="mailto:contact@google.com">Contact</a>
+			<a href="https://www.youtube.com">YouTube</a>
+		`,
+		"https://www.google.com/about": `<a href="/careers">Careers</a>`,
+	}
+
+	ctx := context.Background()
+	svcTest := newTestService(t, WithCrawl(CrawlOptions{MaxDepth: 1, Scope: ScopeHost}))
+	defer svcTest.Close()
+
+	for site, content := range pages {
+		u, err := url.Parse(site)
+		require.NoError(t, err)
+
+		svcTest.fetcher.EXPECT().
+			Fetch(gomock.Any(), FetchRequest{Site: site}).
+			Return(&FetchedItem{
+				Page:    domain.NewPage(u),
+				Content: io.NopCloser(strings.NewReader(content)),
+			}, nil)
+	}
+	svcTest.metaDataRepo.EXPECT().
+		ByIDs(gomock.Any(), gomock.Any()).
+		Return(nil, nil).
+		Times(len(pages))
+	svcTest.disk.EXPECT().
+		NewPageWriter(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nopCloserWriter{io.Discard}, nil).
+		Times(len(pages))
+	svcTest.metaDataRepo.EXPECT().
+		Save(gomock.Any(), gomock.Any()).
+		Return(nil).
+		Times(len(pages))
+
+	results, err := svcTest.svc.Fetch(ctx, "https://www.google.com")
+	assert.NoError(t, err)
+	assert.Len(t, results, len(pages))
+	for _, result := range results {
+		assert.Equal(t, FetchStatusFetched, result.Status)
+		assert.Contains(t, pages, result.Site)
+	}
+}
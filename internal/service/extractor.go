@@ -0,0 +1,144 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gsiffert/fetch/internal/domain"
+)
+
+// extractMetaData reads the Content of the given media type and returns the metadata along with the links of
+// the page, the extraction depends on the media type: the HTML pages are parsed, the words of the plain texts
+// are counted, the titles and the links of the XML documents, such as the feeds, are extracted, and only the
+// size of the other contents is known.
+// When a mirror is given, the Content of an HTML page is copied through it as it is read.
+func (s *Service) extractMetaData(ctx context.Context, mediaType string, data io.Reader, mirror *pageMirror) (*parsedPage, error) {
+	if domain.IsHTML(mediaType) {
+		return s.parseMetaData(ctx, data, mirror)
+	}
+
+	page := parsedPage{
+		metaData: domain.MetaData{
+			LastFetched: time.Now().UTC(),
+		},
+	}
+	counter := &countingReader{reader: data}
+
+	var err error
+	switch {
+	case mediaType == domain.MediaTypeText:
+		err = page.plainText(counter)
+	case domain.IsXML(mediaType):
+		err = page.xmlDocument(counter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The whole Content is read, so it is entirely saved, whatever the extraction needed.
+	if _, err := io.Copy(io.Discard, counter); err != nil {
+		return nil, fmt.Errorf("read content: %w", err)
+	}
+	page.metaData.ByteSize = counter.count
+	return &page, nil
+}
+
+// plainText counts the words of a plain text.
+func (p *parsedPage) plainText(data io.Reader) error {
+	reader := bufio.NewReader(data)
+	inWord := false
+	for {
+		r, _, err := reader.ReadRune()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read text: %w", err)
+		}
+
+		isSpace := unicode.IsSpace(r)
+		if !isSpace && !inWord {
+			p.metaData.WordCount++
+		}
+		inWord = !isSpace
+	}
+}
+
+// xmlDocument extracts the title and the links of an XML document, such as the title of the channel of an
+// RSS feed and the links of its items, or the title and the links of an Atom feed. A malformed document is
+// not an error, the extraction stops where the document is malformed.
+func (p *parsedPage) xmlDocument(data io.Reader) error {
+	decoder := xml.NewDecoder(data)
+	decoder.Strict = false
+	// The charset of the document does not matter to find its title and its links.
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	// elements holds the local names of the elements being read, from the root to the current one.
+	var elements []string
+	for {
+		token, err := decoder.Token()
+		var syntaxErr *xml.SyntaxError
+		switch {
+		case errors.Is(err, io.EOF), errors.As(err, &syntaxErr):
+			return nil
+		case err != nil:
+			return fmt.Errorf("parse xml: %w", err)
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			elements = append(elements, token.Name.Local)
+			p.xmlElement(token)
+		case xml.EndElement:
+			if len(elements) > 0 {
+				elements = elements[:len(elements)-1]
+			}
+		case xml.CharData:
+			p.xmlText(elements, token)
+		}
+	}
+}
+
+// xmlElement extracts the links held by the attributes of an element: the links of an Atom feed and the
+// enclosures of an RSS feed, such as the podcasts.
+func (p *parsedPage) xmlElement(element xml.StartElement) {
+	for _, attr := range element.Attr {
+		isLink := element.Name.Local == "link" && attr.Name.Local == "href" ||
+			element.Name.Local == "enclosure" && attr.Name.Local == "url"
+		if isLink && attr.Name.Space == "" && strings.TrimSpace(attr.Value) != "" {
+			p.metaData.NumLinks++
+			p.links = append(p.links, strings.TrimSpace(attr.Value))
+		}
+	}
+}
+
+// xmlText extracts the title of the document, the first title element, and the links of an RSS feed, the text
+// of its link elements.
+func (p *parsedPage) xmlText(elements []string, text xml.CharData) {
+	if len(elements) == 0 {
+		return
+	}
+
+	value := strings.Join(strings.Fields(string(text)), " ")
+	switch elements[len(elements)-1] {
+	case "title":
+		if p.metaData.Title == "" {
+			p.metaData.Title = value
+		}
+	case "link":
+		if value != "" {
+			p.metaData.NumLinks++
+			p.links = append(p.links, value)
+		}
+	}
+	p.metaData.WordCount += countWords(text)
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_extractMetaData(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		mediaType string
+		content   string
+		expected  domain.MetaData
+		links     []string
+	}{
+		{
+			name:      "html",
+			mediaType: domain.MediaTypeHTML,
+			content:   `<html><head><title>Google</title></head><body><a href="/about">About</a></body></html>`,
+			expected:  domain.MetaData{Title: "Google", NumLinks: 1, WordCount: 1},
+			links:     []string{"/about"},
+		},
+		{
+			name:      "plain text",
+			mediaType: domain.MediaTypeText,
+			content:   "  The quick\nbrown fox\t jumps.  ",
+			expected:  domain.MetaData{WordCount: 5},
+		},
+		{
+			name:      "rss feed",
+			mediaType: domain.MediaTypeRSS,
+			content: `<?xml version="1.0" encoding="ISO-8859-1"?>
+<rss version="2.0"><channel>
+	<title>  Google   News </title>
+	<link>https://news.google.com/</link>
+	<item>
+		<title>First</title>
+		<link>https://news.google.com/first</link>
+		<enclosure url="https://news.google.com/first.mp3" type="audio/mpeg"/>
+	</item>
+</channel></rss>`,
+			expected: domain.MetaData{Title: "Google News", NumLinks: 3, WordCount: 5},
+			links: []string{
+				"https://news.google.com/",
+				"https://news.google.com/first",
+				"https://news.google.com/first.mp3",
+			},
+		},
+		{
+			name:      "atom feed",
+			mediaType: domain.MediaTypeAtom,
+			content: `<feed xmlns="http://www.w3.org/2005/Atom"><title>Blog</title>` +
+				`<link href="https://blog.google/"/><entry><title>Post</title><link href="/post"/></entry></feed>`,
+			expected: domain.MetaData{Title: "Blog", NumLinks: 2, WordCount: 2},
+			links:    []string{"https://blog.google/", "/post"},
+		},
+		{
+			name:      "malformed xml",
+			mediaType: domain.MediaTypeXML,
+			content:   `<root><title>Partial</title><unclosed attr=></root>`,
+			expected:  domain.MetaData{Title: "Partial", WordCount: 1},
+		},
+		{
+			name:      "pdf",
+			mediaType: domain.MediaTypePDF,
+			content:   "%PDF-1.7\n<< /Title (Ignored) >>",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			svcTest := newTestService(t)
+			defer svcTest.Close()
+
+			parsed, err := svcTest.svc.extractMetaData(context.Background(), test.mediaType, strings.NewReader(test.content), nil)
+			require.NoError(t, err)
+
+			expected := test.expected
+			expected.LastFetched = parsed.metaData.LastFetched
+			expected.ByteSize = int64(len(test.content))
+			assert.Equal(t, expected, parsed.metaData)
+			assert.Equal(t, test.links, parsed.links)
+		})
+	}
+}
@@ -5,146 +5,484 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"sync"
 	"time"
 
 	"github.com/gsiffert/fetch/internal/domain"
-	"golang.org/x/net/html"
 )
 
 const (
 	maxConcurrentFetch = 100
+	// maxRequestBatch and requestBatchInterval bound the batches of requests read at once, the sites of a batch
+	// are queued together, within a run in a single transaction.
+	maxRequestBatch      = 100
+	requestBatchInterval = 200 * time.Millisecond
 )
 
+// SiteRequest describes a site given to the Service to fetch, along with its own options.
+type SiteRequest struct {
+	Site string
+	// Method is the HTTP method of the request, GET when empty.
+	Method string
+	// Header holds the headers sent along with the request.
+	Header http.Header
+	// Name is the name the page is stored under, it is derived from the site when empty.
+	Name string
+}
+
+// FetchRequest describes a page to fetch.
+type FetchRequest struct {
+	Site string
+	// Method is the HTTP method of the request, GET when empty.
+	Method string
+	// Header holds the headers sent along with the request.
+	Header http.Header
+	// ETag and LastModified are the validators of the previous fetch of the page. When set, the Fetcher sends
+	// a conditional request and the FetchedItem is NotModified if the page did not change since.
+	ETag         string
+	LastModified string
+}
+
+// Exchange describes the HTTP request sent to fetch a page and the response of the server, the storages
+// archiving the exchange along with the page, such as WARC files, store it.
+type Exchange struct {
+	// Method, URL and RequestHeader describe the last request sent, after the redirects.
+	Method        string
+	URL           string
+	RequestHeader http.Header
+	// Proto is the protocol of the response, such as HTTP/1.1.
+	Proto          string
+	StatusCode     int
+	ResponseHeader http.Header
+	// Started is when the request was sent.
+	Started time.Time
+}
+
 type FetchedItem struct {
 	Page    domain.Page
 	Content io.ReadCloser
+	// Exchange describes the request and the response of the page.
+	Exchange Exchange
+	// ContentType is the media type of the Content, as declared by the server or sniffed from the Content.
+	ContentType string
+	// Attempts is the number of requests sent to get the page, the failed ones included.
+	Attempts int
+	// NotModified is set when the server answered a conditional request with 304 Not Modified,
+	// the Content is empty and the previous content of the page is still valid.
+	NotModified bool
+	// ETag and LastModified are the validators returned by the server for this version of the page.
+	ETag         string
+	LastModified string
 }
 
 func (f *FetchedItem) Close() error {
 	return f.Content.Close()
 }
 
-// parseMetaData reads the html Content and returns the metadata.
-func (s *Service) parseMetaData(_ context.Context, data io.Reader) (*domain.MetaData, error) {
-	metaData := domain.MetaData{
-		LastFetched: time.Now().UTC(),
-	}
+// FetchError is returned by the Fetcher when the requests sent to fetch a page failed, Err is the cause of
+// the failure of the last request.
+type FetchError struct {
+	// Attempts is the number of requests sent.
+	Attempts int
+	Err      error
+}
 
-	// We use the html tokenizer instead of the parser to avoid parsing the whole document
-	// as we only need to count the number of links and images.
-	reader := html.NewTokenizer(data)
-	for token := reader.Next(); token != html.ErrorToken; token = reader.Next() {
-		if token != html.StartTagToken && token != html.SelfClosingTagToken {
-			continue
-		}
+// Error implements the error interface.
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
 
-		tagName, _ := reader.TagName()
-		tagNameStr := string(tagName)
-		switch {
-		case tagNameStr == "a":
-			metaData.NumLinks++
-		case tagNameStr == "img":
-			metaData.NumImages++
-		}
-	}
+// Unwrap returns the cause of the failure.
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
 
-	lastErr := reader.Err()
-	if !errors.Is(lastErr, io.EOF) {
-		return nil, fmt.Errorf("parse html: %w", lastErr)
-	}
+// FetchStatus is the outcome of the fetch of a site.
+type FetchStatus string
+
+const (
+	// FetchStatusFetched reports the page was downloaded and its metadata saved.
+	FetchStatusFetched FetchStatus = "fetched"
+	// FetchStatusNotModified reports the page did not change since its previous fetch, the saved page is kept.
+	FetchStatusNotModified FetchStatus = "not_modified"
+	// FetchStatusFailed reports the page could not be fetched, the error is set.
+	FetchStatusFailed FetchStatus = "failed"
+)
+
+// FetchResult reports the outcome of the fetch of a site.
+type FetchResult struct {
+	Site string
+	Page domain.Page
+	// Location is where the page is stored, as reported by the Disk.
+	Location string
+	Status   FetchStatus
+	// MetaData is the metadata saved for the page, it is empty when the fetch failed.
+	MetaData domain.MetaData
+	// Attempts is the number of requests sent to fetch the page, it is zero when no request was sent.
+	Attempts int
+	Err      error
+}
 
-	return &metaData, nil
+// hasPage reports whether the Disk still holds the page stored along with the metadata.
+func (s *Service) hasPage(ctx context.Context, metaData domain.MetaData) bool {
+	if metaData.FileLocation == "" {
+		return false
+	}
+	ok, err := s.disk.HasPage(ctx, metaData.FileLocation)
+	if err != nil {
+		s.logger.Warn("Failed to check page, requesting its content.", "page", metaData.ID, "error", err)
+		return false
+	}
+	return ok
 }
 
 // fetchSite query the page, parse the metadata, saves the Content of the page in a file and save the metadata.
 // The process stream the Content of the page to the file and through the metadata parser.
-func (s *Service) fetchSite(ctx context.Context, site string) error {
-	fetchedItem, err := s.fetcher.Fetch(ctx, site)
+// It returns the metadata saved for the page, along with the absolute URLs of the links found in the page.
+func (s *Service) fetchSite(ctx context.Context, siteRequest SiteRequest) (FetchResult, []*url.URL, error) {
+	site := siteRequest.Site
+	result := FetchResult{Site: site}
+	requested, err := domain.NewPageID(site)
 	if err != nil {
-		return fmt.Errorf("query page: %w", err)
+		return result, nil, fmt.Errorf("invalid site: %w", err)
 	}
-	defer func() {
+	ids, err := s.metaDataRepo.ResolveAliases(ctx, []domain.PageID{requested})
+	if err != nil {
+		return result, nil, fmt.Errorf("resolve aliases: %w", err)
+	}
+	resolved := ids[0]
+
+	previous, err := s.metaDataRepo.ByIDs(ctx, []domain.PageID{resolved})
+	if err != nil {
+		return result, nil, fmt.Errorf("get previous metadata: %w", err)
+	}
+
+	// An unchanged page is not parsed again, so when crawling we always ask for the content to find its links.
+	// Nothing is written for an unchanged page, it is only requested conditionally when the Disk still holds it.
+	request := FetchRequest{Site: site, Method: siteRequest.Method, Header: siteRequest.Header}
+	if len(previous) > 0 && s.crawl == nil && isSafeMethod(siteRequest.Method) && s.hasPage(ctx, previous[0]) {
+		request.ETag = previous[0].ETag
+		request.LastModified = previous[0].LastModified
+	}
+
+	fetchedItem, err := s.fetcher.Fetch(ctx, request)
+	if err != nil {
+		return result, nil, fmt.Errorf("query page: %w", err)
+	}
+	result.Attempts = fetchedItem.Attempts
+	closeItem := sync.OnceFunc(func() {
 		if err := fetchedItem.Close(); err != nil {
 			s.logger.Warn("Failed to close fetched item.", "site", site, "error", err)
 		}
-	}()
+	})
+	defer closeItem()
+
+	// The page is stored with the extension of its media type.
+	fetchedItem.Page.FileLocation = s.fileLocation(fetchedItem.Page, fetchedItem.ContentType)
+	if siteRequest.Name != "" {
+		fetchedItem.Page.FileLocation = siteRequest.Name + domain.Extension(fetchedItem.ContentType)
+	}
+	result.Page = fetchedItem.Page
+	result.Location = s.disk.PageLocation(fetchedItem.Page.FileLocation)
 
-	writer, err := s.disk.NewPageWriter(ctx, fetchedItem.Page.FileLocation)
+	if fetchedItem.NotModified && len(previous) > 0 {
+		// The saved page is still valid, we only record that it was checked.
+		metaData := previous[0]
+		if err := s.disk.SaveNotModified(ctx, metaData.FileLocation, fetchedItem.Exchange, metaData.LastFetched); err != nil {
+			return result, nil, fmt.Errorf("save not modified: %w", err)
+		}
+		metaData.LastFetched = time.Now().UTC()
+		result.Location = s.disk.PageLocation(metaData.FileLocation)
+		if err := s.metaDataRepo.Save(ctx, metaData); err != nil {
+			return result, nil, fmt.Errorf("save metadata: %w", err)
+		}
+		if err := s.saveAlias(ctx, requested, resolved, fetchedItem.Page.ID); err != nil {
+			return result, nil, err
+		}
+		result.Status = FetchStatusNotModified
+		result.MetaData = metaData
+		return result, nil, nil
+	}
+
+	writer, err := s.disk.NewPageWriter(ctx, fetchedItem.Page.FileLocation, fetchedItem.Exchange)
 	if err != nil {
-		return fmt.Errorf("create file: %w", err)
+		return result, nil, fmt.Errorf("create file: %w", err)
 	}
+	// The page is only replaced once its content and metadata are saved, a failed fetch leaves it untouched.
+	committed := false
 	defer func() {
-		if err := writer.Close(); err != nil {
-			s.logger.Warn("Failed to close writer.", "site", site, "error", err)
+		if committed {
+			return
+		}
+		if err := writer.Discard(); err != nil {
+			s.logger.Warn("Failed to discard writer.", "site", site, "error", err)
 		}
 	}()
 
-	reader := io.TeeReader(fetchedItem.Content, writer)
-	metaData, err := s.parseMetaData(ctx, reader)
+	// The page is stored as it is served, while it is parsed decoded to UTF-8 so the extracted fields are readable.
+	decoded, pageCharset, err := readCharset(fetchedItem)
+	if err != nil {
+		return result, nil, err
+	}
+	// The size of the page is the size of its content as served, not decoded.
+	content := &countingReader{reader: decoded}
+	var utf8Copy AssetWriter
+	if s.utf8Copy && domain.IsText(fetchedItem.ContentType) && !pageCharset.isUTF8() {
+		utf8Copy, err = s.newUTF8Copy(ctx, fetchedItem.Page.FileLocation, fetchedItem.ContentType)
+		if err != nil {
+			return result, nil, fmt.Errorf("new utf-8 copy: %w", err)
+		}
+		// The copy is only stored along with the page, a failed fetch leaves no partial copy behind.
+		defer func() {
+			if err := utf8Copy.Discard(); err != nil {
+				s.logger.Warn("Failed to discard UTF-8 copy.", "site", site, "error", err)
+			}
+		}()
+	}
+
+	// In mirror mode, the parser writes the page itself as it needs to rewrite the references to the assets,
+	// encoded back to the charset of the page. Only the HTML pages reference assets.
+	var mirror *pageMirror
+	var encoder io.WriteCloser
+	reader := pageCharset.decoder(io.TeeReader(content, writer))
+	if utf8Copy != nil {
+		reader = io.TeeReader(reader, utf8Copy)
+	}
+	if s.mirror && domain.IsHTML(fetchedItem.ContentType) {
+		encoder = pageCharset.encoder(writer)
+		var mirrored io.Writer = encoder
+		if utf8Copy != nil {
+			mirrored = io.MultiWriter(encoder, utf8Copy)
+		}
+		mirror, err = newPageMirror(fetchedItem.Page, mirrored)
+		if err != nil {
+			return result, nil, fmt.Errorf("new page mirror: %w", err)
+		}
+		reader = pageCharset.decoder(content)
+	}
+
+	parsed, err := s.extractMetaData(ctx, fetchedItem.ContentType, reader, mirror)
 	if err != nil {
-		return fmt.Errorf("export metadata: %w", err)
+		return result, nil, fmt.Errorf("export metadata: %w", err)
+	}
+	if encoder != nil {
+		if err := encoder.Close(); err != nil {
+			return result, nil, fmt.Errorf("encode page: %w", err)
+		}
+	}
+
+	// Closing the writer stores the snapshot of the page, which must exist before the metadata references it.
+	if err := writer.Close(); err != nil {
+		return result, nil, fmt.Errorf("close page: %w", err)
 	}
 
+	if mirror != nil {
+		// The page holds a request to its host until it is closed, while its assets are mostly fetched from
+		// the same host.
+		closeItem()
+		s.downloadAssets(ctx, site, mirror)
+	}
+
+	metaData := parsed.metaData
 	metaData.ID = fetchedItem.Page.ID
 	metaData.Site = fetchedItem.Page.Site
-	if err := s.metaDataRepo.Save(ctx, *metaData); err != nil {
-		return fmt.Errorf("save metadata: %w", err)
+	metaData.Snapshot = writer.Snapshot()
+	metaData.Compression = writer.Compression()
+	metaData.ContentType = fetchedItem.ContentType
+	metaData.Charset = pageCharset.name
+	metaData.ByteSize = content.count
+	metaData.FileLocation = fetchedItem.Page.FileLocation
+	metaData.ETag = fetchedItem.ETag
+	metaData.LastModified = fetchedItem.LastModified
+	if err := s.metaDataRepo.Save(ctx, metaData); err != nil {
+		return result, nil, fmt.Errorf("save metadata: %w", err)
+	}
+
+	if err := writer.Commit(); err != nil {
+		return result, nil, fmt.Errorf("commit page: %w", err)
+	}
+	committed = true
+	if utf8Copy != nil {
+		if err := utf8Copy.Close(); err != nil {
+			s.logger.Warn("Failed to close UTF-8 copy.", "site", site, "error", err)
+		}
 	}
 
+	if err := s.saveAlias(ctx, requested, resolved, fetchedItem.Page.ID); err != nil {
+		return result, nil, err
+	}
+	result.Status = FetchStatusFetched
+	result.MetaData = metaData
+	return result, resolveLinks(fetchedItem.Page, parsed), nil
+}
+
+// saveAlias records the requested page as an alias of the page it was redirected to, so both resolve to the
+// same page. The requested page previously resolved to the resolved page, the alias is only saved when it changed.
+func (s *Service) saveAlias(ctx context.Context, requested domain.PageID, resolved domain.PageID, page domain.PageID) error {
+	if page == resolved {
+		return nil
+	}
+	if err := s.metaDataRepo.SaveAlias(ctx, requested, page); err != nil {
+		return fmt.Errorf("save alias: %w", err)
+	}
 	return nil
 }
 
-// fetchSitesInParallel fetches the sites in parallel and returns a channel of error.
-// The channel will be closed when all the fetches are done.
-func (s *Service) fetchSitesInParallel(ctx context.Context, sites []string) <-chan error {
-	errChan := make(chan error)
+// failedResult returns the FetchResult of a site which could not be fetched.
+// The page is identified from the site when possible, so the result tells where it would have been stored.
+func (s *Service) failedResult(result FetchResult, err error) FetchResult {
+	result.Status = FetchStatusFailed
+	result.Err = fmt.Errorf("fetch site %s: %w", result.Site, err)
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		result.Attempts = fetchErr.Attempts
+	}
+	if result.Location == "" {
+		if u, err := url.Parse(result.Site); err == nil {
+			result.Page = domain.NewPage(u)
+			result.Page.FileLocation = s.fileLocation(result.Page, "")
+			result.Location = s.disk.PageLocation(result.Page.FileLocation)
+		}
+	}
+	return result
+}
 
-	// We use a channel of empty structs to limit the number of concurrent fetches.
-	pool := make(chan any, maxConcurrentFetch)
+// fileLocation returns the location of the file holding the page of the given media type, named by the
+// FileNaming of the Service and with the extension of the media type.
+func (s *Service) fileLocation(page domain.Page, mediaType string) string {
+	u, err := url.Parse(page.ID.String())
+	if err != nil {
+		return page.FileLocation
+	}
+	return s.naming.FileLocation(u) + domain.Extension(mediaType)
+}
+
+// isSafeMethod reports whether the HTTP method only retrieves the page, so the request can be conditional.
+func isSafeMethod(method string) bool {
+	return method == "" || method == http.MethodGet || method == http.MethodHead
+}
+
+// FetchStream downloads the sites read from the requests channel, store their content in a file and save their
+// related metadata. The sites are downloaded in parallel and the requests are read as the fetches progress,
+// so the sites are never all held in memory. When crawling, the links found in the fetched pages are fetched
+// as well, within the limits of the crawl.
+// The FetchResult of every fetched site is sent on the returned channel as soon as it is fetched, the channel
+// is closed once the requests channel is closed and every site is fetched, or the context is done.
+func (s *Service) FetchStream(ctx context.Context, requests <-chan SiteRequest) <-chan FetchResult {
+	return s.fetchFrontier(ctx, newFrontier(s.crawl), requests)
+}
+
+// fetchFrontier fetches the sites queued in the frontier, followed by the sites read from the requests channel,
+// as described by FetchStream.
+func (s *Service) fetchFrontier(ctx context.Context, frontier *frontier, requests <-chan SiteRequest) <-chan FetchResult {
+	results := make(chan FetchResult)
 
 	go func() {
-		defer close(errChan)
-
-		// We run the fetch of each site in a goroutine and wait for all of them to finish.
-		wg := sync.WaitGroup{}
-		for _, site := range sites {
-			pool <- nil
-			wg.Add(1)
-
-			go func(site string) {
-				defer func() {
-					<-pool
-					wg.Done()
-				}()
-
-				err := s.fetchSite(ctx, site)
-				if err != nil {
-					select {
-					case <-ctx.Done():
-						return
-					case errChan <- fmt.Errorf("fetch site %s: %w", site, err):
+		defer close(results)
+
+		// We run the fetch of each site in a goroutine which reports on the done channel, this lets the loop
+		// limit the number of concurrent fetches and push the links found back to the frontier.
+		done := make(chan fetchedTask)
+		inFlight := 0
+		for {
+			for inFlight < maxConcurrentFetch && ctx.Err() == nil {
+				task, ok := frontier.pop()
+				if !ok {
+					break
+				}
+
+				inFlight++
+				go func(task fetchTask) {
+					result, links, err := s.fetchSite(ctx, task.request)
+					if err != nil {
+						result = s.failedResult(result, err)
+						s.logger.Error("Failed to fetch site.", "error", result.Err)
 					}
+					done <- fetchedTask{task: task, result: result, links: links}
+				}(task)
+			}
+
+			// The next requests are only read once the queued sites are fetched, the links found when crawling
+			// are fetched before moving on to the next sites.
+			var input <-chan SiteRequest
+			if inFlight < maxConcurrentFetch && frontier.empty() && !frontier.full() && ctx.Err() == nil {
+				input = requests
+			}
+			if inFlight == 0 && input == nil {
+				return
+			}
+
+			select {
+			case request, ok := <-input:
+				if !ok {
+					requests = nil
+					continue
+				}
+				var batch []SiteRequest
+				batch, requests = readBatch(ctx, request, requests, frontier.capacity(maxRequestBatch))
+				frontier.add(batch...)
+			case fetched := <-done:
+				inFlight--
+				frontier.run.finish(fetched)
+				select {
+				case <-ctx.Done():
+				case results <- fetched.result:
 				}
-			}(site)
-		}
 
-		wg.Wait()
+				if fetched.result.Err == nil {
+					frontier.push(fetched.task, fetched.links)
+				}
+			}
+		}
 	}()
 
-	return errChan
+	return results
+}
+
+// readBatch returns the first request followed by the requests read from the channel, until the batch holds n
+// requests, the channel is closed or requestBatchInterval elapsed. It returns the channel left to read, which is
+// nil once closed.
+func readBatch(ctx context.Context, first SiteRequest, requests <-chan SiteRequest, n int) ([]SiteRequest, <-chan SiteRequest) {
+	batch := []SiteRequest{first}
+	timer := time.NewTimer(requestBatchInterval)
+	defer timer.Stop()
+
+	for len(batch) < n {
+		select {
+		case <-ctx.Done():
+			return batch, requests
+		case <-timer.C:
+			return batch, requests
+		case request, ok := <-requests:
+			if !ok {
+				return batch, nil
+			}
+			batch = append(batch, request)
+		}
+	}
+	return batch, requests
 }
 
 // Fetch downloads the sites, store their content in a file and save their related metadata.
-// The sites are downloaded in parallel.
-func (s *Service) Fetch(ctx context.Context, sites ...string) error {
-	errChan := s.fetchSitesInParallel(ctx, sites)
+// The sites are downloaded in parallel, it returns the FetchResult of every fetched site,
+// including the ones found when crawling, along with the errors of the failed fetches.
+func (s *Service) Fetch(ctx context.Context, sites ...string) ([]FetchResult, error) {
+	requests := make(chan SiteRequest, len(sites))
+	for _, site := range sites {
+		requests <- SiteRequest{Site: site}
+	}
+	close(requests)
 
-	var errs error
-	for err := range errChan {
-		s.logger.Error("Failed to fetch site.", "error", err)
-		errs = errors.Join(errs, err)
+	var (
+		results []FetchResult
+		errs    error
+	)
+	for result := range s.FetchStream(ctx, requests) {
+		errs = errors.Join(errs, result.Err)
+		results = append(results, result)
 	}
 
-	return errs
+	return results, errs
 }
@@ -5,8 +5,10 @@ import (
 	"context"
 	"errors"
 	"io"
+	"net/http"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/gsiffert/fetch/internal/domain"
@@ -20,6 +22,30 @@ type nopCloserWriter struct {
 
 func (nopCloserWriter) Close() error { return nil }
 
+func (nopCloserWriter) Snapshot() domain.SnapshotID { return testSnapshot }
+
+func (nopCloserWriter) Compression() domain.Compression { return domain.CompressionGzip }
+
+func (nopCloserWriter) Commit() error { return nil }
+
+func (nopCloserWriter) Discard() error { return nil }
+
+// failingReader returns the error once the content is read, as a dropped connection does.
+type failingReader struct {
+	content io.Reader
+	err     error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.content.Read(p)
+	if errors.Is(err, io.EOF) {
+		return n, r.err
+	}
+	return n, err
+}
+
+const testSnapshot = domain.SnapshotID("2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae")
+
 const htmlContent = `
 <!DOCTYPE html>
 <html>
@@ -37,6 +63,12 @@ const htmlContent = `
 </html>
 `
 
+var googlePage = domain.Page{
+	ID:           domain.PageID("https://www.google.com/"),
+	Site:         "www.google.com",
+	FileLocation: "www.google.com-d0e196a0c25d35dd",
+}
+
 func TestService_Fetch(t *testing.T) {
 	t.Parallel()
 
@@ -44,6 +76,8 @@ func TestService_Fetch(t *testing.T) {
 		name       string
 		sites      []string
 		setupMocks func(svcTest *serviceTest)
+		statuses   []FetchStatus
+		attempts   []int
 		assertErr  assert.ErrorAssertionFunc
 	}{
 		{
@@ -55,10 +89,15 @@ func TestService_Fetch(t *testing.T) {
 			name:  "fetcher failed",
 			sites: []string{"https://www.google.com"},
 			setupMocks: func(svcTest *serviceTest) {
+				svcTest.metaDataRepo.EXPECT().
+					ByIDs(gomock.Any(), gomock.Any()).
+					Return(nil, nil)
 				svcTest.fetcher.EXPECT().
 					Fetch(gomock.Any(), gomock.Any()).
-					Return(nil, errors.New("fetcher failed"))
+					Return(nil, &FetchError{Attempts: 3, Err: errors.New("fetcher failed")})
 			},
+			statuses:  []FetchStatus{FetchStatusFailed},
+			attempts:  []int{3},
 			assertErr: assert.Error,
 		},
 		{
@@ -66,16 +105,55 @@ func TestService_Fetch(t *testing.T) {
 			sites: []string{"https://www.google.com"},
 			setupMocks: func(svcTest *serviceTest) {
 				fetchedItem := &FetchedItem{
+					Page:    googlePage,
 					Content: io.NopCloser(strings.NewReader("")),
 				}
 
+				svcTest.metaDataRepo.EXPECT().
+					ByIDs(gomock.Any(), gomock.Any()).
+					Return(nil, nil)
 				svcTest.fetcher.EXPECT().
 					Fetch(gomock.Any(), gomock.Any()).
 					Return(fetchedItem, nil)
 				svcTest.disk.EXPECT().
-					NewPageWriter(gomock.Any(), gomock.Any()).
+					NewPageWriter(gomock.Any(), gomock.Any(), gomock.Any()).
 					Return(nil, errors.New("disk failed"))
 			},
+			statuses:  []FetchStatus{FetchStatusFailed},
+			assertErr: assert.Error,
+		},
+		{
+			name:  "connection dropped",
+			sites: []string{"https://www.google.com"},
+			setupMocks: func(svcTest *serviceTest) {
+				fetchedItem := &FetchedItem{
+					Page: googlePage,
+					Content: io.NopCloser(&failingReader{
+						content: strings.NewReader(htmlContent[:len(htmlContent)/2]),
+						err:     io.ErrUnexpectedEOF,
+					}),
+				}
+				writer := NewMockPageWriter(svcTest.ctrl)
+
+				svcTest.metaDataRepo.EXPECT().
+					ByIDs(gomock.Any(), gomock.Any()).
+					Return(nil, nil)
+				svcTest.fetcher.EXPECT().
+					Fetch(gomock.Any(), gomock.Any()).
+					Return(fetchedItem, nil)
+				svcTest.disk.EXPECT().
+					NewPageWriter(gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(writer, nil)
+				// The partial page is discarded, it is neither stored as a snapshot nor replaces the page.
+				writer.EXPECT().
+					Write(gomock.Any()).
+					DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).
+					AnyTimes()
+				writer.EXPECT().
+					Discard().
+					Return(nil)
+			},
+			statuses:  []FetchStatus{FetchStatusFailed},
 			assertErr: assert.Error,
 		},
 		{
@@ -83,44 +161,144 @@ func TestService_Fetch(t *testing.T) {
 			sites: []string{"https://www.google.com"},
 			setupMocks: func(svcTest *serviceTest) {
 				fetchedItem := &FetchedItem{
+					Page:    googlePage,
 					Content: io.NopCloser(strings.NewReader("")),
 				}
-				writer := nopCloserWriter{io.Discard}
+				writer := NewMockPageWriter(svcTest.ctrl)
 
+				svcTest.metaDataRepo.EXPECT().
+					ByIDs(gomock.Any(), gomock.Any()).
+					Return(nil, nil)
 				svcTest.fetcher.EXPECT().
 					Fetch(gomock.Any(), gomock.Any()).
 					Return(fetchedItem, nil)
 				svcTest.disk.EXPECT().
-					NewPageWriter(gomock.Any(), gomock.Any()).
+					NewPageWriter(gomock.Any(), gomock.Any(), gomock.Any()).
 					Return(writer, nil)
 				svcTest.metaDataRepo.EXPECT().
 					Save(gomock.Any(), gomock.Any()).
 					Return(errors.New("save metadata failed"))
+				// The snapshot is stored but the page is not replaced, as no metadata references it.
+				writer.EXPECT().
+					Close().
+					Return(nil)
+				writer.EXPECT().
+					Snapshot().
+					Return(testSnapshot)
+				writer.EXPECT().
+					Compression().
+					Return(domain.CompressionNone)
+				writer.EXPECT().
+					Discard().
+					Return(nil)
 			},
+			statuses:  []FetchStatus{FetchStatusFailed},
 			assertErr: assert.Error,
 		},
 		{
-			name:  "success",
+			name:  "not modified",
+			sites: []string{"https://www.google.com"},
+			setupMocks: func(svcTest *serviceTest) {
+				previous := domain.MetaData{
+					ID:           domain.PageID("https://www.google.com/"),
+					Site:         "www.google.com",
+					LastFetched:  time.Date(2024, 3, 17, 14, 43, 0, 0, time.UTC),
+					NumLinks:     4,
+					NumImages:    2,
+					Snapshot:     testSnapshot,
+					FileLocation: "www.google.com-d0e196a0c25d35dd.html",
+					ETag:         `"33a64df551425fcc55e4d42a148795d9f25f89d4"`,
+				}
+				fetchedItem := &FetchedItem{
+					Page:        googlePage,
+					Content:     http.NoBody,
+					NotModified: true,
+					Exchange:    Exchange{URL: "https://www.google.com/", StatusCode: http.StatusNotModified},
+				}
+
+				svcTest.metaDataRepo.EXPECT().
+					ByIDs(gomock.Any(), []domain.PageID{previous.ID}).
+					Return([]domain.MetaData{previous}, nil)
+				svcTest.disk.EXPECT().
+					HasPage(gomock.Any(), previous.FileLocation).
+					Return(true, nil)
+				svcTest.fetcher.EXPECT().
+					Fetch(gomock.Any(), FetchRequest{Site: "https://www.google.com", ETag: previous.ETag}).
+					Return(fetchedItem, nil)
+				svcTest.disk.EXPECT().
+					SaveNotModified(gomock.Any(), previous.FileLocation, fetchedItem.Exchange, previous.LastFetched).
+					Return(nil)
+				svcTest.metaDataRepo.EXPECT().
+					Save(gomock.Any(), gomock.Any()).
+					Do(func(_ context.Context, m domain.MetaData) error {
+						// The page is not written again, only the date of the fetch changes.
+						assert.True(t, m.LastFetched.After(previous.LastFetched))
+						m.LastFetched = previous.LastFetched
+						assert.Equal(t, previous, m)
+						return nil
+					})
+			},
+			statuses:  []FetchStatus{FetchStatusNotModified},
+			assertErr: assert.NoError,
+		},
+		{
+			name:  "previous page not held",
 			sites: []string{"https://www.google.com"},
 			setupMocks: func(svcTest *serviceTest) {
+				previous := domain.MetaData{
+					ID:           domain.PageID("https://www.google.com/"),
+					Site:         "www.google.com",
+					FileLocation: "www.google.com-d0e196a0c25d35dd.html",
+					ETag:         `"33a64df551425fcc55e4d42a148795d9f25f89d4"`,
+				}
 				fetchedItem := &FetchedItem{
-					Page: domain.Page{
-						ID:           domain.PageID("https://www.google.com"),
-						Site:         "www.google.com",
-						FileLocation: "www.google.com",
-					},
+					Page:    googlePage,
 					Content: io.NopCloser(strings.NewReader(htmlContent)),
 				}
+
+				// The storage lost the page, such as a new archive, so its content is requested again.
+				svcTest.metaDataRepo.EXPECT().
+					ByIDs(gomock.Any(), []domain.PageID{previous.ID}).
+					Return([]domain.MetaData{previous}, nil)
+				svcTest.disk.EXPECT().
+					HasPage(gomock.Any(), previous.FileLocation).
+					Return(false, nil)
+				svcTest.fetcher.EXPECT().
+					Fetch(gomock.Any(), FetchRequest{Site: "https://www.google.com"}).
+					Return(fetchedItem, nil)
+				svcTest.disk.EXPECT().
+					NewPageWriter(gomock.Any(), previous.FileLocation, gomock.Any()).
+					Return(nopCloserWriter{io.Discard}, nil)
+				svcTest.metaDataRepo.EXPECT().
+					Save(gomock.Any(), gomock.Any()).
+					Return(nil)
+			},
+			statuses:  []FetchStatus{FetchStatusFetched},
+			assertErr: assert.NoError,
+		},
+		{
+			name:  "success",
+			sites: []string{"https://www.google.com"},
+			setupMocks: func(svcTest *serviceTest) {
+				fetchedItem := &FetchedItem{
+					Page:     googlePage,
+					Content:  io.NopCloser(strings.NewReader(htmlContent)),
+					ETag:     `"33a64df551425fcc55e4d42a148795d9f25f89d4"`,
+					Attempts: 2,
+				}
 				writer := &bytes.Buffer{}
 				writerCloser := nopCloserWriter{writer}
 
 				before := time.Now().UTC()
 
+				svcTest.metaDataRepo.EXPECT().
+					ByIDs(gomock.Any(), gomock.Any()).
+					Return(nil, nil)
 				svcTest.fetcher.EXPECT().
-					Fetch(gomock.Any(), string(fetchedItem.Page.ID)).
+					Fetch(gomock.Any(), FetchRequest{Site: "https://www.google.com"}).
 					Return(fetchedItem, nil)
 				svcTest.disk.EXPECT().
-					NewPageWriter(gomock.Any(), fetchedItem.Page.FileLocation).
+					NewPageWriter(gomock.Any(), fetchedItem.Page.FileLocation+".html", gomock.Any()).
 					Return(writerCloser, nil)
 
 				svcTest.metaDataRepo.EXPECT().
@@ -132,12 +310,18 @@ func TestService_Fetch(t *testing.T) {
 						assert.GreaterOrEqual(t, m.LastFetched, before)
 						assert.Equal(t, fetchedItem.Page.Site, m.Site)
 						assert.Equal(t, fetchedItem.Page.ID, m.ID)
+						assert.Equal(t, testSnapshot, m.Snapshot)
+						assert.Equal(t, domain.CompressionGzip, m.Compression)
+						assert.Equal(t, fetchedItem.ETag, m.ETag)
+						assert.Equal(t, "Google", m.Title)
 
 						// We also verify that the writer received the content of the page.
 						assert.Equal(t, htmlContent, writer.String())
 						return nil
 					})
 			},
+			statuses:  []FetchStatus{FetchStatusFetched},
+			attempts:  []int{2},
 			assertErr: assert.NoError,
 		},
 	}
@@ -154,8 +338,228 @@ func TestService_Fetch(t *testing.T) {
 				test.setupMocks(svcTest)
 			}
 
-			err := svcTest.svc.Fetch(ctx, test.sites...)
+			results, err := svcTest.svc.Fetch(ctx, test.sites...)
 			test.assertErr(t, err)
+
+			var (
+				statuses []FetchStatus
+				attempts []int
+			)
+			for _, result := range results {
+				statuses = append(statuses, result.Status)
+				attempts = append(attempts, result.Attempts)
+				assert.Equal(t, googlePage.FileLocation+".html", result.Location)
+			}
+			assert.Equal(t, test.statuses, statuses)
+			if test.attempts != nil {
+				assert.Equal(t, test.attempts, attempts)
+			}
 		})
 	}
 }
+
+func TestService_FetchStream(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svcTest := newTestService(t)
+	defer svcTest.Close()
+
+	previous := domain.MetaData{
+		ID:   googlePage.ID,
+		Site: googlePage.Site,
+		ETag: `"33a64df551425fcc55e4d42a148795d9f25f89d4"`,
+	}
+	request := SiteRequest{
+		Site:   string(googlePage.ID),
+		Method: http.MethodPost,
+		Header: http.Header{"X-Api-Key": []string{"secret"}},
+		Name:   "google/search",
+	}
+
+	svcTest.metaDataRepo.EXPECT().
+		ByIDs(gomock.Any(), []domain.PageID{googlePage.ID}).
+		Return([]domain.MetaData{previous}, nil)
+	// A POST request is never conditional, the validators of the previous fetch are not sent.
+	svcTest.fetcher.EXPECT().
+		Fetch(gomock.Any(), FetchRequest{Site: request.Site, Method: request.Method, Header: request.Header}).
+		Return(&FetchedItem{
+			Page:    googlePage,
+			Content: io.NopCloser(strings.NewReader(htmlContent)),
+		}, nil)
+	svcTest.disk.EXPECT().
+		NewPageWriter(gomock.Any(), request.Name+".html", gomock.Any()).
+		Return(nopCloserWriter{io.Discard}, nil)
+	svcTest.metaDataRepo.EXPECT().
+		Save(gomock.Any(), gomock.Any()).
+		Return(nil)
+
+	requests := make(chan SiteRequest)
+	results := svcTest.svc.FetchStream(ctx, requests)
+	requests <- request
+	close(requests)
+
+	var fetched []FetchResult
+	for result := range results {
+		fetched = append(fetched, result)
+	}
+	if assert.Len(t, fetched, 1) {
+		assert.NoError(t, fetched[0].Err)
+		assert.Equal(t, FetchStatusFetched, fetched[0].Status)
+		assert.Equal(t, "google/search.html", fetched[0].Location)
+	}
+}
+
+func TestService_Fetch_Redirect(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svcTest := newTestService(t)
+	defer svcTest.Close()
+
+	// The site redirects to the page of www.google.com.
+	site := "HTTP://Google.com"
+	svcTest.metaDataRepo.EXPECT().
+		ByIDs(gomock.Any(), []domain.PageID{"http://google.com/"}).
+		Return(nil, nil)
+	svcTest.fetcher.EXPECT().
+		Fetch(gomock.Any(), FetchRequest{Site: site}).
+		Return(&FetchedItem{
+			Page:    googlePage,
+			Content: io.NopCloser(strings.NewReader(htmlContent)),
+		}, nil)
+	svcTest.disk.EXPECT().
+		NewPageWriter(gomock.Any(), googlePage.FileLocation+".html", gomock.Any()).
+		Return(nopCloserWriter{io.Discard}, nil)
+	svcTest.metaDataRepo.EXPECT().
+		Save(gomock.Any(), gomock.Any()).
+		Return(nil)
+
+	results, err := svcTest.svc.Fetch(ctx, site)
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, googlePage.ID, results[0].MetaData.ID)
+	}
+
+	// The site now resolves to the page it redirected to.
+	ids, err := svcTest.svc.ResolveSites(ctx, "http://google.com:80/#about")
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.PageID{googlePage.ID}, ids)
+}
+
+func TestService_Fetch_ContentType(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	// The documents are not mirrored, only the HTML pages reference assets.
+	svcTest := newTestService(t, WithMirror())
+	defer svcTest.Close()
+
+	const content = "%PDF-1.7\n"
+	writer := &bytes.Buffer{}
+	svcTest.metaDataRepo.EXPECT().
+		ByIDs(gomock.Any(), []domain.PageID{googlePage.ID}).
+		Return(nil, nil)
+	svcTest.fetcher.EXPECT().
+		Fetch(gomock.Any(), FetchRequest{Site: string(googlePage.ID)}).
+		Return(&FetchedItem{
+			Page:        googlePage,
+			Content:     io.NopCloser(strings.NewReader(content)),
+			ContentType: domain.MediaTypePDF,
+		}, nil)
+	svcTest.disk.EXPECT().
+		NewPageWriter(gomock.Any(), googlePage.FileLocation+".pdf", gomock.Any()).
+		Return(nopCloserWriter{writer}, nil)
+	svcTest.metaDataRepo.EXPECT().
+		Save(gomock.Any(), gomock.Any()).
+		Do(func(_ context.Context, m domain.MetaData) error {
+			assert.Equal(t, domain.MediaTypePDF, m.ContentType)
+			assert.Equal(t, googlePage.FileLocation+".pdf", m.FileLocation)
+			assert.Equal(t, int64(len(content)), m.ByteSize)
+			return nil
+		})
+
+	results, err := svcTest.svc.Fetch(ctx, string(googlePage.ID))
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.Equal(t, googlePage.FileLocation+".pdf", results[0].Location)
+	}
+	assert.Equal(t, content, writer.String())
+}
+
+func TestService_Fetch_Charset(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svcTest := newTestService(t, WithMirror(), WithUTF8Copy())
+	defer svcTest.Close()
+
+	// The page is encoded in windows-1252, as declared by its meta tag.
+	const content = "<html><head><meta charset=\"windows-1252\"><title>Caf\xe9 \x80</title></head><body></body></html>"
+	writer := &bytes.Buffer{}
+	utf8Copy := &bytes.Buffer{}
+	svcTest.metaDataRepo.EXPECT().
+		ByIDs(gomock.Any(), []domain.PageID{googlePage.ID}).
+		Return(nil, nil)
+	svcTest.fetcher.EXPECT().
+		Fetch(gomock.Any(), FetchRequest{Site: string(googlePage.ID)}).
+		Return(&FetchedItem{
+			Page:        googlePage,
+			Content:     io.NopCloser(strings.NewReader(content)),
+			ContentType: domain.MediaTypeHTML,
+		}, nil)
+	svcTest.disk.EXPECT().
+		NewPageWriter(gomock.Any(), googlePage.FileLocation+".html", gomock.Any()).
+		Return(nopCloserWriter{writer}, nil)
+	svcTest.disk.EXPECT().
+		NewAssetWriter(gomock.Any(), googlePage.FileLocation+".utf-8.html").
+		Return(nopCloserWriter{utf8Copy}, nil)
+	svcTest.metaDataRepo.EXPECT().
+		Save(gomock.Any(), gomock.Any()).
+		Do(func(_ context.Context, m domain.MetaData) error {
+			assert.Equal(t, "Café €", m.Title)
+			assert.Equal(t, "windows-1252", m.Charset)
+			assert.Equal(t, int64(len(content)), m.ByteSize)
+			return nil
+		})
+
+	_, err := svcTest.svc.Fetch(ctx, string(googlePage.ID))
+	assert.NoError(t, err)
+	// The page is stored in its own charset, its copy in UTF-8.
+	assert.Equal(t, content, writer.String())
+	assert.Equal(t, "\xef\xbb\xbf<html><head><meta charset=\"windows-1252\"><title>Café €</title></head><body></body></html>", utf8Copy.String())
+}
+
+func TestService_Fetch_Charset_Failed(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svcTest := newTestService(t, WithUTF8Copy())
+	defer svcTest.Close()
+
+	// The connection is reset once the charset of the page was detected, while its UTF-8 copy is being written.
+	const head = "<html><head><meta charset=\"windows-1252\"><title>Caf\xe9</title></head><body>"
+	content := io.MultiReader(
+		strings.NewReader(head+strings.Repeat("a", 2*charsetSniffLength)),
+		iotest.ErrReader(errors.New("connection reset")),
+	)
+	svcTest.metaDataRepo.EXPECT().
+		ByIDs(gomock.Any(), []domain.PageID{googlePage.ID}).
+		Return(nil, nil)
+	svcTest.fetcher.EXPECT().
+		Fetch(gomock.Any(), FetchRequest{Site: string(googlePage.ID)}).
+		Return(&FetchedItem{Page: googlePage, Content: io.NopCloser(content), ContentType: domain.MediaTypeHTML}, nil)
+	svcTest.disk.EXPECT().
+		NewPageWriter(gomock.Any(), googlePage.FileLocation+".html", gomock.Any()).
+		Return(nopCloserWriter{io.Discard}, nil)
+	// The partial copy is discarded instead of being stored.
+	utf8Copy := NewMockAssetWriter(svcTest.ctrl)
+	utf8Copy.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+	utf8Copy.EXPECT().Discard().Return(nil)
+	svcTest.disk.EXPECT().
+		NewAssetWriter(gomock.Any(), googlePage.FileLocation+".utf-8.html").
+		Return(utf8Copy, nil)
+
+	_, err := svcTest.svc.Fetch(ctx, string(googlePage.ID))
+	assert.ErrorContains(t, err, "connection reset")
+}
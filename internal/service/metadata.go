@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"fmt"
+	"net/url"
 
 	"github.com/gsiffert/fetch/internal/domain"
 )
@@ -10,9 +11,9 @@ import (
 // GetMetaDataForSites retrieves a list of domain.MetaData from the given sites.
 // It returns an error if it fails to retrieve the data from the repository.
 func (s *Service) GetMetaDataForSites(ctx context.Context, sites ...string) ([]domain.MetaData, error) {
-	ids := make([]domain.PageID, len(sites))
-	for i, site := range sites {
-		ids[i] = domain.PageID(site)
+	ids, err := s.ResolveSites(ctx, sites...)
+	if err != nil {
+		return nil, err
 	}
 
 	metadataItems, err := s.metaDataRepo.ByIDs(ctx, ids)
@@ -23,3 +24,62 @@ func (s *Service) GetMetaDataForSites(ctx context.Context, sites ...string) ([]d
 
 	return metadataItems, nil
 }
+
+// GetHistoryForSites retrieves every domain.MetaData computed for the given sites, from the oldest fetch to the newest.
+// It returns an error if it fails to retrieve the data from the repository.
+func (s *Service) GetHistoryForSites(ctx context.Context, sites ...string) ([]domain.MetaData, error) {
+	ids, err := s.ResolveSites(ctx, sites...)
+	if err != nil {
+		return nil, err
+	}
+
+	metadataItems, err := s.metaDataRepo.HistoryByIDs(ctx, ids)
+	if err != nil {
+		s.logger.Error("Failed to get history.", "ids", ids, "error", err)
+		return nil, fmt.Errorf("get history: %w", err)
+	}
+
+	return metadataItems, nil
+}
+
+// ResolveSites returns the domain.PageID of each of the given sites, in the same order.
+// The sites are normalized and the aliases recorded when they redirected are followed,
+// so each site resolves to the page it was saved as.
+func (s *Service) ResolveSites(ctx context.Context, sites ...string) ([]domain.PageID, error) {
+	ids := make([]domain.PageID, len(sites))
+	for i, site := range sites {
+		id, err := domain.NewPageID(site)
+		if err != nil {
+			return nil, fmt.Errorf("invalid site %s: %w", site, err)
+		}
+		ids[i] = id
+	}
+	if len(ids) == 0 {
+		return ids, nil
+	}
+
+	resolved, err := s.metaDataRepo.ResolveAliases(ctx, ids)
+	if err != nil {
+		s.logger.Error("Failed to resolve aliases.", "ids", ids, "error", err)
+		return nil, fmt.Errorf("resolve aliases: %w", err)
+	}
+	return resolved, nil
+}
+
+// PageLocation returns where the page of the given id is stored. The location saved along with the metadata
+// of the page is used when the page was fetched, so the pages stored under another name are found as well.
+func (s *Service) PageLocation(ctx context.Context, id domain.PageID) (string, error) {
+	metadataItems, err := s.metaDataRepo.ByIDs(ctx, []domain.PageID{id})
+	if err != nil {
+		return "", fmt.Errorf("get metadata: %w", err)
+	}
+	if len(metadataItems) > 0 && metadataItems[0].FileLocation != "" {
+		return s.disk.PageLocation(metadataItems[0].FileLocation), nil
+	}
+
+	u, err := url.Parse(id.String())
+	if err != nil {
+		return "", fmt.Errorf("parse page id: %w", err)
+	}
+	return s.disk.PageLocation(s.fileLocation(domain.NewPage(u), "")), nil
+}
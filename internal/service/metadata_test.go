@@ -48,7 +48,7 @@ func TestService_GetMetaDataForSites(t *testing.T) {
 			setupMocks: func(svcTest *serviceTest) {
 				out := []domain.MetaData{
 					{
-						ID:          "https://www.google.com",
+						ID:          "https://www.google.com/",
 						Site:        "www.google.com",
 						LastFetched: time.Date(2024, 3, 17, 14, 43, 0, 0, time.UTC),
 						NumLinks:    12,
@@ -69,7 +69,7 @@ func TestService_GetMetaDataForSites(t *testing.T) {
 			},
 			expected: []domain.MetaData{
 				{
-					ID:          "https://www.google.com",
+					ID:          "https://www.google.com/",
 					Site:        "www.google.com",
 					LastFetched: time.Date(2024, 3, 17, 14, 43, 0, 0, time.UTC),
 					NumLinks:    12,
@@ -104,3 +104,98 @@ func TestService_GetMetaDataForSites(t *testing.T) {
 		})
 	}
 }
+
+func TestService_GetHistoryForSites(t *testing.T) {
+	t.Parallel()
+
+	history := []domain.MetaData{
+		{
+			ID:          "https://www.google.com/",
+			Site:        "www.google.com",
+			LastFetched: time.Date(2024, 3, 17, 14, 43, 0, 0, time.UTC),
+			NumLinks:    12,
+			NumImages:   2,
+		},
+		{
+			ID:          "https://www.google.com/",
+			Site:        "www.google.com",
+			LastFetched: time.Date(2024, 3, 18, 14, 43, 0, 0, time.UTC),
+			NumLinks:    14,
+			NumImages:   3,
+		},
+	}
+
+	tests := []struct {
+		name       string
+		sites      []string
+		setupMocks func(svcTest *serviceTest)
+		assertErr  assert.ErrorAssertionFunc
+		expected   []domain.MetaData
+	}{
+		{
+			name:      "HistoryByIDs failed",
+			sites:     []string{"https://www.google.com"},
+			assertErr: assert.Error,
+			setupMocks: func(svcTest *serviceTest) {
+				svcTest.metaDataRepo.EXPECT().
+					HistoryByIDs(gomock.Any(), gomock.Any()).
+					Return(nil, errors.New("HistoryByIDs failed"))
+			},
+		},
+		{
+			name:      "success",
+			sites:     []string{"https://www.google.com"},
+			assertErr: assert.NoError,
+			setupMocks: func(svcTest *serviceTest) {
+				svcTest.metaDataRepo.EXPECT().
+					HistoryByIDs(gomock.Any(), []domain.PageID{"https://www.google.com/"}).
+					Return(history, nil)
+			},
+			expected: history,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			svcTest := newTestService(t)
+			defer svcTest.Close()
+
+			if test.setupMocks != nil {
+				test.setupMocks(svcTest)
+			}
+
+			metadataItems, err := svcTest.svc.GetHistoryForSites(ctx, test.sites...)
+			test.assertErr(t, err)
+			assert.Equal(t, test.expected, metadataItems)
+		})
+	}
+}
+
+func TestService_PageLocation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svcTest := newTestService(t, WithFileNaming(domain.NamingHierarchy))
+	defer svcTest.Close()
+
+	fetched := domain.MetaData{ID: "https://www.google.com/", FileLocation: "google.html"}
+	svcTest.metaDataRepo.EXPECT().
+		ByIDs(gomock.Any(), []domain.PageID{fetched.ID}).
+		Return([]domain.MetaData{fetched}, nil)
+	svcTest.metaDataRepo.EXPECT().
+		ByIDs(gomock.Any(), []domain.PageID{"https://www.google.com/about"}).
+		Return(nil, nil)
+
+	// The location of a fetched page is saved with its metadata.
+	location, err := svcTest.svc.PageLocation(ctx, fetched.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "google.html", location)
+
+	// The location of a page never fetched is named by the FileNaming of the service.
+	location, err = svcTest.svc.PageLocation(ctx, "https://www.google.com/about")
+	assert.NoError(t, err)
+	assert.Equal(t, "www.google.com/about-d2bfc30fb9386b2a.html", location)
+}
@@ -0,0 +1,262 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"golang.org/x/net/html"
+)
+
+// assetAttributes maps the tags referencing an asset needed to render a page to the attribute holding its URL.
+var assetAttributes = map[string]string{
+	"img":    "src",
+	"script": "src",
+	"link":   "href",
+	"source": "src",
+}
+
+// srcsetTags are the tags whose srcset attribute lists the candidates of an image, the browsers load them
+// rather than the src attribute.
+var srcsetTags = map[string]bool{
+	"img":    true,
+	"source": true,
+}
+
+// cssReference matches the url() references and the @import rules of a stylesheet, the URL is either
+// quoted or not.
+var cssReference = regexp.MustCompile(`(?i)(url\(\s*)(?:"([^"]*)"|'([^']*)'|([^'"()\s]*))(\s*\))|(@import\s+)(?:"([^"]*)"|'([^']*)')`)
+
+// pageMirror copies a page to a writer while rewriting the references to its assets, so the copy points
+// to the local version of the assets instead of the remote ones.
+type pageMirror struct {
+	page   domain.Page
+	base   *url.URL
+	writer io.Writer
+
+	// assets maps the URL of each asset referenced by the page to the location of its local copy.
+	assets map[string]string
+	// stylesheets holds the URL of the assets which are stylesheets, their references are rewritten as well.
+	stylesheets map[string]bool
+}
+
+func newPageMirror(page domain.Page, writer io.Writer) (*pageMirror, error) {
+	base, err := url.Parse(page.ID.String())
+	if err != nil {
+		return nil, fmt.Errorf("parse page url: %w", err)
+	}
+
+	return &pageMirror{
+		page:        page,
+		base:        base,
+		writer:      writer,
+		assets:      make(map[string]string),
+		stylesheets: make(map[string]bool),
+	}, nil
+}
+
+// write copies the raw content of a token to the writer.
+// When the token is a tag referencing an asset, the tag is rewritten to reference the local copy instead.
+func (m *pageMirror) write(raw []byte, tag *html.Token) error {
+	if tag != nil && m.rewrite(tag) {
+		raw = []byte(tag.String())
+	}
+
+	if _, err := m.writer.Write(raw); err != nil {
+		return fmt.Errorf("write page: %w", err)
+	}
+	return nil
+}
+
+// writeStyle copies the text of a style tag to the writer, with its references rewritten to the local copies.
+func (m *pageMirror) writeStyle(raw []byte) error {
+	style := m.rewriteCSS(string(raw), m.base, m.pageReference)
+	if _, err := io.WriteString(m.writer, style); err != nil {
+		return fmt.Errorf("write page: %w", err)
+	}
+	return nil
+}
+
+// rewrite updates the tag to reference the local copy of its assets and reports whether the tag changed.
+func (m *pageMirror) rewrite(tag *html.Token) bool {
+	// The base tag changes how the relative URLs of the page are resolved. The local copies are relative to
+	// the page itself, so we resolve the assets against the base and drop it from the copy.
+	if tag.Data == "base" {
+		for i, attr := range tag.Attr {
+			if attr.Key != "href" {
+				continue
+			}
+			if base, err := m.base.Parse(strings.TrimSpace(attr.Val)); err == nil {
+				m.base = base
+			}
+			tag.Attr = append(tag.Attr[:i], tag.Attr[i+1:]...)
+			return true
+		}
+		return false
+	}
+
+	changed := false
+	for i, attr := range tag.Attr {
+		if attr.Namespace != "" {
+			continue
+		}
+
+		value := attr.Val
+		switch {
+		case attr.Key == assetAttributes[tag.Data] && (tag.Data != "link" || isAssetLink(tag)):
+			asset, ok := m.add(m.base, attr.Val, tag.Data == "link" && hasRel(tag, "stylesheet"))
+			if !ok {
+				continue
+			}
+			value = m.pageReference(asset)
+		case attr.Key == "srcset" && srcsetTags[tag.Data]:
+			value = m.rewriteSrcset(attr.Val)
+		case attr.Key == "style":
+			value = m.rewriteCSS(attr.Val, m.base, m.pageReference)
+		}
+		if value != attr.Val {
+			tag.Attr[i].Val = value
+			changed = true
+		}
+	}
+	return changed
+}
+
+// add records the asset referenced from the given base URL, it reports false when the reference is not an
+// asset fetched over HTTP, such as a data URL.
+func (m *pageMirror) add(base *url.URL, reference string, stylesheet bool) (*url.URL, bool) {
+	asset, err := base.Parse(strings.TrimSpace(reference))
+	if err != nil || (asset.Scheme != "http" && asset.Scheme != "https") {
+		return nil, false
+	}
+	asset.Fragment = ""
+
+	m.assets[asset.String()] = m.page.AssetLocation(asset)
+	if stylesheet {
+		m.stylesheets[asset.String()] = true
+	}
+	return asset, true
+}
+
+// pageReference returns the reference to the local copy of the asset from the page. The directory of the
+// assets sits next to the page, the reference is relative to the directory of the page.
+func (m *pageMirror) pageReference(asset *url.URL) string {
+	return url.PathEscape(path.Base(m.page.AssetDirectory())) + "/" + path.Base(m.assets[asset.String()])
+}
+
+// assetReference returns the reference to the local copy of the asset from another asset, such as a
+// stylesheet, both sit in the directory of the assets.
+func (m *pageMirror) assetReference(asset *url.URL) string {
+	return path.Base(m.assets[asset.String()])
+}
+
+// rewriteSrcset rewrites the candidates of a srcset attribute, a comma separated list of URLs each followed
+// by an optional descriptor such as 2x or 480w.
+func (m *pageMirror) rewriteSrcset(srcset string) string {
+	candidates := strings.Split(srcset, ",")
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		asset, ok := m.add(m.base, fields[0], false)
+		if !ok {
+			continue
+		}
+		fields[0] = m.pageReference(asset)
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// rewriteCSS rewrites the url() references and the @import rules of a stylesheet resolved against the base,
+// the imported stylesheets are recorded as stylesheets so their own references are rewritten once downloaded.
+func (m *pageMirror) rewriteCSS(css string, base *url.URL, reference func(*url.URL) string) string {
+	return cssReference.ReplaceAllStringFunc(css, func(match string) string {
+		groups := cssReference.FindStringSubmatch(match)
+		if groups[6] != "" {
+			asset, ok := m.add(base, groups[7]+groups[8], true)
+			if !ok {
+				return match
+			}
+			return groups[6] + `"` + reference(asset) + `"`
+		}
+
+		asset, ok := m.add(base, groups[2]+groups[3]+groups[4], false)
+		if !ok {
+			return match
+		}
+		return groups[1] + `"` + reference(asset) + `"` + groups[5]
+	})
+}
+
+// isAssetLink reports whether a link tag references a resource needed to render the page,
+// as opposed to a link to another document.
+func isAssetLink(tag *html.Token) bool {
+	return hasRel(tag, "stylesheet") || hasRel(tag, "icon")
+}
+
+// downloadAssets fetches the assets collected by the mirror and saves them next to the page. The stylesheets
+// are rewritten to reference the local copies of their own assets, which are downloaded in turn.
+// A missing asset does not fail the fetch of the page, it is only logged.
+func (s *Service) downloadAssets(ctx context.Context, site string, mirror *pageMirror) {
+	downloaded := make(map[string]bool, len(mirror.assets))
+	for len(downloaded) < len(mirror.assets) {
+		for asset, location := range mirror.assets {
+			if downloaded[asset] {
+				continue
+			}
+			downloaded[asset] = true
+			if err := s.downloadAsset(ctx, site, asset, location, mirror); err != nil {
+				s.logger.Warn("Failed to download asset.", "site", site, "asset", asset, "error", err)
+			}
+		}
+	}
+}
+
+func (s *Service) downloadAsset(ctx context.Context, site string, asset string, location string, mirror *pageMirror) error {
+	content, err := s.fetcher.FetchAsset(ctx, site, asset)
+	if err != nil {
+		return fmt.Errorf("query asset: %w", err)
+	}
+	defer func() {
+		if err := content.Close(); err != nil {
+			s.logger.Warn("Failed to close asset.", "asset", asset, "error", err)
+		}
+	}()
+
+	var reader io.Reader = content
+	if mirror.stylesheets[asset] {
+		// The references of a stylesheet are relative to the stylesheet itself.
+		base, err := url.Parse(asset)
+		if err != nil {
+			return fmt.Errorf("parse stylesheet url: %w", err)
+		}
+		css, err := io.ReadAll(content)
+		if err != nil {
+			return fmt.Errorf("read stylesheet: %w", err)
+		}
+		reader = bytes.NewReader([]byte(mirror.rewriteCSS(string(css), base, mirror.assetReference)))
+	}
+
+	writer, err := s.disk.NewAssetWriter(ctx, location)
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+
+	if _, err := io.Copy(writer, reader); err != nil {
+		_ = writer.Discard()
+		return fmt.Errorf("copy asset: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("close file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+const mirroredHTMLContent = `
+<!DOCTYPE html>
+<html>
+	<head>
+		<title>Google</title>
+		<link rel="stylesheet" href="/style.css">
+		<link rel="canonical" href="https://www.google.com">
+		<script src="https://cdn.google.com/app.js"></script>
+	</head>
+	<body>
+		<a href="https://www.google.com/about">About</a>
+		<img src="logo.png" alt="Google" />
+		<img src="data:image/png;base64,AAAA" alt="Inline" />
+	</body>
+</html>
+`
+
+const expectedMirroredHTMLContent = `
+<!DOCTYPE html>
+<html>
+	<head>
+		<title>Google</title>
+		<link rel="stylesheet" href="www.google.com-d0e196a0c25d35dd_files/d9713d767702af79.css">
+		<link rel="canonical" href="https://www.google.com">
+		<script src="www.google.com-d0e196a0c25d35dd_files/b989f3ae55a129d4.js"></script>
+	</head>
+	<body>
+		<a href="https://www.google.com/about">About</a>
+		<img src="www.google.com-d0e196a0c25d35dd_files/bc3c9344ab4c0e69.png" alt="Google"/>
+		<img src="data:image/png;base64,AAAA" alt="Inline" />
+	</body>
+</html>
+`
+
+func TestService_Fetch_Mirror(t *testing.T) {
+	t.Parallel()
+
+	page := domain.Page{
+		ID:           domain.PageID("https://www.google.com/"),
+		Site:         "www.google.com",
+		FileLocation: "www.google.com-d0e196a0c25d35dd",
+	}
+	assets := map[string]string{
+		"https://www.google.com/style.css": "www.google.com-d0e196a0c25d35dd_files/d9713d767702af79.css",
+		"https://cdn.google.com/app.js":    "www.google.com-d0e196a0c25d35dd_files/b989f3ae55a129d4.js",
+		"https://www.google.com/logo.png":  "www.google.com-d0e196a0c25d35dd_files/bc3c9344ab4c0e69.png",
+	}
+
+	ctx := context.Background()
+	svcTest := newTestService(t, WithMirror())
+	defer svcTest.Close()
+
+	fetchedItem := &FetchedItem{
+		Page:    page,
+		Content: io.NopCloser(strings.NewReader(mirroredHTMLContent)),
+	}
+	pageWriter := &bytes.Buffer{}
+
+	svcTest.metaDataRepo.EXPECT().
+		ByIDs(gomock.Any(), []domain.PageID{page.ID}).
+		Return(nil, nil)
+	svcTest.fetcher.EXPECT().
+		Fetch(gomock.Any(), FetchRequest{Site: string(page.ID)}).
+		Return(fetchedItem, nil)
+	svcTest.disk.EXPECT().
+		NewPageWriter(gomock.Any(), page.FileLocation+".html", gomock.Any()).
+		Return(nopCloserWriter{pageWriter}, nil)
+
+	assetWriters := make(map[string]*bytes.Buffer)
+	for asset, location := range assets {
+		if strings.HasSuffix(asset, ".js") {
+			// A missing asset should not fail the fetch of the page.
+			svcTest.fetcher.EXPECT().
+				FetchAsset(gomock.Any(), gomock.Any(), asset).
+				Return(nil, errors.New("not found"))
+			continue
+		}
+
+		assetWriters[location] = &bytes.Buffer{}
+		svcTest.fetcher.EXPECT().
+			FetchAsset(gomock.Any(), gomock.Any(), asset).
+			Return(io.NopCloser(strings.NewReader(asset)), nil)
+		svcTest.disk.EXPECT().
+			NewAssetWriter(gomock.Any(), location).
+			Return(nopCloserWriter{assetWriters[location]}, nil)
+	}
+
+	svcTest.metaDataRepo.EXPECT().
+		Save(gomock.Any(), gomock.Any()).
+		Do(func(_ context.Context, m domain.MetaData) error {
+			assert.Equal(t, 1, m.NumLinks)
+			assert.Equal(t, 2, m.NumImages)
+			return nil
+		})
+
+	_, err := svcTest.svc.Fetch(ctx, string(page.ID))
+	assert.NoError(t, err)
+	assert.Equal(t, expectedMirroredHTMLContent, pageWriter.String())
+	for asset, location := range assets {
+		if writer, ok := assetWriters[location]; ok {
+			assert.Equal(t, asset, writer.String())
+		}
+	}
+}
+
+func TestService_Fetch_Mirror_Hierarchy(t *testing.T) {
+	t.Parallel()
+
+	page := domain.Page{
+		ID:   domain.PageID("https://www.google.com/docs/intro"),
+		Site: "www.google.com/docs/intro",
+	}
+	u, err := url.Parse(page.ID.String())
+	require.NoError(t, err)
+	pageLocation := domain.NamingHierarchy.FileLocation(u) + ".html"
+	require.Equal(t, "www.google.com/docs", path.Dir(pageLocation))
+
+	ctx := context.Background()
+	svcTest := newTestService(t, WithMirror(), WithFileNaming(domain.NamingHierarchy))
+	defer svcTest.Close()
+
+	pageWriter := &bytes.Buffer{}
+	svcTest.metaDataRepo.EXPECT().ByIDs(gomock.Any(), []domain.PageID{page.ID}).Return(nil, nil)
+	svcTest.fetcher.EXPECT().
+		Fetch(gomock.Any(), FetchRequest{Site: string(page.ID)}).
+		Return(&FetchedItem{Page: page, Content: io.NopCloser(strings.NewReader(`<img src="logo.png">`))}, nil)
+	svcTest.disk.EXPECT().
+		NewPageWriter(gomock.Any(), pageLocation, gomock.Any()).
+		Return(nopCloserWriter{pageWriter}, nil)
+
+	var assetLocation string
+	svcTest.fetcher.EXPECT().
+		FetchAsset(gomock.Any(), gomock.Any(), "https://www.google.com/docs/logo.png").
+		Return(io.NopCloser(strings.NewReader("png")), nil)
+	svcTest.disk.EXPECT().
+		NewAssetWriter(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, location string) (AssetWriter, error) {
+			assetLocation = location
+			return nopCloserWriter{io.Discard}, nil
+		})
+	svcTest.metaDataRepo.EXPECT().Save(gomock.Any(), gomock.Any()).Return(nil)
+
+	_, err = svcTest.svc.Fetch(ctx, string(page.ID))
+	require.NoError(t, err)
+
+	// The asset is referenced relative to the directory of the page, where the browser resolves it from.
+	matches := regexp.MustCompile(`src="([^"]+)"`).FindStringSubmatch(pageWriter.String())
+	require.Len(t, matches, 2, pageWriter.String())
+	href, err := url.PathUnescape(matches[1])
+	require.NoError(t, err)
+	assert.NotContains(t, matches[1], "%2F")
+	assert.Equal(t, assetLocation, path.Join(path.Dir(pageLocation), href))
+}
+
+func TestService_Fetch_Mirror_CSS(t *testing.T) {
+	t.Parallel()
+
+	page := domain.Page{
+		ID:           domain.PageID("https://www.google.com/"),
+		Site:         "www.google.com",
+		FileLocation: "www.google.com-d0e196a0c25d35dd",
+	}
+	const content = `<html><head>` +
+		`<link rel="stylesheet" href="/css/style.css">` +
+		`<style>@import "print.css"; body { background: url(body.png) }</style>` +
+		`</head><body>` +
+		`<img src="small.png" srcset="small.png 1x, /large.png 2x">` +
+		`<picture><source srcset="photo.webp"></picture>` +
+		`<div style="background: url('banner.png')"></div>` +
+		`</body></html>`
+	// The references of a stylesheet are relative to the stylesheet.
+	remote := map[string]string{
+		"https://www.google.com/css/style.css": `@font-face { src: url("../fonts/sans.woff2") } a { background: url(data:image/png;base64,AA) }`,
+		"https://www.google.com/print.css":     `@import url(extra.css);`,
+		"https://www.google.com/extra.css":     `p { color: red }`,
+	}
+
+	ctx := context.Background()
+	svcTest := newTestService(t, WithMirror())
+	defer svcTest.Close()
+
+	pageWriter := &bytes.Buffer{}
+	svcTest.metaDataRepo.EXPECT().ByIDs(gomock.Any(), []domain.PageID{page.ID}).Return(nil, nil)
+	svcTest.fetcher.EXPECT().
+		Fetch(gomock.Any(), FetchRequest{Site: string(page.ID)}).
+		Return(&FetchedItem{Page: page, Content: io.NopCloser(strings.NewReader(content))}, nil)
+	svcTest.disk.EXPECT().
+		NewPageWriter(gomock.Any(), page.FileLocation+".html", gomock.Any()).
+		Return(nopCloserWriter{pageWriter}, nil)
+
+	var fetched []string
+	svcTest.fetcher.EXPECT().
+		FetchAsset(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ string, asset string) (io.ReadCloser, error) {
+			fetched = append(fetched, asset)
+			return io.NopCloser(strings.NewReader(remote[asset])), nil
+		}).
+		AnyTimes()
+	stored := make(map[string]*bytes.Buffer)
+	svcTest.disk.EXPECT().
+		NewAssetWriter(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, location string) (AssetWriter, error) {
+			stored[location] = &bytes.Buffer{}
+			return nopCloserWriter{stored[location]}, nil
+		}).
+		AnyTimes()
+	svcTest.metaDataRepo.EXPECT().Save(gomock.Any(), gomock.Any()).Return(nil)
+
+	_, err := svcTest.svc.Fetch(ctx, string(page.ID))
+	require.NoError(t, err)
+
+	location := func(asset string) string {
+		u, err := url.Parse(asset)
+		require.NoError(t, err)
+		return page.AssetLocation(u)
+	}
+	// The local copies are referenced from the page relative to its directory, and from the stylesheets
+	// relative to the directory of the assets.
+	fromPage := location
+	fromAsset := func(asset string) string {
+		return path.Base(location(asset))
+	}
+
+	assert.ElementsMatch(t, []string{
+		"https://www.google.com/css/style.css",
+		"https://www.google.com/print.css",
+		"https://www.google.com/extra.css",
+		"https://www.google.com/body.png",
+		"https://www.google.com/small.png",
+		"https://www.google.com/large.png",
+		"https://www.google.com/photo.webp",
+		"https://www.google.com/banner.png",
+		"https://www.google.com/fonts/sans.woff2",
+	}, fetched)
+
+	expected := `<html><head>` +
+		`<link rel="stylesheet" href="` + fromPage("https://www.google.com/css/style.css") + `">` +
+		`<style>@import "` + fromPage("https://www.google.com/print.css") + `"; ` +
+		`body { background: url("` + fromPage("https://www.google.com/body.png") + `") }</style>` +
+		`</head><body>` +
+		`<img src="` + fromPage("https://www.google.com/small.png") + `" srcset="` +
+		fromPage("https://www.google.com/small.png") + ` 1x, ` + fromPage("https://www.google.com/large.png") + ` 2x">` +
+		`<picture><source srcset="` + fromPage("https://www.google.com/photo.webp") + `"></picture>` +
+		`<div style="background: url(&#34;` + fromPage("https://www.google.com/banner.png") + `&#34;)"></div>` +
+		`</body></html>`
+	assert.Equal(t, expected, pageWriter.String())
+
+	assert.Equal(t,
+		`@font-face { src: url("`+fromAsset("https://www.google.com/fonts/sans.woff2")+`") } `+
+			`a { background: url(data:image/png;base64,AA) }`,
+		stored[location("https://www.google.com/css/style.css")].String(),
+	)
+	assert.Equal(t,
+		`@import url("`+fromAsset("https://www.google.com/extra.css")+`");`,
+		stored[location("https://www.google.com/print.css")].String(),
+	)
+}
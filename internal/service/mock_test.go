@@ -13,231 +13,1445 @@ import (
 	context "context"
 	io "io"
 	reflect "reflect"
+	time "time"
 
 	domain "github.com/gsiffert/fetch/internal/domain"
 	gomock "go.uber.org/mock/gomock"
 )
 
+// MockPageWriter is a mock of PageWriter interface.
+type MockPageWriter struct {
+	ctrl     *gomock.Controller
+	recorder *MockPageWriterMockRecorder
+}
+
+// MockPageWriterMockRecorder is the mock recorder for MockPageWriter.
+type MockPageWriterMockRecorder struct {
+	mock *MockPageWriter
+}
+
+// NewMockPageWriter creates a new mock instance.
+func NewMockPageWriter(ctrl *gomock.Controller) *MockPageWriter {
+	mock := &MockPageWriter{ctrl: ctrl}
+	mock.recorder = &MockPageWriterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPageWriter) EXPECT() *MockPageWriterMockRecorder {
+	return m.recorder
+}
+
+// Close mocks base method.
+func (m *MockPageWriter) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockPageWriterMockRecorder) Close() *MockPageWriterCloseCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockPageWriter)(nil).Close))
+	return &MockPageWriterCloseCall{Call: call}
+}
+
+// MockPageWriterCloseCall wrap *gomock.Call
+type MockPageWriterCloseCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockPageWriterCloseCall) Return(arg0 error) *MockPageWriterCloseCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockPageWriterCloseCall) Do(f func() error) *MockPageWriterCloseCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockPageWriterCloseCall) DoAndReturn(f func() error) *MockPageWriterCloseCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Commit mocks base method.
+func (m *MockPageWriter) Commit() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Commit")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Commit indicates an expected call of Commit.
+func (mr *MockPageWriterMockRecorder) Commit() *MockPageWriterCommitCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Commit", reflect.TypeOf((*MockPageWriter)(nil).Commit))
+	return &MockPageWriterCommitCall{Call: call}
+}
+
+// MockPageWriterCommitCall wrap *gomock.Call
+type MockPageWriterCommitCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockPageWriterCommitCall) Return(arg0 error) *MockPageWriterCommitCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockPageWriterCommitCall) Do(f func() error) *MockPageWriterCommitCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockPageWriterCommitCall) DoAndReturn(f func() error) *MockPageWriterCommitCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Compression mocks base method.
+func (m *MockPageWriter) Compression() domain.Compression {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Compression")
+	ret0, _ := ret[0].(domain.Compression)
+	return ret0
+}
+
+// Compression indicates an expected call of Compression.
+func (mr *MockPageWriterMockRecorder) Compression() *MockPageWriterCompressionCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Compression", reflect.TypeOf((*MockPageWriter)(nil).Compression))
+	return &MockPageWriterCompressionCall{Call: call}
+}
+
+// MockPageWriterCompressionCall wrap *gomock.Call
+type MockPageWriterCompressionCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockPageWriterCompressionCall) Return(arg0 domain.Compression) *MockPageWriterCompressionCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockPageWriterCompressionCall) Do(f func() domain.Compression) *MockPageWriterCompressionCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockPageWriterCompressionCall) DoAndReturn(f func() domain.Compression) *MockPageWriterCompressionCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Discard mocks base method.
+func (m *MockPageWriter) Discard() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Discard")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Discard indicates an expected call of Discard.
+func (mr *MockPageWriterMockRecorder) Discard() *MockPageWriterDiscardCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Discard", reflect.TypeOf((*MockPageWriter)(nil).Discard))
+	return &MockPageWriterDiscardCall{Call: call}
+}
+
+// MockPageWriterDiscardCall wrap *gomock.Call
+type MockPageWriterDiscardCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockPageWriterDiscardCall) Return(arg0 error) *MockPageWriterDiscardCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockPageWriterDiscardCall) Do(f func() error) *MockPageWriterDiscardCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockPageWriterDiscardCall) DoAndReturn(f func() error) *MockPageWriterDiscardCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Snapshot mocks base method.
+func (m *MockPageWriter) Snapshot() domain.SnapshotID {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Snapshot")
+	ret0, _ := ret[0].(domain.SnapshotID)
+	return ret0
+}
+
+// Snapshot indicates an expected call of Snapshot.
+func (mr *MockPageWriterMockRecorder) Snapshot() *MockPageWriterSnapshotCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Snapshot", reflect.TypeOf((*MockPageWriter)(nil).Snapshot))
+	return &MockPageWriterSnapshotCall{Call: call}
+}
+
+// MockPageWriterSnapshotCall wrap *gomock.Call
+type MockPageWriterSnapshotCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockPageWriterSnapshotCall) Return(arg0 domain.SnapshotID) *MockPageWriterSnapshotCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockPageWriterSnapshotCall) Do(f func() domain.SnapshotID) *MockPageWriterSnapshotCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockPageWriterSnapshotCall) DoAndReturn(f func() domain.SnapshotID) *MockPageWriterSnapshotCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Write mocks base method.
+func (m *MockPageWriter) Write(p []byte) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Write", p)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Write indicates an expected call of Write.
+func (mr *MockPageWriterMockRecorder) Write(p any) *MockPageWriterWriteCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Write", reflect.TypeOf((*MockPageWriter)(nil).Write), p)
+	return &MockPageWriterWriteCall{Call: call}
+}
+
+// MockPageWriterWriteCall wrap *gomock.Call
+type MockPageWriterWriteCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockPageWriterWriteCall) Return(n int, err error) *MockPageWriterWriteCall {
+	c.Call = c.Call.Return(n, err)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockPageWriterWriteCall) Do(f func([]byte) (int, error)) *MockPageWriterWriteCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockPageWriterWriteCall) DoAndReturn(f func([]byte) (int, error)) *MockPageWriterWriteCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// MockAssetWriter is a mock of AssetWriter interface.
+type MockAssetWriter struct {
+	ctrl     *gomock.Controller
+	recorder *MockAssetWriterMockRecorder
+}
+
+// MockAssetWriterMockRecorder is the mock recorder for MockAssetWriter.
+type MockAssetWriterMockRecorder struct {
+	mock *MockAssetWriter
+}
+
+// NewMockAssetWriter creates a new mock instance.
+func NewMockAssetWriter(ctrl *gomock.Controller) *MockAssetWriter {
+	mock := &MockAssetWriter{ctrl: ctrl}
+	mock.recorder = &MockAssetWriterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAssetWriter) EXPECT() *MockAssetWriterMockRecorder {
+	return m.recorder
+}
+
+// Close mocks base method.
+func (m *MockAssetWriter) Close() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Close")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockAssetWriterMockRecorder) Close() *MockAssetWriterCloseCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockAssetWriter)(nil).Close))
+	return &MockAssetWriterCloseCall{Call: call}
+}
+
+// MockAssetWriterCloseCall wrap *gomock.Call
+type MockAssetWriterCloseCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockAssetWriterCloseCall) Return(arg0 error) *MockAssetWriterCloseCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockAssetWriterCloseCall) Do(f func() error) *MockAssetWriterCloseCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockAssetWriterCloseCall) DoAndReturn(f func() error) *MockAssetWriterCloseCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Discard mocks base method.
+func (m *MockAssetWriter) Discard() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Discard")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Discard indicates an expected call of Discard.
+func (mr *MockAssetWriterMockRecorder) Discard() *MockAssetWriterDiscardCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Discard", reflect.TypeOf((*MockAssetWriter)(nil).Discard))
+	return &MockAssetWriterDiscardCall{Call: call}
+}
+
+// MockAssetWriterDiscardCall wrap *gomock.Call
+type MockAssetWriterDiscardCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockAssetWriterDiscardCall) Return(arg0 error) *MockAssetWriterDiscardCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockAssetWriterDiscardCall) Do(f func() error) *MockAssetWriterDiscardCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockAssetWriterDiscardCall) DoAndReturn(f func() error) *MockAssetWriterDiscardCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Write mocks base method.
+func (m *MockAssetWriter) Write(p []byte) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Write", p)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Write indicates an expected call of Write.
+func (mr *MockAssetWriterMockRecorder) Write(p any) *MockAssetWriterWriteCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Write", reflect.TypeOf((*MockAssetWriter)(nil).Write), p)
+	return &MockAssetWriterWriteCall{Call: call}
+}
+
+// MockAssetWriterWriteCall wrap *gomock.Call
+type MockAssetWriterWriteCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockAssetWriterWriteCall) Return(n int, err error) *MockAssetWriterWriteCall {
+	c.Call = c.Call.Return(n, err)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockAssetWriterWriteCall) Do(f func([]byte) (int, error)) *MockAssetWriterWriteCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockAssetWriterWriteCall) DoAndReturn(f func([]byte) (int, error)) *MockAssetWriterWriteCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // MockDisk is a mock of Disk interface.
 type MockDisk struct {
 	ctrl     *gomock.Controller
-	recorder *MockDiskMockRecorder
+	recorder *MockDiskMockRecorder
+}
+
+// MockDiskMockRecorder is the mock recorder for MockDisk.
+type MockDiskMockRecorder struct {
+	mock *MockDisk
+}
+
+// NewMockDisk creates a new mock instance.
+func NewMockDisk(ctrl *gomock.Controller) *MockDisk {
+	mock := &MockDisk{ctrl: ctrl}
+	mock.recorder = &MockDiskMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDisk) EXPECT() *MockDiskMockRecorder {
+	return m.recorder
+}
+
+// HasPage mocks base method.
+func (m *MockDisk) HasPage(ctx context.Context, name string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HasPage", ctx, name)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HasPage indicates an expected call of HasPage.
+func (mr *MockDiskMockRecorder) HasPage(ctx, name any) *MockDiskHasPageCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HasPage", reflect.TypeOf((*MockDisk)(nil).HasPage), ctx, name)
+	return &MockDiskHasPageCall{Call: call}
+}
+
+// MockDiskHasPageCall wrap *gomock.Call
+type MockDiskHasPageCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockDiskHasPageCall) Return(arg0 bool, arg1 error) *MockDiskHasPageCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockDiskHasPageCall) Do(f func(context.Context, string) (bool, error)) *MockDiskHasPageCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockDiskHasPageCall) DoAndReturn(f func(context.Context, string) (bool, error)) *MockDiskHasPageCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// NewAssetWriter mocks base method.
+func (m *MockDisk) NewAssetWriter(ctx context.Context, name string) (AssetWriter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewAssetWriter", ctx, name)
+	ret0, _ := ret[0].(AssetWriter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NewAssetWriter indicates an expected call of NewAssetWriter.
+func (mr *MockDiskMockRecorder) NewAssetWriter(ctx, name any) *MockDiskNewAssetWriterCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewAssetWriter", reflect.TypeOf((*MockDisk)(nil).NewAssetWriter), ctx, name)
+	return &MockDiskNewAssetWriterCall{Call: call}
+}
+
+// MockDiskNewAssetWriterCall wrap *gomock.Call
+type MockDiskNewAssetWriterCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockDiskNewAssetWriterCall) Return(arg0 AssetWriter, arg1 error) *MockDiskNewAssetWriterCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockDiskNewAssetWriterCall) Do(f func(context.Context, string) (AssetWriter, error)) *MockDiskNewAssetWriterCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockDiskNewAssetWriterCall) DoAndReturn(f func(context.Context, string) (AssetWriter, error)) *MockDiskNewAssetWriterCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// NewPageWriter mocks base method.
+func (m *MockDisk) NewPageWriter(ctx context.Context, name string, exchange Exchange) (PageWriter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NewPageWriter", ctx, name, exchange)
+	ret0, _ := ret[0].(PageWriter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NewPageWriter indicates an expected call of NewPageWriter.
+func (mr *MockDiskMockRecorder) NewPageWriter(ctx, name, exchange any) *MockDiskNewPageWriterCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewPageWriter", reflect.TypeOf((*MockDisk)(nil).NewPageWriter), ctx, name, exchange)
+	return &MockDiskNewPageWriterCall{Call: call}
+}
+
+// MockDiskNewPageWriterCall wrap *gomock.Call
+type MockDiskNewPageWriterCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockDiskNewPageWriterCall) Return(arg0 PageWriter, arg1 error) *MockDiskNewPageWriterCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockDiskNewPageWriterCall) Do(f func(context.Context, string, Exchange) (PageWriter, error)) *MockDiskNewPageWriterCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockDiskNewPageWriterCall) DoAndReturn(f func(context.Context, string, Exchange) (PageWriter, error)) *MockDiskNewPageWriterCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// OpenSnapshot mocks base method.
+func (m *MockDisk) OpenSnapshot(ctx context.Context, name string, snapshot domain.SnapshotID, compression domain.Compression) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "OpenSnapshot", ctx, name, snapshot, compression)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// OpenSnapshot indicates an expected call of OpenSnapshot.
+func (mr *MockDiskMockRecorder) OpenSnapshot(ctx, name, snapshot, compression any) *MockDiskOpenSnapshotCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OpenSnapshot", reflect.TypeOf((*MockDisk)(nil).OpenSnapshot), ctx, name, snapshot, compression)
+	return &MockDiskOpenSnapshotCall{Call: call}
+}
+
+// MockDiskOpenSnapshotCall wrap *gomock.Call
+type MockDiskOpenSnapshotCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockDiskOpenSnapshotCall) Return(arg0 io.ReadCloser, arg1 error) *MockDiskOpenSnapshotCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockDiskOpenSnapshotCall) Do(f func(context.Context, string, domain.SnapshotID, domain.Compression) (io.ReadCloser, error)) *MockDiskOpenSnapshotCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockDiskOpenSnapshotCall) DoAndReturn(f func(context.Context, string, domain.SnapshotID, domain.Compression) (io.ReadCloser, error)) *MockDiskOpenSnapshotCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// PageLocation mocks base method.
+func (m *MockDisk) PageLocation(name string) string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PageLocation", name)
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// PageLocation indicates an expected call of PageLocation.
+func (mr *MockDiskMockRecorder) PageLocation(name any) *MockDiskPageLocationCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PageLocation", reflect.TypeOf((*MockDisk)(nil).PageLocation), name)
+	return &MockDiskPageLocationCall{Call: call}
+}
+
+// MockDiskPageLocationCall wrap *gomock.Call
+type MockDiskPageLocationCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockDiskPageLocationCall) Return(arg0 string) *MockDiskPageLocationCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockDiskPageLocationCall) Do(f func(string) string) *MockDiskPageLocationCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockDiskPageLocationCall) DoAndReturn(f func(string) string) *MockDiskPageLocationCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// RestoreSnapshot mocks base method.
+func (m *MockDisk) RestoreSnapshot(ctx context.Context, name string, snapshot domain.SnapshotID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RestoreSnapshot", ctx, name, snapshot)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreSnapshot indicates an expected call of RestoreSnapshot.
+func (mr *MockDiskMockRecorder) RestoreSnapshot(ctx, name, snapshot any) *MockDiskRestoreSnapshotCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreSnapshot", reflect.TypeOf((*MockDisk)(nil).RestoreSnapshot), ctx, name, snapshot)
+	return &MockDiskRestoreSnapshotCall{Call: call}
+}
+
+// MockDiskRestoreSnapshotCall wrap *gomock.Call
+type MockDiskRestoreSnapshotCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockDiskRestoreSnapshotCall) Return(arg0 error) *MockDiskRestoreSnapshotCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockDiskRestoreSnapshotCall) Do(f func(context.Context, string, domain.SnapshotID) error) *MockDiskRestoreSnapshotCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockDiskRestoreSnapshotCall) DoAndReturn(f func(context.Context, string, domain.SnapshotID) error) *MockDiskRestoreSnapshotCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// SaveNotModified mocks base method.
+func (m *MockDisk) SaveNotModified(ctx context.Context, name string, exchange Exchange, fetched time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveNotModified", ctx, name, exchange, fetched)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveNotModified indicates an expected call of SaveNotModified.
+func (mr *MockDiskMockRecorder) SaveNotModified(ctx, name, exchange, fetched any) *MockDiskSaveNotModifiedCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveNotModified", reflect.TypeOf((*MockDisk)(nil).SaveNotModified), ctx, name, exchange, fetched)
+	return &MockDiskSaveNotModifiedCall{Call: call}
+}
+
+// MockDiskSaveNotModifiedCall wrap *gomock.Call
+type MockDiskSaveNotModifiedCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockDiskSaveNotModifiedCall) Return(arg0 error) *MockDiskSaveNotModifiedCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockDiskSaveNotModifiedCall) Do(f func(context.Context, string, Exchange, time.Time) error) *MockDiskSaveNotModifiedCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockDiskSaveNotModifiedCall) DoAndReturn(f func(context.Context, string, Exchange, time.Time) error) *MockDiskSaveNotModifiedCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// MockFetcher is a mock of Fetcher interface.
+type MockFetcher struct {
+	ctrl     *gomock.Controller
+	recorder *MockFetcherMockRecorder
+}
+
+// MockFetcherMockRecorder is the mock recorder for MockFetcher.
+type MockFetcherMockRecorder struct {
+	mock *MockFetcher
+}
+
+// NewMockFetcher creates a new mock instance.
+func NewMockFetcher(ctrl *gomock.Controller) *MockFetcher {
+	mock := &MockFetcher{ctrl: ctrl}
+	mock.recorder = &MockFetcherMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockFetcher) EXPECT() *MockFetcherMockRecorder {
+	return m.recorder
+}
+
+// Fetch mocks base method.
+func (m *MockFetcher) Fetch(ctx context.Context, request FetchRequest) (*FetchedItem, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Fetch", ctx, request)
+	ret0, _ := ret[0].(*FetchedItem)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Fetch indicates an expected call of Fetch.
+func (mr *MockFetcherMockRecorder) Fetch(ctx, request any) *MockFetcherFetchCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockFetcher)(nil).Fetch), ctx, request)
+	return &MockFetcherFetchCall{Call: call}
+}
+
+// MockFetcherFetchCall wrap *gomock.Call
+type MockFetcherFetchCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockFetcherFetchCall) Return(arg0 *FetchedItem, arg1 error) *MockFetcherFetchCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockFetcherFetchCall) Do(f func(context.Context, FetchRequest) (*FetchedItem, error)) *MockFetcherFetchCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockFetcherFetchCall) DoAndReturn(f func(context.Context, FetchRequest) (*FetchedItem, error)) *MockFetcherFetchCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// FetchAsset mocks base method.
+func (m *MockFetcher) FetchAsset(ctx context.Context, site, asset string) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FetchAsset", ctx, site, asset)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FetchAsset indicates an expected call of FetchAsset.
+func (mr *MockFetcherMockRecorder) FetchAsset(ctx, site, asset any) *MockFetcherFetchAssetCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FetchAsset", reflect.TypeOf((*MockFetcher)(nil).FetchAsset), ctx, site, asset)
+	return &MockFetcherFetchAssetCall{Call: call}
+}
+
+// MockFetcherFetchAssetCall wrap *gomock.Call
+type MockFetcherFetchAssetCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockFetcherFetchAssetCall) Return(arg0 io.ReadCloser, arg1 error) *MockFetcherFetchAssetCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockFetcherFetchAssetCall) Do(f func(context.Context, string, string) (io.ReadCloser, error)) *MockFetcherFetchAssetCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockFetcherFetchAssetCall) DoAndReturn(f func(context.Context, string, string) (io.ReadCloser, error)) *MockFetcherFetchAssetCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// MockMetaDataRepository is a mock of MetaDataRepository interface.
+type MockMetaDataRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockMetaDataRepositoryMockRecorder
+}
+
+// MockMetaDataRepositoryMockRecorder is the mock recorder for MockMetaDataRepository.
+type MockMetaDataRepositoryMockRecorder struct {
+	mock *MockMetaDataRepository
+}
+
+// NewMockMetaDataRepository creates a new mock instance.
+func NewMockMetaDataRepository(ctrl *gomock.Controller) *MockMetaDataRepository {
+	mock := &MockMetaDataRepository{ctrl: ctrl}
+	mock.recorder = &MockMetaDataRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMetaDataRepository) EXPECT() *MockMetaDataRepositoryMockRecorder {
+	return m.recorder
+}
+
+// ByIDs mocks base method.
+func (m *MockMetaDataRepository) ByIDs(ctx context.Context, ids []domain.PageID) ([]domain.MetaData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ByIDs", ctx, ids)
+	ret0, _ := ret[0].([]domain.MetaData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ByIDs indicates an expected call of ByIDs.
+func (mr *MockMetaDataRepositoryMockRecorder) ByIDs(ctx, ids any) *MockMetaDataRepositoryByIDsCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ByIDs", reflect.TypeOf((*MockMetaDataRepository)(nil).ByIDs), ctx, ids)
+	return &MockMetaDataRepositoryByIDsCall{Call: call}
+}
+
+// MockMetaDataRepositoryByIDsCall wrap *gomock.Call
+type MockMetaDataRepositoryByIDsCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockMetaDataRepositoryByIDsCall) Return(arg0 []domain.MetaData, arg1 error) *MockMetaDataRepositoryByIDsCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockMetaDataRepositoryByIDsCall) Do(f func(context.Context, []domain.PageID) ([]domain.MetaData, error)) *MockMetaDataRepositoryByIDsCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockMetaDataRepositoryByIDsCall) DoAndReturn(f func(context.Context, []domain.PageID) ([]domain.MetaData, error)) *MockMetaDataRepositoryByIDsCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// HistoryByIDs mocks base method.
+func (m *MockMetaDataRepository) HistoryByIDs(ctx context.Context, ids []domain.PageID) ([]domain.MetaData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HistoryByIDs", ctx, ids)
+	ret0, _ := ret[0].([]domain.MetaData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HistoryByIDs indicates an expected call of HistoryByIDs.
+func (mr *MockMetaDataRepositoryMockRecorder) HistoryByIDs(ctx, ids any) *MockMetaDataRepositoryHistoryByIDsCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HistoryByIDs", reflect.TypeOf((*MockMetaDataRepository)(nil).HistoryByIDs), ctx, ids)
+	return &MockMetaDataRepositoryHistoryByIDsCall{Call: call}
+}
+
+// MockMetaDataRepositoryHistoryByIDsCall wrap *gomock.Call
+type MockMetaDataRepositoryHistoryByIDsCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockMetaDataRepositoryHistoryByIDsCall) Return(arg0 []domain.MetaData, arg1 error) *MockMetaDataRepositoryHistoryByIDsCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockMetaDataRepositoryHistoryByIDsCall) Do(f func(context.Context, []domain.PageID) ([]domain.MetaData, error)) *MockMetaDataRepositoryHistoryByIDsCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockMetaDataRepositoryHistoryByIDsCall) DoAndReturn(f func(context.Context, []domain.PageID) ([]domain.MetaData, error)) *MockMetaDataRepositoryHistoryByIDsCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// ResolveAliases mocks base method.
+func (m *MockMetaDataRepository) ResolveAliases(ctx context.Context, ids []domain.PageID) ([]domain.PageID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResolveAliases", ctx, ids)
+	ret0, _ := ret[0].([]domain.PageID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResolveAliases indicates an expected call of ResolveAliases.
+func (mr *MockMetaDataRepositoryMockRecorder) ResolveAliases(ctx, ids any) *MockMetaDataRepositoryResolveAliasesCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResolveAliases", reflect.TypeOf((*MockMetaDataRepository)(nil).ResolveAliases), ctx, ids)
+	return &MockMetaDataRepositoryResolveAliasesCall{Call: call}
+}
+
+// MockMetaDataRepositoryResolveAliasesCall wrap *gomock.Call
+type MockMetaDataRepositoryResolveAliasesCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockMetaDataRepositoryResolveAliasesCall) Return(arg0 []domain.PageID, arg1 error) *MockMetaDataRepositoryResolveAliasesCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockMetaDataRepositoryResolveAliasesCall) Do(f func(context.Context, []domain.PageID) ([]domain.PageID, error)) *MockMetaDataRepositoryResolveAliasesCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockMetaDataRepositoryResolveAliasesCall) DoAndReturn(f func(context.Context, []domain.PageID) ([]domain.PageID, error)) *MockMetaDataRepositoryResolveAliasesCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Save mocks base method.
+func (m *MockMetaDataRepository) Save(ctx context.Context, metaData domain.MetaData) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, metaData)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockMetaDataRepositoryMockRecorder) Save(ctx, metaData any) *MockMetaDataRepositorySaveCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockMetaDataRepository)(nil).Save), ctx, metaData)
+	return &MockMetaDataRepositorySaveCall{Call: call}
+}
+
+// MockMetaDataRepositorySaveCall wrap *gomock.Call
+type MockMetaDataRepositorySaveCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockMetaDataRepositorySaveCall) Return(arg0 error) *MockMetaDataRepositorySaveCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockMetaDataRepositorySaveCall) Do(f func(context.Context, domain.MetaData) error) *MockMetaDataRepositorySaveCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockMetaDataRepositorySaveCall) DoAndReturn(f func(context.Context, domain.MetaData) error) *MockMetaDataRepositorySaveCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// SaveAlias mocks base method.
+func (m *MockMetaDataRepository) SaveAlias(ctx context.Context, alias, id domain.PageID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveAlias", ctx, alias, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveAlias indicates an expected call of SaveAlias.
+func (mr *MockMetaDataRepositoryMockRecorder) SaveAlias(ctx, alias, id any) *MockMetaDataRepositorySaveAliasCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveAlias", reflect.TypeOf((*MockMetaDataRepository)(nil).SaveAlias), ctx, alias, id)
+	return &MockMetaDataRepositorySaveAliasCall{Call: call}
+}
+
+// MockMetaDataRepositorySaveAliasCall wrap *gomock.Call
+type MockMetaDataRepositorySaveAliasCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockMetaDataRepositorySaveAliasCall) Return(arg0 error) *MockMetaDataRepositorySaveAliasCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockMetaDataRepositorySaveAliasCall) Do(f func(context.Context, domain.PageID, domain.PageID) error) *MockMetaDataRepositorySaveAliasCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockMetaDataRepositorySaveAliasCall) DoAndReturn(f func(context.Context, domain.PageID, domain.PageID) error) *MockMetaDataRepositorySaveAliasCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// MockScheduleRepository is a mock of ScheduleRepository interface.
+type MockScheduleRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockScheduleRepositoryMockRecorder
 }
 
-// MockDiskMockRecorder is the mock recorder for MockDisk.
-type MockDiskMockRecorder struct {
-	mock *MockDisk
+// MockScheduleRepositoryMockRecorder is the mock recorder for MockScheduleRepository.
+type MockScheduleRepositoryMockRecorder struct {
+	mock *MockScheduleRepository
 }
 
-// NewMockDisk creates a new mock instance.
-func NewMockDisk(ctrl *gomock.Controller) *MockDisk {
-	mock := &MockDisk{ctrl: ctrl}
-	mock.recorder = &MockDiskMockRecorder{mock}
+// NewMockScheduleRepository creates a new mock instance.
+func NewMockScheduleRepository(ctrl *gomock.Controller) *MockScheduleRepository {
+	mock := &MockScheduleRepository{ctrl: ctrl}
+	mock.recorder = &MockScheduleRepositoryMockRecorder{mock}
 	return mock
 }
 
 // EXPECT returns an object that allows the caller to indicate expected use.
-func (m *MockDisk) EXPECT() *MockDiskMockRecorder {
+func (m *MockScheduleRepository) EXPECT() *MockScheduleRepositoryMockRecorder {
 	return m.recorder
 }
 
-// NewPageWriter mocks base method.
-func (m *MockDisk) NewPageWriter(ctx context.Context, name string) (io.WriteCloser, error) {
+// DeleteSchedule mocks base method.
+func (m *MockScheduleRepository) DeleteSchedule(ctx context.Context, id domain.PageID) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "NewPageWriter", ctx, name)
-	ret0, _ := ret[0].(io.WriteCloser)
+	ret := m.ctrl.Call(m, "DeleteSchedule", ctx, id)
+	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// NewPageWriter indicates an expected call of NewPageWriter.
-func (mr *MockDiskMockRecorder) NewPageWriter(ctx, name any) *MockDiskNewPageWriterCall {
+// DeleteSchedule indicates an expected call of DeleteSchedule.
+func (mr *MockScheduleRepositoryMockRecorder) DeleteSchedule(ctx, id any) *MockScheduleRepositoryDeleteScheduleCall {
 	mr.mock.ctrl.T.Helper()
-	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NewPageWriter", reflect.TypeOf((*MockDisk)(nil).NewPageWriter), ctx, name)
-	return &MockDiskNewPageWriterCall{Call: call}
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteSchedule", reflect.TypeOf((*MockScheduleRepository)(nil).DeleteSchedule), ctx, id)
+	return &MockScheduleRepositoryDeleteScheduleCall{Call: call}
 }
 
-// MockDiskNewPageWriterCall wrap *gomock.Call
-type MockDiskNewPageWriterCall struct {
+// MockScheduleRepositoryDeleteScheduleCall wrap *gomock.Call
+type MockScheduleRepositoryDeleteScheduleCall struct {
 	*gomock.Call
 }
 
 // Return rewrite *gomock.Call.Return
-func (c *MockDiskNewPageWriterCall) Return(arg0 io.WriteCloser, arg1 error) *MockDiskNewPageWriterCall {
+func (c *MockScheduleRepositoryDeleteScheduleCall) Return(arg0 bool, arg1 error) *MockScheduleRepositoryDeleteScheduleCall {
 	c.Call = c.Call.Return(arg0, arg1)
 	return c
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *MockDiskNewPageWriterCall) Do(f func(context.Context, string) (io.WriteCloser, error)) *MockDiskNewPageWriterCall {
+func (c *MockScheduleRepositoryDeleteScheduleCall) Do(f func(context.Context, domain.PageID) (bool, error)) *MockScheduleRepositoryDeleteScheduleCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *MockDiskNewPageWriterCall) DoAndReturn(f func(context.Context, string) (io.WriteCloser, error)) *MockDiskNewPageWriterCall {
+func (c *MockScheduleRepositoryDeleteScheduleCall) DoAndReturn(f func(context.Context, domain.PageID) (bool, error)) *MockScheduleRepositoryDeleteScheduleCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
 
-// MockFetcher is a mock of Fetcher interface.
-type MockFetcher struct {
-	ctrl     *gomock.Controller
-	recorder *MockFetcherMockRecorder
+// SaveSchedule mocks base method.
+func (m *MockScheduleRepository) SaveSchedule(ctx context.Context, schedule domain.Schedule) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveSchedule", ctx, schedule)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
-// MockFetcherMockRecorder is the mock recorder for MockFetcher.
-type MockFetcherMockRecorder struct {
-	mock *MockFetcher
+// SaveSchedule indicates an expected call of SaveSchedule.
+func (mr *MockScheduleRepositoryMockRecorder) SaveSchedule(ctx, schedule any) *MockScheduleRepositorySaveScheduleCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveSchedule", reflect.TypeOf((*MockScheduleRepository)(nil).SaveSchedule), ctx, schedule)
+	return &MockScheduleRepositorySaveScheduleCall{Call: call}
 }
 
-// NewMockFetcher creates a new mock instance.
-func NewMockFetcher(ctrl *gomock.Controller) *MockFetcher {
-	mock := &MockFetcher{ctrl: ctrl}
-	mock.recorder = &MockFetcherMockRecorder{mock}
-	return mock
+// MockScheduleRepositorySaveScheduleCall wrap *gomock.Call
+type MockScheduleRepositorySaveScheduleCall struct {
+	*gomock.Call
 }
 
-// EXPECT returns an object that allows the caller to indicate expected use.
-func (m *MockFetcher) EXPECT() *MockFetcherMockRecorder {
-	return m.recorder
+// Return rewrite *gomock.Call.Return
+func (c *MockScheduleRepositorySaveScheduleCall) Return(arg0 error) *MockScheduleRepositorySaveScheduleCall {
+	c.Call = c.Call.Return(arg0)
+	return c
 }
 
-// Fetch mocks base method.
-func (m *MockFetcher) Fetch(ctx context.Context, site string) (*FetchedItem, error) {
+// Do rewrite *gomock.Call.Do
+func (c *MockScheduleRepositorySaveScheduleCall) Do(f func(context.Context, domain.Schedule) error) *MockScheduleRepositorySaveScheduleCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockScheduleRepositorySaveScheduleCall) DoAndReturn(f func(context.Context, domain.Schedule) error) *MockScheduleRepositorySaveScheduleCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Schedules mocks base method.
+func (m *MockScheduleRepository) Schedules(ctx context.Context) ([]domain.Schedule, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Fetch", ctx, site)
-	ret0, _ := ret[0].(*FetchedItem)
+	ret := m.ctrl.Call(m, "Schedules", ctx)
+	ret0, _ := ret[0].([]domain.Schedule)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// Fetch indicates an expected call of Fetch.
-func (mr *MockFetcherMockRecorder) Fetch(ctx, site any) *MockFetcherFetchCall {
+// Schedules indicates an expected call of Schedules.
+func (mr *MockScheduleRepositoryMockRecorder) Schedules(ctx any) *MockScheduleRepositorySchedulesCall {
 	mr.mock.ctrl.T.Helper()
-	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockFetcher)(nil).Fetch), ctx, site)
-	return &MockFetcherFetchCall{Call: call}
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Schedules", reflect.TypeOf((*MockScheduleRepository)(nil).Schedules), ctx)
+	return &MockScheduleRepositorySchedulesCall{Call: call}
 }
 
-// MockFetcherFetchCall wrap *gomock.Call
-type MockFetcherFetchCall struct {
+// MockScheduleRepositorySchedulesCall wrap *gomock.Call
+type MockScheduleRepositorySchedulesCall struct {
 	*gomock.Call
 }
 
 // Return rewrite *gomock.Call.Return
-func (c *MockFetcherFetchCall) Return(arg0 *FetchedItem, arg1 error) *MockFetcherFetchCall {
+func (c *MockScheduleRepositorySchedulesCall) Return(arg0 []domain.Schedule, arg1 error) *MockScheduleRepositorySchedulesCall {
 	c.Call = c.Call.Return(arg0, arg1)
 	return c
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *MockFetcherFetchCall) Do(f func(context.Context, string) (*FetchedItem, error)) *MockFetcherFetchCall {
+func (c *MockScheduleRepositorySchedulesCall) Do(f func(context.Context) ([]domain.Schedule, error)) *MockScheduleRepositorySchedulesCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *MockFetcherFetchCall) DoAndReturn(f func(context.Context, string) (*FetchedItem, error)) *MockFetcherFetchCall {
+func (c *MockScheduleRepositorySchedulesCall) DoAndReturn(f func(context.Context) ([]domain.Schedule, error)) *MockScheduleRepositorySchedulesCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
 
-// MockMetaDataRepository is a mock of MetaDataRepository interface.
-type MockMetaDataRepository struct {
+// UpdateScheduleRuns mocks base method.
+func (m *MockScheduleRepository) UpdateScheduleRuns(ctx context.Context, id domain.PageID, lastRun, nextRun time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateScheduleRuns", ctx, id, lastRun, nextRun)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateScheduleRuns indicates an expected call of UpdateScheduleRuns.
+func (mr *MockScheduleRepositoryMockRecorder) UpdateScheduleRuns(ctx, id, lastRun, nextRun any) *MockScheduleRepositoryUpdateScheduleRunsCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateScheduleRuns", reflect.TypeOf((*MockScheduleRepository)(nil).UpdateScheduleRuns), ctx, id, lastRun, nextRun)
+	return &MockScheduleRepositoryUpdateScheduleRunsCall{Call: call}
+}
+
+// MockScheduleRepositoryUpdateScheduleRunsCall wrap *gomock.Call
+type MockScheduleRepositoryUpdateScheduleRunsCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockScheduleRepositoryUpdateScheduleRunsCall) Return(arg0 error) *MockScheduleRepositoryUpdateScheduleRunsCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockScheduleRepositoryUpdateScheduleRunsCall) Do(f func(context.Context, domain.PageID, time.Time, time.Time) error) *MockScheduleRepositoryUpdateScheduleRunsCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockScheduleRepositoryUpdateScheduleRunsCall) DoAndReturn(f func(context.Context, domain.PageID, time.Time, time.Time) error) *MockScheduleRepositoryUpdateScheduleRunsCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// MockRunRepository is a mock of RunRepository interface.
+type MockRunRepository struct {
 	ctrl     *gomock.Controller
-	recorder *MockMetaDataRepositoryMockRecorder
+	recorder *MockRunRepositoryMockRecorder
 }
 
-// MockMetaDataRepositoryMockRecorder is the mock recorder for MockMetaDataRepository.
-type MockMetaDataRepositoryMockRecorder struct {
-	mock *MockMetaDataRepository
+// MockRunRepositoryMockRecorder is the mock recorder for MockRunRepository.
+type MockRunRepositoryMockRecorder struct {
+	mock *MockRunRepository
 }
 
-// NewMockMetaDataRepository creates a new mock instance.
-func NewMockMetaDataRepository(ctrl *gomock.Controller) *MockMetaDataRepository {
-	mock := &MockMetaDataRepository{ctrl: ctrl}
-	mock.recorder = &MockMetaDataRepositoryMockRecorder{mock}
+// NewMockRunRepository creates a new mock instance.
+func NewMockRunRepository(ctrl *gomock.Controller) *MockRunRepository {
+	mock := &MockRunRepository{ctrl: ctrl}
+	mock.recorder = &MockRunRepositoryMockRecorder{mock}
 	return mock
 }
 
 // EXPECT returns an object that allows the caller to indicate expected use.
-func (m *MockMetaDataRepository) EXPECT() *MockMetaDataRepositoryMockRecorder {
+func (m *MockRunRepository) EXPECT() *MockRunRepositoryMockRecorder {
 	return m.recorder
 }
 
-// ByIDs mocks base method.
-func (m *MockMetaDataRepository) ByIDs(ctx context.Context, ids []domain.PageID) ([]domain.MetaData, error) {
+// AddTasks mocks base method.
+func (m *MockRunRepository) AddTasks(ctx context.Context, tasks []domain.RunTask) ([]int64, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ByIDs", ctx, ids)
-	ret0, _ := ret[0].([]domain.MetaData)
+	ret := m.ctrl.Call(m, "AddTasks", ctx, tasks)
+	ret0, _ := ret[0].([]int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// ByIDs indicates an expected call of ByIDs.
-func (mr *MockMetaDataRepositoryMockRecorder) ByIDs(ctx, ids any) *MockMetaDataRepositoryByIDsCall {
+// AddTasks indicates an expected call of AddTasks.
+func (mr *MockRunRepositoryMockRecorder) AddTasks(ctx, tasks any) *MockRunRepositoryAddTasksCall {
 	mr.mock.ctrl.T.Helper()
-	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ByIDs", reflect.TypeOf((*MockMetaDataRepository)(nil).ByIDs), ctx, ids)
-	return &MockMetaDataRepositoryByIDsCall{Call: call}
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddTasks", reflect.TypeOf((*MockRunRepository)(nil).AddTasks), ctx, tasks)
+	return &MockRunRepositoryAddTasksCall{Call: call}
 }
 
-// MockMetaDataRepositoryByIDsCall wrap *gomock.Call
-type MockMetaDataRepositoryByIDsCall struct {
+// MockRunRepositoryAddTasksCall wrap *gomock.Call
+type MockRunRepositoryAddTasksCall struct {
 	*gomock.Call
 }
 
 // Return rewrite *gomock.Call.Return
-func (c *MockMetaDataRepositoryByIDsCall) Return(arg0 []domain.MetaData, arg1 error) *MockMetaDataRepositoryByIDsCall {
+func (c *MockRunRepositoryAddTasksCall) Return(arg0 []int64, arg1 error) *MockRunRepositoryAddTasksCall {
 	c.Call = c.Call.Return(arg0, arg1)
 	return c
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *MockMetaDataRepositoryByIDsCall) Do(f func(context.Context, []domain.PageID) ([]domain.MetaData, error)) *MockMetaDataRepositoryByIDsCall {
+func (c *MockRunRepositoryAddTasksCall) Do(f func(context.Context, []domain.RunTask) ([]int64, error)) *MockRunRepositoryAddTasksCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *MockMetaDataRepositoryByIDsCall) DoAndReturn(f func(context.Context, []domain.PageID) ([]domain.MetaData, error)) *MockMetaDataRepositoryByIDsCall {
+func (c *MockRunRepositoryAddTasksCall) DoAndReturn(f func(context.Context, []domain.RunTask) ([]int64, error)) *MockRunRepositoryAddTasksCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
 
-// Save mocks base method.
-func (m *MockMetaDataRepository) Save(ctx context.Context, metaData domain.MetaData) error {
+// DeleteRun mocks base method.
+func (m *MockRunRepository) DeleteRun(ctx context.Context, id domain.RunID) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Save", ctx, metaData)
+	ret := m.ctrl.Call(m, "DeleteRun", ctx, id)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// Save indicates an expected call of Save.
-func (mr *MockMetaDataRepositoryMockRecorder) Save(ctx, metaData any) *MockMetaDataRepositorySaveCall {
+// DeleteRun indicates an expected call of DeleteRun.
+func (mr *MockRunRepositoryMockRecorder) DeleteRun(ctx, id any) *MockRunRepositoryDeleteRunCall {
 	mr.mock.ctrl.T.Helper()
-	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockMetaDataRepository)(nil).Save), ctx, metaData)
-	return &MockMetaDataRepositorySaveCall{Call: call}
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRun", reflect.TypeOf((*MockRunRepository)(nil).DeleteRun), ctx, id)
+	return &MockRunRepositoryDeleteRunCall{Call: call}
 }
 
-// MockMetaDataRepositorySaveCall wrap *gomock.Call
-type MockMetaDataRepositorySaveCall struct {
+// MockRunRepositoryDeleteRunCall wrap *gomock.Call
+type MockRunRepositoryDeleteRunCall struct {
 	*gomock.Call
 }
 
 // Return rewrite *gomock.Call.Return
-func (c *MockMetaDataRepositorySaveCall) Return(arg0 error) *MockMetaDataRepositorySaveCall {
+func (c *MockRunRepositoryDeleteRunCall) Return(arg0 error) *MockRunRepositoryDeleteRunCall {
 	c.Call = c.Call.Return(arg0)
 	return c
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *MockMetaDataRepositorySaveCall) Do(f func(context.Context, domain.MetaData) error) *MockMetaDataRepositorySaveCall {
+func (c *MockRunRepositoryDeleteRunCall) Do(f func(context.Context, domain.RunID) error) *MockRunRepositoryDeleteRunCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *MockMetaDataRepositorySaveCall) DoAndReturn(f func(context.Context, domain.MetaData) error) *MockMetaDataRepositorySaveCall {
+func (c *MockRunRepositoryDeleteRunCall) DoAndReturn(f func(context.Context, domain.RunID) error) *MockRunRepositoryDeleteRunCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// RunByID mocks base method.
+func (m *MockRunRepository) RunByID(ctx context.Context, id domain.RunID) (domain.Run, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RunByID", ctx, id)
+	ret0, _ := ret[0].(domain.Run)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// RunByID indicates an expected call of RunByID.
+func (mr *MockRunRepositoryMockRecorder) RunByID(ctx, id any) *MockRunRepositoryRunByIDCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunByID", reflect.TypeOf((*MockRunRepository)(nil).RunByID), ctx, id)
+	return &MockRunRepositoryRunByIDCall{Call: call}
+}
+
+// MockRunRepositoryRunByIDCall wrap *gomock.Call
+type MockRunRepositoryRunByIDCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockRunRepositoryRunByIDCall) Return(arg0 domain.Run, arg1 bool, arg2 error) *MockRunRepositoryRunByIDCall {
+	c.Call = c.Call.Return(arg0, arg1, arg2)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockRunRepositoryRunByIDCall) Do(f func(context.Context, domain.RunID) (domain.Run, bool, error)) *MockRunRepositoryRunByIDCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockRunRepositoryRunByIDCall) DoAndReturn(f func(context.Context, domain.RunID) (domain.Run, bool, error)) *MockRunRepositoryRunByIDCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// SaveRun mocks base method.
+func (m *MockRunRepository) SaveRun(ctx context.Context, run domain.Run) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveRun", ctx, run)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveRun indicates an expected call of SaveRun.
+func (mr *MockRunRepositoryMockRecorder) SaveRun(ctx, run any) *MockRunRepositorySaveRunCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveRun", reflect.TypeOf((*MockRunRepository)(nil).SaveRun), ctx, run)
+	return &MockRunRepositorySaveRunCall{Call: call}
+}
+
+// MockRunRepositorySaveRunCall wrap *gomock.Call
+type MockRunRepositorySaveRunCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockRunRepositorySaveRunCall) Return(arg0 error) *MockRunRepositorySaveRunCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockRunRepositorySaveRunCall) Do(f func(context.Context, domain.Run) error) *MockRunRepositorySaveRunCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockRunRepositorySaveRunCall) DoAndReturn(f func(context.Context, domain.Run) error) *MockRunRepositorySaveRunCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Tasks mocks base method.
+func (m *MockRunRepository) Tasks(ctx context.Context, id domain.RunID, statuses ...domain.TaskStatus) ([]domain.RunTask, error) {
+	m.ctrl.T.Helper()
+	varargs := []any{ctx, id}
+	for _, a := range statuses {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Tasks", varargs...)
+	ret0, _ := ret[0].([]domain.RunTask)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Tasks indicates an expected call of Tasks.
+func (mr *MockRunRepositoryMockRecorder) Tasks(ctx, id any, statuses ...any) *MockRunRepositoryTasksCall {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]any{ctx, id}, statuses...)
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Tasks", reflect.TypeOf((*MockRunRepository)(nil).Tasks), varargs...)
+	return &MockRunRepositoryTasksCall{Call: call}
+}
+
+// MockRunRepositoryTasksCall wrap *gomock.Call
+type MockRunRepositoryTasksCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockRunRepositoryTasksCall) Return(arg0 []domain.RunTask, arg1 error) *MockRunRepositoryTasksCall {
+	c.Call = c.Call.Return(arg0, arg1)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockRunRepositoryTasksCall) Do(f func(context.Context, domain.RunID, ...domain.TaskStatus) ([]domain.RunTask, error)) *MockRunRepositoryTasksCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockRunRepositoryTasksCall) DoAndReturn(f func(context.Context, domain.RunID, ...domain.TaskStatus) ([]domain.RunTask, error)) *MockRunRepositoryTasksCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// UpdateTask mocks base method.
+func (m *MockRunRepository) UpdateTask(ctx context.Context, id int64, status domain.TaskStatus, attempts int, lastError string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateTask", ctx, id, status, attempts, lastError)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateTask indicates an expected call of UpdateTask.
+func (mr *MockRunRepositoryMockRecorder) UpdateTask(ctx, id, status, attempts, lastError any) *MockRunRepositoryUpdateTaskCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateTask", reflect.TypeOf((*MockRunRepository)(nil).UpdateTask), ctx, id, status, attempts, lastError)
+	return &MockRunRepositoryUpdateTaskCall{Call: call}
+}
+
+// MockRunRepositoryUpdateTaskCall wrap *gomock.Call
+type MockRunRepositoryUpdateTaskCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *MockRunRepositoryUpdateTaskCall) Return(arg0 error) *MockRunRepositoryUpdateTaskCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *MockRunRepositoryUpdateTaskCall) Do(f func(context.Context, int64, domain.TaskStatus, int, string) error) *MockRunRepositoryUpdateTaskCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *MockRunRepositoryUpdateTaskCall) DoAndReturn(f func(context.Context, int64, domain.TaskStatus, int, string) error) *MockRunRepositoryUpdateTaskCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"golang.org/x/net/html"
+)
+
+// parsedPage holds what the parser extracts from the html Content of a page.
+type parsedPage struct {
+	metaData domain.MetaData
+
+	// links holds the targets of the anchors of the page, as written in the page.
+	links []string
+	// base holds the target of the base tag of the page, relative links are resolved against it when set.
+	base string
+
+	// inTitle is set while reading the text of the title of the page.
+	inTitle bool
+	// rawTextTag is the script or style tag whose text is being read, this text is not part of the words of the page.
+	rawTextTag string
+}
+
+// parseMetaData reads the html Content and returns the metadata along with the links of the page.
+// When a mirror is given, the Content is copied through it as it is read.
+func (s *Service) parseMetaData(_ context.Context, data io.Reader, mirror *pageMirror) (*parsedPage, error) {
+	page := parsedPage{
+		metaData: domain.MetaData{
+			LastFetched: time.Now().UTC(),
+		},
+	}
+	counter := &countingReader{reader: data}
+
+	// We use the html tokenizer instead of the parser to avoid parsing the whole document
+	// as we only need a few attributes of the tags and the text of the page.
+	reader := html.NewTokenizer(counter)
+	for token := reader.Next(); token != html.ErrorToken; token = reader.Next() {
+		if token != html.StartTagToken && token != html.SelfClosingTagToken {
+			if mirror != nil {
+				var err error
+				if token == html.TextToken && page.rawTextTag == "style" {
+					err = mirror.writeStyle(reader.Raw())
+				} else {
+					err = mirror.write(reader.Raw(), nil)
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			// Reading the text or the tag name modifies the buffer of the tokenizer, so it is done after the copy.
+			switch token {
+			case html.TextToken:
+				page.text(reader.Text())
+			case html.EndTagToken:
+				name, _ := reader.TagName()
+				page.endTag(string(name))
+			default:
+			}
+			continue
+		}
+
+		// The tokenizer modifies its buffer while reading the tag, so the raw tag is copied beforehand.
+		var raw []byte
+		if mirror != nil {
+			raw = bytes.Clone(reader.Raw())
+		}
+
+		tag := reader.Token()
+		page.startTag(&tag, token == html.SelfClosingTagToken)
+
+		if mirror != nil {
+			if err := mirror.write(raw, &tag); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	lastErr := reader.Err()
+	if !errors.Is(lastErr, io.EOF) {
+		return nil, fmt.Errorf("parse html: %w", lastErr)
+	}
+
+	page.metaData.ByteSize = counter.count
+	return &page, nil
+}
+
+// startTag extracts the metadata held by the tag.
+func (p *parsedPage) startTag(tag *html.Token, selfClosing bool) {
+	metaData := &p.metaData
+
+	switch tag.Data {
+	case "a":
+		metaData.NumLinks++
+		if href, ok := attribute(tag, "href"); ok {
+			p.links = append(p.links, href)
+		}
+	case "img":
+		metaData.NumImages++
+	case "base":
+		if p.base == "" {
+			p.base, _ = attribute(tag, "href")
+		}
+	case "html":
+		if metaData.Lang == "" {
+			metaData.Lang, _ = attribute(tag, "lang")
+		}
+	case "title":
+		p.inTitle = !selfClosing && metaData.Title == ""
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		metaData.NumHeadings[tag.Data[1]-'1']++
+	case "script", "style":
+		if tag.Data == "script" {
+			metaData.NumScripts++
+		} else {
+			metaData.NumStylesheets++
+		}
+		if !selfClosing {
+			p.rawTextTag = tag.Data
+		}
+	case "link":
+		if hasRel(tag, "stylesheet") {
+			metaData.NumStylesheets++
+		}
+		if hasRel(tag, "canonical") && metaData.Canonical == "" {
+			metaData.Canonical, _ = attribute(tag, "href")
+		}
+	case "meta":
+		p.meta(tag)
+	}
+}
+
+// meta extracts the description and the social cards from a meta tag.
+func (p *parsedPage) meta(tag *html.Token) {
+	content, ok := attribute(tag, "content")
+	if !ok {
+		return
+	}
+
+	// OpenGraph uses the property attribute while Twitter cards use the name attribute, but both are found in the wild.
+	name, _ := attribute(tag, "name")
+	if name == "" {
+		name, _ = attribute(tag, "property")
+	}
+	name = strings.ToLower(name)
+
+	switch {
+	case name == "description":
+		setOnce(&p.metaData.Description, content)
+	case strings.HasPrefix(name, "og:"):
+		setCardField(&p.metaData.OpenGraph, strings.TrimPrefix(name, "og:"), content)
+	case strings.HasPrefix(name, "twitter:"):
+		setCardField(&p.metaData.Twitter, strings.TrimPrefix(name, "twitter:"), content)
+	}
+}
+
+// endTag closes the tag opened by startTag.
+func (p *parsedPage) endTag(name string) {
+	switch {
+	case name == "title":
+		p.inTitle = false
+	case name == p.rawTextTag:
+		p.rawTextTag = ""
+	}
+}
+
+// text extracts the title and counts the words of the text of the page.
+func (p *parsedPage) text(text []byte) {
+	switch {
+	case p.inTitle:
+		p.metaData.Title += string(text)
+		p.metaData.Title = strings.Join(strings.Fields(p.metaData.Title), " ")
+	case p.rawTextTag == "":
+		p.metaData.WordCount += countWords(text)
+	}
+}
+
+// setCardField sets the field of the card matching the name of an OpenGraph or Twitter property.
+func setCardField(card *domain.SocialCard, name string, content string) {
+	switch name {
+	case "type", "card":
+		setOnce(&card.Type, content)
+	case "title":
+		setOnce(&card.Title, content)
+	case "description":
+		setOnce(&card.Description, content)
+	case "image":
+		setOnce(&card.Image, content)
+	case "url":
+		setOnce(&card.URL, content)
+	}
+}
+
+// setOnce sets the field unless it was already set, the first occurrence of a field in the page wins.
+func setOnce(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+// countWords returns the number of words of the text, words being separated by spaces.
+func countWords(text []byte) int {
+	count := 0
+	inWord := false
+	for len(text) > 0 {
+		r, size := utf8.DecodeRune(text)
+		text = text[size:]
+
+		isSpace := unicode.IsSpace(r)
+		if !isSpace && !inWord {
+			count++
+		}
+		inWord = !isSpace
+	}
+	return count
+}
+
+// attribute returns the value of the attribute of the tag with the given name.
+func attribute(tag *html.Token, name string) (string, bool) {
+	for _, attr := range tag.Attr {
+		if attr.Namespace == "" && attr.Key == name {
+			return strings.TrimSpace(attr.Val), true
+		}
+	}
+	return "", false
+}
+
+// hasRel reports whether the rel attribute of the tag holds the given link type.
+func hasRel(tag *html.Token, linkType string) bool {
+	rel, _ := attribute(tag, "rel")
+	for _, value := range strings.Fields(rel) {
+		if strings.EqualFold(value, linkType) {
+			return true
+		}
+	}
+	return false
+}
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+// Read implements the io.Reader interface.
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_parseMetaData(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		content  string
+		expected domain.MetaData
+		links    []string
+	}{
+		{
+			name:    "empty page",
+			content: "",
+		},
+		{
+			name: "head",
+			content: `<html lang="en-GB"><head>
+				<title>
+					The   Google
+					Search
+				</title>
+				<meta name="description" content="Search the world's information.">
+				<meta name="description" content="Ignored, the first description wins.">
+				<link rel="canonical" href="https://www.google.com/">
+				<meta property="og:type" content="website">
+				<meta property="og:title" content="Google">
+				<meta property="og:image" content="https://www.google.com/logo.png">
+				<meta name="twitter:card" content="summary">
+				<meta name="twitter:url" content="https://www.google.com">
+				<meta name="keywords">
+			</head></html>`,
+			expected: domain.MetaData{
+				Title:       "The Google Search",
+				Description: "Search the world's information.",
+				Canonical:   "https://www.google.com/",
+				Lang:        "en-GB",
+				OpenGraph: domain.SocialCard{
+					Type:  "website",
+					Title: "Google",
+					Image: "https://www.google.com/logo.png",
+				},
+				Twitter: domain.SocialCard{
+					Type: "summary",
+					URL:  "https://www.google.com",
+				},
+			},
+		},
+		{
+			name: "body",
+			content: `<html><head>
+				<link rel="stylesheet" href="/main.css">
+				<style>body { color: red; }</style>
+				<script src="/main.js"></script>
+			</head><body>
+				<h1>Search engine</h1>
+				<h2>Images</h2><h2>Maps</h2>
+				<h6>Footer</h6>
+				<p>Find what you are looking for.</p>
+				<script>var notWords = "one two three";</script>
+				<a href="/about">About</a>
+				<img src="/logo.png">
+			</body></html>`,
+			expected: domain.MetaData{
+				NumLinks:       1,
+				NumImages:      1,
+				NumHeadings:    [6]int{1, 2, 0, 0, 0, 1},
+				NumScripts:     2,
+				NumStylesheets: 2,
+				WordCount:      12,
+			},
+			links: []string{"/about"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			svcTest := newTestService(t)
+			defer svcTest.Close()
+
+			parsed, err := svcTest.svc.parseMetaData(context.Background(), strings.NewReader(test.content), nil)
+			require.NoError(t, err)
+
+			expected := test.expected
+			expected.LastFetched = parsed.metaData.LastFetched
+			expected.ByteSize = int64(len(test.content))
+			assert.Equal(t, expected, parsed.metaData)
+			assert.Equal(t, test.links, parsed.links)
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+)
+
+// ErrRunNotFound is returned when no run has the given id.
+var ErrRunNotFound = errors.New("run not found")
+
+// Runner fetches the sites with the Service within a domain.Run, whose queue is persisted as the sites are
+// fetched, so a run interrupted by a crash or a restart is resumed where it stopped.
+type Runner struct {
+	service *Service
+	repo    RunRepository
+	logger  *slog.Logger
+	now     func() time.Time
+}
+
+// NewRunner instantiates a new Runner fetching the sites with the given Service.
+func NewRunner(service *Service, repo RunRepository, logger *slog.Logger) *Runner {
+	return &Runner{
+		service: service,
+		repo:    repo,
+		logger:  logger,
+		now:     time.Now,
+	}
+}
+
+// Start records a new run of the sites, followed by the sites read from the input.
+func (r *Runner) Start(ctx context.Context, sites []string, input string) (domain.Run, error) {
+	run, err := domain.NewRun(sites, input, r.now())
+	if err != nil {
+		return domain.Run{}, fmt.Errorf("new run: %w", err)
+	}
+	if err := r.repo.SaveRun(ctx, run); err != nil {
+		return domain.Run{}, fmt.Errorf("save run: %w", err)
+	}
+	return run, nil
+}
+
+// Get returns the run of the given id, along with the number of its tasks by status. It returns ErrRunNotFound
+// if no run has this id.
+func (r *Runner) Get(ctx context.Context, id domain.RunID) (domain.Run, error) {
+	run, ok, err := r.repo.RunByID(ctx, id)
+	if err != nil {
+		return domain.Run{}, fmt.Errorf("get run: %w", err)
+	}
+	if !ok {
+		return domain.Run{}, fmt.Errorf("run %s: %w", id, ErrRunNotFound)
+	}
+	return run, nil
+}
+
+// Finish deletes the run of the given id along with its queue, once every site was fetched there is nothing
+// left to resume. A run with failed sites is kept, so their attempts and errors are not lost, it returns the
+// run and reports whether it was kept.
+func (r *Runner) Finish(ctx context.Context, id domain.RunID) (domain.Run, bool, error) {
+	run, err := r.Get(ctx, id)
+	if err != nil {
+		return domain.Run{}, false, err
+	}
+	if run.Tasks[domain.TaskFailed] > 0 {
+		return run, true, nil
+	}
+	if err := r.repo.DeleteRun(ctx, id); err != nil {
+		return domain.Run{}, false, fmt.Errorf("delete run: %w", err)
+	}
+	return run, false, nil
+}
+
+// Fetch fetches the sites of the run as FetchStream does, the requests being the sites of the run followed by
+// the sites read from its input. Every site is recorded in the queue of the run as pending once read or found
+// when crawling, then as in progress, and finally as done or failed along with its attempts and its error.
+// A resumed run first fetches the sites left pending or in progress, then skips the requests it already read.
+// The sites failing because the context is done are left in progress, so they are fetched once resumed.
+func (r *Runner) Fetch(ctx context.Context, run domain.Run, requests <-chan SiteRequest) (<-chan FetchResult, error) {
+	unfinished, err := r.repo.Tasks(ctx, run.ID, domain.TaskPending, domain.TaskInProgress)
+	if err != nil {
+		return nil, fmt.Errorf("get unfinished tasks: %w", err)
+	}
+
+	frontier := newFrontier(r.service.crawl)
+	if r.service.crawl != nil && run.Read > 0 {
+		// The crawl goes on within its limits, without queuing the sites the run already queued.
+		tasks, err := r.repo.Tasks(ctx, run.ID)
+		if err != nil {
+			return nil, fmt.Errorf("get tasks: %w", err)
+		}
+		for _, task := range tasks {
+			if u, err := url.Parse(task.Site); err == nil {
+				frontier.seen[domain.NormalizeURL(u).String()] = struct{}{}
+			}
+		}
+		frontier.popped = run.Tasks[domain.TaskDone] + run.Tasks[domain.TaskFailed]
+	}
+	for _, task := range unfinished {
+		frontier.queue = append(frontier.queue, newFetchTask(task))
+	}
+	frontier.run = &runQueue{ctx: ctx, repo: r.repo, run: run.ID, logger: r.logger}
+
+	return r.service.fetchFrontier(ctx, frontier, skipRequests(ctx, requests, run.Read)), nil
+}
+
+// newFetchTask returns the fetchTask of a task recorded in the queue of a run.
+func newFetchTask(task domain.RunTask) fetchTask {
+	// The sites read by the run are the seeds of their own crawl.
+	seed := task.Seed
+	if task.Depth == 0 {
+		seed = task.Site
+	}
+	u, err := url.Parse(seed)
+	if err != nil {
+		u = nil
+	}
+
+	return fetchTask{
+		request: SiteRequest{Site: task.Site, Method: task.Method, Header: http.Header(task.Header), Name: task.Name},
+		depth:   task.Depth,
+		seed:    u,
+		id:      task.ID,
+	}
+}
+
+// skipRequests returns the requests read from the channel after the first n, which are dropped.
+func skipRequests(ctx context.Context, requests <-chan SiteRequest, n int) <-chan SiteRequest {
+	if n == 0 {
+		return requests
+	}
+
+	skipped := make(chan SiteRequest)
+	go func() {
+		defer close(skipped)
+		for request := range requests {
+			if n > 0 {
+				n--
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case skipped <- request:
+			}
+		}
+	}()
+	return skipped
+}
+
+// runQueue records the tasks of a frontier in the queue of a run. Its methods do nothing on a nil runQueue,
+// so the frontier outside a run is left as is.
+type runQueue struct {
+	// ctx is the context of the fetch, the tasks are recorded even once it is done so the queue tells how far
+	// the run went.
+	ctx    context.Context
+	repo   RunRepository
+	run    domain.RunID
+	logger *slog.Logger
+}
+
+// enqueue records the tasks as pending, it returns them with the id of their domain.RunTask.
+func (q *runQueue) enqueue(tasks ...fetchTask) []fetchTask {
+	if q == nil || len(tasks) == 0 {
+		return tasks
+	}
+
+	runTasks := make([]domain.RunTask, 0, len(tasks))
+	for _, task := range tasks {
+		runTask := domain.RunTask{
+			Run:    q.run,
+			Site:   task.request.Site,
+			Method: task.request.Method,
+			Header: task.request.Header,
+			Name:   task.request.Name,
+			Depth:  task.depth,
+			Status: domain.TaskPending,
+		}
+		if task.depth > 0 && task.seed != nil {
+			runTask.Seed = task.seed.String()
+		}
+		runTasks = append(runTasks, runTask)
+	}
+
+	ids, err := q.repo.AddTasks(context.WithoutCancel(q.ctx), runTasks)
+	if err != nil {
+		q.logger.Error("Failed to queue the sites of the run.", "run", q.run, "error", err)
+		return tasks
+	}
+	for i := range tasks {
+		tasks[i].id = ids[i]
+	}
+	return tasks
+}
+
+// start records the task as in progress.
+func (q *runQueue) start(task fetchTask) {
+	q.update(task, domain.TaskInProgress, 0, nil)
+}
+
+// finish records the task as done or failed, along with its attempts and its error.
+func (q *runQueue) finish(fetched fetchedTask) {
+	status := domain.TaskDone
+	if fetched.result.Err != nil {
+		status = domain.TaskFailed
+		if q != nil && q.ctx.Err() != nil {
+			// The site was interrupted along with the run, it is fetched again once the run is resumed.
+			status = domain.TaskInProgress
+		}
+	}
+	q.update(fetched.task, status, fetched.result.Attempts, fetched.result.Err)
+}
+
+// update records the status of the task, its attempts are added to the ones of its domain.RunTask.
+func (q *runQueue) update(task fetchTask, status domain.TaskStatus, attempts int, err error) {
+	if q == nil || task.id == 0 {
+		return
+	}
+
+	var lastError string
+	if err != nil {
+		lastError = err.Error()
+	}
+	if err := q.repo.UpdateTask(context.WithoutCancel(q.ctx), task.id, status, attempts, lastError); err != nil {
+		q.logger.Error("Failed to update the queue of the run.", "run", q.run, "site", task.request.Site, "error", err)
+	}
+}
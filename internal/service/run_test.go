@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func newTestRunner(svcTest *serviceTest, now time.Time) (*Runner, *MockRunRepository) {
+	repo := NewMockRunRepository(svcTest.ctrl)
+	runner := NewRunner(svcTest.svc, repo, slog.Default())
+	runner.now = func() time.Time { return now }
+	return runner, repo
+}
+
+func TestRunner_Start(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svcTest := newTestService(t)
+	defer svcTest.Close()
+
+	now := time.Date(2024, time.March, 17, 14, 43, 0, 0, time.UTC)
+	runner, repo := newTestRunner(svcTest, now)
+
+	repo.EXPECT().SaveRun(gomock.Any(), gomock.Any()).Return(nil)
+	run, err := runner.Start(ctx, []string{"https://www.google.com"}, "sites.txt")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(run.ID.String(), "20240317T144300Z-"), run.ID)
+	assert.Equal(t, now, run.Started)
+	assert.Equal(t, []string{"https://www.google.com"}, run.Sites)
+	assert.Equal(t, "sites.txt", run.Input)
+
+	repo.EXPECT().RunByID(gomock.Any(), run.ID).Return(run, true, nil)
+	got, err := runner.Get(ctx, run.ID)
+	require.NoError(t, err)
+	assert.Equal(t, run, got)
+
+	repo.EXPECT().RunByID(gomock.Any(), domain.RunID("unknown")).Return(domain.Run{}, false, nil)
+	_, err = runner.Get(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrRunNotFound)
+
+	repo.EXPECT().RunByID(gomock.Any(), run.ID).Return(run, true, nil)
+	repo.EXPECT().DeleteRun(gomock.Any(), run.ID).Return(nil)
+	_, kept, err := runner.Finish(ctx, run.ID)
+	require.NoError(t, err)
+	assert.False(t, kept)
+
+	// The run with failed sites is kept along with their errors.
+	failed := run
+	failed.Tasks = map[domain.TaskStatus]int{domain.TaskDone: 1, domain.TaskFailed: 1}
+	repo.EXPECT().RunByID(gomock.Any(), run.ID).Return(failed, true, nil)
+	_, kept, err = runner.Finish(ctx, run.ID)
+	require.NoError(t, err)
+	assert.True(t, kept)
+}
+
+func TestRunner_Fetch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svcTest := newTestService(t)
+	defer svcTest.Close()
+
+	runner, repo := newTestRunner(svcTest, time.Now())
+
+	// The run was interrupted once the first site was fetched, while the second one was in progress.
+	run := domain.Run{
+		ID:    "20240317T144300Z-0a1b2c3d",
+		Read:  2,
+		Tasks: map[domain.TaskStatus]int{domain.TaskDone: 1, domain.TaskInProgress: 1},
+	}
+	interrupted := domain.RunTask{
+		ID:        2,
+		Run:       run.ID,
+		Site:      string(googlePage.ID),
+		Status:    domain.TaskInProgress,
+		LastError: "context canceled",
+	}
+	missing := "https://www.google.com/missing"
+
+	repo.EXPECT().
+		Tasks(gomock.Any(), run.ID, domain.TaskPending, domain.TaskInProgress).
+		Return([]domain.RunTask{interrupted}, nil)
+	// The interrupted site is fetched again.
+	gomock.InOrder(
+		repo.EXPECT().UpdateTask(gomock.Any(), interrupted.ID, domain.TaskInProgress, 0, "").Return(nil),
+		repo.EXPECT().UpdateTask(gomock.Any(), interrupted.ID, domain.TaskDone, 1, "").Return(nil),
+	)
+	svcTest.metaDataRepo.EXPECT().ByIDs(gomock.Any(), []domain.PageID{googlePage.ID}).Return(nil, nil)
+	svcTest.fetcher.EXPECT().
+		Fetch(gomock.Any(), FetchRequest{Site: interrupted.Site}).
+		Return(&FetchedItem{Page: googlePage, Content: io.NopCloser(strings.NewReader(htmlContent)), Attempts: 1}, nil)
+	svcTest.disk.EXPECT().NewPageWriter(gomock.Any(), gomock.Any(), gomock.Any()).Return(nopCloserWriter{io.Discard}, nil)
+	svcTest.metaDataRepo.EXPECT().Save(gomock.Any(), gomock.Any()).Return(nil)
+
+	// The sites read before the interruption are skipped, the next one is queued and fails.
+	gomock.InOrder(
+		repo.EXPECT().
+			AddTasks(gomock.Any(), []domain.RunTask{{Run: run.ID, Site: missing, Status: domain.TaskPending}}).
+			Return([]int64{3}, nil),
+		repo.EXPECT().UpdateTask(gomock.Any(), int64(3), domain.TaskInProgress, 0, "").Return(nil),
+		repo.EXPECT().
+			UpdateTask(gomock.Any(), int64(3), domain.TaskFailed, 2, "fetch site "+missing+": query page: 404 Not Found").
+			Return(nil),
+	)
+	svcTest.metaDataRepo.EXPECT().ByIDs(gomock.Any(), []domain.PageID{domain.PageID(missing)}).Return(nil, nil)
+	svcTest.fetcher.EXPECT().
+		Fetch(gomock.Any(), FetchRequest{Site: missing}).
+		Return(nil, &FetchError{Attempts: 2, Err: errors.New("404 Not Found")})
+
+	requests := make(chan SiteRequest, 3)
+	requests <- SiteRequest{Site: "https://www.google.com/search"}
+	requests <- SiteRequest{Site: interrupted.Site}
+	requests <- SiteRequest{Site: missing}
+	close(requests)
+
+	results, err := runner.Fetch(ctx, run, requests)
+	require.NoError(t, err)
+	statuses := map[string]FetchStatus{}
+	for result := range results {
+		statuses[result.Site] = result.Status
+	}
+	assert.Equal(t, map[string]FetchStatus{interrupted.Site: FetchStatusFetched, missing: FetchStatusFailed}, statuses)
+}
+
+func TestRunner_Fetch_Interrupted(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	svcTest := newTestService(t)
+	defer svcTest.Close()
+
+	runner, repo := newTestRunner(svcTest, time.Now())
+	run := domain.Run{ID: "20240317T144300Z-0a1b2c3d", Tasks: map[domain.TaskStatus]int{}}
+
+	// The site interrupted along with the run is left in progress, with the error telling why.
+	repo.EXPECT().Tasks(gomock.Any(), run.ID, domain.TaskPending, domain.TaskInProgress).Return(nil, nil)
+	gomock.InOrder(
+		repo.EXPECT().
+			AddTasks(gomock.Any(), []domain.RunTask{{Run: run.ID, Site: string(googlePage.ID), Status: domain.TaskPending}}).
+			Return([]int64{1}, nil),
+		repo.EXPECT().UpdateTask(gomock.Any(), int64(1), domain.TaskInProgress, 0, "").Return(nil),
+		repo.EXPECT().
+			UpdateTask(gomock.Any(), int64(1), domain.TaskInProgress, 0, gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ int64, _ domain.TaskStatus, _ int, lastError string) error {
+				assert.Contains(t, lastError, context.Canceled.Error())
+				return nil
+			}),
+	)
+	svcTest.metaDataRepo.EXPECT().ByIDs(gomock.Any(), []domain.PageID{googlePage.ID}).Return(nil, nil)
+	svcTest.fetcher.EXPECT().
+		Fetch(gomock.Any(), FetchRequest{Site: string(googlePage.ID)}).
+		DoAndReturn(func(ctx context.Context, _ FetchRequest) (*FetchedItem, error) {
+			cancel()
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+
+	requests := make(chan SiteRequest, 1)
+	requests <- SiteRequest{Site: string(googlePage.ID)}
+	close(requests)
+
+	results, err := runner.Fetch(ctx, run, requests)
+	require.NoError(t, err)
+	for range results {
+		// The results are drained until the fetch stops.
+	}
+}
+
+func TestRunner_Fetch_Batch(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svcTest := newTestService(t)
+	defer svcTest.Close()
+
+	runner, repo := newTestRunner(svcTest, time.Now())
+	run := domain.Run{ID: "20240317T144300Z-0a1b2c3d", Tasks: map[domain.TaskStatus]int{}}
+	sites := []string{"https://www.google.com/a", "https://www.google.com/b", "https://www.google.com/c"}
+
+	// The sites read at once are queued in a single batch.
+	repo.EXPECT().Tasks(gomock.Any(), run.ID, domain.TaskPending, domain.TaskInProgress).Return(nil, nil)
+	repo.EXPECT().
+		AddTasks(gomock.Any(), gomock.Len(len(sites))).
+		Return([]int64{1, 2, 3}, nil)
+	repo.EXPECT().UpdateTask(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	svcTest.metaDataRepo.EXPECT().ByIDs(gomock.Any(), gomock.Any()).Return(nil, nil).Times(len(sites))
+	svcTest.fetcher.EXPECT().
+		Fetch(gomock.Any(), gomock.Any()).
+		Return(nil, &FetchError{Attempts: 1, Err: errors.New("404 Not Found")}).
+		Times(len(sites))
+
+	requests := make(chan SiteRequest, len(sites))
+	for _, site := range sites {
+		requests <- SiteRequest{Site: site}
+	}
+	close(requests)
+
+	results, err := runner.Fetch(ctx, run, requests)
+	require.NoError(t, err)
+	var fetched int
+	for range results {
+		fetched++
+	}
+	assert.Equal(t, len(sites), fetched)
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+)
+
+// defaultSchedulerPoll is the longest time the Scheduler waits before reading the schedules again, so the
+// schedules saved while it runs are picked up.
+const defaultSchedulerPoll = time.Minute
+
+// ErrScheduleNotFound is returned when a site is not fetched on a schedule.
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// Scheduler fetches the sites periodically with the Service, as their domain.Schedule decides.
+type Scheduler struct {
+	service *Service
+	repo    ScheduleRepository
+	logger  *slog.Logger
+	poll    time.Duration
+	now     func() time.Time
+}
+
+// NewScheduler instantiates a new Scheduler fetching the sites with the given Service.
+func NewScheduler(service *Service, repo ScheduleRepository, logger *slog.Logger) *Scheduler {
+	return &Scheduler{
+		service: service,
+		repo:    repo,
+		logger:  logger,
+		poll:    defaultSchedulerPoll,
+		now:     time.Now,
+	}
+}
+
+// Add fetches the site every interval, or at the times of the cron expression, replacing its previous schedule.
+func (s *Scheduler) Add(ctx context.Context, site string, interval time.Duration, cron string) (domain.Schedule, error) {
+	schedule, err := domain.NewSchedule(site, interval, cron, s.now())
+	if err != nil {
+		return domain.Schedule{}, fmt.Errorf("new schedule of %s: %w", site, err)
+	}
+	if err := s.repo.SaveSchedule(ctx, schedule); err != nil {
+		return domain.Schedule{}, fmt.Errorf("save schedule: %w", err)
+	}
+	return schedule, nil
+}
+
+// Remove stops fetching the site periodically. It returns ErrScheduleNotFound if the site has no schedule.
+func (s *Scheduler) Remove(ctx context.Context, site string) error {
+	id, err := domain.NewPageID(site)
+	if err != nil {
+		return fmt.Errorf("invalid site: %w", err)
+	}
+	deleted, err := s.repo.DeleteSchedule(ctx, id)
+	if err != nil {
+		return fmt.Errorf("delete schedule: %w", err)
+	}
+	if !deleted {
+		return fmt.Errorf("schedule of %s: %w", site, ErrScheduleNotFound)
+	}
+	return nil
+}
+
+// List returns the schedule of every site fetched periodically, from the first due to the last.
+func (s *Scheduler) List(ctx context.Context) ([]domain.Schedule, error) {
+	schedules, err := s.repo.Schedules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// Run fetches the sites as they are due, until the context is done. The sites due together are fetched in
+// parallel, a site still being fetched when it is due again skips that run.
+// The FetchResult of every fetched site is sent on the returned channel as soon as it is fetched, the channel
+// is closed once the context is done and the fetches in flight are over.
+func (s *Scheduler) Run(ctx context.Context) <-chan FetchResult {
+	results := make(chan FetchResult)
+
+	go func() {
+		var wg sync.WaitGroup
+		defer func() {
+			wg.Wait()
+			close(results)
+		}()
+
+		var mu sync.Mutex
+		inFlight := make(map[domain.PageID]bool)
+		for {
+			mu.Lock()
+			due, wait := s.due(ctx, inFlight)
+			for _, schedule := range due {
+				inFlight[schedule.ID] = true
+			}
+			mu.Unlock()
+
+			if len(due) > 0 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					s.fetch(ctx, due, results)
+
+					mu.Lock()
+					defer mu.Unlock()
+					for _, schedule := range due {
+						delete(inFlight, schedule.ID)
+					}
+				}()
+			}
+
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+
+	return results
+}
+
+// due returns the schedules due to be fetched which are not in flight, and records their next run. It returns
+// how long to wait until the next schedule is due as well.
+func (s *Scheduler) due(ctx context.Context, inFlight map[domain.PageID]bool) ([]domain.Schedule, time.Duration) {
+	schedules, err := s.repo.Schedules(ctx)
+	if err != nil {
+		s.logger.Error("Failed to get the schedules.", "error", err)
+		return nil, s.poll
+	}
+
+	now := s.now()
+	wait := s.poll
+	var due []domain.Schedule
+	for _, schedule := range schedules {
+		if schedule.Due(now) {
+			lastRun := schedule.LastRun
+			if inFlight[schedule.ID] {
+				s.logger.Warn("Site still being fetched, the run is skipped.", "site", schedule.Site)
+			} else {
+				lastRun = now
+				due = append(due, schedule)
+			}
+
+			schedule.NextRun = schedule.Next(now)
+			if schedule.NextRun.IsZero() {
+				s.logger.Error("Schedule never runs again.", "site", schedule.Site, "cron", schedule.Cron)
+			}
+			if err := s.repo.UpdateScheduleRuns(ctx, schedule.ID, lastRun, schedule.NextRun); err != nil {
+				s.logger.Error("Failed to update the schedule.", "site", schedule.Site, "error", err)
+			}
+		}
+
+		if !schedule.NextRun.IsZero() {
+			wait = min(wait, schedule.NextRun.Sub(now))
+		}
+	}
+	return due, max(wait, 0)
+}
+
+// fetch fetches the sites of the schedules and sends their FetchResult on the results channel.
+func (s *Scheduler) fetch(ctx context.Context, schedules []domain.Schedule, results chan<- FetchResult) {
+	requests := make(chan SiteRequest, len(schedules))
+	for _, schedule := range schedules {
+		requests <- SiteRequest{Site: schedule.Site}
+	}
+	close(requests)
+
+	for result := range s.service.FetchStream(ctx, requests) {
+		select {
+		case <-ctx.Done():
+		case results <- result:
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func newTestScheduler(svcTest *serviceTest, now time.Time) (*Scheduler, *MockScheduleRepository) {
+	repo := NewMockScheduleRepository(svcTest.ctrl)
+	scheduler := NewScheduler(svcTest.svc, repo, slog.Default())
+	scheduler.now = func() time.Time { return now }
+	return scheduler, repo
+}
+
+func TestScheduler_Add(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	svcTest := newTestService(t)
+	defer svcTest.Close()
+
+	now := time.Date(2024, time.March, 17, 14, 43, 0, 0, time.UTC)
+	scheduler, repo := newTestScheduler(svcTest, now)
+
+	expected := domain.Schedule{
+		ID:      googlePage.ID,
+		Site:    "https://www.google.com",
+		Cron:    "@daily",
+		NextRun: time.Date(2024, time.March, 18, 0, 0, 0, 0, time.UTC),
+	}
+	repo.EXPECT().SaveSchedule(gomock.Any(), expected).Return(nil)
+	schedule, err := scheduler.Add(ctx, "https://www.google.com", 0, "@daily")
+	require.NoError(t, err)
+	assert.Equal(t, expected, schedule)
+
+	_, err = scheduler.Add(ctx, "https://www.google.com", 0, "61 * * * *")
+	assert.Error(t, err)
+
+	repo.EXPECT().DeleteSchedule(gomock.Any(), googlePage.ID).Return(true, nil)
+	require.NoError(t, scheduler.Remove(ctx, "https://www.google.com"))
+	repo.EXPECT().DeleteSchedule(gomock.Any(), googlePage.ID).Return(false, nil)
+	assert.ErrorIs(t, scheduler.Remove(ctx, "https://www.google.com"), ErrScheduleNotFound)
+}
+
+func TestScheduler_Run(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svcTest := newTestService(t)
+	defer svcTest.Close()
+
+	now := time.Date(2024, time.March, 17, 14, 43, 0, 0, time.UTC)
+	scheduler, repo := newTestScheduler(svcTest, now)
+	scheduler.poll = time.Millisecond
+
+	due := domain.Schedule{
+		ID:       googlePage.ID,
+		Site:     string(googlePage.ID),
+		Interval: time.Hour,
+		NextRun:  now.Add(-time.Minute),
+	}
+	later := domain.Schedule{
+		ID:       domain.PageID("https://www.google.com/about"),
+		Site:     "https://www.google.com/about",
+		Interval: time.Hour,
+		NextRun:  now.Add(time.Minute),
+	}
+	// The due site is fetched once, its next run is an interval away.
+	gomock.InOrder(
+		repo.EXPECT().Schedules(gomock.Any()).Return([]domain.Schedule{due, later}, nil),
+		repo.EXPECT().UpdateScheduleRuns(gomock.Any(), due.ID, now, now.Add(time.Hour)).Return(nil),
+	)
+	due.LastRun, due.NextRun = now, now.Add(time.Hour)
+	repo.EXPECT().Schedules(gomock.Any()).Return([]domain.Schedule{later, due}, nil).AnyTimes()
+
+	svcTest.metaDataRepo.EXPECT().
+		ByIDs(gomock.Any(), []domain.PageID{googlePage.ID}).
+		Return(nil, nil)
+	svcTest.fetcher.EXPECT().
+		Fetch(gomock.Any(), FetchRequest{Site: due.Site}).
+		Return(nil, errors.New("connection refused"))
+
+	results := scheduler.Run(ctx)
+	result := <-results
+	assert.Equal(t, due.Site, result.Site)
+	assert.Equal(t, FetchStatusFailed, result.Status)
+
+	cancel()
+	for range results {
+		t.Error("no other site is due")
+	}
+}
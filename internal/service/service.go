@@ -3,26 +3,104 @@ package service
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log/slog"
+	"time"
 
 	"github.com/gsiffert/fetch/internal/domain"
 )
 
-// Disk defines the interface to save the content of a WebPage.
+// ErrDisallowedByRobots is returned by the Fetcher when the robots.txt file of a host disallows a site.
+var ErrDisallowedByRobots = errors.New("disallowed by robots.txt")
+
+// PageWriter defines the interface to write the content of a WebPage.
+// The content is stored as an immutable snapshot once the writer is closed, the page itself is only replaced
+// by the snapshot once committed, so a failed fetch never leaves a partial page behind.
+type PageWriter interface {
+	io.WriteCloser
+	Snapshot() domain.SnapshotID
+	// Compression returns the compression the snapshot is stored with.
+	Compression() domain.Compression
+	// Commit replaces the page with the snapshot, it must be called once the writer is closed.
+	Commit() error
+	// Discard removes what was written so far, the page is left untouched. It is a no-op once committed.
+	Discard() error
+}
+
+// AssetWriter writes the content of an asset, which is stored once closed.
+type AssetWriter interface {
+	io.WriteCloser
+	// Discard removes what was written so far instead of storing it. It is a no-op once closed.
+	Discard() error
+}
+
+// Disk defines the interface to save the content of a WebPage and of its assets.
 type Disk interface {
-	NewPageWriter(ctx context.Context, name string) (io.WriteCloser, error)
+	// NewPageWriter returns the PageWriter of the page of the given name, fetched by the given Exchange.
+	NewPageWriter(ctx context.Context, name string, exchange Exchange) (PageWriter, error)
+	NewAssetWriter(ctx context.Context, name string) (AssetWriter, error)
+	RestoreSnapshot(ctx context.Context, name string, snapshot domain.SnapshotID) error
+	// OpenSnapshot returns the content of the snapshot of the page of the given name stored with the given
+	// compression, decompressed.
+	OpenSnapshot(ctx context.Context, name string, snapshot domain.SnapshotID, compression domain.Compression) (io.ReadCloser, error)
+	// PageLocation returns where the page of the given name is stored. The names hold the extension of the
+	// media type of the page, the snapshots of a page are stored with the same extension.
+	PageLocation(name string) string
+	// HasPage reports whether the page of the given name, stored by an earlier fetch, is still held. Only the
+	// pages held are requested conditionally, as nothing replaces them when they were not modified.
+	HasPage(ctx context.Context, name string) (bool, error)
+	// SaveNotModified records that the page of the given name was requested again by the given Exchange, and
+	// was not modified since its fetch at the given time.
+	SaveNotModified(ctx context.Context, name string, exchange Exchange, fetched time.Time) error
 }
 
-// Fetcher defines the interface to download a WebPage.
+// Fetcher defines the interface to download a WebPage and the assets it references.
 type Fetcher interface {
-	Fetch(ctx context.Context, site string) (*FetchedItem, error)
+	Fetch(ctx context.Context, request FetchRequest) (*FetchedItem, error)
+	// FetchAsset returns the content of an asset referenced by a page of the given site.
+	FetchAsset(ctx context.Context, site string, asset string) (io.ReadCloser, error)
 }
 
 // MetaDataRepository defines the interface to save and retrieve domain.MetaData.
 type MetaDataRepository interface {
 	ByIDs(ctx context.Context, ids []domain.PageID) ([]domain.MetaData, error)
+	HistoryByIDs(ctx context.Context, ids []domain.PageID) ([]domain.MetaData, error)
 	Save(ctx context.Context, metaData domain.MetaData) error
+	// ResolveAliases returns the id of the page each of the given ids is an alias of, in the same order.
+	ResolveAliases(ctx context.Context, ids []domain.PageID) ([]domain.PageID, error)
+	// SaveAlias makes the alias resolve to the page of the given id, an alias of itself is removed.
+	SaveAlias(ctx context.Context, alias domain.PageID, id domain.PageID) error
+}
+
+// ScheduleRepository defines the interface to save and retrieve the domain.Schedule of the sites fetched periodically.
+type ScheduleRepository interface {
+	// Schedules returns every domain.Schedule, from the first due to the last.
+	Schedules(ctx context.Context) ([]domain.Schedule, error)
+	// SaveSchedule saves the domain.Schedule, replacing the previous schedule of the page if any.
+	SaveSchedule(ctx context.Context, schedule domain.Schedule) error
+	// UpdateScheduleRuns records the last and the next run of the schedule of the page, if it still exists.
+	UpdateScheduleRuns(ctx context.Context, id domain.PageID, lastRun time.Time, nextRun time.Time) error
+	// DeleteSchedule removes the schedule of the page, it reports whether the page had one.
+	DeleteSchedule(ctx context.Context, id domain.PageID) (bool, error)
+}
+
+// RunRepository defines the interface to save and retrieve the domain.Run and the queue of their domain.RunTask.
+type RunRepository interface {
+	// SaveRun saves a new domain.Run.
+	SaveRun(ctx context.Context, run domain.Run) error
+	// RunByID returns the domain.Run of the given id along with the number of its tasks by status, it reports
+	// whether the run exists.
+	RunByID(ctx context.Context, id domain.RunID) (domain.Run, bool, error)
+	// AddTasks queues the tasks as pending, it returns their ids in the same order.
+	AddTasks(ctx context.Context, tasks []domain.RunTask) ([]int64, error)
+	// UpdateTask sets the status and the last error of the task, and adds the attempts to its count.
+	UpdateTask(ctx context.Context, id int64, status domain.TaskStatus, attempts int, lastError string) error
+	// Tasks returns the tasks of the run in one of the given statuses, every task when none is given, in the
+	// order they were queued.
+	Tasks(ctx context.Context, id domain.RunID, statuses ...domain.TaskStatus) ([]domain.RunTask, error)
+	// DeleteRun deletes the domain.Run of the given id along with its tasks.
+	DeleteRun(ctx context.Context, id domain.RunID) error
 }
 
 // Service implements the functionality exposed to the application.
@@ -31,14 +109,58 @@ type Service struct {
 	disk         Disk
 	logger       *slog.Logger
 	metaDataRepo MetaDataRepository
+
+	mirror   bool
+	crawl    *CrawlOptions
+	naming   domain.FileNaming
+	utf8Copy bool
+}
+
+// Option configures optional behaviours of the Service.
+type Option func(s *Service)
+
+// WithMirror makes the Service download the assets referenced by the pages, such as images, stylesheets
+// and scripts, and rewrite the saved pages to reference the local copies so they can be browsed offline.
+func WithMirror() Option {
+	return func(s *Service) {
+		s.mirror = true
+	}
+}
+
+// WithCrawl makes the Service follow the links of the fetched pages, within the limits of the options.
+func WithCrawl(opts CrawlOptions) Option {
+	return func(s *Service) {
+		s.crawl = &opts
+	}
+}
+
+// WithFileNaming makes the Service store the pages in the files named by the given FileNaming,
+// the pages are stored in flat files by default.
+func WithFileNaming(naming domain.FileNaming) Option {
+	return func(s *Service) {
+		s.naming = naming
+	}
+}
+
+// WithUTF8Copy makes the Service store a copy of the text pages which are not encoded in UTF-8, transcoded to
+// UTF-8 and stored next to the page.
+func WithUTF8Copy() Option {
+	return func(s *Service) {
+		s.utf8Copy = true
+	}
 }
 
 // New instantiate a new Service.
-func New(fetcher Fetcher, disk Disk, logger *slog.Logger, metaDataRepo MetaDataRepository) *Service {
-	return &Service{
+func New(fetcher Fetcher, disk Disk, logger *slog.Logger, metaDataRepo MetaDataRepository, opts ...Option) *Service {
+	s := &Service{
 		fetcher:      fetcher,
 		disk:         disk,
 		logger:       logger,
 		metaDataRepo: metaDataRepo,
+		naming:       domain.NamingFlat,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
@@ -2,9 +2,13 @@
 package service
 
 import (
+	"context"
 	"log/slog"
+	"sync"
 	"testing"
 
+	"github.com/gsiffert/fetch/internal/domain"
+
 	"go.uber.org/mock/gomock"
 )
 
@@ -15,13 +19,17 @@ type serviceTest struct {
 	fetcher      *MockFetcher
 	disk         *MockDisk
 	metaDataRepo *MockMetaDataRepository
+
+	// aliases holds the aliases of the repository, they are resolved and saved by the repository mock.
+	mu      sync.Mutex
+	aliases map[domain.PageID]domain.PageID
 }
 
 func (s *serviceTest) Close() {
 	s.ctrl.Finish()
 }
 
-func newTestService(t *testing.T) *serviceTest {
+func newTestService(t *testing.T, opts ...Option) *serviceTest {
 	t.Helper()
 
 	ctrl := gomock.NewController(t)
@@ -30,8 +38,48 @@ func newTestService(t *testing.T) *serviceTest {
 		fetcher:      NewMockFetcher(ctrl),
 		disk:         NewMockDisk(ctrl),
 		metaDataRepo: NewMockMetaDataRepository(ctrl),
+		aliases:      make(map[domain.PageID]domain.PageID),
 	}
+	// The pages are stored next to each other, under their name.
+	svcTest.disk.EXPECT().
+		PageLocation(gomock.Any()).
+		DoAndReturn(func(name string) string { return name }).
+		AnyTimes()
+	svcTest.metaDataRepo.EXPECT().
+		ResolveAliases(gomock.Any(), gomock.Any()).
+		DoAndReturn(svcTest.resolveAliases).
+		AnyTimes()
+	svcTest.metaDataRepo.EXPECT().
+		SaveAlias(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(svcTest.saveAlias).
+		AnyTimes()
 	slog.SetLogLoggerLevel(slog.Level(10)) // Disable the logs.
-	svcTest.svc = New(svcTest.fetcher, svcTest.disk, slog.Default(), svcTest.metaDataRepo)
+	svcTest.svc = New(svcTest.fetcher, svcTest.disk, slog.Default(), svcTest.metaDataRepo, opts...)
 	return svcTest
 }
+
+func (s *serviceTest) resolveAliases(_ context.Context, ids []domain.PageID) ([]domain.PageID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resolved := make([]domain.PageID, len(ids))
+	for i, id := range ids {
+		resolved[i] = id
+		if pageID, ok := s.aliases[id]; ok {
+			resolved[i] = pageID
+		}
+	}
+	return resolved, nil
+}
+
+func (s *serviceTest) saveAlias(_ context.Context, alias domain.PageID, id domain.PageID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if alias == id {
+		delete(s.aliases, alias)
+		return nil
+	}
+	s.aliases[alias] = id
+	return nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/gsiffert/fetch/internal/domain"
+)
+
+// ErrSnapshotNotFound is returned when a snapshot is not part of the history of a site.
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// RestoreSnapshot replaces the saved page of the site with the content of one of its past snapshots.
+// It returns ErrSnapshotNotFound if the snapshot does not belong to the history of the site.
+func (s *Service) RestoreSnapshot(ctx context.Context, site string, snapshot domain.SnapshotID) error {
+	ids, err := s.ResolveSites(ctx, site)
+	if err != nil {
+		return err
+	}
+
+	history, err := s.metaDataRepo.HistoryByIDs(ctx, ids)
+	if err != nil {
+		return fmt.Errorf("get history: %w", err)
+	}
+
+	var found *domain.MetaData
+	for i, metaData := range history {
+		if snapshot != "" && metaData.Snapshot == snapshot {
+			found = &history[i]
+			break
+		}
+	}
+	if found == nil {
+		return fmt.Errorf("snapshot %s of %s: %w", snapshot, site, ErrSnapshotNotFound)
+	}
+
+	// The page is restored where it is currently stored, with the extension of the media type of the snapshot.
+	last := history[len(history)-1]
+	fileLocation := strings.TrimSuffix(last.FileLocation, domain.Extension(last.ContentType)) + domain.Extension(found.ContentType)
+	if last.FileLocation == "" {
+		u, err := url.Parse(ids[0].String())
+		if err != nil {
+			return fmt.Errorf("parse page id: %w", err)
+		}
+		fileLocation = s.fileLocation(domain.NewPage(u), found.ContentType)
+	}
+
+	if err := s.disk.RestoreSnapshot(ctx, fileLocation, snapshot); err != nil {
+		return fmt.Errorf("restore snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// OpenPage returns the content of the last snapshot of the site, decompressed with the compression it was
+// stored with. It returns ErrSnapshotNotFound if the site was never fetched.
+func (s *Service) OpenPage(ctx context.Context, site string) (io.ReadCloser, error) {
+	ids, err := s.ResolveSites(ctx, site)
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := s.metaDataRepo.HistoryByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("get history: %w", err)
+	}
+
+	// The failed fetches are part of the history, without a snapshot.
+	for i := len(history) - 1; i >= 0; i-- {
+		if metaData := history[i]; metaData.Snapshot != "" {
+			content, err := s.disk.OpenSnapshot(ctx, metaData.FileLocation, metaData.Snapshot, metaData.Compression)
+			if err != nil {
+				return nil, fmt.Errorf("open snapshot: %w", err)
+			}
+			return content, nil
+		}
+	}
+	return nil, fmt.Errorf("page of %s: %w", site, ErrSnapshotNotFound)
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+func TestService_RestoreSnapshot(t *testing.T) {
+	t.Parallel()
+
+	history := []domain.MetaData{
+		{
+			ID:           "https://www.google.com/about",
+			Site:         "www.google.com/about",
+			Snapshot:     testSnapshot,
+			FileLocation: "google/about.html",
+		},
+		{
+			ID:           "https://www.google.com/about",
+			Site:         "www.google.com/about",
+			Snapshot:     domain.SnapshotID("document"),
+			FileLocation: "google/about.pdf",
+			ContentType:  domain.MediaTypePDF,
+		},
+	}
+
+	tests := []struct {
+		name       string
+		snapshot   domain.SnapshotID
+		setupMocks func(svcTest *serviceTest)
+		assertErr  assert.ErrorAssertionFunc
+	}{
+		{
+			name:     "HistoryByIDs failed",
+			snapshot: testSnapshot,
+			setupMocks: func(svcTest *serviceTest) {
+				svcTest.metaDataRepo.EXPECT().
+					HistoryByIDs(gomock.Any(), gomock.Any()).
+					Return(nil, errors.New("HistoryByIDs failed"))
+			},
+			assertErr: assert.Error,
+		},
+		{
+			name:     "unknown snapshot",
+			snapshot: domain.SnapshotID("unknown"),
+			setupMocks: func(svcTest *serviceTest) {
+				svcTest.metaDataRepo.EXPECT().
+					HistoryByIDs(gomock.Any(), gomock.Any()).
+					Return(history, nil)
+			},
+			assertErr: func(t assert.TestingT, err error, _ ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrSnapshotNotFound)
+			},
+		},
+		{
+			name:     "success",
+			snapshot: testSnapshot,
+			setupMocks: func(svcTest *serviceTest) {
+				svcTest.metaDataRepo.EXPECT().
+					HistoryByIDs(gomock.Any(), []domain.PageID{"https://www.google.com/about"}).
+					Return(history, nil)
+				// The page is now a PDF document, the HTML snapshot is restored with its own extension.
+				svcTest.disk.EXPECT().
+					RestoreSnapshot(gomock.Any(), "google/about.html", testSnapshot).
+					Return(nil)
+			},
+			assertErr: assert.NoError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			svcTest := newTestService(t)
+			defer svcTest.Close()
+
+			if test.setupMocks != nil {
+				test.setupMocks(svcTest)
+			}
+
+			err := svcTest.svc.RestoreSnapshot(ctx, "https://www.google.com/about", test.snapshot)
+			test.assertErr(t, err)
+		})
+	}
+}
+
+func TestService_OpenPage(t *testing.T) {
+	t.Parallel()
+
+	history := []domain.MetaData{
+		{
+			ID:       "https://www.google.com/about",
+			Snapshot: domain.SnapshotID("previous"),
+		},
+		{
+			ID:           "https://www.google.com/about",
+			Snapshot:     testSnapshot,
+			FileLocation: "google/about.html",
+			Compression:  domain.CompressionZstd,
+		},
+	}
+
+	tests := []struct {
+		name       string
+		setupMocks func(svcTest *serviceTest)
+		content    string
+		assertErr  assert.ErrorAssertionFunc
+	}{
+		{
+			name: "never fetched",
+			setupMocks: func(svcTest *serviceTest) {
+				svcTest.metaDataRepo.EXPECT().
+					HistoryByIDs(gomock.Any(), gomock.Any()).
+					Return(nil, nil)
+			},
+			assertErr: func(t assert.TestingT, err error, _ ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrSnapshotNotFound)
+			},
+		},
+		{
+			name: "OpenSnapshot failed",
+			setupMocks: func(svcTest *serviceTest) {
+				svcTest.metaDataRepo.EXPECT().
+					HistoryByIDs(gomock.Any(), gomock.Any()).
+					Return(history, nil)
+				svcTest.disk.EXPECT().
+					OpenSnapshot(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+					Return(nil, errors.New("OpenSnapshot failed"))
+			},
+			assertErr: assert.Error,
+		},
+		{
+			name: "success",
+			setupMocks: func(svcTest *serviceTest) {
+				svcTest.metaDataRepo.EXPECT().
+					HistoryByIDs(gomock.Any(), []domain.PageID{"https://www.google.com/about"}).
+					Return(history, nil)
+				// The last snapshot is read with the compression it was stored with.
+				svcTest.disk.EXPECT().
+					OpenSnapshot(gomock.Any(), "google/about.html", testSnapshot, domain.CompressionZstd).
+					Return(io.NopCloser(strings.NewReader("<html></html>")), nil)
+			},
+			content:   "<html></html>",
+			assertErr: assert.NoError,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			svcTest := newTestService(t)
+			defer svcTest.Close()
+
+			if test.setupMocks != nil {
+				test.setupMocks(svcTest)
+			}
+
+			page, err := svcTest.svc.OpenPage(ctx, "https://www.google.com/about")
+			test.assertErr(t, err)
+			if err != nil {
+				return
+			}
+			defer page.Close()
+			content, err := io.ReadAll(page)
+			assert.NoError(t, err)
+			assert.Equal(t, test.content, string(content))
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package sqlite
+
+import (
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+)
+
+// metaDataColumns lists the columns shared by the metadata and the fetch_history tables, besides the ID
+// of the page and the date of the fetch which are named differently in each table.
+var metaDataColumns = []string{
+	"site",
+	"num_links",
+	"num_images",
+	"snapshot",
+	"etag",
+	"last_modified",
+	"title",
+	"description",
+	"canonical",
+	"lang",
+	"og_type",
+	"og_title",
+	"og_description",
+	"og_image",
+	"og_url",
+	"twitter_card",
+	"twitter_title",
+	"twitter_description",
+	"twitter_image",
+	"twitter_url",
+	"num_h1",
+	"num_h2",
+	"num_h3",
+	"num_h4",
+	"num_h5",
+	"num_h6",
+	"num_scripts",
+	"num_stylesheets",
+	"word_count",
+	"byte_size",
+	"file_location",
+	"compression",
+	"content_type",
+	"charset",
+}
+
+// metaDataRow maps a domain.MetaData to the columns of the metadata and the fetch_history tables.
+type metaDataRow struct {
+	ID                 string    `db:"id"`
+	LastFetched        time.Time `db:"last_fetched"`
+	Site               string    `db:"site"`
+	NumLinks           int       `db:"num_links"`
+	NumImages          int       `db:"num_images"`
+	Snapshot           string    `db:"snapshot"`
+	ETag               string    `db:"etag"`
+	LastModified       string    `db:"last_modified"`
+	Title              string    `db:"title"`
+	Description        string    `db:"description"`
+	Canonical          string    `db:"canonical"`
+	Lang               string    `db:"lang"`
+	OpenGraphType      string    `db:"og_type"`
+	OpenGraphTitle     string    `db:"og_title"`
+	OpenGraphDesc      string    `db:"og_description"`
+	OpenGraphImage     string    `db:"og_image"`
+	OpenGraphURL       string    `db:"og_url"`
+	TwitterCard        string    `db:"twitter_card"`
+	TwitterTitle       string    `db:"twitter_title"`
+	TwitterDescription string    `db:"twitter_description"`
+	TwitterImage       string    `db:"twitter_image"`
+	TwitterURL         string    `db:"twitter_url"`
+	NumH1              int       `db:"num_h1"`
+	NumH2              int       `db:"num_h2"`
+	NumH3              int       `db:"num_h3"`
+	NumH4              int       `db:"num_h4"`
+	NumH5              int       `db:"num_h5"`
+	NumH6              int       `db:"num_h6"`
+	NumScripts         int       `db:"num_scripts"`
+	NumStylesheets     int       `db:"num_stylesheets"`
+	WordCount          int       `db:"word_count"`
+	ByteSize           int64     `db:"byte_size"`
+	FileLocation       string    `db:"file_location"`
+	Compression        string    `db:"compression"`
+	ContentType        string    `db:"content_type"`
+	Charset            string    `db:"charset"`
+}
+
+func newMetaDataRow(m domain.MetaData) metaDataRow {
+	return metaDataRow{
+		ID:                 m.ID.String(),
+		LastFetched:        m.LastFetched,
+		Site:               m.Site,
+		NumLinks:           m.NumLinks,
+		NumImages:          m.NumImages,
+		Snapshot:           m.Snapshot.String(),
+		ETag:               m.ETag,
+		LastModified:       m.LastModified,
+		Title:              m.Title,
+		Description:        m.Description,
+		Canonical:          m.Canonical,
+		Lang:               m.Lang,
+		OpenGraphType:      m.OpenGraph.Type,
+		OpenGraphTitle:     m.OpenGraph.Title,
+		OpenGraphDesc:      m.OpenGraph.Description,
+		OpenGraphImage:     m.OpenGraph.Image,
+		OpenGraphURL:       m.OpenGraph.URL,
+		TwitterCard:        m.Twitter.Type,
+		TwitterTitle:       m.Twitter.Title,
+		TwitterDescription: m.Twitter.Description,
+		TwitterImage:       m.Twitter.Image,
+		TwitterURL:         m.Twitter.URL,
+		NumH1:              m.NumHeadings[0],
+		NumH2:              m.NumHeadings[1],
+		NumH3:              m.NumHeadings[2],
+		NumH4:              m.NumHeadings[3],
+		NumH5:              m.NumHeadings[4],
+		NumH6:              m.NumHeadings[5],
+		NumScripts:         m.NumScripts,
+		NumStylesheets:     m.NumStylesheets,
+		WordCount:          m.WordCount,
+		ByteSize:           m.ByteSize,
+		FileLocation:       m.FileLocation,
+		Compression:        string(m.Compression),
+		ContentType:        m.ContentType,
+		Charset:            m.Charset,
+	}
+}
+
+func (r metaDataRow) toDomain() domain.MetaData {
+	return domain.MetaData{
+		ID:           domain.PageID(r.ID),
+		Site:         r.Site,
+		LastFetched:  r.LastFetched,
+		NumLinks:     r.NumLinks,
+		NumImages:    r.NumImages,
+		Snapshot:     domain.SnapshotID(r.Snapshot),
+		ETag:         r.ETag,
+		LastModified: r.LastModified,
+		Title:        r.Title,
+		Description:  r.Description,
+		Canonical:    r.Canonical,
+		Lang:         r.Lang,
+		OpenGraph: domain.SocialCard{
+			Type:        r.OpenGraphType,
+			Title:       r.OpenGraphTitle,
+			Description: r.OpenGraphDesc,
+			Image:       r.OpenGraphImage,
+			URL:         r.OpenGraphURL,
+		},
+		Twitter: domain.SocialCard{
+			Type:        r.TwitterCard,
+			Title:       r.TwitterTitle,
+			Description: r.TwitterDescription,
+			Image:       r.TwitterImage,
+			URL:         r.TwitterURL,
+		},
+		NumHeadings:    [6]int{r.NumH1, r.NumH2, r.NumH3, r.NumH4, r.NumH5, r.NumH6},
+		NumScripts:     r.NumScripts,
+		NumStylesheets: r.NumStylesheets,
+		WordCount:      r.WordCount,
+		ByteSize:       r.ByteSize,
+		FileLocation:   r.FileLocation,
+		Compression:    domain.Compression(r.Compression),
+		ContentType:    r.ContentType,
+		Charset:        r.Charset,
+	}
+}
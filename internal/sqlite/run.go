@@ -0,0 +1,208 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+// runRow maps a domain.Run to the columns of the runs table, the sites are encoded in JSON.
+type runRow struct {
+	ID      string    `db:"id"`
+	Started time.Time `db:"started"`
+	Sites   string    `db:"sites"`
+	Input   string    `db:"input"`
+}
+
+// taskRow maps a domain.RunTask to the columns of the run_tasks table, the header is encoded in JSON.
+type taskRow struct {
+	ID        int64  `db:"id"`
+	RunID     string `db:"run_id"`
+	Site      string `db:"site"`
+	Method    string `db:"method"`
+	Header    string `db:"header"`
+	Name      string `db:"name"`
+	Depth     int    `db:"depth"`
+	Seed      string `db:"seed"`
+	Status    string `db:"status"`
+	Attempts  int    `db:"attempts"`
+	LastError string `db:"last_error"`
+}
+
+// SaveRun saves a new domain.Run.
+func (r *MetaDataRepo) SaveRun(ctx context.Context, run domain.Run) error {
+	sites, err := json.Marshal(run.Sites)
+	if err != nil {
+		return fmt.Errorf("marshal sites: %w", err)
+	}
+	row := runRow{ID: run.ID.String(), Started: run.Started.UTC(), Sites: string(sites), Input: run.Input}
+	query := "INSERT INTO runs(id, started, sites, input) VALUES (:id, :started, :sites, :input)"
+	if _, err := r.db.NamedExecContext(ctx, query, row); err != nil {
+		return fmt.Errorf("exec context: %w", err)
+	}
+	return nil
+}
+
+// RunByID retrieves the domain.Run of the given id along with the number of its tasks by status, it reports
+// whether the run exists.
+func (r *MetaDataRepo) RunByID(ctx context.Context, id domain.RunID) (domain.Run, bool, error) {
+	var row runRow
+	err := r.db.GetContext(ctx, &row, "SELECT id, started, sites, input FROM runs WHERE id = ?", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.Run{}, false, nil
+	}
+	if err != nil {
+		return domain.Run{}, false, fmt.Errorf("get context: %w", err)
+	}
+
+	run := domain.Run{ID: domain.RunID(row.ID), Started: row.Started, Input: row.Input, Tasks: map[domain.TaskStatus]int{}}
+	if err := json.Unmarshal([]byte(row.Sites), &run.Sites); err != nil {
+		return domain.Run{}, false, fmt.Errorf("unmarshal sites: %w", err)
+	}
+
+	// The sites read by the run are the tasks it did not find when crawling.
+	query := "SELECT count(*) FROM run_tasks WHERE run_id = ? AND depth = 0"
+	if err := r.db.GetContext(ctx, &run.Read, query, id); err != nil {
+		return domain.Run{}, false, fmt.Errorf("count read sites: %w", err)
+	}
+
+	var counts []struct {
+		Status string `db:"status"`
+		Count  int    `db:"count"`
+	}
+	query = "SELECT status, count(*) AS count FROM run_tasks WHERE run_id = ? GROUP BY status"
+	if err := r.db.SelectContext(ctx, &counts, query, id); err != nil {
+		return domain.Run{}, false, fmt.Errorf("count tasks: %w", err)
+	}
+	for _, c := range counts {
+		run.Tasks[domain.TaskStatus(c.Status)] = c.Count
+	}
+	return run, true, nil
+}
+
+// AddTasks queues the tasks as pending in a single transaction, it returns their ids in the same order.
+func (r *MetaDataRepo) AddTasks(ctx context.Context, tasks []domain.RunTask) ([]int64, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	query := `
+	INSERT INTO run_tasks(run_id, site, method, header, name, depth, seed, status, attempts, last_error, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, 0, '', ?)
+`
+	now := time.Now().UTC()
+	ids := make([]int64, 0, len(tasks))
+	for _, task := range tasks {
+		var header []byte
+		if len(task.Header) > 0 {
+			if header, err = json.Marshal(task.Header); err != nil {
+				return nil, fmt.Errorf("marshal header: %w", err)
+			}
+		}
+		res, err := tx.ExecContext(
+			ctx, query,
+			task.Run, task.Site, task.Method, string(header), task.Name, task.Depth, task.Seed, domain.TaskPending, now,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("exec context: %w", err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return nil, fmt.Errorf("last insert id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return ids, nil
+}
+
+// UpdateTask sets the status and the last error of the task, and adds the attempts to its count.
+func (r *MetaDataRepo) UpdateTask(ctx context.Context, id int64, status domain.TaskStatus, attempts int, lastError string) error {
+	query := "UPDATE run_tasks SET status = ?, attempts = attempts + ?, last_error = ?, updated_at = ? WHERE id = ?"
+	if _, err := r.db.ExecContext(ctx, query, status, attempts, lastError, time.Now().UTC(), id); err != nil {
+		return fmt.Errorf("exec context: %w", err)
+	}
+	return nil
+}
+
+// Tasks retrieves the tasks of the run in one of the given statuses, every task when none is given, in the
+// order they were queued.
+func (r *MetaDataRepo) Tasks(ctx context.Context, id domain.RunID, statuses ...domain.TaskStatus) ([]domain.RunTask, error) {
+	query := `
+	SELECT id, run_id, site, method, header, name, depth, seed, status, attempts, last_error
+	FROM run_tasks
+	WHERE run_id = ?
+`
+	args := []any{id}
+	if len(statuses) > 0 {
+		var err error
+		query, args, err = sqlx.In(query+" AND status IN(?)", id, statuses)
+		if err != nil {
+			return nil, fmt.Errorf("build sql in query: %w", err)
+		}
+	}
+
+	var rows []taskRow
+	if err := r.db.SelectContext(ctx, &rows, query+" ORDER BY id", args...); err != nil {
+		return nil, fmt.Errorf("select context: %w", err)
+	}
+
+	tasks := make([]domain.RunTask, 0, len(rows))
+	for _, row := range rows {
+		task := domain.RunTask{
+			ID:        row.ID,
+			Run:       domain.RunID(row.RunID),
+			Site:      row.Site,
+			Method:    row.Method,
+			Name:      row.Name,
+			Depth:     row.Depth,
+			Seed:      row.Seed,
+			Status:    domain.TaskStatus(row.Status),
+			Attempts:  row.Attempts,
+			LastError: row.LastError,
+		}
+		if row.Header != "" {
+			if err := json.Unmarshal([]byte(row.Header), &task.Header); err != nil {
+				return nil, fmt.Errorf("unmarshal header of task %d: %w", row.ID, err)
+			}
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// DeleteRun deletes the domain.Run of the given id along with its tasks, in a single transaction.
+func (r *MetaDataRepo) DeleteRun(ctx context.Context, id domain.RunID) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM run_tasks WHERE run_id = ?", id); err != nil {
+		return fmt.Errorf("delete tasks: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM runs WHERE id = ?", id); err != nil {
+		return fmt.Errorf("delete run: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
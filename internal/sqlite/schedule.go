@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+)
+
+// scheduleRow maps a domain.Schedule to the columns of the schedules table.
+type scheduleRow struct {
+	ID       string        `db:"id"`
+	Site     string        `db:"site"`
+	Interval time.Duration `db:"interval_ns"`
+	Cron     string        `db:"cron"`
+	NextRun  time.Time     `db:"next_run"`
+	LastRun  time.Time     `db:"last_run"`
+}
+
+// Schedules retrieves every domain.Schedule, from the first due to the last.
+func (r *MetaDataRepo) Schedules(ctx context.Context) ([]domain.Schedule, error) {
+	var rows []scheduleRow
+	query := "SELECT id, site, interval_ns, cron, next_run, last_run FROM schedules ORDER BY next_run, id"
+	if err := r.db.SelectContext(ctx, &rows, query); err != nil {
+		return nil, fmt.Errorf("select context: %w", err)
+	}
+
+	schedules := make([]domain.Schedule, 0, len(rows))
+	for _, row := range rows {
+		schedules = append(schedules, domain.Schedule{
+			ID:       domain.PageID(row.ID),
+			Site:     row.Site,
+			Interval: row.Interval,
+			Cron:     row.Cron,
+			NextRun:  row.NextRun,
+			LastRun:  row.LastRun,
+		})
+	}
+	return schedules, nil
+}
+
+// SaveSchedule saves the domain.Schedule, replacing the previous schedule of the page if any.
+func (r *MetaDataRepo) SaveSchedule(ctx context.Context, s domain.Schedule) error {
+	query := `
+	INSERT INTO schedules(id, site, interval_ns, cron, next_run, last_run)
+	VALUES (:id, :site, :interval_ns, :cron, :next_run, :last_run)
+	ON CONFLICT(id) DO UPDATE SET
+		site = excluded.site,
+		interval_ns = excluded.interval_ns,
+		cron = excluded.cron,
+		next_run = excluded.next_run,
+		last_run = excluded.last_run
+`
+	row := scheduleRow{
+		ID:       s.ID.String(),
+		Site:     s.Site,
+		Interval: s.Interval,
+		Cron:     s.Cron,
+		NextRun:  s.NextRun.UTC(),
+		LastRun:  s.LastRun.UTC(),
+	}
+	if _, err := r.db.NamedExecContext(ctx, query, row); err != nil {
+		return fmt.Errorf("exec context: %w", err)
+	}
+	return nil
+}
+
+// UpdateScheduleRuns records the last and the next run of the schedule of the page, it does nothing if the
+// page has no schedule anymore.
+func (r *MetaDataRepo) UpdateScheduleRuns(ctx context.Context, id domain.PageID, lastRun time.Time, nextRun time.Time) error {
+	query := "UPDATE schedules SET last_run = ?, next_run = ? WHERE id = ?"
+	if _, err := r.db.ExecContext(ctx, query, lastRun.UTC(), nextRun.UTC(), id); err != nil {
+		return fmt.Errorf("exec context: %w", err)
+	}
+	return nil
+}
+
+// DeleteSchedule removes the schedule of the page, it reports whether the page had one.
+func (r *MetaDataRepo) DeleteSchedule(ctx context.Context, id domain.PageID) (bool, error) {
+	res, err := r.db.ExecContext(ctx, "DELETE FROM schedules WHERE id = ?", id)
+	if err != nil {
+		return false, fmt.Errorf("exec context: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("rows affected: %w", err)
+	}
+	return n > 0, nil
+}
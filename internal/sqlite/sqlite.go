@@ -4,6 +4,7 @@ package sqlite
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/gsiffert/fetch/internal/domain"
 	"github.com/jmoiron/sqlx"
@@ -21,6 +22,9 @@ func NewMetaDataRepo(ctx context.Context, dsn string) (*MetaDataRepo, error) {
 	if err != nil {
 		return nil, fmt.Errorf("open db: %w", err)
 	}
+	// The connections of a shared cache fail with "database table is locked" instead of waiting for each other,
+	// sqlite only has a single writer anyway so the queries wait for the single connection instead.
+	db.SetMaxOpenConns(1)
 
 	repo := &MetaDataRepo{db: db}
 	if err := repo.createTables(ctx); err != nil {
@@ -35,9 +39,11 @@ func (r *MetaDataRepo) Close() error {
 	return r.db.Close()
 }
 
-// This code will likely be removed in the future by using a migration tool.
-func (r *MetaDataRepo) createTables(ctx context.Context) error {
-	const query = `
+// migrations holds the statements creating and updating the schema of the database, in order.
+// The number of migrations applied to a database is stored in its user_version pragma,
+// so only the new migrations are applied when the repository is instantiated.
+var migrations = []string{
+	`
 	CREATE TABLE IF NOT EXISTS metadata (
 	    id VARCHAR(255) PRIMARY KEY,
 	    site VARCHAR(255) NOT NULL,
@@ -45,77 +51,355 @@ func (r *MetaDataRepo) createTables(ctx context.Context) error {
 	    num_links INT UNSIGNED NOT NULL,
 	    num_images INT UNSIGNED NOT NULL
 	)
-`
+`,
+	`
+	CREATE TABLE IF NOT EXISTS fetch_history (
+	    id INTEGER PRIMARY KEY AUTOINCREMENT,
+	    page_id VARCHAR(255) NOT NULL,
+	    site VARCHAR(255) NOT NULL,
+	    fetched_at DATETIME NOT NULL,
+	    num_links INT UNSIGNED NOT NULL,
+	    num_images INT UNSIGNED NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS fetch_history_page_id ON fetch_history(page_id, fetched_at);
 
-	_, err := r.db.ExecContext(ctx, query)
-	if err != nil {
-		return fmt.Errorf("create metadata table: %w", err)
+	-- Databases created before the history existed only know about the last fetch of each page,
+	-- we keep it as the first entry of the history.
+	INSERT INTO fetch_history(page_id, site, fetched_at, num_links, num_images)
+	SELECT id, site, last_fetched, num_links, num_images
+	FROM metadata
+	WHERE NOT EXISTS (SELECT 1 FROM fetch_history)
+`,
+	`
+	ALTER TABLE metadata ADD COLUMN snapshot VARCHAR(64) NOT NULL DEFAULT '';
+	ALTER TABLE fetch_history ADD COLUMN snapshot VARCHAR(64) NOT NULL DEFAULT ''
+`,
+	`
+	ALTER TABLE metadata ADD COLUMN etag VARCHAR(255) NOT NULL DEFAULT '';
+	ALTER TABLE metadata ADD COLUMN last_modified VARCHAR(255) NOT NULL DEFAULT '';
+	ALTER TABLE fetch_history ADD COLUMN etag VARCHAR(255) NOT NULL DEFAULT '';
+	ALTER TABLE fetch_history ADD COLUMN last_modified VARCHAR(255) NOT NULL DEFAULT ''
+`,
+	addColumns(
+		"title TEXT NOT NULL DEFAULT ''",
+		"description TEXT NOT NULL DEFAULT ''",
+		"canonical TEXT NOT NULL DEFAULT ''",
+		"lang VARCHAR(35) NOT NULL DEFAULT ''",
+		"og_type VARCHAR(255) NOT NULL DEFAULT ''",
+		"og_title TEXT NOT NULL DEFAULT ''",
+		"og_description TEXT NOT NULL DEFAULT ''",
+		"og_image TEXT NOT NULL DEFAULT ''",
+		"og_url TEXT NOT NULL DEFAULT ''",
+		"twitter_card VARCHAR(255) NOT NULL DEFAULT ''",
+		"twitter_title TEXT NOT NULL DEFAULT ''",
+		"twitter_description TEXT NOT NULL DEFAULT ''",
+		"twitter_image TEXT NOT NULL DEFAULT ''",
+		"twitter_url TEXT NOT NULL DEFAULT ''",
+		"num_h1 INT UNSIGNED NOT NULL DEFAULT 0",
+		"num_h2 INT UNSIGNED NOT NULL DEFAULT 0",
+		"num_h3 INT UNSIGNED NOT NULL DEFAULT 0",
+		"num_h4 INT UNSIGNED NOT NULL DEFAULT 0",
+		"num_h5 INT UNSIGNED NOT NULL DEFAULT 0",
+		"num_h6 INT UNSIGNED NOT NULL DEFAULT 0",
+		"num_scripts INT UNSIGNED NOT NULL DEFAULT 0",
+		"num_stylesheets INT UNSIGNED NOT NULL DEFAULT 0",
+		"word_count INT UNSIGNED NOT NULL DEFAULT 0",
+		"byte_size BIGINT UNSIGNED NOT NULL DEFAULT 0",
+	),
+	`
+	CREATE TABLE IF NOT EXISTS aliases (
+	    alias VARCHAR(255) PRIMARY KEY,
+	    page_id VARCHAR(255) NOT NULL
+	)
+`,
+	`
+	-- The pages fetched before the file naming existed have no file location, they are located by the naming
+	-- of the run, flat by default.
+	ALTER TABLE metadata ADD COLUMN file_location TEXT NOT NULL DEFAULT '';
+	ALTER TABLE fetch_history ADD COLUMN file_location TEXT NOT NULL DEFAULT ''
+`,
+	addColumns("compression TEXT NOT NULL DEFAULT ''"),
+	addColumns("content_type VARCHAR(255) NOT NULL DEFAULT ''") + `;
+
+	-- The file locations hold the extension of the media type of the pages, the pages fetched before were HTML pages.
+	UPDATE metadata SET file_location = file_location || '.html' WHERE file_location != '';
+	UPDATE fetch_history SET file_location = file_location || '.html' WHERE file_location != ''
+`,
+	addColumns("charset VARCHAR(64) NOT NULL DEFAULT ''"),
+	`
+	CREATE TABLE IF NOT EXISTS schedules (
+	    id VARCHAR(255) PRIMARY KEY,
+	    site VARCHAR(255) NOT NULL,
+	    interval_ns BIGINT NOT NULL DEFAULT 0,
+	    cron VARCHAR(255) NOT NULL DEFAULT '',
+	    next_run DATETIME NOT NULL,
+	    last_run DATETIME NOT NULL
+	)
+`,
+	`
+	CREATE TABLE IF NOT EXISTS runs (
+	    id VARCHAR(64) PRIMARY KEY,
+	    started DATETIME NOT NULL,
+	    sites TEXT NOT NULL DEFAULT '[]',
+	    input TEXT NOT NULL DEFAULT ''
+	);
+	CREATE TABLE IF NOT EXISTS run_tasks (
+	    id INTEGER PRIMARY KEY AUTOINCREMENT,
+	    run_id VARCHAR(64) NOT NULL,
+	    site TEXT NOT NULL,
+	    method VARCHAR(16) NOT NULL DEFAULT '',
+	    header TEXT NOT NULL DEFAULT '',
+	    name TEXT NOT NULL DEFAULT '',
+	    depth INT UNSIGNED NOT NULL DEFAULT 0,
+	    seed TEXT NOT NULL DEFAULT '',
+	    status VARCHAR(16) NOT NULL,
+	    attempts INT UNSIGNED NOT NULL DEFAULT 0,
+	    last_error TEXT NOT NULL DEFAULT '',
+	    updated_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS run_tasks_run_id ON run_tasks(run_id, status, id)
+`,
+	`
+	-- The ids of the pages fetched before the URLs were normalized are normalized by normalizePageIDs.
+`,
+}
+
+// dataMigrations holds the migrations which cannot be written in SQL, by schema version. They are applied
+// after the statements of their version, within the same transaction.
+var dataMigrations = map[int]func(context.Context, *sqlx.Tx) error{
+	13: normalizePageIDs,
+}
+
+// normalizePageIDs rewrites the ids of the pages to their normalized URL, as they are looked up since the URLs
+// are normalized. A page fetched again since under its normalized id keeps its latest metadata.
+func normalizePageIDs(ctx context.Context, tx *sqlx.Tx) error {
+	var ids []string
+	if err := tx.SelectContext(ctx, &ids, "SELECT id FROM metadata UNION SELECT page_id FROM fetch_history"); err != nil {
+		return fmt.Errorf("select page ids: %w", err)
 	}
 
+	for _, id := range ids {
+		normalized, err := domain.NewPageID(id)
+		if err != nil || string(normalized) == id {
+			// The ids which are not absolute URLs are left as is.
+			continue
+		}
+
+		statements := []string{
+			`DELETE FROM metadata WHERE id = :normalized
+			AND last_fetched < (SELECT last_fetched FROM metadata WHERE id = :id)`,
+			`DELETE FROM metadata WHERE id = :id AND EXISTS (SELECT 1 FROM metadata WHERE id = :normalized)`,
+			`UPDATE metadata SET id = :normalized WHERE id = :id`,
+			`UPDATE fetch_history SET page_id = :normalized WHERE page_id = :id`,
+		}
+		args := map[string]any{"id": id, "normalized": normalized}
+		for _, statement := range statements {
+			if _, err := tx.NamedExecContext(ctx, statement, args); err != nil {
+				return fmt.Errorf("normalize page id %s: %w", id, err)
+			}
+		}
+	}
 	return nil
 }
 
+// addColumns returns a migration adding the columns to both the metadata and the fetch_history tables.
+func addColumns(definitions ...string) string {
+	var statements []string
+	for _, table := range []string{"metadata", "fetch_history"} {
+		for _, definition := range definitions {
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, definition))
+		}
+	}
+	return strings.Join(statements, ";\n")
+}
+
+// This code will likely be removed in the future by using a migration tool.
+func (r *MetaDataRepo) createTables(ctx context.Context) error {
+	var version int
+	if err := r.db.GetContext(ctx, &version, "PRAGMA user_version"); err != nil {
+		return fmt.Errorf("get schema version: %w", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		if err := r.migrate(ctx, i+1, migrations[i]); err != nil {
+			return fmt.Errorf("migrate to version %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// migrate applies the migration and updates the schema version in a single transaction.
+func (r *MetaDataRepo) migrate(ctx context.Context, version int, migration string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, migration); err != nil {
+		return fmt.Errorf("exec migration: %w", err)
+	}
+	if dataMigration, ok := dataMigrations[version]; ok {
+		if err := dataMigration(ctx, tx); err != nil {
+			return fmt.Errorf("exec data migration: %w", err)
+		}
+	}
+
+	// The pragma does not support placeholders, the version is an integer so it is safe to format it.
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version)); err != nil {
+		return fmt.Errorf("set schema version: %w", err)
+	}
+
+	return tx.Commit()
+}
+
 // ByIDs retrieves a list od domain.MetaData matching the given ids.
 func (r *MetaDataRepo) ByIDs(ctx context.Context, ids []domain.PageID) ([]domain.MetaData, error) {
-	const baseQuery = `
-	SELECT id, site, last_fetched, num_links, num_images
+	baseQuery := fmt.Sprintf(`
+	SELECT id, last_fetched, %s
 	FROM metadata
 	WHERE id IN(?)
-`
+`, strings.Join(metaDataColumns, ", "))
 
 	query, args, err := sqlx.In(baseQuery, ids)
 	if err != nil {
 		return nil, fmt.Errorf("build sql in query: %w", err)
 	}
 
-	var items []domain.MetaData
-	rows, err := r.db.QueryContext(ctx, query, args...)
+	return r.query(ctx, query, args...)
+}
+
+// HistoryByIDs retrieves every fetch of the pages matching the given ids, from the oldest to the newest.
+func (r *MetaDataRepo) HistoryByIDs(ctx context.Context, ids []domain.PageID) ([]domain.MetaData, error) {
+	baseQuery := fmt.Sprintf(`
+	SELECT page_id AS id, fetched_at AS last_fetched, %s
+	FROM fetch_history
+	WHERE page_id IN(?)
+	ORDER BY page_id, fetched_at, id
+`, strings.Join(metaDataColumns, ", "))
+
+	query, args, err := sqlx.In(baseQuery, ids)
 	if err != nil {
-		return nil, fmt.Errorf("query context: %w", err)
+		return nil, fmt.Errorf("build sql in query: %w", err)
 	}
 
-	for rows.Next() {
-		var m domain.MetaData
-		err = rows.Scan(&m.ID, &m.Site, &m.LastFetched, &m.NumLinks, &m.NumImages)
-		if err != nil {
-			return nil, fmt.Errorf("scan row: %w", err)
-		}
-		items = append(items, m)
+	return r.query(ctx, query, args...)
+}
+
+// query runs a query selecting the columns of a metaDataRow and returns the matching domain.MetaData.
+func (r *MetaDataRepo) query(ctx context.Context, query string, args ...any) ([]domain.MetaData, error) {
+	var rows []metaDataRow
+	if err := r.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, fmt.Errorf("select context: %w", err)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows err: %w", err)
+	var items []domain.MetaData
+	for _, row := range rows {
+		items = append(items, row.toDomain())
 	}
 
 	return items, nil
 }
 
-// Save the domain.MetaData.
+// Save the domain.MetaData as the latest metadata of the page and append it to the page history.
 func (r *MetaDataRepo) Save(ctx context.Context, m domain.MetaData) error {
-	const query = `
-	INSERT INTO metadata(id, site, last_fetched, num_links, num_images)
-	VALUES (?, ?, ?, ?, ?)
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	updates := make([]string, len(metaDataColumns))
+	for i, column := range metaDataColumns {
+		updates[i] = fmt.Sprintf("%s = excluded.%s", column, column)
+	}
+
+	query := fmt.Sprintf(`
+	INSERT INTO metadata(id, last_fetched, %s)
+	VALUES (:id, :last_fetched, :%s)
 	ON CONFLICT(id) DO UPDATE SET
-		last_fetched = ?,
-		num_links = ?,
-		num_images = ?
-`
+		last_fetched = excluded.last_fetched,
+		%s
+`, strings.Join(metaDataColumns, ", "), strings.Join(metaDataColumns, ", :"), strings.Join(updates, ",\n\t\t"))
 
-	_, err := r.db.ExecContext(
-		ctx,
-		query,
-		m.ID,
-		m.Site,
-		m.LastFetched,
-		m.NumLinks,
-		m.NumImages,
-		m.LastFetched,
-		m.NumLinks,
-		m.NumImages,
-	)
-	if err != nil {
+	row := newMetaDataRow(m)
+	if _, err := tx.NamedExecContext(ctx, query, row); err != nil {
 		return fmt.Errorf("exec context: %w", err)
 	}
 
+	historyQuery := fmt.Sprintf(`
+	INSERT INTO fetch_history(page_id, fetched_at, %s)
+	VALUES (:id, :last_fetched, :%s)
+`, strings.Join(metaDataColumns, ", "), strings.Join(metaDataColumns, ", :"))
+
+	if _, err := tx.NamedExecContext(ctx, historyQuery, row); err != nil {
+		return fmt.Errorf("exec history context: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ResolveAliases returns the id of the page each of the given ids is an alias of, in the same order.
+// The ids which are not aliases are returned as is.
+func (r *MetaDataRepo) ResolveAliases(ctx context.Context, ids []domain.PageID) ([]domain.PageID, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In("SELECT alias, page_id FROM aliases WHERE alias IN(?)", ids)
+	if err != nil {
+		return nil, fmt.Errorf("build sql in query: %w", err)
+	}
+
+	var rows []struct {
+		Alias  string `db:"alias"`
+		PageID string `db:"page_id"`
+	}
+	if err := r.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, fmt.Errorf("select context: %w", err)
+	}
+
+	aliases := make(map[domain.PageID]domain.PageID, len(rows))
+	for _, row := range rows {
+		aliases[domain.PageID(row.Alias)] = domain.PageID(row.PageID)
+	}
+
+	resolved := make([]domain.PageID, len(ids))
+	for i, id := range ids {
+		resolved[i] = id
+		if pageID, ok := aliases[id]; ok {
+			resolved[i] = pageID
+		}
+	}
+	return resolved, nil
+}
+
+// SaveAlias makes the alias resolve to the page of the given id. An alias of itself is removed,
+// so the alias identifies its own page again.
+func (r *MetaDataRepo) SaveAlias(ctx context.Context, alias domain.PageID, id domain.PageID) error {
+	if alias == id {
+		if _, err := r.db.ExecContext(ctx, "DELETE FROM aliases WHERE alias = ?", alias); err != nil {
+			return fmt.Errorf("exec context: %w", err)
+		}
+		return nil
+	}
+
+	query := `
+	INSERT INTO aliases(alias, page_id)
+	VALUES (?, ?)
+	ON CONFLICT(alias) DO UPDATE SET page_id = excluded.page_id
+`
+	if _, err := r.db.ExecContext(ctx, query, alias, id); err != nil {
+		return fmt.Errorf("exec context: %w", err)
+	}
 	return nil
 }
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -30,13 +31,39 @@ func TestMetaDataRepo(t *testing.T) {
 			LastFetched: time.Now().UTC().Truncate(time.Second),
 			NumImages:   18,
 			NumLinks:    8,
+			Snapshot:    domain.SnapshotID("3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7"),
+			ETag:        `"33a64df551425fcc55e4d42a148795d9f25f89d4"`,
+			Title:       "Google",
+			Description: "Search the world's information.",
+			Canonical:   "https://www.google.com/",
+			Lang:        "en",
+			OpenGraph: domain.SocialCard{
+				Type:  "website",
+				Title: "Google",
+				Image: "https://www.google.com/logo.png",
+			},
+			Twitter: domain.SocialCard{
+				Type:        "summary",
+				Description: "Search engine",
+				URL:         "https://www.google.com",
+			},
+			NumHeadings:    [6]int{1, 2, 3, 0, 0, 1},
+			NumScripts:     6,
+			NumStylesheets: 2,
+			WordCount:      120,
+			ByteSize:       52341,
+			FileLocation:   "www.google.com-d0e196a0c25d35dd.html",
+			ContentType:    domain.MediaTypeHTML,
+			Charset:        "utf-8",
 		},
 		{
-			ID:          domain.PageID("https://wwww.google.com/abount"),
-			Site:        "www.google.com/about",
-			LastFetched: time.Now().UTC().Truncate(time.Second),
-			NumImages:   35,
-			NumLinks:    23,
+			ID:           domain.PageID("https://wwww.google.com/abount"),
+			Site:         "www.google.com/about",
+			LastFetched:  time.Now().UTC().Truncate(time.Second),
+			NumImages:    35,
+			NumLinks:     23,
+			Snapshot:     domain.SnapshotID("b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"),
+			LastModified: "Wed, 21 Oct 2015 07:28:00 GMT",
 		},
 	}
 
@@ -52,4 +79,309 @@ func TestMetaDataRepo(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, records, fetchedRecords)
 	})
+
+	refetched := records[0]
+	refetched.LastFetched = refetched.LastFetched.Add(time.Hour)
+	refetched.NumLinks = 12
+	refetched.Title = "Google Search"
+	refetched.WordCount = 98
+	refetched.Snapshot = domain.SnapshotID("7d865e959b2466918c9863afca942d0fb89d7c9ac0c99bafc3749504ded97730")
+
+	t.Run("save metadata again", func(t *testing.T) {
+		err := repo.Save(ctx, refetched)
+		require.NoError(t, err)
+	})
+
+	t.Run("retrieve latest", func(t *testing.T) {
+		fetchedRecords, err := repo.ByIDs(ctx, []domain.PageID{records[0].ID})
+		require.NoError(t, err)
+		assert.Equal(t, []domain.MetaData{refetched}, fetchedRecords)
+	})
+
+	t.Run("retrieve history", func(t *testing.T) {
+		fetchedRecords, err := repo.HistoryByIDs(ctx, []domain.PageID{records[0].ID})
+		require.NoError(t, err)
+		assert.Equal(t, []domain.MetaData{records[0], refetched}, fetchedRecords)
+	})
+}
+
+func TestMetaDataRepo_Migrate(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dsn := "file:test_migrate.sqlite?cache=shared&mode=memory"
+
+	// We keep a connection open so the in memory database survives between the repositories.
+	db, err := sqlx.Open("sqlite3", dsn)
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+
+	// The schema as it was before the migrations were introduced.
+	lastFetched := time.Now().UTC().Truncate(time.Second)
+	_, err = db.ExecContext(ctx, migrations[0])
+	require.NoError(t, err)
+	_, err = db.ExecContext(
+		ctx,
+		"INSERT INTO metadata(id, site, last_fetched, num_links, num_images) VALUES (?, ?, ?, ?, ?)",
+		"https://www.google.com", "www.google.com", lastFetched, 4, 2,
+	)
+	require.NoError(t, err)
+
+	repo, err := NewMetaDataRepo(ctx, dsn)
+	require.NoError(t, err)
+	defer func() {
+		err := repo.Close()
+		require.NoError(t, err)
+	}()
+
+	expected := []domain.MetaData{
+		{
+			ID:          domain.PageID("https://www.google.com/"),
+			Site:        "www.google.com",
+			LastFetched: lastFetched,
+			NumLinks:    4,
+			NumImages:   2,
+		},
+	}
+
+	fetchedRecords, err := repo.HistoryByIDs(ctx, []domain.PageID{expected[0].ID})
+	require.NoError(t, err)
+	assert.Equal(t, expected, fetchedRecords)
+
+	var version int
+	err = db.GetContext(ctx, &version, "PRAGMA user_version")
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations), version)
+}
+
+func TestMetaDataRepo_Migrate_NormalizePageIDs(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dsn := "file:test_migrate_normalize.sqlite?cache=shared&mode=memory"
+
+	// We keep a connection open so the in memory database survives between the repositories.
+	db, err := sqlx.Open("sqlite3", dsn)
+	require.NoError(t, err)
+	defer func() {
+		err := db.Close()
+		require.NoError(t, err)
+	}()
+
+	// The schema as it was before the ids were normalized.
+	for i, migration := range migrations[:12] {
+		_, err = db.ExecContext(ctx, migration)
+		require.NoError(t, err, "migration %d", i+1)
+	}
+	_, err = db.ExecContext(ctx, "PRAGMA user_version = 12")
+	require.NoError(t, err)
+
+	before := time.Now().UTC().Truncate(time.Second).Add(-time.Hour)
+	after := before.Add(time.Minute)
+	insert := func(id string, lastFetched time.Time, numLinks int) {
+		_, err := db.ExecContext(
+			ctx,
+			"INSERT INTO metadata(id, site, last_fetched, num_links, num_images) VALUES (?, ?, ?, ?, 0)",
+			id, id, lastFetched, numLinks,
+		)
+		require.NoError(t, err)
+		_, err = db.ExecContext(
+			ctx,
+			"INSERT INTO fetch_history(page_id, site, fetched_at, num_links, num_images) VALUES (?, ?, ?, ?, 0)",
+			id, id, lastFetched, numLinks,
+		)
+		require.NoError(t, err)
+	}
+	insert("https://a.com", before, 1)
+	// The page was fetched again once the URLs were normalized.
+	insert("HTTP://B.com:80/page#top", before, 2)
+	insert("http://b.com/page", after, 3)
+
+	repo, err := NewMetaDataRepo(ctx, dsn)
+	require.NoError(t, err)
+	defer func() {
+		err := repo.Close()
+		require.NoError(t, err)
+	}()
+
+	pageA, pageB := domain.PageID("https://a.com/"), domain.PageID("http://b.com/page")
+	latest, err := repo.ByIDs(ctx, []domain.PageID{pageA, pageB, "https://a.com"})
+	require.NoError(t, err)
+	require.Len(t, latest, 2)
+	numLinks := map[domain.PageID]int{}
+	for _, m := range latest {
+		numLinks[m.ID] = m.NumLinks
+	}
+	assert.Equal(t, map[domain.PageID]int{pageA: 1, pageB: 3}, numLinks)
+
+	history, err := repo.HistoryByIDs(ctx, []domain.PageID{pageB})
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, 2, history[0].NumLinks)
+	assert.Equal(t, 3, history[1].NumLinks)
+}
+
+func TestMetaDataRepo_Aliases(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo, err := NewMetaDataRepo(ctx, "file:test_aliases.sqlite?cache=shared&mode=memory")
+	require.NoError(t, err)
+	defer func() {
+		err := repo.Close()
+		require.NoError(t, err)
+	}()
+
+	page := domain.PageID("https://www.google.com/")
+	alias := domain.PageID("http://google.com/")
+	other := domain.PageID("https://www.google.com/about")
+
+	resolved, err := repo.ResolveAliases(ctx, []domain.PageID{alias, other})
+	require.NoError(t, err)
+	assert.Equal(t, []domain.PageID{alias, other}, resolved)
+
+	err = repo.SaveAlias(ctx, alias, other)
+	require.NoError(t, err)
+	err = repo.SaveAlias(ctx, alias, page)
+	require.NoError(t, err)
+
+	resolved, err = repo.ResolveAliases(ctx, []domain.PageID{alias, other})
+	require.NoError(t, err)
+	assert.Equal(t, []domain.PageID{page, other}, resolved)
+
+	// The alias is removed once it identifies its own page.
+	err = repo.SaveAlias(ctx, alias, alias)
+	require.NoError(t, err)
+
+	resolved, err = repo.ResolveAliases(ctx, []domain.PageID{alias})
+	require.NoError(t, err)
+	assert.Equal(t, []domain.PageID{alias}, resolved)
+}
+
+func TestMetaDataRepo_Schedules(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo, err := NewMetaDataRepo(ctx, "file:test_schedules.sqlite?cache=shared&mode=memory")
+	require.NoError(t, err)
+	defer func() {
+		err := repo.Close()
+		require.NoError(t, err)
+	}()
+
+	now := time.Date(2024, time.March, 17, 14, 43, 0, 0, time.UTC)
+	hourly := domain.Schedule{
+		ID:       domain.PageID("https://www.google.com/"),
+		Site:     "https://www.google.com",
+		Interval: time.Hour,
+		NextRun:  now.Add(time.Hour),
+	}
+	daily := domain.Schedule{
+		ID:      domain.PageID("https://www.google.com/about"),
+		Site:    "https://www.google.com/about",
+		Cron:    "@daily",
+		NextRun: now.Add(10 * time.Hour),
+		LastRun: now,
+	}
+	require.NoError(t, repo.SaveSchedule(ctx, daily))
+	require.NoError(t, repo.SaveSchedule(ctx, hourly))
+
+	schedules, err := repo.Schedules(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Schedule{hourly, daily}, schedules)
+
+	// The runs are only updated while the schedule exists.
+	require.NoError(t, repo.UpdateScheduleRuns(ctx, hourly.ID, now, now.Add(20*time.Hour)))
+	deleted, err := repo.DeleteSchedule(ctx, daily.ID)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	require.NoError(t, repo.UpdateScheduleRuns(ctx, daily.ID, now, now))
+	deleted, err = repo.DeleteSchedule(ctx, daily.ID)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+
+	hourly.LastRun = now
+	hourly.NextRun = now.Add(20 * time.Hour)
+	schedules, err = repo.Schedules(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Schedule{hourly}, schedules)
+}
+
+func TestMetaDataRepo_Runs(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo, err := NewMetaDataRepo(ctx, "file:test_runs.sqlite?cache=shared&mode=memory")
+	require.NoError(t, err)
+	defer func() {
+		err := repo.Close()
+		require.NoError(t, err)
+	}()
+
+	_, ok, err := repo.RunByID(ctx, "unknown")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	run := domain.Run{
+		ID:      "20240317T144300Z-0a1b2c3d",
+		Started: time.Date(2024, time.March, 17, 14, 43, 0, 0, time.UTC),
+		Sites:   []string{"https://www.google.com"},
+		Input:   "sites.jsonl",
+		Tasks:   map[domain.TaskStatus]int{},
+	}
+	require.NoError(t, repo.SaveRun(ctx, run))
+
+	tasks := []domain.RunTask{
+		{Run: run.ID, Site: "https://www.google.com", Status: domain.TaskPending},
+		{
+			Run:    run.ID,
+			Site:   "https://www.google.com/search",
+			Method: "POST",
+			Header: map[string][]string{"Content-Type": {"application/json"}},
+			Name:   "search",
+			Status: domain.TaskPending,
+		},
+		{Run: run.ID, Site: "https://www.google.com/about", Depth: 1, Seed: "https://www.google.com", Status: domain.TaskPending},
+	}
+	ids, err := repo.AddTasks(ctx, tasks)
+	require.NoError(t, err)
+	require.Len(t, ids, 3)
+	for i := range tasks {
+		tasks[i].ID = ids[i]
+	}
+	assert.Less(t, ids[0], ids[1])
+	assert.Less(t, ids[1], ids[2])
+
+	require.NoError(t, repo.UpdateTask(ctx, ids[0], domain.TaskDone, 1, ""))
+	require.NoError(t, repo.UpdateTask(ctx, ids[1], domain.TaskInProgress, 0, ""))
+	require.NoError(t, repo.UpdateTask(ctx, ids[1], domain.TaskFailed, 3, "503 Service Unavailable"))
+	require.NoError(t, repo.UpdateTask(ctx, ids[2], domain.TaskInProgress, 0, ""))
+	tasks[0].Status, tasks[0].Attempts = domain.TaskDone, 1
+	tasks[1].Status, tasks[1].Attempts, tasks[1].LastError = domain.TaskFailed, 3, "503 Service Unavailable"
+	tasks[2].Status = domain.TaskInProgress
+
+	all, err := repo.Tasks(ctx, run.ID)
+	require.NoError(t, err)
+	assert.Equal(t, tasks, all)
+	unfinished, err := repo.Tasks(ctx, run.ID, domain.TaskPending, domain.TaskInProgress)
+	require.NoError(t, err)
+	assert.Equal(t, tasks[2:], unfinished)
+
+	run.Read = 2
+	run.Tasks = map[domain.TaskStatus]int{domain.TaskDone: 1, domain.TaskFailed: 1, domain.TaskInProgress: 1}
+	saved, ok, err := repo.RunByID(ctx, run.ID)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, run, saved)
+
+	require.NoError(t, repo.DeleteRun(ctx, run.ID))
+	_, ok, err = repo.RunByID(ctx, run.ID)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	all, err = repo.Tasks(ctx, run.ID)
+	require.NoError(t, err)
+	assert.Empty(t, all)
 }
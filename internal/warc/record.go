@@ -0,0 +1,293 @@
+package warc
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// version is the version of the WARC format written, the records of the previous versions are read as well.
+	version = "WARC/1.1"
+	// maxHeaderLineSize is the maximum size of a line of the header of a record.
+	maxHeaderLineSize = 64 * 1024
+)
+
+// The types of the records.
+const (
+	TypeWarcinfo = "warcinfo"
+	TypeRequest  = "request"
+	TypeResponse = "response"
+	TypeRevisit  = "revisit"
+	TypeResource = "resource"
+	TypeMetadata = "metadata"
+)
+
+// The names of the fields of the header of the records.
+const (
+	FieldType          = "WARC-Type"
+	FieldRecordID      = "WARC-Record-ID"
+	FieldDate          = "WARC-Date"
+	FieldTargetURI     = "WARC-Target-URI"
+	FieldConcurrentTo  = "WARC-Concurrent-To"
+	FieldWarcinfoID    = "WARC-Warcinfo-ID"
+	FieldPayloadDigest = "WARC-Payload-Digest"
+	FieldProfile       = "WARC-Profile"
+	FieldRefersTo      = "WARC-Refers-To"
+	FieldRefersToURI   = "WARC-Refers-To-Target-URI"
+	FieldRefersToDate  = "WARC-Refers-To-Date"
+	FieldFilename      = "WARC-Filename"
+	FieldContentType   = "Content-Type"
+	FieldContentLength = "Content-Length"
+)
+
+const (
+	revisitProfile       = "http://netpreserve.org/warc/1.1/revisit/identical-payload-digest"
+	notModifiedProfile   = "http://netpreserve.org/warc/1.1/revisit/server-not-modified"
+	httpRequestMIMEType  = "application/http;msgtype=request"
+	httpResponseMIMEType = "application/http;msgtype=response"
+	warcFieldsMIMEType   = "application/warc-fields"
+)
+
+// Field is a named field of the header of a record.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Header of a record, the fields are kept in order.
+type Header []Field
+
+// Get returns the value of the first field of the given name, the names are case insensitive.
+func (h Header) Get(name string) string {
+	for _, field := range h {
+		if strings.EqualFold(field.Name, name) {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// Record of a WARC file.
+type Record struct {
+	Header Header
+	// Content is the block of the record, it is only readable until the next record is read.
+	Content io.Reader
+}
+
+// Type returns the type of the record, such as TypeResponse.
+func (r *Record) Type() string {
+	return r.Header.Get(FieldType)
+}
+
+// ID returns the ID of the record.
+func (r *Record) ID() string {
+	return r.Header.Get(FieldRecordID)
+}
+
+// TargetURI returns the URI of the resource the record is about.
+func (r *Record) TargetURI() string {
+	return r.Header.Get(FieldTargetURI)
+}
+
+// Date returns when the content of the record was captured.
+func (r *Record) Date() (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, r.Header.Get(FieldDate))
+}
+
+// ContentLength returns the length of the block of the record.
+func (r *Record) ContentLength() (int64, error) {
+	return strconv.ParseInt(r.Header.Get(FieldContentLength), 10, 64)
+}
+
+// Payload returns the content of the resource the record is about: the body of the HTTP response of a
+// response record, or the block of a resource record. The other records have no payload.
+func (r *Record) Payload() (io.Reader, error) {
+	switch r.Type() {
+	case TypeResource:
+		return r.Content, nil
+	case TypeResponse:
+		resp, err := r.Response()
+		if err != nil {
+			return nil, err
+		}
+		return resp.Body, nil
+	default:
+		return nil, fmt.Errorf("%s record has no payload", r.Type())
+	}
+}
+
+// Response returns the HTTP response held by a response record, its body is the payload of the record. The
+// revisit records only hold the headers of the response, its body is empty.
+func (r *Record) Response() (*http.Response, error) {
+	if r.Type() != TypeResponse && r.Type() != TypeRevisit {
+		return nil, fmt.Errorf("%s record has no http response", r.Type())
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(r.Content), nil)
+	if err != nil {
+		return nil, fmt.Errorf("read http response: %w", err)
+	}
+	return resp, nil
+}
+
+// newRecordID returns a new unique ID for a record.
+func newRecordID() string {
+	var uuid [16]byte
+	_, _ = rand.Read(uuid[:])
+	uuid[6] = (uuid[6] & 0x0f) | 0x40 // Version 4.
+	uuid[8] = (uuid[8] & 0x3f) | 0x80 // Variant RFC 4122.
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
+
+// formatDate formats the date of a record.
+func formatDate(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Writer writes WARC records. When compressed, each record is a gzip member of its own, as expected by the
+// tools reading the records at random offsets.
+type Writer struct {
+	w        io.Writer
+	compress bool
+}
+
+// NewWriter returns a Writer writing the records to w.
+func NewWriter(w io.Writer, compress bool) *Writer {
+	return &Writer{w: w, compress: compress}
+}
+
+// WriteRecord writes a record of the given header, with length bytes read from the block. The Content-Length
+// field is added to the header.
+func (w *Writer) WriteRecord(header Header, block io.Reader, length int64) error {
+	out := w.w
+	var gz *gzip.Writer
+	if w.compress {
+		gz = gzip.NewWriter(w.w)
+		out = gz
+	}
+	buffered := bufio.NewWriter(out)
+
+	fmt.Fprintf(buffered, "%s\r\n", version)
+	for _, field := range header {
+		fmt.Fprintf(buffered, "%s: %s\r\n", field.Name, field.Value)
+	}
+	fmt.Fprintf(buffered, "%s: %d\r\n\r\n", FieldContentLength, length)
+	if _, err := io.CopyN(buffered, block, length); err != nil {
+		return fmt.Errorf("write block: %w", err)
+	}
+	buffered.WriteString("\r\n\r\n")
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("write record: %w", err)
+	}
+
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("compress record: %w", err)
+		}
+	}
+	return nil
+}
+
+// Reader reads the records of a WARC file, compressed or not.
+type Reader struct {
+	r       *bufio.Reader
+	content io.Reader
+}
+
+// NewReader returns a Reader reading the records from r, the gzip compression is detected.
+func NewReader(r io.Reader) (*Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		// The gzip members of the records are read as a single stream.
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("open gzip: %w", err)
+		}
+		buffered = bufio.NewReader(gz)
+	}
+	return &Reader{r: buffered}, nil
+}
+
+// Next returns the next record, or io.EOF once every record is read. The content of the previous record
+// is skipped.
+func (r *Reader) Next() (*Record, error) {
+	if r.content != nil {
+		if _, err := io.Copy(io.Discard, r.content); err != nil {
+			return nil, fmt.Errorf("skip content: %w", err)
+		}
+		r.content = nil
+	}
+
+	// The records are separated by empty lines.
+	line, err := r.readLine()
+	for err == nil && line == "" {
+		line, err = r.readLine()
+	}
+	if errors.Is(err, io.EOF) && line == "" {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read version: %w", err)
+	}
+	if !strings.HasPrefix(line, "WARC/") {
+		return nil, fmt.Errorf("invalid record version %q", line)
+	}
+
+	var header Header
+	for {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, fmt.Errorf("read header: %w", noEOF(err))
+		}
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid header line %q", line)
+		}
+		header = append(header, Field{Name: strings.TrimSpace(name), Value: strings.TrimSpace(value)})
+	}
+
+	record := &Record{Header: header}
+	length, err := record.ContentLength()
+	if err != nil {
+		return nil, fmt.Errorf("invalid content length: %w", err)
+	}
+	r.content = io.LimitReader(r.r, length)
+	record.Content = r.content
+	return record, nil
+}
+
+// readLine returns the next line, without its line ending.
+func (r *Reader) readLine() (string, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := r.r.ReadLine()
+		line = append(line, chunk...)
+		if err != nil {
+			return string(line), err
+		}
+		if len(line) > maxHeaderLineSize {
+			return "", errors.New("header line too long")
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
+
+func noEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,468 @@
+// Package warc is part of the infrastructure layer and it implements the service.Disk interface by appending
+// the fetches to a WARC file, the format of the web archives. Each page is stored as the request sent,
+// the response received with its headers and a metadata record, rather than as a bare file.
+package warc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/domain"
+	"github.com/gsiffert/fetch/internal/service"
+)
+
+// ErrRestoreNotSupported is returned when restoring a snapshot, as the WARC file is written once.
+var ErrRestoreNotSupported = errors.New("restore is not supported by warc files")
+
+// ErrOpenNotSupported is returned when opening a snapshot, as the WARC file is only read once complete.
+var ErrOpenNotSupported = errors.New("opening a snapshot is not supported by warc files")
+
+const (
+	// CompressedExtension is the extension of the WARC files whose records are compressed.
+	CompressedExtension = ".gz"
+	// AssetURIPrefix prefixes the name of the assets to form the target URI of their resource records.
+	AssetURIPrefix = "urn:fetch:asset:"
+)
+
+// Client of the warc package. The content is written to temporary files, and appended to the WARC file
+// once complete, so the records of the concurrent fetches are never interleaved.
+type Client struct {
+	warcPath string
+
+	mu         sync.Mutex
+	file       *os.File
+	writer     *Writer
+	warcinfoID string
+	// payloads holds the response record of each payload written, the next responses with the same payload
+	// are written as revisit records referring to it.
+	payloads map[domain.SnapshotID]Header
+}
+
+// New creates the WARC file at the given path, its records are compressed when the path ends with ".gz".
+func New(warcPath string) (*Client, error) {
+	file, err := os.Create(warcPath)
+	if err != nil {
+		return nil, fmt.Errorf("create warc file: %w", err)
+	}
+
+	c := &Client{
+		warcPath:   warcPath,
+		file:       file,
+		writer:     NewWriter(file, strings.HasSuffix(warcPath, CompressedExtension)),
+		warcinfoID: newRecordID(),
+		payloads:   make(map[domain.SnapshotID]Header),
+	}
+
+	info := []byte("software: fetch\r\nformat: WARC File Format 1.1\r\n")
+	header := Header{
+		{FieldType, TypeWarcinfo},
+		{FieldRecordID, c.warcinfoID},
+		{FieldDate, formatDate(time.Now())},
+		{FieldFilename, filepath.Base(warcPath)},
+		{FieldContentType, warcFieldsMIMEType},
+	}
+	if err := c.writer.WriteRecord(header, bytes.NewReader(info), int64(len(info))); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("write warcinfo: %w", err)
+	}
+	return c, nil
+}
+
+// NewPageWriter creates a new PageWriter for the page fetched by the given exchange.
+func (c *Client) NewPageWriter(_ context.Context, name string, exchange service.Exchange) (service.PageWriter, error) {
+	file, err := os.CreateTemp("", "fetch-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+
+	hash := sha256.New()
+	return &PageWriter{
+		client:   c,
+		name:     name,
+		exchange: exchange,
+		file:     file,
+		hash:     hash,
+		writer:   io.MultiWriter(file, hash),
+	}, nil
+}
+
+// NewAssetWriter creates a new resource record for the asset of the given name, the record is appended once
+// the writer is closed. The assets are identified by their name, as their URL is not known.
+func (c *Client) NewAssetWriter(_ context.Context, name string) (service.AssetWriter, error) {
+	file, err := os.CreateTemp("", "fetch-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	return &assetWriter{client: c, name: name, file: file}, nil
+}
+
+// RestoreSnapshot is not supported, the records of a WARC file are never replaced.
+func (c *Client) RestoreSnapshot(_ context.Context, _ string, _ domain.SnapshotID) error {
+	return ErrRestoreNotSupported
+}
+
+// OpenSnapshot is not supported, the WARC file is being written.
+func (c *Client) OpenSnapshot(_ context.Context, _ string, _ domain.SnapshotID, _ domain.Compression) (io.ReadCloser, error) {
+	return nil, ErrOpenNotSupported
+}
+
+// PageLocation returns the path of the WARC file, which holds every page.
+func (c *Client) PageLocation(_ string) string {
+	return c.warcPath
+}
+
+// HasPage reports true, as a page not modified is recorded as a revisit of its capture in an earlier file.
+func (c *Client) HasPage(_ context.Context, _ string) (bool, error) {
+	return true, nil
+}
+
+// SaveNotModified appends the request of the exchange and a revisit record of the page, holding the headers of
+// the response not modified and referring to the capture of the page at the given time.
+func (c *Client) SaveNotModified(_ context.Context, _ string, exchange service.Exchange, fetched time.Time) error {
+	if exchange.URL == "" {
+		return errors.New("missing the exchange of the page")
+	}
+	requestBlock, err := httpRequestHead(exchange)
+	if err != nil {
+		return err
+	}
+	responseHead := httpResponseHead(exchange, 0)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	revisitID := newRecordID()
+	if err := c.writeRequest(exchange, requestBlock, revisitID); err != nil {
+		return err
+	}
+	header := Header{
+		{FieldType, TypeRevisit},
+		{FieldRecordID, revisitID},
+		{FieldDate, formatDate(exchange.Started)},
+		{FieldTargetURI, exchange.URL},
+		{FieldWarcinfoID, c.warcinfoID},
+		{FieldProfile, notModifiedProfile},
+		{FieldRefersToURI, exchange.URL},
+		{FieldRefersToDate, formatDate(fetched)},
+		{FieldContentType, httpResponseMIMEType},
+	}
+	if err := c.writer.WriteRecord(header, bytes.NewReader(responseHead), int64(len(responseHead))); err != nil {
+		return fmt.Errorf("write revisit: %w", err)
+	}
+	return nil
+}
+
+// Close closes the WARC file.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.file.Close(); err != nil {
+		return fmt.Errorf("close warc file: %w", err)
+	}
+	return nil
+}
+
+// appendPage appends the request, response and metadata records of a page, whose body is held by the file.
+// The response is written as a revisit record when the same payload was already written.
+func (c *Client) appendPage(w *PageWriter, fetched time.Time) error {
+	exchange := w.exchange
+	if exchange.URL == "" {
+		return errors.New("missing the exchange of the page")
+	}
+	size, err := rewind(w.file)
+	if err != nil {
+		return err
+	}
+
+	date := formatDate(exchange.Started)
+	payloadDigest := "sha256:" + base32.StdEncoding.EncodeToString(w.hash.Sum(nil))
+	requestBlock, err := httpRequestHead(exchange)
+	if err != nil {
+		return err
+	}
+	responseHead := httpResponseHead(exchange, size)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	responseID := newRecordID()
+	if err := c.writeRequest(exchange, requestBlock, responseID); err != nil {
+		return err
+	}
+
+	responseHeader := Header{
+		{FieldType, TypeResponse},
+		{FieldRecordID, responseID},
+		{FieldDate, date},
+		{FieldTargetURI, exchange.URL},
+		{FieldWarcinfoID, c.warcinfoID},
+		{FieldPayloadDigest, payloadDigest},
+		{FieldContentType, httpResponseMIMEType},
+	}
+	block := io.MultiReader(bytes.NewReader(responseHead), w.file)
+	length := int64(len(responseHead)) + size
+	if original, ok := c.payloads[w.snapshot]; ok {
+		responseHeader[0].Value = TypeRevisit
+		responseHeader = append(responseHeader,
+			Field{FieldProfile, revisitProfile},
+			Field{FieldRefersTo, original.Get(FieldRecordID)},
+			Field{FieldRefersToURI, original.Get(FieldTargetURI)},
+			Field{FieldRefersToDate, original.Get(FieldDate)},
+		)
+		// The revisit records only hold the headers of the response, the payload is in the original record.
+		block, length = bytes.NewReader(responseHead), int64(len(responseHead))
+	}
+	if err := c.writer.WriteRecord(responseHeader, block, length); err != nil {
+		return fmt.Errorf("write response: %w", err)
+	}
+	if _, ok := c.payloads[w.snapshot]; !ok {
+		c.payloads[w.snapshot] = responseHeader
+	}
+
+	metadata := []byte(fmt.Sprintf(
+		"fetchTimeMs: %d\r\nsnapshot: %s\r\nfile: %s\r\n",
+		fetched.Sub(exchange.Started).Milliseconds(), w.snapshot, w.name,
+	))
+	metadataHeader := Header{
+		{FieldType, TypeMetadata},
+		{FieldRecordID, newRecordID()},
+		{FieldDate, date},
+		{FieldTargetURI, exchange.URL},
+		{FieldWarcinfoID, c.warcinfoID},
+		{FieldConcurrentTo, responseID},
+		{FieldContentType, warcFieldsMIMEType},
+	}
+	if err := c.writer.WriteRecord(metadataHeader, bytes.NewReader(metadata), int64(len(metadata))); err != nil {
+		return fmt.Errorf("write metadata: %w", err)
+	}
+	return nil
+}
+
+// writeRequest writes the request record of the exchange, concurrent to the record of the given id.
+func (c *Client) writeRequest(exchange service.Exchange, block []byte, concurrentTo string) error {
+	header := Header{
+		{FieldType, TypeRequest},
+		{FieldRecordID, newRecordID()},
+		{FieldDate, formatDate(exchange.Started)},
+		{FieldTargetURI, exchange.URL},
+		{FieldWarcinfoID, c.warcinfoID},
+		{FieldConcurrentTo, concurrentTo},
+		{FieldContentType, httpRequestMIMEType},
+	}
+	if err := c.writer.WriteRecord(header, bytes.NewReader(block), int64(len(block))); err != nil {
+		return fmt.Errorf("write request: %w", err)
+	}
+	return nil
+}
+
+// appendResource appends a resource record of the given name, whose content is held by the file.
+func (c *Client) appendResource(name string, file *os.File) error {
+	size, err := rewind(file)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	header := Header{
+		{FieldType, TypeResource},
+		{FieldRecordID, newRecordID()},
+		{FieldDate, formatDate(time.Now())},
+		{FieldTargetURI, AssetURIPrefix + name},
+		{FieldWarcinfoID, c.warcinfoID},
+		{FieldContentType, "application/octet-stream"},
+	}
+	if err := c.writer.WriteRecord(header, file, size); err != nil {
+		return fmt.Errorf("write resource: %w", err)
+	}
+	return nil
+}
+
+// httpRequestHead returns the request line and the headers of the request of the exchange.
+func httpRequestHead(exchange service.Exchange) ([]byte, error) {
+	u, err := url.Parse(exchange.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parse url: %w", err)
+	}
+
+	var head bytes.Buffer
+	fmt.Fprintf(&head, "%s %s %s\r\n", exchange.Method, u.RequestURI(), protoOrDefault(exchange.Proto))
+	fmt.Fprintf(&head, "Host: %s\r\n", u.Host)
+	if err := exchange.RequestHeader.Write(&head); err != nil {
+		return nil, fmt.Errorf("write request header: %w", err)
+	}
+	head.WriteString("\r\n")
+	return head.Bytes(), nil
+}
+
+// httpResponseHead returns the status line and the headers of the response of the exchange.
+// The HTTP client removes the transfer encoding from the body, the headers are adjusted to the body as stored.
+// A response not modified has no body, its headers describe the page as stored earlier and are kept.
+func httpResponseHead(exchange service.Exchange, size int64) []byte {
+	header := exchange.ResponseHeader.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Del("Transfer-Encoding")
+	if exchange.StatusCode != http.StatusNotModified {
+		header.Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+
+	var head bytes.Buffer
+	fmt.Fprintf(&head, "%s %d %s\r\n", protoOrDefault(exchange.Proto), exchange.StatusCode, http.StatusText(exchange.StatusCode))
+	_ = header.Write(&head)
+	head.WriteString("\r\n")
+	return head.Bytes()
+}
+
+func protoOrDefault(proto string) string {
+	if proto == "" {
+		return "HTTP/1.1"
+	}
+	return proto
+}
+
+// rewind returns the size of the content written to the file, and seeks back to its start.
+func rewind(file *os.File) (int64, error) {
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, fmt.Errorf("size of file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("rewind file: %w", err)
+	}
+	return size, nil
+}
+
+// PageWriter writes the content of a page to a temporary file. Once closed, the snapshot of the page is the
+// hash of its content, and once committed the records of the page are appended to the WARC file.
+type PageWriter struct {
+	client   *Client
+	name     string
+	exchange service.Exchange
+	file     *os.File
+	hash     hash.Hash
+	writer   io.Writer
+	snapshot domain.SnapshotID
+	fetched  time.Time
+	done     bool
+}
+
+// Write implements the io.Writer interface.
+func (w *PageWriter) Write(p []byte) (int, error) {
+	return w.writer.Write(p)
+}
+
+// Snapshot returns the ID of the snapshot holding the content of the page, it is set once the writer is closed.
+func (w *PageWriter) Snapshot() domain.SnapshotID {
+	return w.snapshot
+}
+
+// Compression returns domain.CompressionNone, the pages are stored as is in the WARC file.
+func (w *PageWriter) Compression() domain.Compression {
+	return domain.CompressionNone
+}
+
+// Close completes the content of the page, nothing is appended until the writer is committed.
+func (w *PageWriter) Close() error {
+	if w.snapshot == "" && !w.done {
+		w.snapshot = domain.SnapshotID(hex.EncodeToString(w.hash.Sum(nil)))
+		w.fetched = time.Now()
+	}
+	return nil
+}
+
+// Commit appends the records of the page to the WARC file.
+func (w *PageWriter) Commit() error {
+	if w.snapshot == "" || w.done {
+		return errors.New("commit a page writer which is not closed")
+	}
+	defer w.removeFile()
+
+	if err := w.client.appendPage(w, w.fetched); err != nil {
+		return fmt.Errorf("append page: %w", err)
+	}
+	return nil
+}
+
+// Discard removes the temporary file holding the content written so far, nothing is appended.
+func (w *PageWriter) Discard() error {
+	if w.done {
+		return nil
+	}
+	return w.removeFile()
+}
+
+func (w *PageWriter) removeFile() error {
+	w.done = true
+	closeErr := w.file.Close()
+	if err := os.Remove(w.file.Name()); err != nil {
+		return fmt.Errorf("remove temporary file: %w", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("close file: %w", closeErr)
+	}
+	return nil
+}
+
+// assetWriter writes the content of an asset to a temporary file, which is appended once closed.
+type assetWriter struct {
+	client *Client
+	name   string
+	file   *os.File
+	done   bool
+}
+
+// Write implements the io.Writer interface.
+func (w *assetWriter) Write(p []byte) (int, error) {
+	return w.file.Write(p)
+}
+
+// Close appends the asset to the WARC file.
+func (w *assetWriter) Close() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	defer os.Remove(w.file.Name())
+	defer w.file.Close()
+
+	if err := w.client.appendResource(w.name, w.file); err != nil {
+		return fmt.Errorf("append asset: %w", err)
+	}
+	return nil
+}
+
+// Discard removes the temporary file, the asset is not appended.
+func (w *assetWriter) Discard() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+
+	closeErr := w.file.Close()
+	if err := os.Remove(w.file.Name()); err != nil {
+		return fmt.Errorf("remove temporary file: %w", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("close file: %w", closeErr)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package warc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gsiffert/fetch/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newExchange(site string) service.Exchange {
+	return service.Exchange{
+		Method:         http.MethodGet,
+		URL:            site,
+		RequestHeader:  http.Header{"Accept": []string{"text/html"}},
+		Proto:          "HTTP/1.1",
+		StatusCode:     http.StatusOK,
+		ResponseHeader: http.Header{"Content-Type": []string{"text/html"}, "Transfer-Encoding": []string{"chunked"}},
+		Started:        time.Date(2024, 3, 17, 14, 43, 0, 0, time.UTC),
+	}
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"run.warc", "run.warc.gz"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			warcPath := filepath.Join(t.TempDir(), name)
+			client, err := New(warcPath)
+			require.NoError(t, err)
+			ctx := context.Background()
+
+			writePage := func(site string, content string, commit bool) {
+				writer, err := client.NewPageWriter(ctx, "page", newExchange(site))
+				require.NoError(t, err)
+				_, err = fmt.Fprint(writer, content)
+				require.NoError(t, err)
+				if !commit {
+					require.NoError(t, writer.Discard())
+					return
+				}
+				require.NoError(t, writer.Close())
+				require.NoError(t, writer.Commit())
+			}
+
+			writePage("https://www.google.com/", "<html>Google</html>", true)
+			writePage("https://www.google.com/contact", "partial", false)
+			writePage("https://google.com/", "<html>Google</html>", true)
+
+			asset, err := client.NewAssetWriter(ctx, "www.google.com_files/style.css")
+			require.NoError(t, err)
+			_, err = fmt.Fprint(asset, "body { color: red; }")
+			require.NoError(t, err)
+			require.NoError(t, asset.Close())
+
+			assert.Equal(t, warcPath, client.PageLocation("page"))
+			assert.ErrorIs(t, client.RestoreSnapshot(ctx, "page", ""), ErrRestoreNotSupported)
+			require.NoError(t, client.Close())
+
+			file, err := os.Open(warcPath)
+			require.NoError(t, err)
+			defer file.Close()
+			reader, err := NewReader(file)
+			require.NoError(t, err)
+
+			var (
+				types    []string
+				targets  []string
+				payloads []string
+				original string
+			)
+			for {
+				record, err := reader.Next()
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				require.NoError(t, err)
+				types = append(types, record.Type())
+				targets = append(targets, record.TargetURI())
+
+				switch record.Type() {
+				case TypeResponse:
+					original = record.ID()
+					payload, err := record.Payload()
+					require.NoError(t, err)
+					content, err := io.ReadAll(payload)
+					require.NoError(t, err)
+					payloads = append(payloads, string(content))
+				case TypeResource:
+					payload, err := record.Payload()
+					require.NoError(t, err)
+					content, err := io.ReadAll(payload)
+					require.NoError(t, err)
+					payloads = append(payloads, string(content))
+				case TypeRevisit:
+					// The second page has the same payload as the first one.
+					assert.Equal(t, original, record.Header.Get(FieldRefersTo))
+					assert.Equal(t, "https://www.google.com/", record.Header.Get(FieldRefersToURI))
+				case TypeRequest:
+					date, err := record.Date()
+					require.NoError(t, err)
+					assert.Equal(t, newExchange("").Started, date)
+				}
+			}
+
+			assert.Equal(t, []string{
+				TypeWarcinfo,
+				TypeRequest, TypeResponse, TypeMetadata,
+				TypeRequest, TypeRevisit, TypeMetadata,
+				TypeResource,
+			}, types)
+			assert.Equal(t, []string{
+				"",
+				"https://www.google.com/", "https://www.google.com/", "https://www.google.com/",
+				"https://google.com/", "https://google.com/", "https://google.com/",
+				"urn:fetch:asset:www.google.com_files/style.css",
+			}, targets)
+			assert.Equal(t, []string{"<html>Google</html>", "body { color: red; }"}, payloads)
+		})
+	}
+}
+
+func TestClient_SaveNotModified(t *testing.T) {
+	t.Parallel()
+
+	warcPath := filepath.Join(t.TempDir(), "run.warc")
+	client, err := New(warcPath)
+	require.NoError(t, err)
+
+	exchange := newExchange("https://www.google.com/")
+	exchange.RequestHeader.Set("If-None-Match", `"v1"`)
+	exchange.StatusCode = http.StatusNotModified
+	exchange.ResponseHeader = http.Header{"Etag": []string{`"v1"`}}
+	fetched := time.Date(2024, 3, 10, 8, 0, 0, 0, time.UTC)
+
+	hasPage, err := client.HasPage(context.Background(), "page")
+	require.NoError(t, err)
+	assert.True(t, hasPage)
+	require.NoError(t, client.SaveNotModified(context.Background(), "page", exchange, fetched))
+	require.NoError(t, client.Close())
+
+	file, err := os.Open(warcPath)
+	require.NoError(t, err)
+	defer file.Close()
+	reader, err := NewReader(file)
+	require.NoError(t, err)
+
+	// The content of a record is read before the next one.
+	var types []string
+	var requestConcurrentTo, revisitID string
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		types = append(types, record.Type())
+
+		switch record.Type() {
+		case TypeRequest:
+			requestConcurrentTo = record.Header.Get(FieldConcurrentTo)
+		case TypeRevisit:
+			revisitID = record.ID()
+			assert.Equal(t, notModifiedProfile, record.Header.Get(FieldProfile))
+			assert.Equal(t, "https://www.google.com/", record.Header.Get(FieldRefersToURI))
+			assert.Equal(t, formatDate(fetched), record.Header.Get(FieldRefersToDate))
+			resp, err := record.Response()
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+			assert.Equal(t, `"v1"`, resp.Header.Get("ETag"))
+		}
+	}
+	assert.Equal(t, []string{TypeWarcinfo, TypeRequest, TypeRevisit}, types)
+	assert.Equal(t, revisitID, requestConcurrentTo)
+}
+
+func TestReader_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name:    "not a warc file",
+			content: "<html></html>",
+		},
+		{
+			name:    "missing content length",
+			content: "WARC/1.1\r\nWARC-Type: resource\r\n\r\n",
+		},
+		{
+			name:    "truncated header",
+			content: "WARC/1.1\r\nWARC-Type: resource\r\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			reader, err := NewReader(strings.NewReader(test.content))
+			require.NoError(t, err)
+			_, err = reader.Next()
+			assert.Error(t, err)
+			assert.NotErrorIs(t, err, io.EOF)
+		})
+	}
+}